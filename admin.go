@@ -0,0 +1,220 @@
+package grada
+
+// Management of metrics at runtime.
+//
+// GET /admin/metrics lists all metrics, sorted by target:
+//
+//	[{"target": "cpu", "size": 300, "points": 120,
+//	  "oldest": 1508929014000, "newest": 1508929133000, "last": 0.57}, ...]
+//
+// Times are Unix milliseconds. The requests for a single metric are:
+//
+//	GET    /admin/metrics/<target>          the metric, as above
+//	POST   /admin/metrics/<target>?size=300 create the metric
+//	PUT    /admin/metrics/<target>?size=600 change the buffer size
+//	DELETE /admin/metrics/<target>          delete the metric
+//
+// The target is the rest of the path and may contain slashes.
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithAdminAPI serves /admin/metrics, which lists, creates, resizes, and
+// deletes metrics at runtime, so that operators can manage the metrics
+// without redeploying the application. Metrics that POST creates are
+// filled by pushes (see /push) or by the application through GetMetric.
+// The web page at /admin/ shows the metrics with sparklines and links.
+//
+// Like the endpoints of WithPprof, the endpoints respond with 403
+// Forbidden unless the server authenticates clients. Use
+// WithClientCerts to restrict them to certain clients.
+func WithAdminAPI() Option {
+	return func(srv *server) {
+		srv.admin = true
+	}
+}
+
+// adminMetric is the description of a metric in /admin/metrics responses.
+type adminMetric struct {
+	Target string   `json:"target"`
+	Size   int      `json:"size"`
+	Points int      `json:"points"`
+	Oldest int64    `json:"oldest,omitempty"`
+	Newest int64    `json:"newest,omitempty"`
+	Last   *float64 `json:"last,omitempty"` // nil for NaN and infinities
+}
+
+// ResizeMetric changes the buffer size of the metric for target to size.
+// A smaller buffer keeps the newest data points. If no metric exists for
+// target, ResizeMetric returns an error that wraps ErrMetricNotFound.
+func (d *Dashboard) ResizeMetric(target string, size int) error {
+	return d.srv.metrics.Resize(target, size)
+}
+
+// Resize implements Dashboard.ResizeMetric.
+func (m *metrics) Resize(target string, size int) error {
+	if size < 1 {
+		return fmt.Errorf("%w: %d", ErrBufferSize, size)
+	}
+	metric, err := m.Get(target)
+	if err != nil {
+		return err
+	}
+	metric.resize(size)
+	return nil
+}
+
+// resize changes the buffer size of g to size, keeping the newest data
+// points. Empty slots go first, as in backfill. resize changes the ETag of
+// queries for g.
+func (g *Metric) resize(size int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.sort()
+	n := g.list.len()
+	list := newCountBuffer(size)
+	j := size - 1
+	for i := n - 1; i >= 0 && j >= 0; i-- {
+		k := (g.head + i) % n
+		if g.list.ns[k] == noTime {
+			break
+		}
+		list.n[j], list.ns[j] = g.list.n[k], g.list.ns[k]
+		j--
+	}
+	// Drop the weights of the data points that do not fit, as AddCount
+	// does for evicted ones (see DuplicatesAverage).
+	for t := range g.weights {
+		if j+1 == size || t < list.ns[j+1] {
+			delete(g.weights, t)
+		}
+	}
+	g.list, g.head, g.unsorted = list, 0, false
+	g.seq = nextSeq()
+}
+
+// describe returns the description of g.
+func (g *Metric) describe(target string) adminMetric {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.sort()
+	n := g.list.len()
+	am := adminMetric{Target: target, Size: n}
+	for i := 0; i < n; i++ {
+		k := (g.head + i) % n
+		if g.list.ns[k] == noTime {
+			continue
+		}
+		if am.Points == 0 {
+			am.Oldest = g.list.ns[k] / int64(time.Millisecond)
+		}
+		am.Points++
+		am.Newest = g.list.ns[k] / int64(time.Millisecond)
+		if v := g.list.n[k]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+			am.Last = &v
+		} else {
+			am.Last = nil
+		}
+	}
+	return am
+}
+
+// adminMetrics returns the descriptions of all metrics, sorted by target.
+func (srv *server) adminMetrics() []adminMetric {
+	srv.metrics.m.Lock()
+	targets := make([]string, 0, len(srv.metrics.metric))
+	metrics := make(map[string]*Metric, len(srv.metrics.metric))
+	for target, m := range srv.metrics.metric {
+		targets = append(targets, target)
+		metrics[target] = m
+	}
+	srv.metrics.m.Unlock()
+	sort.Strings(targets)
+	list := make([]adminMetric, len(targets))
+	for i, target := range targets {
+		list[i] = metrics[target].describe(target)
+	}
+	return list
+}
+
+// installAdmin adds the admin endpoints to the server's mux.
+func (srv *server) installAdmin() {
+	srv.mux.Handle("/admin/metrics", srv.guarded(allowMethods(srv.adminListHandler, "GET", "HEAD")))
+	srv.mux.Handle("/admin/metrics/", srv.guarded(allowMethods(srv.adminMetricHandler, "GET", "HEAD", "POST", "PUT", "DELETE")))
+	srv.mux.Handle("/admin/", srv.guarded(allowMethods(srv.uiHandler, "GET", "HEAD")))
+}
+
+// adminListHandler responds with the descriptions of all metrics.
+func (srv *server) adminListHandler(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.Marshal(srv.adminMetrics())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal metrics response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// adminMetricHandler inspects, creates, resizes, or deletes the metric
+// named by the rest of the path.
+func (srv *server) adminMetricHandler(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimPrefix(r.URL.Path, "/admin/metrics/")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, nil, "missing target")
+		return
+	}
+	size := DefaultAutoCreateSize
+	if s := r.FormValue("size"); s != "" {
+		var err error
+		if size, err = strconv.Atoi(s); err != nil {
+			writeError(w, http.StatusBadRequest, err, "invalid size")
+			return
+		}
+	} else if r.Method == "PUT" {
+		writeError(w, http.StatusBadRequest, nil, "missing size")
+		return
+	}
+
+	status := http.StatusOK
+	switch r.Method {
+	case "POST":
+		if _, err := srv.metrics.Create(target, size); err != nil {
+			writeError(w, statusFor(err), err, "cannot create metric")
+			return
+		}
+		status = http.StatusCreated
+	case "PUT":
+		if err := srv.metrics.Resize(target, size); err != nil {
+			writeError(w, statusFor(err), err, "cannot resize metric")
+			return
+		}
+	case "DELETE":
+		if err := srv.metrics.Delete(target); err != nil {
+			writeError(w, statusFor(err), err, "cannot delete metric")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	m, err := srv.metrics.Get(target)
+	if err != nil {
+		writeError(w, statusFor(err), err, "cannot get metric")
+		return
+	}
+	resp, err := json.Marshal(m.describe(target))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal metric response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
@@ -0,0 +1,115 @@
+package grada
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWithAdminAPI(t *testing.T) {
+	anyone := AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		return Principal{Name: "anyone"}, nil
+	})
+	d := NewDashboard(WithAdminAPI(), WithAuthenticator(anyone))
+	m, _ := d.CreateMetricWithBufSize("cpu", 3)
+	m.AddWithTime(0.5, time.Unix(1508929014, 0))
+	m.AddWithTime(0.75, time.Unix(1508929015, 0))
+
+	// The requests run in order, each on the metrics that the previous
+	// ones have left.
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantBody     string
+	}{
+		{"GET", "/admin/metrics", 200, `[{"target":"cpu","size":3,"points":2,"oldest":1508929014000,"newest":1508929015000,"last":0.75}]`},
+		{"GET", "/admin/metrics/cpu", 200, `{"target":"cpu","size":3,"points":2,"oldest":1508929014000,"newest":1508929015000,"last":0.75}`},
+		{"GET", "/admin/metrics/nope", 404, "no such metric"},
+		{"POST", "/admin/metrics/app/mem?size=5", 201, `{"target":"app/mem","size":5,"points":0}`},
+		{"POST", "/admin/metrics/app/mem", 409, "metric already exists"},
+		{"POST", "/admin/metrics/disk?size=0", 400, "buffer size must be positive"},
+		{"PUT", "/admin/metrics/cpu?size=1", 200, `{"target":"cpu","size":1,"points":1,"oldest":1508929015000,"newest":1508929015000,"last":0.75}`},
+		{"PUT", "/admin/metrics/cpu", 400, "missing size"},
+		{"PUT", "/admin/metrics/nope?size=2", 404, "no such metric"},
+		{"DELETE", "/admin/metrics/app/mem", 204, ""},
+		{"DELETE", "/admin/metrics/app/mem", 404, "no such metric"},
+		{"PATCH", "/admin/metrics/cpu", 405, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	NewDashboard(WithAdminAPI()).Handler().ServeHTTP(w, httptest.NewRequest("GET", "/admin/metrics", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("unauthenticated: status %d, want 403", w.Code)
+	}
+}
+
+func TestDashboard_ResizeMetric(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		size    int
+		want    []Count
+		wantErr error
+	}{
+		{"grow", 6, []Count{{1, t0.Add(1 * time.Second)}, {2, t0.Add(2 * time.Second)}, {3, t0.Add(3 * time.Second)}}, nil},
+		{"shrink", 2, []Count{{2, t0.Add(2 * time.Second)}, {3, t0.Add(3 * time.Second)}}, nil},
+		{"invalid", 0, nil, ErrBufferSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard()
+			m, _ := d.CreateMetricWithBufSize("cpu", 3)
+			for i := 0; i <= 3; i++ {
+				m.AddWithTime(float64(i), t0.Add(time.Duration(i)*time.Second))
+			}
+			seq := m.seq
+			err := d.ResizeMetric("cpu", tt.size)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResizeMetric() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if m.seq == seq {
+				t.Errorf("ResizeMetric() leaves the sequence number %d", seq)
+			}
+			if diff := cmp.Diff(tt.want, allCounts(t, d, "cpu")); diff != "" {
+				t.Errorf("data points mismatch (-want +got):\n%s", diff)
+			}
+			m.AddWithTime(4, t0.Add(4*time.Second))
+			if got := allCounts(t, d, "cpu"); len(got) != min(len(tt.want)+1, tt.size) || got[len(got)-1].N != 4 {
+				t.Errorf("after Add, data points %v", got)
+			}
+		})
+	}
+	// Weights of averaged duplicates go with their data points.
+	d := NewDashboard(WithDuplicates(DuplicateConfig{Policy: DuplicatesAverage, OnIngest: true}))
+	m, _ := d.CreateMetricWithBufSize("cpu", 3)
+	for _, c := range []Count{{1, t0}, {3, t0}, {2, t0.Add(time.Second)}, {4, t0.Add(time.Second)}} {
+		m.AddCount(c)
+	}
+	d.ResizeMetric("cpu", 1)
+	if _, ok := m.weights[t0.UnixNano()]; ok || len(m.weights) != 1 {
+		t.Errorf("weights after shrinking = %v, want only %d", m.weights, t0.Add(time.Second).UnixNano())
+	}
+	if err := NewDashboard().ResizeMetric("nope", 2); !errors.Is(err, ErrMetricNotFound) {
+		t.Errorf("ResizeMetric(nope) error = %v, want ErrMetricNotFound", err)
+	}
+}
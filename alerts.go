@@ -0,0 +1,306 @@
+package grada
+
+// Threshold rules, alert states, and webhook notifications.
+//
+// GET /alerts returns the current state of all rules:
+//
+//	[{"rule": "cpu high", "target": "cpu", "state": "firing",
+//	  "value": 0.93, "threshold": 0.9, "since": 1508929014000}, ...]
+//
+// An annotation query of "alerts" in Grafana shows every time a rule
+// started firing or was resolved.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rule is a threshold rule for a metric. The rule fires when For consecutive
+// samples of the metric are above Threshold (or below, if Below is set), and
+// recovers with the first sample that is not.
+type Rule struct {
+	Name      string
+	Target    string
+	Threshold float64
+	Below     bool // fire on values below Threshold instead of above
+	For       int  // number of consecutive samples; 0 means 1
+}
+
+// AlertState is the state of a rule.
+type AlertState int
+
+const (
+	// AlertInactive means the rule is not breached.
+	AlertInactive AlertState = iota
+	// AlertPending means the rule is breached, but not yet for enough samples.
+	AlertPending
+	// AlertFiring means the rule is breached for at least Rule.For samples.
+	AlertFiring
+	// AlertResolved means the rule has fired and is not breached anymore.
+	AlertResolved
+)
+
+// String returns the name of the state, as used in /alerts and webhook payloads.
+func (s AlertState) String() string {
+	switch s {
+	case AlertInactive:
+		return "inactive"
+	case AlertPending:
+		return "pending"
+	case AlertFiring:
+		return "firing"
+	case AlertResolved:
+		return "resolved"
+	}
+	return fmt.Sprintf("AlertState(%d)", int(s))
+}
+
+// Alert is the current state of a rule.
+type Alert struct {
+	Rule  Rule
+	State AlertState
+	Value float64   // the data point that caused the last state change
+	Since time.Time // the time of the last state change
+}
+
+// alertResponse is an element of the response to an `/alerts` request.
+type alertResponse struct {
+	Rule      string  `json:"rule"`
+	Target    string  `json:"target"`
+	State     string  `json:"state"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Since     int64   `json:"since,omitempty"` // Unix milliseconds
+}
+
+// maxAlertHistory is the number of state changes per rule that are kept
+// for annotations.
+const maxAlertHistory = 100
+
+// alertNotification is the JSON payload that the server posts to the webhook
+// when a rule fires or recovers.
+type alertNotification struct {
+	Rule      string  `json:"rule"`
+	Target    string  `json:"target"`
+	State     string  `json:"state"` // "firing" or "resolved"
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Time      int64   `json:"time"` // Unix milliseconds
+}
+
+// rule is a Rule attached to a metric, with its evaluation state.
+type rule struct {
+	Rule
+	srv *server
+
+	mu       sync.Mutex
+	breaches int     // consecutive samples beyond the threshold
+	alert    Alert   // current state
+	history  []Alert // changes to AlertFiring and AlertResolved, oldest first
+}
+
+// WithWebhook makes the server post a JSON payload to url whenever a rule
+// fires or recovers:
+//
+//	{"rule": "cpu high", "target": "cpu", "state": "firing",
+//	 "value": 0.93, "threshold": 0.9, "time": 1508929014000}
+//
+// "state" is either "firing" or "resolved". Failed posts are logged
+// through WithLogger and not retried.
+func WithWebhook(url string) Option {
+	return func(srv *server) {
+		srv.webhook = url
+	}
+}
+
+// AddRule attaches a threshold rule to the metric of r.Target, and
+// evaluates the rule for every data point added from now on.
+// AddRule fails with ErrMetricNotFound if the target has no metric.
+func (d *Dashboard) AddRule(r Rule) error {
+	metric, err := d.srv.metrics.Get(r.Target)
+	if err != nil {
+		return err
+	}
+	ru := &rule{Rule: r, srv: d.srv}
+	ru.alert.Rule = r
+	d.srv.rulesMu.Lock()
+	d.srv.rules = append(d.srv.rules, ru)
+	d.srv.rulesMu.Unlock()
+	metric.Subscribe(ru.eval)
+	return nil
+}
+
+// Alerts returns the current state of all rules, in the order in
+// which they were added.
+func (d *Dashboard) Alerts() []Alert {
+	return d.srv.alerts()
+}
+
+func (srv *server) alerts() []Alert {
+	srv.rulesMu.Lock()
+	rules := srv.rules
+	srv.rulesMu.Unlock()
+	alerts := make([]Alert, len(rules))
+	for i, r := range rules {
+		r.mu.Lock()
+		alerts[i] = r.alert
+		r.mu.Unlock()
+	}
+	return alerts
+}
+
+// alertsHandler responds with the current state of all rules.
+func (srv *server) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	response := []alertResponse{}
+	for _, a := range srv.alerts() {
+		ar := alertResponse{
+			Rule:      a.Rule.Name,
+			Target:    a.Rule.Target,
+			State:     a.State.String(),
+			Value:     a.Value,
+			Threshold: a.Rule.Threshold,
+		}
+		if !a.Since.IsZero() {
+			ar.Since = a.Since.UnixNano() / int64(time.Millisecond)
+		}
+		response = append(response, ar)
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal alerts response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// alertAnnotations returns the state changes of all rules within [from, to]
+// as annotations.
+func (srv *server) alertAnnotations(info annotationInfo, from, to time.Time) []annotationResponse {
+	srv.rulesMu.Lock()
+	rules := srv.rules
+	srv.rulesMu.Unlock()
+	annotations := []annotationResponse{}
+	for _, r := range rules {
+		r.mu.Lock()
+		for _, a := range r.history {
+			if a.Since.Before(from) || a.Since.After(to) {
+				continue
+			}
+			annotations = append(annotations, annotationResponse{
+				Annotation: info,
+				Time:       a.Since.UnixNano() / int64(time.Millisecond),
+				Title:      a.Rule.Name + " " + a.State.String(),
+				Tags:       []string{"alert", a.State.String()},
+				Text:       a.Rule.Target + " = " + strconv.FormatFloat(a.Value, 'g', -1, 64),
+			})
+		}
+		r.mu.Unlock()
+	}
+	return annotations
+}
+
+// breached reports whether n is beyond the threshold of the rule.
+func (r *rule) breached(n float64) bool {
+	if r.Below {
+		return n < r.Threshold
+	}
+	return n > r.Threshold
+}
+
+// eval updates the rule state with a new data point and notifies the
+// webhook if the rule fires or recovers.
+func (r *rule) eval(c Count) {
+	r.mu.Lock()
+	old := r.alert.State
+	state := old
+	if r.breached(c.N) {
+		r.breaches++
+		switch {
+		case r.breaches >= max(r.For, 1):
+			state = AlertFiring
+		case old != AlertFiring:
+			state = AlertPending
+		}
+	} else {
+		r.breaches = 0
+		switch old {
+		case AlertFiring:
+			state = AlertResolved
+		case AlertPending:
+			state = AlertInactive
+		}
+	}
+	changed := state != r.alert.State
+	if changed {
+		r.alert.State = state
+		r.alert.Value = c.N
+		r.alert.Since = c.T
+		if state == AlertFiring || state == AlertResolved {
+			if len(r.history) == maxAlertHistory {
+				r.history = r.history[1:]
+			}
+			r.history = append(r.history, r.alert)
+		}
+	}
+	r.mu.Unlock()
+
+	if changed && (state == AlertFiring || state == AlertResolved) && r.srv.webhook != "" {
+		r.srv.queueWebhook(alertNotification{
+			Rule:      r.Name,
+			Target:    r.Target,
+			State:     state.String(),
+			Value:     c.N,
+			Threshold: r.Threshold,
+			Time:      c.T.UnixNano() / int64(time.Millisecond),
+		})
+	}
+}
+
+// webhookClient posts webhook notifications.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// queueWebhook hands a notification to the goroutine that posts
+// notifications in order. If too many notifications are queued, it drops
+// the notification rather than block the caller of Metric.Add.
+func (srv *server) queueWebhook(n alertNotification) {
+	srv.webhookOnce.Do(func() {
+		srv.webhookQueue = make(chan alertNotification, 100)
+		go func() {
+			for n := range srv.webhookQueue {
+				srv.postWebhook(n)
+			}
+		}()
+	})
+	select {
+	case srv.webhookQueue <- n:
+	default:
+		if srv.logger != nil {
+			srv.logger.Printf("grada: webhook queue full; dropping %s notification for rule %q", n.State, n.Rule)
+		}
+	}
+}
+
+// postWebhook posts a notification to the webhook.
+func (srv *server) postWebhook(n alertNotification) {
+	body, err := json.Marshal(n)
+	if err == nil {
+		var resp *http.Response
+		resp, err = webhookClient.Post(srv.webhook, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = errors.New("unexpected status " + resp.Status)
+			}
+		}
+	}
+	if err != nil && srv.logger != nil {
+		srv.logger.Printf("grada: webhook for rule %q: %v", n.Rule, err)
+	}
+}
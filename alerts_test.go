@@ -0,0 +1,101 @@
+package grada
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard_AddRule(t *testing.T) {
+	notes := make(chan alertNotification, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n alertNotification
+		json.NewDecoder(r.Body).Decode(&n)
+		notes <- n
+	}))
+	defer hook.Close()
+
+	d := NewDashboard(WithWebhook(hook.URL))
+	metric, _ := d.CreateMetricWithBufSize("cpu", 10)
+	if err := d.AddRule(Rule{Name: "high", Target: "cpu", Threshold: 0.9, For: 2}); err != nil {
+		t.Fatalf("AddRule(): %v", err)
+	}
+	if err := d.AddRule(Rule{Target: "nope"}); err == nil {
+		t.Errorf("AddRule() for unknown target: no error")
+	}
+
+	next := func() alertNotification {
+		select {
+		case n := <-notes:
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatal("no webhook notification")
+		}
+		return alertNotification{}
+	}
+	for _, n := range []float64{0.95, 0.5, 0.95, 0.96, 0.97} {
+		metric.Add(n)
+	}
+	if n := next(); n.State != "firing" || n.Value != 0.96 || n.Rule != "high" {
+		t.Errorf("got %+v, want firing at 0.96", n)
+	}
+	metric.Add(0.2)
+	if n := next(); n.State != "resolved" || n.Value != 0.2 {
+		t.Errorf("got %+v, want resolved at 0.2", n)
+	}
+}
+
+func TestServer_alerts(t *testing.T) {
+	d := NewDashboard()
+	metric, _ := d.CreateMetricWithBufSize("cpu", 10)
+	d.AddRule(Rule{Name: "high", Target: "cpu", Threshold: 0.9, For: 2})
+	d.AddRule(Rule{Name: "low", Target: "cpu", Threshold: 0.1, Below: true})
+
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	states := func() []AlertState {
+		var s []AlertState
+		for _, a := range d.Alerts() {
+			s = append(s, a.State)
+		}
+		return s
+	}
+	steps := []struct {
+		value float64
+		want  []AlertState
+	}{
+		{0.5, []AlertState{AlertInactive, AlertInactive}},
+		{0.95, []AlertState{AlertPending, AlertInactive}},
+		{0.5, []AlertState{AlertInactive, AlertInactive}},
+		{0.95, []AlertState{AlertPending, AlertInactive}},
+		{0.96, []AlertState{AlertFiring, AlertInactive}},
+		{0.05, []AlertState{AlertResolved, AlertFiring}},
+	}
+	for i, st := range steps {
+		metric.AddWithTime(st.value, t0.Add(time.Duration(i)*time.Minute))
+		if got := states(); !cmp.Equal(got, st.want) {
+			t.Errorf("after %v: states %v, want %v", st.value, got, st.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/alerts", nil))
+	want := `[{"rule":"high","target":"cpu","state":"resolved","value":0.05,"threshold":0.9,"since":1508929500000},` +
+		`{"rule":"low","target":"cpu","state":"firing","value":0.05,"threshold":0.1,"since":1508929500000}]`
+	if w.Body.String() != want {
+		t.Errorf("/alerts:\ngot  %s\nwant %s", w.Body.String(), want)
+	}
+
+	body := `{"range": {"from": "2017-10-25T11:03:00Z", "to": "2017-10-25T11:04:30Z"}, "annotation": {"name": "a", "query": "alerts"}}`
+	w = httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/annotations", strings.NewReader(body)))
+	var annotations []annotationResponse
+	json.Unmarshal(w.Body.Bytes(), &annotations)
+	if len(annotations) != 1 || annotations[0].Title != "high firing" {
+		t.Errorf("/annotations: got %s, want a single \"high firing\" annotation", w.Body.String())
+	}
+}
@@ -0,0 +1,132 @@
+package grada
+
+// Display names of targets.
+
+import (
+	"strings"
+	"sync"
+)
+
+// targetMeta is the metadata of a target name.
+type targetMeta struct {
+	alias      string
+	labels     map[string]string
+	categories []string   // see Dashboard.SetCategories
+	unit       string     // see Dashboard.SetUnit
+	min, max   *float64   // see Dashboard.SetRange
+	decimals   *int       // see Dashboard.SetDecimals
+	fill       FillPolicy // see Dashboard.SetFill
+	aggregate  string     // see Dashboard.SetAggregation
+	seq        uint64     // write sequence number of the last change, see nextSeq
+}
+
+// targetMetas maps target names to their metadata: aliases, labels,
+// categories, units, ranges, decimals, fill policies, and aggregations.
+// Metadata belongs to the name, not to a metric: it applies to any
+// metric, virtual series, or source of that name, including ones created
+// later.
+type targetMetas struct {
+	m    sync.Mutex
+	meta map[string]*targetMeta
+}
+
+// get returns a copy of the metadata of target.
+func (tm *targetMetas) get(target string) targetMeta {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	if meta, ok := tm.meta[target]; ok {
+		return *meta
+	}
+	return targetMeta{}
+}
+
+// update calls f with the metadata of target, creating it if necessary.
+func (tm *targetMetas) update(target string, f func(*targetMeta)) {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	if tm.meta == nil {
+		tm.meta = map[string]*targetMeta{}
+	}
+	meta, ok := tm.meta[target]
+	if !ok {
+		meta = &targetMeta{}
+		tm.meta[target] = meta
+	}
+	f(meta)
+	meta.seq = nextSeq()
+}
+
+// SetAlias sets the display name of a target. /query responses carry the
+// alias as the target name, which Grafana shows in the legend, while
+// panels keep selecting the target by its name.
+//
+// The alias may contain the placeholders {{target}}, for the target
+// name, and {{label}}, for the value of a label set with SetLabels.
+// Placeholders of missing labels become empty. An empty alias removes
+// the alias. The alias applies to the target name, even if no metric of
+// that name exists yet.
+//
+// A panel can override the alias with an "alias" template in the
+// target's data:
+//
+//	{"target": "cpu.0", "data": {"alias": "CPU {{core}} on {{host}}"}}
+func (d *Dashboard) SetAlias(target, alias string) {
+	d.srv.meta.update(target, func(m *targetMeta) { m.alias = alias })
+}
+
+// SetLabels sets the labels of a target for alias templates.
+// It replaces any previous labels of the target.
+func (d *Dashboard) SetLabels(target string, labels map[string]string) {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	d.srv.meta.update(target, func(m *targetMeta) { m.labels = copied })
+}
+
+// SetUnit sets the unit of a target, as one of Grafana's unit IDs such
+// as "percent", "bytes", "ms", or "reqps", for the panels of
+// GrafanaDashboard and the data frames of the JSON data source (see
+// fieldconfig.go). An empty unit removes the unit.
+func (d *Dashboard) SetUnit(target, unit string) {
+	d.srv.meta.update(target, func(m *targetMeta) { m.unit = unit })
+}
+
+// displayName returns the name under which a query response shows target.
+// A non-empty alias from the query overrides the alias of the target.
+func (srv *server) displayName(target, queryAlias string) string {
+	meta := srv.meta.get(target)
+	alias := queryAlias
+	if alias == "" {
+		alias = meta.alias
+	}
+	if alias == "" {
+		return target
+	}
+	return expandAlias(alias, target, meta.labels)
+}
+
+// expandAlias replaces the {{...}} placeholders in alias.
+func expandAlias(alias, target string, labels map[string]string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(alias, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(alias[start:], "}}")
+		if end < 0 {
+			break
+		}
+		b.WriteString(alias[:start])
+		name := strings.TrimSpace(alias[start+2 : start+end])
+		if name == "target" {
+			b.WriteString(target)
+		} else {
+			b.WriteString(labels[name])
+		}
+		alias = alias[start+end+2:]
+	}
+	b.WriteString(alias)
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package grada
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpandAlias(t *testing.T) {
+	labels := map[string]string{"host": "web-1", "core": "0"}
+	tests := []struct {
+		alias, want string
+	}{
+		{"CPU", "CPU"},
+		{"CPU {{core}} on {{ host }}", "CPU 0 on web-1"},
+		{"{{target}} ({{missing}})", "cpu.0 ()"},
+		{"unterminated {{host", "unterminated {{host"},
+	}
+	for _, tt := range tests {
+		if got := expandAlias(tt.alias, "cpu.0", labels); got != tt.want {
+			t.Errorf("expandAlias(%q) = %q, want %q", tt.alias, got, tt.want)
+		}
+	}
+}
+
+func TestServer_queryAlias(t *testing.T) {
+	d := NewDashboard(WithExpressions())
+	d.CreateMetricWithBufSize("cpu.0", 10)
+	d.CreateMetricWithBufSize("cpu.1", 10)
+	d.SetAlias("cpu.0", "CPU {{core}}")
+	d.SetLabels("cpu.0", map[string]string{"core": "0"})
+	d.SetLabels("cpu.1", map[string]string{"core": "1"})
+
+	tests := []struct {
+		name    string
+		targets string
+		want    []string
+	}{
+		{"registered", `{"target": "cpu.0"}`, []string{"CPU 0"}},
+		{"none", `{"target": "cpu.1"}`, []string{"cpu.1"}},
+		{"query", `{"target": "cpu.1", "data": {"alias": "core {{core}}"}}`, []string{"core 1"}},
+		{"reduce", `{"target": "cpu.0", "data": {"reduce": "last"}}`, []string{"CPU 0"}},
+		{"expression", `{"target": "\"cpu.*\""}`, []string{"CPU 0", "cpu.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "maxDataPoints": 10, "targets": [` + tt.targets + `]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			var resp []timeseriesResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("cannot unmarshal %s: %v", w.Body.String(), err)
+			}
+			var got []string
+			for _, r := range resp {
+				got = append(got, r.Target)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("targets %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package grada
+
+// Annotations for Grafana panels.
+//
+// The annotation query of a Grafana annotation selects the annotations:
+// "alerts" returns the state changes of threshold rules; "event:<target>"
+// returns the messages of an event target; any other query is a list of
+// tags, separated by spaces or commas, and returns the annotations of the
+// store that have all of these tags.
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Annotation is an event that Grafana shows as a marker in time series panels,
+// such as a deployment or a configuration change.
+type Annotation struct {
+	Time  time.Time
+	Title string
+	Text  string
+	Tags  []string
+}
+
+// annotationRecord is the JSON form of an Annotation in an annotation file.
+type annotationRecord struct {
+	Time  int64    `json:"time"` // Unix milliseconds
+	Title string   `json:"title"`
+	Text  string   `json:"text,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// annotationStore holds annotations sorted by time.
+type annotationStore struct {
+	m    sync.Mutex
+	list []Annotation
+	path string // append annotations to this file if set
+}
+
+// WithAnnotationFile persists annotations in the file at path, so that they
+// survive restarts. The server loads the annotations of the file at startup
+// and appends every new annotation. Failures are logged through WithLogger.
+func WithAnnotationFile(path string) Option {
+	return func(srv *server) {
+		srv.annotations.path = path
+	}
+}
+
+// AddAnnotation adds an annotation at time t. The error reports a failure
+// to write the annotation file; the annotation is stored nevertheless.
+func (d *Dashboard) AddAnnotation(title, text string, tags []string, t time.Time) error {
+	return d.srv.annotations.add(Annotation{Time: t, Title: title, Text: text, Tags: tags}, true)
+}
+
+// Annotations returns the annotations within [from, to] that have all
+// of the given tags, sorted by time.
+func (d *Dashboard) Annotations(from, to time.Time, tags ...string) []Annotation {
+	return d.srv.annotations.find(from, to, tags)
+}
+
+// add inserts a into the store and, if persist is set, appends it to
+// the annotation file.
+func (s *annotationStore) add(a Annotation, persist bool) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	i := sort.Search(len(s.list), func(i int) bool { return s.list[i].Time.After(a.Time) })
+	s.list = append(s.list, Annotation{})
+	copy(s.list[i+1:], s.list[i:])
+	s.list[i] = a
+	if !persist || s.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(annotationRecord{
+		Time:  a.Time.UnixNano() / int64(time.Millisecond),
+		Title: a.Title,
+		Text:  a.Text,
+		Tags:  a.Tags,
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// load reads the annotation file. A missing file is not an error.
+func (s *annotationStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var rec annotationRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return err
+		}
+		s.add(Annotation{
+			Time:  time.Unix(0, rec.Time*int64(time.Millisecond)),
+			Title: rec.Title,
+			Text:  rec.Text,
+			Tags:  rec.Tags,
+		}, false)
+	}
+	return sc.Err()
+}
+
+// find returns the annotations within [from, to] that have all tags.
+func (s *annotationStore) find(from, to time.Time, tags []string) []Annotation {
+	s.m.Lock()
+	defer s.m.Unlock()
+	i := sort.Search(len(s.list), func(i int) bool { return !s.list[i].Time.Before(from) })
+	var found []Annotation
+	for ; i < len(s.list) && !s.list[i].Time.After(to); i++ {
+		if hasTags(s.list[i].Tags, tags) {
+			found = append(found, s.list[i])
+		}
+	}
+	return found
+}
+
+// hasTags reports whether have contains all of want.
+func hasTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// annotationQuery is an `/annotations` request from Grafana.
+type annotationQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Annotation annotationInfo `json:"annotation"`
+}
+
+// annotationInfo describes the Grafana annotation that requests events.
+// The response repeats it for every event.
+type annotationInfo struct {
+	Name       string `json:"name"`
+	Datasource string `json:"datasource"`
+	IconColor  string `json:"iconColor"`
+	Enable     bool   `json:"enable"`
+	Query      string `json:"query"`
+}
+
+// annotationResponse is a single event in the response to an `/annotations` request.
+type annotationResponse struct {
+	Annotation annotationInfo `json:"annotation"`
+	Time       int64          `json:"time"` // Unix milliseconds
+	Title      string         `json:"title"`
+	Tags       []string       `json:"tags,omitempty"`
+	Text       string         `json:"text,omitempty"`
+}
+
+// annotationsHandler responds to an annotation request from Grafana.
+func (srv *server) annotationsHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := readQueryBody(w, r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	var q annotationQuery
+	err = json.Unmarshal(body, &q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot unmarshal request body")
+		return
+	}
+
+	response := []annotationResponse{}
+	if q.Annotation.Query == "alerts" {
+		response = srv.alertAnnotations(q.Annotation, q.Range.From, q.Range.To)
+	} else if target, ok := strings.CutPrefix(q.Annotation.Query, "event:"); ok {
+		response, err = srv.eventAnnotations(q.Annotation, target, q.Range.From, q.Range.To)
+		if err != nil {
+			writeError(w, statusFor(err), err, "Cannot get event for target "+target)
+			return
+		}
+	} else {
+		tags := strings.FieldsFunc(q.Annotation.Query, func(r rune) bool { return r == ' ' || r == ',' })
+		for _, a := range srv.annotations.find(q.Range.From, q.Range.To, tags) {
+			response = append(response, annotationResponse{
+				Annotation: q.Annotation,
+				Time:       a.Time.UnixNano() / int64(time.Millisecond),
+				Title:      a.Title,
+				Tags:       a.Tags,
+				Text:       a.Text,
+			})
+		}
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal annotations response")
+		return
+	}
+	w.Write(resp)
+}
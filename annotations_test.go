@@ -0,0 +1,58 @@
+package grada
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard_AddAnnotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.jsonl")
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+
+	d := NewDashboard(WithAnnotationFile(path))
+	d.AddAnnotation("deploy v2", "", []string{"deploy", "prod"}, t0.Add(2*time.Minute))
+	d.AddAnnotation("deploy v1", "", []string{"deploy"}, t0.Add(time.Minute))
+	if err := d.AddAnnotation("reload", "config changed", nil, t0.Add(3*time.Minute)); err != nil {
+		t.Fatalf("AddAnnotation(): %v", err)
+	}
+
+	// A new dashboard loads the annotations from the file.
+	d = NewDashboard(WithAnnotationFile(path))
+
+	tests := []struct {
+		name      string
+		from, to  time.Duration
+		tags      []string
+		wantTitle []string
+	}{
+		{"all", 0, time.Hour, nil, []string{"deploy v1", "deploy v2", "reload"}},
+		{"range", 90 * time.Second, 3 * time.Minute, nil, []string{"deploy v2", "reload"}},
+		{"tag", 0, time.Hour, []string{"deploy"}, []string{"deploy v1", "deploy v2"}},
+		{"tags", 0, time.Hour, []string{"deploy", "prod"}, []string{"deploy v2"}},
+		{"none", 4 * time.Minute, time.Hour, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range d.Annotations(t0.Add(tt.from), t0.Add(tt.to), tt.tags...) {
+				got = append(got, a.Title)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantTitle, ",") {
+				t.Errorf("Annotations() = %v, want %v", got, tt.wantTitle)
+			}
+		})
+	}
+
+	body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "annotation": {"name": "deploys", "query": "deploy, prod"}}`
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/annotations", strings.NewReader(body)))
+	var got []annotationResponse
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if len(got) != 1 || got[0].Title != "deploy v2" || got[0].Annotation.Name != "deploys" || got[0].Time != 1508929320000 {
+		t.Errorf("/annotations: got %s", w.Body.String())
+	}
+}
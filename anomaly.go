@@ -0,0 +1,109 @@
+package grada
+
+// Anomaly scores of metrics.
+
+import (
+	"math"
+	"sync"
+)
+
+// AnomalyConfig configures an anomaly score series. See CreateAnomalyScore.
+type AnomalyConfig struct {
+	// Window is the number of earlier samples that each sample is compared
+	// with. Default is 30.
+	Window int
+	// Season is the number of samples per season, for metrics with a
+	// periodic pattern such as daily load. If Season is set, each sample is
+	// compared with the samples at the same position in the previous Window
+	// seasons, rather than with the previous Window samples.
+	Season int
+}
+
+// maxAnomalyScore limits anomaly scores, so that a change of a previously
+// constant metric yields a finite score.
+const maxAnomalyScore = 100
+
+// CreateAnomalyScore creates a metric for target that receives an anomaly
+// score for every data point added to the metric of source. The score is
+// the z-score of the data point: its distance from the mean of the
+// comparison samples (see AnomalyConfig), in standard deviations, limited
+// to ±100. Scores start after two comparison samples are available.
+//
+// The score metric has the same buffer size as the source metric. Like
+// every metric, it can be queried by Grafana and used in rules, for
+// example Rule{Target: target, Threshold: 3}.
+func (d *Dashboard) CreateAnomalyScore(source, target string, cfg AnomalyConfig) (*Metric, error) {
+	src, err := d.srv.metrics.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	src.m.Lock()
+	size := src.list.len()
+	src.m.Unlock()
+	score, err := d.srv.metrics.Create(target, size)
+	if err != nil {
+		return nil, err
+	}
+	a := newAnomalyScorer(cfg)
+	src.Subscribe(func(c Count) {
+		if z, ok := a.score(c.N); ok {
+			score.AddCount(Count{z, c.T})
+		}
+	})
+	return score, nil
+}
+
+// anomalyScorer computes z-scores over a history of samples.
+type anomalyScorer struct {
+	window, period int
+
+	mu   sync.Mutex
+	hist []float64 // ring buffer of the last window*period samples
+	pos  int       // next position in hist
+	seen int       // number of samples so far
+}
+
+func newAnomalyScorer(cfg AnomalyConfig) *anomalyScorer {
+	a := &anomalyScorer{window: cfg.Window, period: cfg.Season}
+	if a.window < 1 {
+		a.window = 30
+	}
+	if a.period < 1 {
+		a.period = 1
+	}
+	a.hist = make([]float64, a.window*a.period)
+	return a
+}
+
+// score returns the z-score of n and adds n to the history.
+// ok is false if there are not enough comparison samples yet.
+func (a *anomalyScorer) score(n float64) (z float64, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var sum, sumSq float64
+	count := 0
+	for k := 1; k <= a.window && k*a.period <= a.seen; k++ {
+		v := a.hist[(a.pos-k*a.period+len(a.hist))%len(a.hist)]
+		sum += v
+		sumSq += v * v
+		count++
+	}
+	a.hist[a.pos] = n
+	a.pos = (a.pos + 1) % len(a.hist)
+	a.seen++
+
+	if count < 2 {
+		return 0, false
+	}
+	mean := sum / float64(count)
+	sd := math.Sqrt(math.Max(sumSq/float64(count)-mean*mean, 0))
+	if sd == 0 {
+		if n == mean {
+			return 0, true
+		}
+		return math.Copysign(maxAnomalyScore, n-mean), true
+	}
+	z = (n - mean) / sd
+	return math.Max(-maxAnomalyScore, math.Min(maxAnomalyScore, z)), true
+}
@@ -0,0 +1,54 @@
+package grada
+
+import (
+	"testing"
+)
+
+func TestAnomalyScorer_score(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    AnomalyConfig
+		values []float64
+		want   float64
+		wantOk bool
+	}{
+		{"tooFew", AnomalyConfig{Window: 3}, []float64{1, 2}, 0, false},
+		{"normal", AnomalyConfig{Window: 4}, []float64{1, 3, 1, 3, 2}, 0, true},
+		{"spike", AnomalyConfig{Window: 4}, []float64{1, 3, 1, 3, 6}, 4, true},
+		{"window", AnomalyConfig{Window: 2}, []float64{100, 1, 3, 4}, 2, true},
+		{"constant", AnomalyConfig{Window: 3}, []float64{5, 5, 5, 6}, maxAnomalyScore, true},
+		// Season 2: 10 is compared with 1 and 3, not with 100 and 200.
+		{"seasonal", AnomalyConfig{Window: 2, Season: 2}, []float64{1, 100, 3, 200, 10}, 8, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAnomalyScorer(tt.cfg)
+			var got float64
+			var ok bool
+			for _, v := range tt.values {
+				got, ok = a.score(v)
+			}
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("score() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestDashboard_CreateAnomalyScore(t *testing.T) {
+	d := NewDashboard()
+	src, _ := d.CreateMetricWithBufSize("cpu", 10)
+	score, err := d.CreateAnomalyScore("cpu", "cpu:anomaly", AnomalyConfig{Window: 4})
+	if err != nil {
+		t.Fatalf("CreateAnomalyScore(): %v", err)
+	}
+	for _, v := range []float64{1, 3, 1, 3, 6} {
+		src.Add(v)
+	}
+	if score.head != 3 || score.list.at(2).N != 4 {
+		t.Errorf("scores %v, want 3 scores, the last one 4", score.list.counts()[:score.head])
+	}
+	if _, err := d.CreateAnomalyScore("nope", "x", AnomalyConfig{}); err == nil {
+		t.Errorf("CreateAnomalyScore() for unknown source: no error")
+	}
+}
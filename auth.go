@@ -0,0 +1,74 @@
+package grada
+
+// Pluggable authentication.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Principal is the identity of an authenticated client.
+type Principal struct {
+	Name       string
+	Attributes map[string]interface{} // scheme-specific details, such as JWT claims
+}
+
+// Authenticator authenticates requests to the grada server.
+//
+// Authenticate returns the identity of the client that sent r, or an error
+// if the client cannot be authenticated. The server calls Authenticate on
+// every request and rejects requests that fail with 401 Unauthorized.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// AuthenticatorFunc adapts an ordinary function to the Authenticator interface.
+type AuthenticatorFunc func(r *http.Request) (Principal, error)
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Principal, error) {
+	return f(r)
+}
+
+// WithAuthenticator makes the server authenticate every request through a.
+// Use it to connect grada to the authentication system of your organization.
+// Only one authenticator is active; a later WithAuthenticator or WithJWT
+// replaces an earlier one.
+func WithAuthenticator(a Authenticator) Option {
+	return func(srv *server) {
+		srv.authenticator = a
+	}
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the Principal of an authenticated request.
+// The context is the one of the *http.Request passed to grada's handlers.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// authenticate passes a request on to h only if the authenticator accepts it.
+// The principal is added to the request context.
+func (srv *server) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := srv.authenticator.Authenticate(r)
+		if err != nil {
+			writeUnauthorized(w, err)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// writeUnauthorized writes a 401 response with a JSON error message. Bearer
+// token errors also set the WWW-Authenticate challenge.
+func writeUnauthorized(w http.ResponseWriter, e error) {
+	var be *bearerError
+	if errors.As(e, &be) {
+		w.Header().Set("WWW-Authenticate", be.challenge)
+	}
+	writeError(w, http.StatusUnauthorized, e, "unauthorized")
+}
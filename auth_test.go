@@ -0,0 +1,45 @@
+package grada
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer_authenticate(t *testing.T) {
+	auth := AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		if r.Header.Get("X-User") == "" {
+			return Principal{}, errors.New("no user")
+		}
+		return Principal{Name: r.Header.Get("X-User")}, nil
+	})
+
+	tests := []struct {
+		name       string
+		user       string
+		wantStatus int
+	}{
+		{"authenticated", "grafana", 200},
+		{"anonymous", "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &server{authenticator: auth}
+			var got Principal
+			h := srv.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = PrincipalFromContext(r.Context())
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-User", tt.user)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("authenticate(): status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got.Name != tt.user {
+				t.Errorf("authenticate(): principal %q, want %q", got.Name, tt.user)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package grada
+
+// Backfill of historical data points.
+
+import (
+	"fmt"
+	"time"
+)
+
+// Backfill inserts historical data points into the metric of target in
+// one pass, for example to load the history of a metric at startup.
+// Unlike AddCount, which overwrites the oldest data point of a full
+// buffer, Backfill grows the buffer of the metric so that it holds both
+// the data points it has and the new ones. Data points whose time stamp
+// the metric has already are skipped. If no metric exists for target,
+// Backfill creates one as Dashboard.Add does.
+//
+// points must be sorted by time stamp, and every point must have a time
+// stamp; otherwise Backfill adds nothing and returns an error that wraps
+// ErrUnordered. Backfill grows a buffer to at most DefaultBackfillLimit
+// data points, or the limit set through WithBackfillLimit; beyond, it adds
+// nothing and returns an error that wraps ErrBackfillLimit.
+//
+// POST /push?backfill=1 backfills the samples of the request into
+// existing metrics.
+func (d *Dashboard) Backfill(target string, points []Count) error {
+	if err := checkOrder(target, points); err != nil {
+		return err
+	}
+	limit := d.srv.backfillLimit()
+	if len(points) > limit {
+		return fmt.Errorf("%w: %s: %d data points", ErrBackfillLimit, target, len(points))
+	}
+	m, err := d.srv.metrics.Get(target)
+	if err != nil {
+		if m, err = d.srv.metrics.createAuto(target, max(len(points), DefaultAutoCreateSize)); err != nil {
+			m = d.srv.metrics.getOrCreate(target) // created concurrently
+		}
+	}
+	_, err = m.backfill(target, points, limit)
+	return err
+}
+
+// DefaultBackfillLimit is the largest buffer size to which a backfill
+// grows a metric, unless set through WithBackfillLimit.
+const DefaultBackfillLimit = 1000000
+
+// WithBackfillLimit sets the largest buffer size, in data points, to which
+// Dashboard.Backfill and POST /push?backfill=1 grow a metric. Backfills
+// that need a larger buffer fail; /push responds to them with 413 Request
+// Entity Too Large. Sizes below 1 mean DefaultBackfillLimit.
+func WithBackfillLimit(size int) Option {
+	return func(srv *server) {
+		srv.maxBackfill = size
+	}
+}
+
+// backfillLimit returns the largest buffer size of a backfill.
+func (srv *server) backfillLimit() int {
+	if srv.maxBackfill < 1 {
+		return DefaultBackfillLimit
+	}
+	return srv.maxBackfill
+}
+
+// checkOrder returns an error wrapping ErrUnordered unless the points
+// have time stamps in ascending order.
+func checkOrder(target string, points []Count) error {
+	for i, c := range points {
+		if c.T.IsZero() {
+			return fmt.Errorf("%w: %s: data point %d has no time stamp", ErrUnordered, target, i)
+		}
+		if i > 0 && c.T.Before(points[i-1].T) {
+			return fmt.Errorf("%w: %s: data point %d is older than its predecessor", ErrUnordered, target, i)
+		}
+	}
+	return nil
+}
+
+// backfill merges sorted points into the buffer, growing the buffer if
+// it cannot hold all data points. It returns the number of data points
+// it has added. If the buffer would grow beyond limit, backfill adds
+// nothing and returns an error that wraps ErrBackfillLimit.
+func (g *Metric) backfill(target string, points []Count, limit int) (int, error) {
+	g.m.Lock()
+	merged, added := g.mergeBackfill(points)
+	n := g.list.len()
+	size := max(n, len(merged))
+	if size > n && size > limit {
+		g.m.Unlock()
+		return 0, fmt.Errorf("%w: %s: %d data points", ErrBackfillLimit, target, size)
+	}
+
+	// Empty slots go first, so that the next data point fills one of
+	// them. The buffer stays in chronological order from head.
+	list := newCountBuffer(size)
+	for i, c := range merged {
+		list.set(size-len(merged)+i, c)
+	}
+	g.list, g.head, g.unsorted = list, 0, false
+	if g.wal != nil {
+		for _, c := range added {
+			g.wal.append(g.target, c)
+		}
+	}
+	if len(added) > 0 {
+		g.seq = nextSeq()
+	}
+	subs := g.subs
+	g.m.Unlock()
+	for _, c := range added {
+		for _, s := range subs {
+			s.fn(c)
+		}
+	}
+	return len(added), nil
+}
+
+// backfillSize returns the buffer size that backfilling points requires.
+func (g *Metric) backfillSize(points []Count) int {
+	g.m.Lock()
+	defer g.m.Unlock()
+	merged, _ := g.mergeBackfill(points)
+	return max(g.list.len(), len(merged))
+}
+
+// mergeBackfill returns the data points of the buffer merged with the
+// sorted points, and the points that are new to the buffer. The caller
+// must hold g.m.
+func (g *Metric) mergeBackfill(points []Count) (merged, added []Count) {
+	g.sort()
+	n := g.list.len()
+	have := make([]Count, 0, n)
+	for i := 0; i < n; i++ {
+		if c := g.list.at((i + g.head) % n); !c.T.IsZero() {
+			have = append(have, c)
+		}
+	}
+
+	// Merge the two sorted lists.
+	merged = make([]Count, 0, len(have)+len(points))
+	i := 0
+	for _, c := range points {
+		for i < len(have) && have[i].T.Before(c.T) {
+			merged = append(merged, have[i])
+			i++
+		}
+		if i < len(have) && have[i].T.Equal(c.T) {
+			continue
+		}
+		if len(added) > 0 && added[len(added)-1].T.Equal(c.T) {
+			continue
+		}
+		merged = append(merged, c)
+		added = append(added, c)
+	}
+	merged = append(merged, have[i:]...)
+	return merged, added
+}
+
+// backfillSamples backfills the samples of a /push request, grouped by
+// metric. It adds nothing if the samples of a metric are not in order, or
+// if a metric would grow beyond limit.
+func backfillSamples(samples []pushSample, metrics []*Metric, limit int) error {
+	var order []*Metric
+	var targets []string
+	points := map[*Metric][]Count{}
+	for i, s := range samples {
+		t := s.t
+		if t.IsZero() && s.Time != 0 {
+			t = time.Unix(0, s.Time*int64(time.Millisecond))
+		}
+		m := metrics[i]
+		if _, ok := points[m]; !ok {
+			order = append(order, m)
+			targets = append(targets, s.Target)
+		}
+		points[m] = append(points[m], Count{s.Value, t})
+	}
+	for i, m := range order {
+		if err := checkOrder(targets[i], points[m]); err != nil {
+			return err
+		}
+		if size := m.backfillSize(points[m]); size > m.list.len() && size > limit {
+			return fmt.Errorf("%w: %s: %d data points", ErrBackfillLimit, targets[i], size)
+		}
+	}
+	for i, m := range order {
+		// Only a concurrent backfill of the same metric fails here.
+		if _, err := m.backfill(targets[i], points[m], limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package grada
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard_Backfill(t *testing.T) {
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	tests := []struct {
+		name     string
+		have     []Count // added before the backfill
+		size     int
+		points   []Count
+		want     []Count
+		wantSize int
+		wantErr  error
+	}{
+		{
+			name:     "into an empty metric",
+			size:     5,
+			points:   []Count{{1, at(1)}, {2, at(2)}},
+			want:     []Count{{1, at(1)}, {2, at(2)}},
+			wantSize: 5,
+		},
+		{
+			name:     "grows the buffer",
+			have:     []Count{{3, at(3)}, {5, at(5)}},
+			size:     3,
+			points:   []Count{{1, at(1)}, {4, at(4)}, {5, at(5)}, {6, at(6)}},
+			want:     []Count{{1, at(1)}, {3, at(3)}, {4, at(4)}, {5, at(5)}, {6, at(6)}},
+			wantSize: 5,
+		},
+		{
+			name:     "equal time stamps",
+			size:     5,
+			points:   []Count{{1, at(1)}, {2, at(1)}},
+			want:     []Count{{1, at(1)}},
+			wantSize: 5,
+		},
+		{
+			name:     "unordered",
+			have:     []Count{{3, at(3)}},
+			size:     5,
+			points:   []Count{{2, at(2)}, {1, at(1)}},
+			want:     []Count{{3, at(3)}},
+			wantSize: 5,
+			wantErr:  ErrUnordered,
+		},
+		{
+			name:     "beyond the limit",
+			have:     []Count{{3, at(3)}},
+			size:     2,
+			points:   []Count{{1, at(1)}, {2, at(2)}, {4, at(4)}, {5, at(5)}, {6, at(6)}},
+			want:     []Count{{3, at(3)}},
+			wantSize: 2,
+			wantErr:  ErrBackfillLimit,
+		},
+		{
+			name:     "no time stamp",
+			size:     5,
+			points:   []Count{{1, time.Time{}}},
+			wantSize: 5,
+			wantErr:  ErrUnordered,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard(WithBackfillLimit(5))
+			m, _ := d.CreateMetricWithBufSize("cpu", tt.size)
+			for _, c := range tt.have {
+				m.AddCount(c)
+			}
+			if err := d.Backfill("cpu", tt.points); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Backfill() error = %v, want %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, allCounts(t, d, "cpu")); diff != "" {
+				t.Errorf("data points mismatch (-want +got):\n%s", diff)
+			}
+			if m.list.len() != tt.wantSize {
+				t.Errorf("buffer size %d, want %d", m.list.len(), tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestDashboard_Backfill_thenAdd(t *testing.T) {
+	d := NewDashboard()
+	m, _ := d.CreateMetricWithBufSize("cpu", 4)
+	d.Backfill("cpu", []Count{{1, time.Unix(1, 0)}, {2, time.Unix(2, 0)}})
+	for i := int64(3); i <= 5; i++ {
+		m.AddWithTime(float64(i), time.Unix(i, 0))
+	}
+	want := []Count{{2, time.Unix(2, 0)}, {3, time.Unix(3, 0)}, {4, time.Unix(4, 0)}, {5, time.Unix(5, 0)}}
+	if diff := cmp.Diff(want, allCounts(t, d, "cpu")); diff != "" {
+		t.Errorf("data points mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServer_pushHandler_backfill(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       []Count
+	}{
+		{
+			"ordered",
+			`[{"target": "cpu", "value": 1, "time": 1000}, {"target": "mem", "value": 9, "time": 500},
+			  {"target": "cpu", "value": 2, "time": 2000}, {"target": "cpu", "value": 3, "time": 3000}]`,
+			200,
+			[]Count{{1, time.Unix(1, 0)}, {2, time.Unix(2, 0)}, {3, time.Unix(3, 0)}},
+		},
+		{
+			"unordered",
+			`[{"target": "cpu", "value": 2, "time": 2000}, {"target": "cpu", "value": 1, "time": 1000}]`,
+			400,
+			nil,
+		},
+		{
+			"no time",
+			`[{"target": "cpu", "value": 1}]`,
+			400,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard()
+			d.CreateMetricWithBufSize("cpu", 2)
+			d.CreateMetricWithBufSize("mem", 2)
+			r := httptest.NewRequest("POST", "/push?backfill=1", bytes.NewReader([]byte(tt.body)))
+			w := httptest.NewRecorder()
+			d.srv.pushHandler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("pushHandler(): status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if diff := cmp.Diff(tt.want, allCounts(t, d, "cpu")); diff != "" {
+				t.Errorf("data points mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServer_pushHandler_backfillParams(t *testing.T) {
+	body := `[{"target": "cpu", "value": 1, "time": 1000}, {"target": "cpu", "value": 2, "time": 2000},
+	  {"target": "cpu", "value": 3, "time": 3000}]`
+	tests := []struct {
+		name       string
+		url        string
+		limit      int
+		wantStatus int
+		wantSize   int
+	}{
+		{"true", "/push?backfill=true", 0, 200, 3},
+		{"false", "/push?backfill=0", 0, 200, 2},
+		{"invalid", "/push?backfill=yes", 0, 400, 2},
+		{"withinLimit", "/push?backfill=1", 3, 200, 3},
+		{"beyondLimit", "/push?backfill=1", 2, 413, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard(WithBackfillLimit(tt.limit))
+			m, _ := d.CreateMetricWithBufSize("cpu", 2)
+			r := httptest.NewRequest("POST", tt.url, bytes.NewReader([]byte(body)))
+			w := httptest.NewRecorder()
+			d.srv.pushHandler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("pushHandler(): status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if m.list.len() != tt.wantSize {
+				t.Errorf("buffer size %d, want %d", m.list.len(), tt.wantSize)
+			}
+		})
+	}
+}
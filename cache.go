@@ -0,0 +1,189 @@
+package grada
+
+// A short-lived cache of /query responses.
+//
+// Every viewer of a dashboard refreshes the same panels at the same
+// interval. With the cache, only the first of several identical queries
+// scans the metric buffers; the others receive the cached response until
+// it expires.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries limits the number of responses in the cache.
+const maxCacheEntries = 1000
+
+// WithResponseCache caches /query responses for ttl. Queries with the same
+// targets, time range, interval, and maximum number of data points get the
+// cached response until it expires, so data added within ttl may not show
+// up immediately. Partial responses (see WithQueryTimeout) and error
+// responses are not cached.
+func WithResponseCache(ttl time.Duration) Option {
+	return func(srv *server) {
+		srv.cache.ttl = ttl
+	}
+}
+
+// responseCache maps query keys to responses.
+type responseCache struct {
+	ttl     time.Duration // cache responses if > 0
+	m       sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	body        []byte
+	contentType string
+	expires     time.Time
+}
+
+// cacheKey contains everything of a query that determines the response.
+type cacheKey struct {
+	Targets       []cacheKeyTarget
+	From, To      time.Time
+	Interval      time.Duration
+	MaxDataPoints int
+	Format        string `json:",omitempty"`
+}
+
+type cacheKeyTarget struct {
+	Target, Type string
+	Data         json.RawMessage
+}
+
+// queryKey returns the cache key of a query. Hidden targets do not change
+// the response, and are not part of the key.
+func queryKey(q *query, format string) string {
+	k := cacheKey{
+		From:          q.Range.From,
+		To:            q.Range.To,
+		Interval:      q.interval(),
+		MaxDataPoints: q.MaxDataPoints,
+		Format:        format,
+	}
+	for _, t := range q.Targets {
+		if !t.Hide {
+			k.Targets = append(k.Targets, cacheKeyTarget{t.Target, t.Type, t.Data})
+		}
+	}
+	b, _ := json.Marshal(k)
+	return string(b)
+}
+
+// get returns the unexpired response for key.
+func (c *responseCache) get(key string, now time.Time) (cacheEntry, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	e, ok := c.entries[key]
+	if !ok || now.After(e.expires) {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// put stores a response. If the cache is full, put first removes expired
+// entries, and drops the response if that does not make room.
+func (c *responseCache) put(key string, e cacheEntry, now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry{}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		for k, old := range c.entries {
+			if now.After(old.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = e
+}
+
+// cacheQueries answers /query requests from the response cache, and
+// caches the successful responses of h.
+func (srv *server) cacheQueries(h http.HandlerFunc) http.HandlerFunc {
+	if srv.cache.ttl <= 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := peekQuery(w, r)
+		if err != nil {
+			h(w, r) // let h report the error
+			return
+		}
+
+		for _, t := range q.Targets {
+			if _, ok := srv.source(t.Target); ok {
+				h(w, r) // do not hold streamed responses in memory
+				return
+			}
+		}
+
+		key := queryKey(q, responseFormat(r))
+		if e, ok := srv.cache.get(key, time.Now()); ok {
+			if e.contentType != "" {
+				w.Header().Set("Content-Type", e.contentType)
+			}
+			w.Write(e.body)
+			return
+		}
+
+		rec := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		h(rec, r)
+		if rec.status == http.StatusOK && w.Header().Get(PartialHeader) == "" {
+			now := time.Now()
+			srv.cache.put(key, cacheEntry{
+				body:        rec.body.Bytes(),
+				contentType: w.Header().Get("Content-Type"),
+				expires:     now.Add(srv.cache.ttl),
+			}, now)
+		}
+	}
+}
+
+// peekQuery parses the query in the body of r, and leaves the body
+// for the next handler to read. If the body cannot be read, the next
+// handler reads the same error.
+func peekQuery(w http.ResponseWriter, r *http.Request) (*query, error) {
+	body, err := readQueryBody(w, r)
+	r.Body = replayBody(body, err)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalQuery(body)
+}
+
+// replayBody returns a request body that yields body, and then err
+// if err is not nil.
+func replayBody(body []byte, err error) io.ReadCloser {
+	if err == nil {
+		return io.NopCloser(bytes.NewReader(body))
+	}
+	return io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+}
+
+// errReader is a reader that fails with err.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// bodyRecorder keeps a copy of the body written to a ResponseWriter.
+type bodyRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (br *bodyRecorder) Write(b []byte) (int, error) {
+	br.body.Write(b)
+	return br.statusRecorder.Write(b)
+}
@@ -0,0 +1,77 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_cacheQueries(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	body := func(target string) string {
+		return `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "maxDataPoints": 10, "targets": [{"target": "` + target + `"}]}`
+	}
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		second    string // body of the second query
+		wantFresh bool   // whether the second query sees the new data point
+	}{
+		{"noCache", 0, body("cpu"), true},
+		{"hit", time.Minute, body("cpu"), false},
+		{"expired", time.Nanosecond, body("cpu"), true},
+		{"otherKey", time.Minute, strings.Replace(body("cpu"), `"maxDataPoints": 10`, `"maxDataPoints": 20`, 1), true},
+		{"hidden", time.Minute, strings.Replace(body("cpu"), `"cpu"}`, `"cpu", "hide": true}`, 1), true},
+		{"hiddenExtra", time.Minute, strings.Replace(body("cpu"), `"cpu"}`, `"cpu"}, {"target": "mem", "hide": true}`, 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard(WithResponseCache(tt.ttl))
+			metric, _ := d.CreateMetricWithBufSize("cpu", 10)
+			metric.AddWithTime(1, t0)
+			query := func(b string) string {
+				w := httptest.NewRecorder()
+				d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(b)))
+				return w.Body.String()
+			}
+
+			first := query(body("cpu"))
+			metric.AddWithTime(2, t0.Add(time.Second))
+			time.Sleep(time.Millisecond)
+			second := query(tt.second)
+			if fresh := second != first; fresh != tt.wantFresh {
+				t.Errorf("second response fresh = %v, want %v:\nfirst  %s\nsecond %s", fresh, tt.wantFresh, first, second)
+			}
+		})
+	}
+}
+
+func TestServer_cacheQueriesErrors(t *testing.T) {
+	d := NewDashboard(WithResponseCache(time.Minute))
+	body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "targets": [{"target": "cpu"}]}`
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	if w.Code != 404 {
+		t.Fatalf("status %d, want 404", w.Code)
+	}
+	d.CreateMetricWithBufSize("cpu", 10)
+	w = httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Errorf("status after creating the metric %d, want 200: error response was cached", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader("{")))
+	if w.Code != 400 {
+		t.Errorf("status for invalid JSON %d, want 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	large := `{"targets": [{"target": "cpu"}], "pad": "` + strings.Repeat("x", maxQueryBytes) + `"}`
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(large)))
+	if w.Code != 413 {
+		t.Errorf("status for a body over maxQueryBytes %d, want 413", w.Code)
+	}
+}
@@ -0,0 +1,217 @@
+package grada
+
+// Checkpoints of the write-ahead log.
+//
+// A checkpoint is a text file with the buffer sizes and the data points
+// of all metrics, followed by the CRC-32 checksum of everything before it:
+//
+//	grada checkpoint 1
+//	m 1000 "cpu"
+//	1508929014000000000 0.5 "cpu"
+//	...
+//	crc32 8a3f01c2
+//
+// Data point lines have the format of the write-ahead log.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkpointHeader is the first line of a checkpoint.
+const checkpointHeader = "grada checkpoint 1\n"
+
+// errBadChecksum reports a checkpoint that does not match its checksum.
+var errBadChecksum = errors.New("checksum mismatch")
+
+// checkpointPath returns the path of the checkpoint of the log at path.
+func checkpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// checkpointer is the collector that writes the checkpoints.
+type checkpointer struct {
+	srv *server
+}
+
+func (c *checkpointer) Name() string            { return "wal.checkpoint" }
+func (c *checkpointer) Interval() time.Duration { return c.srv.walConfig.CheckpointInterval }
+
+// Collect writes a checkpoint. Failures are logged.
+func (c *checkpointer) Collect(ctx context.Context) []Sample {
+	if err := c.srv.checkpoint(); err != nil && c.srv.logger != nil {
+		c.srv.logger.Printf("grada: checkpoint: %v", err)
+	}
+	return nil
+}
+
+// checkpoint starts a new segment of the log, and writes a checkpoint of
+// all metrics. The checkpoint contains all data points of the previous
+// segments, because a data point is logged and added to its metric under
+// the lock of the metric, so it is in the metric before checkpoint can
+// read the metric. The previous checkpoint remains as a fallback.
+func (srv *server) checkpoint() error {
+	w := srv.metrics.wal
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	err := w.rotate()
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	srv.metrics.m.Lock()
+	targets := make([]string, 0, len(srv.metrics.metric))
+	all := make(map[string]*Metric, len(srv.metrics.metric))
+	for target, m := range srv.metrics.metric {
+		targets = append(targets, target)
+		all[target] = m
+	}
+	srv.metrics.m.Unlock()
+	sort.Strings(targets)
+
+	b := []byte(checkpointHeader)
+	for _, target := range targets {
+		size, counts := all[target].snapshot()
+		b = append(b, "m "...)
+		b = strconv.AppendInt(b, int64(size), 10)
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, target)
+		b = append(b, '\n')
+		for _, c := range counts {
+			b = appendWALLine(b, target, c)
+		}
+	}
+	return writeCheckpoint(checkpointPath(w.cfg.Path), appendChecksum(b))
+}
+
+// snapshot returns the buffer size and all data points of g, read under
+// one lock, so that a concurrent resize cannot change the size between
+// the two.
+func (g *Metric) snapshot() (size int, counts []Count) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.list.len(), g.collect(nil, time.Time{}, endOfTime, math.MaxInt)
+}
+
+// appendChecksum appends the checksum line of b to b.
+func appendChecksum(b []byte) []byte {
+	return fmt.Appendf(b, "crc32 %08x\n", crc32.ChecksumIEEE(b))
+}
+
+// writeCheckpoint replaces the checkpoint at path by b atomically: it
+// writes b to a temporary file, flushes it to the disk, keeps the old
+// checkpoint as <path>.prev, and renames the temporary file to path.
+func writeCheckpoint(path string, b []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(path, path+".prev"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadCheckpoint adds the metrics of the checkpoint of the log at path,
+// or of the previous checkpoint if it is damaged, to metrics. It reports
+// whether it has loaded a checkpoint.
+func (srv *server) loadCheckpoint(path string) bool {
+	for _, p := range []string{checkpointPath(path), checkpointPath(path) + ".prev"} {
+		cp, err := readCheckpoint(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			if srv.logger != nil {
+				srv.logger.Printf("grada: cannot load checkpoint %s: %v", p, err)
+			}
+			continue
+		}
+		for _, target := range cp.targets {
+			m, err := srv.metrics.createAuto(target, cp.sizes[target])
+			if err != nil {
+				continue // a metric of the same name exists
+			}
+			for _, c := range cp.counts[target] {
+				m.AddCount(c)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// checkpointData is the content of a checkpoint.
+type checkpointData struct {
+	targets []string
+	sizes   map[string]int
+	counts  map[string][]Count
+}
+
+// readCheckpoint reads and verifies the checkpoint at path.
+func readCheckpoint(path string) (*checkpointData, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, []byte(checkpointHeader)) {
+		return nil, errors.New("not a checkpoint")
+	}
+	i := bytes.LastIndex(b, []byte("crc32 "))
+	if i < 0 {
+		return nil, errBadChecksum
+	}
+	sum, err := strconv.ParseUint(strings.TrimSpace(string(b[i+len("crc32 "):])), 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(b[:i]) {
+		return nil, errBadChecksum
+	}
+
+	cp := &checkpointData{sizes: map[string]int{}, counts: map[string][]Count{}}
+	lines := strings.Split(string(b[len(checkpointHeader):i]), "\n")
+	for n, line := range lines {
+		if line == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "m "); ok {
+			size, quoted, _ := strings.Cut(rest, " ")
+			s, err := strconv.Atoi(size)
+			target, qerr := strconv.Unquote(quoted)
+			if err != nil || qerr != nil || s < 1 {
+				return nil, fmt.Errorf("line %d: invalid metric", n+2)
+			}
+			cp.targets = append(cp.targets, target)
+			cp.sizes[target] = s
+			continue
+		}
+		target, c, ok := parseWALLine(line)
+		if !ok || cp.sizes[target] == 0 {
+			return nil, fmt.Errorf("line %d: invalid data point", n+2)
+		}
+		cp.counts[target] = append(cp.counts[target], c)
+	}
+	return cp, nil
+}
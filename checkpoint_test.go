@@ -0,0 +1,128 @@
+package grada
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// values returns the values of the metric of target.
+func values(t *testing.T, d *Dashboard, target string) []float64 {
+	t.Helper()
+	var v []float64
+	for _, c := range allCounts(t, d, target) {
+		v = append(v, c.N)
+	}
+	return v
+}
+
+func TestServer_checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grada.wal")
+	cfg := WALConfig{Path: path, CheckpointInterval: time.Hour}
+	d := NewDashboard(WithWAL(cfg))
+	waitForRun(t, d) // the first checkpoint, at startup
+	m, _ := d.CreateMetricWithBufSize("cpu", 3)
+	for i := 1; i <= 4; i++ {
+		m.AddCount(Count{float64(i), time.Unix(int64(i), 0)})
+	}
+	if err := d.srv.checkpoint(); err != nil {
+		t.Fatalf("checkpoint(): %v", err)
+	}
+	m.AddCount(Count{5, time.Unix(5, 0)}) // in the log only
+	d.Shutdown(context.Background())      // writes another checkpoint
+
+	d = NewDashboard(WithWAL(cfg))
+	defer d.Shutdown(context.Background())
+	if diff := cmp.Diff([]float64{3, 4, 5}, values(t, d, "cpu")); diff != "" {
+		t.Errorf("restored values mismatch (-want +got):\n%s", diff)
+	}
+	if m, _ := d.GetMetric("cpu"); m.list.len() != 3 {
+		t.Errorf("restored buffer size %d, want 3", m.list.len())
+	}
+}
+
+// TestServer_checkpoint_resize is meant for the race detector.
+func TestServer_checkpoint_resize(t *testing.T) {
+	d := NewDashboard(WithWAL(WALConfig{Path: filepath.Join(t.TempDir(), "grada.wal"), CheckpointInterval: time.Hour}))
+	defer d.Shutdown(context.Background())
+	waitForRun(t, d)
+	d.CreateMetricWithBufSize("cpu", 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for size := 1; size <= 20; size++ {
+			d.ResizeMetric("cpu", size)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := d.srv.checkpoint(); err != nil {
+			t.Fatalf("checkpoint(): %v", err)
+		}
+	}
+	<-done
+}
+
+func TestServer_loadCheckpoint_fallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grada.wal")
+	d := NewDashboard(WithWAL(WALConfig{Path: path, CheckpointInterval: time.Hour}))
+	waitForRun(t, d)
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	m.AddCount(Count{1, time.Unix(1, 0)})
+	d.srv.checkpoint() // becomes the previous checkpoint
+	m.AddCount(Count{2, time.Unix(2, 0)})
+	d.Shutdown(context.Background())
+
+	// Damage the checkpoint and remove the log, so that only the
+	// previous checkpoint has data.
+	cp := checkpointPath(path)
+	b, err := os.ReadFile(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(checkpointHeader)+3] ^= 1
+	os.WriteFile(cp, b, 0644)
+	if _, err := readCheckpoint(cp); !errors.Is(err, errBadChecksum) {
+		t.Errorf("readCheckpoint() of a damaged file: error %v, want errBadChecksum", err)
+	}
+	os.Remove(path)
+	os.Remove(path + ".1")
+
+	d = NewDashboard(WithWAL(WALConfig{Path: path}))
+	defer d.Shutdown(context.Background())
+	if !d.srv.loadCheckpoint(path) {
+		t.Fatal("loadCheckpoint() found no checkpoint")
+	}
+	if diff := cmp.Diff([]float64{1}, values(t, d, "cpu")); diff != "" {
+		t.Errorf("values mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"ok", checkpointHeader + "m 2 \"a\"\n1 2 \"a\"\n", false},
+		{"noHeader", "m 2 \"a\"\n", true},
+		{"noMetric", checkpointHeader + "1 2 \"a\"\n", true},
+		{"badSize", checkpointHeader + "m 0 \"a\"\n", true},
+		{"badLine", checkpointHeader + "m 2 \"a\"\nx\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			writeCheckpoint(path, appendChecksum([]byte(tt.content)))
+			_, err := readCheckpoint(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readCheckpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package grada
+
+// Clusters of servers that share the targets.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// clusterHeader marks the requests that the nodes of a cluster send to
+// each other. Nodes answer them from their own targets only.
+const clusterHeader = "X-Grada-Cluster"
+
+// ClusterConfig configures WithCluster.
+type ClusterConfig struct {
+	// Self is the base URL of this node, as the other nodes reach it.
+	Self string
+	// Nodes are the base URLs of all nodes of the cluster, including
+	// Self, as in "http://node1:3001". All nodes must have the same list.
+	Nodes []string
+	// VirtualNodes is the number of points of each node on the hash ring.
+	// More points spread the targets more evenly. Default is 100.
+	VirtualNodes int
+	// Client sends the requests to other nodes. Default is
+	// http.DefaultClient.
+	Client *http.Client
+	// Header is added to every request to other nodes, for example for
+	// authorization.
+	Header http.Header
+}
+
+// WithCluster makes the server a node of a cluster that shares the work
+// of a very large number of targets. Each target belongs to one node,
+// chosen by consistent hashing of the target name, so that adding or
+// removing a node moves only the targets of a share of the ring. Any node
+// answers Grafana's requests:
+//
+//   - /query fans out to the nodes that own the targets of the query,
+//     and merges their responses, grouped by node. Merged responses are
+//     always JSON.
+//   - /search returns the target names of all nodes, sorted. Grouped
+//     searches (see Dashboard.SetCategories) return the targets of the
+//     node only.
+//
+// Producers write the data points of a target to the node that
+// Dashboard.Owner returns, for example through its /push endpoint.
+// Expressions are evaluated by the node that owns the text of the
+// expression, so they see only the metrics of that node.
+func WithCluster(cfg ClusterConfig) Option {
+	return func(srv *server) {
+		srv.cluster = newCluster(cfg)
+	}
+}
+
+// Owner returns the base URL of the node of the cluster that owns
+// target, or "" if the server is not a node of a cluster.
+// See WithCluster.
+func (d *Dashboard) Owner(target string) string {
+	if d.srv.cluster == nil {
+		return ""
+	}
+	return d.srv.cluster.owner(target)
+}
+
+// cluster is the configuration and hash ring of a cluster.
+type cluster struct {
+	self   string
+	client *http.Client
+	header http.Header
+	ring   []ringPoint // sorted by hash
+}
+
+// ringPoint is a point of a node on the hash ring.
+type ringPoint struct {
+	hash uint32
+	node string
+}
+
+// newCluster builds the hash ring of the nodes.
+func newCluster(cfg ClusterConfig) *cluster {
+	c := &cluster{
+		self:   strings.TrimSuffix(cfg.Self, "/"),
+		client: cfg.Client,
+		header: cfg.Header,
+	}
+	if c.client == nil {
+		c.client = http.DefaultClient
+	}
+	virtual := cfg.VirtualNodes
+	if virtual <= 0 {
+		virtual = 100
+	}
+	nodes := map[string]bool{}
+	if c.self != "" {
+		nodes[c.self] = true
+	}
+	for _, n := range cfg.Nodes {
+		nodes[strings.TrimSuffix(n, "/")] = true
+	}
+	for n := range nodes {
+		for i := 0; i < virtual; i++ {
+			c.ring = append(c.ring, ringPoint{crc32.ChecksumIEEE([]byte(n + "#" + strconv.Itoa(i))), n})
+		}
+	}
+	sort.Slice(c.ring, func(i, j int) bool {
+		if c.ring[i].hash != c.ring[j].hash {
+			return c.ring[i].hash < c.ring[j].hash
+		}
+		return c.ring[i].node < c.ring[j].node
+	})
+	return c
+}
+
+// owner returns the node that owns target: the node of the first point
+// on the ring at or after the hash of target.
+func (c *cluster) owner(target string) string {
+	h := crc32.ChecksumIEEE([]byte(target))
+	i := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= h })
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.ring[i].node
+}
+
+// post sends body to the endpoint of node and decodes the JSON response
+// into v.
+func (c *cluster) post(ctx context.Context, node, endpoint string, body []byte, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", node+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vs := range c.header {
+		req.Header[k] = vs
+	}
+	req.Header.Set(clusterHeader, "1")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{endpoint, resp.Status, resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// clusterSearch adds the target names that match q on all other nodes
+// to targets, and sorts them. Nodes that fail are logged and left out.
+func (srv *server) clusterSearch(ctx context.Context, q string, targets []string) []string {
+	c := srv.cluster
+	body, _ := json.Marshal(map[string]string{"target": q})
+	all := map[string]bool{}
+	for _, t := range targets {
+		all[t] = true
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range c.nodes() {
+		if node == c.self {
+			continue
+		}
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			var list []string
+			if err := c.post(ctx, node, "/search", body, &list); err != nil {
+				if srv.logger != nil {
+					srv.logger.Printf("grada: cluster search on %s: %v", node, err)
+				}
+				return
+			}
+			mu.Lock()
+			for _, t := range list {
+				all[t] = true
+			}
+			mu.Unlock()
+		}(node)
+	}
+	wg.Wait()
+	merged := make([]string, 0, len(all))
+	for t := range all {
+		merged = append(merged, t)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// nodes returns the nodes of the cluster, sorted.
+func (c *cluster) nodes() []string {
+	seen := map[string]bool{}
+	var nodes []string
+	for _, p := range c.ring {
+		if !seen[p.node] {
+			seen[p.node] = true
+			nodes = append(nodes, p.node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// clusterQueries fans /query requests out to the nodes that own their
+// targets, with h answering for the targets of this node.
+func (srv *server) clusterQueries(h http.HandlerFunc) http.HandlerFunc {
+	if srv.cluster == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(clusterHeader) != "" {
+			h(w, r)
+			return
+		}
+		body, err := readQueryBody(w, r)
+		r.Body = replayBody(body, err)
+		if err != nil {
+			h(w, r) // let h report the error
+			return
+		}
+		var q map[string]json.RawMessage
+		var raw []json.RawMessage
+		var targets []struct {
+			Target string `json:"target"`
+			Hide   bool   `json:"hide"`
+		}
+		if json.Unmarshal(body, &q) != nil || json.Unmarshal(q["targets"], &raw) != nil ||
+			json.Unmarshal(q["targets"], &targets) != nil {
+			h(w, r)
+			return
+		}
+
+		// Group the targets by node, in the order of their first target.
+		// Hidden targets go nowhere.
+		var nodes []string
+		byNode := map[string][]json.RawMessage{}
+		for i, t := range targets {
+			if t.Hide {
+				continue
+			}
+			node := srv.cluster.owner(t.Target)
+			if _, ok := byNode[node]; !ok {
+				nodes = append(nodes, node)
+			}
+			byNode[node] = append(byNode[node], raw[i])
+		}
+		if len(nodes) <= 1 && (len(nodes) == 0 || nodes[0] == srv.cluster.self) {
+			h(w, r)
+			return
+		}
+		bodies := make([][]byte, len(nodes))
+		for i, node := range nodes {
+			q["targets"], _ = json.Marshal(byNode[node])
+			bodies[i], _ = json.Marshal(q)
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		results := make([][]json.RawMessage, len(nodes))
+		errs := make([]error, len(nodes))
+		var wg sync.WaitGroup
+		self := -1
+		for i, node := range nodes {
+			if node == srv.cluster.self {
+				self = i
+				continue
+			}
+			wg.Add(1)
+			go func(i int, node string) {
+				defer wg.Done()
+				errs[i] = srv.cluster.post(ctx, node, "/query", bodies[i], &results[i])
+			}(i, node)
+		}
+		local := &bufferWriter{header: http.Header{}}
+		if self >= 0 {
+			lr := r.Clone(ctx)
+			lr.Body = io.NopCloser(bytes.NewReader(bodies[self]))
+			lr.ContentLength = int64(len(bodies[self]))
+			lr.Header.Del("Accept") // merging needs JSON
+			h(local, lr)
+			if local.status != http.StatusOK && local.status != 0 {
+				cancel()
+				wg.Wait()
+				for k, vs := range local.header {
+					w.Header()[k] = vs
+				}
+				w.WriteHeader(local.status)
+				w.Write(local.body.Bytes())
+				return
+			}
+			errs[self] = json.Unmarshal(local.body.Bytes(), &results[self])
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err, "cannot query cluster node "+nodes[i])
+				return
+			}
+		}
+
+		if local.header.Get(PartialHeader) != "" {
+			w.Header().Set(PartialHeader, local.header.Get(PartialHeader))
+		}
+		merged := []json.RawMessage{}
+		for _, list := range results {
+			merged = append(merged, list...)
+		}
+		resp, err := json.Marshal(merged)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err, "cannot marshal cluster response")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	}
+}
+
+// bufferWriter is a ResponseWriter that keeps the response in memory.
+type bufferWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferWriter) Header() http.Header { return bw.header }
+
+// WriteHeader records the first status. A handler that writes nothing
+// responds with 200 OK.
+func (bw *bufferWriter) WriteHeader(status int) {
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+func (bw *bufferWriter) Write(b []byte) (int, error) {
+	bw.WriteHeader(http.StatusOK)
+	return bw.body.Write(b)
+}
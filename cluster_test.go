@@ -0,0 +1,161 @@
+package grada
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCluster_owner(t *testing.T) {
+	nodes := []string{"http://a", "http://b", "http://c"}
+	three := newCluster(ClusterConfig{Self: "http://a/", Nodes: nodes})
+	two := newCluster(ClusterConfig{Self: "http://a", Nodes: nodes[:2]})
+	if diff := cmp.Diff(nodes, three.nodes()); diff != "" {
+		t.Errorf("nodes() mismatch (-want +got):\n%s", diff)
+	}
+	owned := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		target := fmt.Sprintf("target.%d", i)
+		owner := three.owner(target)
+		owned[owner]++
+		// Removing c moves only the targets of c.
+		if owner != "http://c" && two.owner(target) != owner {
+			t.Errorf("%s moved from %s to %s", target, owner, two.owner(target))
+		}
+	}
+	for _, n := range nodes {
+		if owned[n] < 500 {
+			t.Errorf("%s owns %d of 3000 targets", n, owned[n])
+		}
+	}
+}
+
+// testCluster starts the nodes of a cluster.
+func testCluster(t *testing.T, n int) ([]*Dashboard, []*httptest.Server) {
+	t.Helper()
+	dashboards := make([]*Dashboard, n)
+	servers := make([]*httptest.Server, n)
+	urls := make([]string, n)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dashboards[i].Handler().ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[i].Close)
+		urls[i] = servers[i].URL
+	}
+	for i := range dashboards {
+		dashboards[i] = NewDashboard(WithCluster(ClusterConfig{Self: urls[i], Nodes: urls}))
+	}
+	return dashboards, servers
+}
+
+func TestServer_clusterQueries(t *testing.T) {
+	dashboards, servers := testCluster(t, 3)
+	byURL := map[string]*Dashboard{}
+	for i, s := range servers {
+		byURL[s.URL] = dashboards[i]
+	}
+	var targets []string
+	for i := 0; i < 12; i++ {
+		target := fmt.Sprintf("target.%d", i)
+		targets = append(targets, target)
+		byURL[dashboards[0].Owner(target)].Add(target, float64(i))
+	}
+
+	var query struct {
+		Range struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+		} `json:"range"`
+		Targets       []map[string]string `json:"targets"`
+		MaxDataPoints int                 `json:"maxDataPoints"`
+	}
+	query.Range.From, query.Range.To = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	query.MaxDataPoints = 100
+	for _, target := range targets {
+		query.Targets = append(query.Targets, map[string]string{"target": target, "type": "timeserie"})
+	}
+	body, _ := json.Marshal(query)
+
+	for i, s := range servers {
+		t.Run(fmt.Sprint("node", i), func(t *testing.T) {
+			resp, err := s.Client().Post(s.URL+"/query", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("POST /query: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %s", resp.Status)
+			}
+			var series []struct {
+				Target     string      `json:"target"`
+				Datapoints [][]float64 `json:"datapoints"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&series); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			var got []string
+			for _, s := range series {
+				if len(s.Datapoints) != 1 || fmt.Sprintf("target.%g", s.Datapoints[0][0]) != s.Target {
+					t.Errorf("series %s has data points %v", s.Target, s.Datapoints)
+				}
+				got = append(got, s.Target)
+			}
+			sort.Strings(got)
+			want := append([]string(nil), targets...)
+			sort.Strings(want)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("targets mismatch (-want +got):\n%s", diff)
+			}
+
+			resp, err = s.Client().Post(s.URL+"/search", "application/json", strings.NewReader(`{"target": ""}`))
+			if err != nil {
+				t.Fatalf("POST /search: %v", err)
+			}
+			defer resp.Body.Close()
+			got = nil
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding search response: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("search mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServer_clusterQueries_nodeDown(t *testing.T) {
+	dashboards, servers := testCluster(t, 2)
+	servers[1].Close()
+	var remote string
+	for i := 0; remote == ""; i++ {
+		if target := fmt.Sprint("target.", i); dashboards[0].Owner(target) == servers[1].URL {
+			remote = target
+		}
+	}
+	body := `{"targets": [{"target": "` + remote + `"}]}`
+	w := httptest.NewRecorder()
+	dashboards[0].Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if got := NewDashboard().Owner(remote); got != "" {
+		t.Errorf("Owner() without cluster = %q", got)
+	}
+
+	large := `{"targets": [{"target": "` + remote + `"}], "pad": "` + strings.Repeat("x", maxQueryBytes) + `"}`
+	w = httptest.NewRecorder()
+	dashboards[0].Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(large)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status for a body over maxQueryBytes %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
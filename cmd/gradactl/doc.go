@@ -0,0 +1,41 @@
+/*
+Gradactl talks to a running grada server from the command line, for
+debugging dashboards and for scripts.
+
+Usage:
+
+	gradactl [flags] <command> [arguments]
+
+The commands are:
+
+	targets [text]                    list the targets, searching for text as Grafana does
+	query [-from t] [-to t] [-max n] target...
+	                                  print the data points of time series
+	push [-time t] target value...    add data points to a metric
+	table [-from t] [-to t] target... print table targets as text tables
+	doctor [-target target]           check that the server speaks Grafana's protocol
+	replay [-speed x] [-shift] file   send the requests of a recording to the server
+
+The flags are:
+
+	-url    the address of the server (default http://localhost:3001,
+	        or the port in $GRADA_PORT)
+	-token  a bearer token for servers that authenticate clients
+
+Times are "now", a duration relative to now such as "-1h", an RFC 3339
+time stamp, or Unix milliseconds. query prints one line per data point,
+with the target, the time in RFC 3339, and the value, separated by tabs.
+
+doctor does what Grafana does when it tests a data source and draws a
+panel: it requests /, /search, and /query for the last hour of the
+target, or of the first target that /search returns. It prints one line
+per check, starting with "ok", "warn", or "FAIL", that explains problems
+such as missing endpoints, responses that are not JSON, and time stamps
+that are not Unix milliseconds. It fails if any check fails.
+
+replay reads a recording of grada.WithRecorder from file, or from the
+standard input if file is "-", and sends its requests at the pace of the
+recording times -speed; -speed 0 sends them without pauses. -shift moves
+the time ranges of the queries by the time since they were recorded.
+*/
+package main
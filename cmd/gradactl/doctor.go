@@ -0,0 +1,207 @@
+package main
+
+// The doctor command checks that a server speaks the protocol of
+// Grafana's SimpleJSON data source.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Plausible Unix milliseconds, between 1973 and 5138. Seconds and
+// nanoseconds of today lie outside.
+const minMillis, maxMillis = 1e11, 1e14
+
+// checkup collects the results of the checks of the doctor command.
+type checkup struct {
+	out      io.Writer
+	failures int
+}
+
+// ok reports a passed check.
+func (cu *checkup) ok(check, format string, args ...interface{}) {
+	fmt.Fprintf(cu.out, "ok    %s: %s\n", check, fmt.Sprintf(format, args...))
+}
+
+// warn reports a problem that Grafana tolerates.
+func (cu *checkup) warn(check, format string, args ...interface{}) {
+	fmt.Fprintf(cu.out, "warn  %s: %s\n", check, fmt.Sprintf(format, args...))
+}
+
+// fail reports a problem that breaks Grafana.
+func (cu *checkup) fail(check, format string, args ...interface{}) {
+	cu.failures++
+	fmt.Fprintf(cu.out, "FAIL  %s: %s\n", check, fmt.Sprintf(format, args...))
+}
+
+// response checks the status and the content type of the response to
+// a check, and reports whether the check can go on.
+func (cu *checkup) response(check string, resp *http.Response, body []byte, err error, wantJSON bool) bool {
+	if err != nil {
+		cu.fail(check, "%v; check the URL and that the server is running", err)
+		return false
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		cu.fail(check, "404 Not Found; the server does not serve this endpoint, or the URL lacks its path prefix")
+		return false
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		cu.fail(check, "%s; pass credentials with -token, and configure them in the Grafana data source", resp.Status)
+		return false
+	case resp.StatusCode != http.StatusOK:
+		msg := errorMessage(body)
+		if msg == "" {
+			msg = strings.TrimSpace(string(body))
+		}
+		cu.fail(check, "%s, want 200 OK: %s", resp.Status, msg)
+		return false
+	}
+	if wantJSON {
+		ct := resp.Header.Get("Content-Type")
+		if mt, _, _ := mime.ParseMediaType(ct); mt != "application/json" {
+			cu.warn(check, "Content-Type %q, want application/json; proxies and clients other than Grafana may reject the response", ct)
+		}
+	}
+	return true
+}
+
+// doctor simulates Grafana's test of the data source and a round trip
+// of /search and /query, and reports the problems it finds.
+func (c *client) doctor(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	target := fs.String("target", "", "the target to query; default is the first target of /search")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cu := &checkup{out: out}
+
+	// "Save & test" of the data source.
+	check := "GET /"
+	resp, body, err := c.send("GET", "/", nil)
+	if cu.response(check, resp, body, err, false) {
+		cu.ok(check, "the data source test of Grafana succeeds")
+	}
+
+	check = "POST /search"
+	resp, body, err = c.send("POST", "/search", map[string]string{"target": ""})
+	if cu.response(check, resp, body, err, true) {
+		if t := cu.search(check, body); *target == "" {
+			*target = t
+		}
+	}
+
+	if *target == "" {
+		cu.warn("POST /query", "skipped, as there is no target to query; use -target")
+	} else {
+		c.checkQuery(cu, *target)
+	}
+
+	if cu.failures > 0 {
+		return fmt.Errorf("%d problems found", cu.failures)
+	}
+	return nil
+}
+
+// search checks a /search response and returns its first target.
+func (cu *checkup) search(check string, body []byte) string {
+	var list []json.RawMessage
+	if err := json.Unmarshal(body, &list); err != nil {
+		cu.fail(check, "the response is not a JSON array: %v", err)
+		return ""
+	}
+	var first string
+	for i, raw := range list {
+		// Targets are strings, or objects with text and value.
+		var s string
+		var o struct {
+			Text  *string     `json:"text"`
+			Value interface{} `json:"value"`
+		}
+		switch {
+		case json.Unmarshal(raw, &s) == nil:
+		case json.Unmarshal(raw, &o) == nil && o.Text != nil:
+			s = fmt.Sprint(o.Value)
+		default:
+			cu.fail(check, "element %d is %s, want a string or an object with text and value", i, raw)
+			return ""
+		}
+		if i == 0 {
+			first = s
+		}
+	}
+	if len(list) == 0 {
+		cu.warn(check, "no targets; panels have no metrics to choose from")
+		return ""
+	}
+	cu.ok(check, "%d targets", len(list))
+	return first
+}
+
+// checkQuery checks a /query round trip for target over the last hour.
+func (c *client) checkQuery(cu *checkup, target string) {
+	check := fmt.Sprintf("POST /query %q", target)
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	q := &queryRequest{MaxDataPoints: 100, Targets: []queryTarget{{Target: target, RefID: "A", Type: "timeserie"}}}
+	q.Range.From, q.Range.To = from, to
+	resp, body, err := c.send("POST", "/query", q)
+	if !cu.response(check, resp, body, err, true) {
+		return
+	}
+	var list []struct {
+		Target     *string             `json:"target"`
+		Datapoints [][]json.RawMessage `json:"datapoints"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		cu.fail(check, "the response is not an array of series with target and datapoints: %v", err)
+		return
+	}
+	if len(list) == 0 {
+		cu.fail(check, "no series; Grafana shows \"No data\"")
+		return
+	}
+	points, problems := 0, cu.failures
+	for _, s := range list {
+		if s.Target == nil {
+			cu.fail(check, "a series has no \"target\"; Grafana cannot name it")
+		}
+		var last float64
+		for j, p := range s.Datapoints {
+			var v *float64
+			var t float64
+			if len(p) != 2 || json.Unmarshal(p[0], &v) != nil || json.Unmarshal(p[1], &t) != nil {
+				cu.fail(check, "data point %d is %s, want [value, Unix milliseconds]", j, p)
+				return
+			}
+			switch {
+			case t > 0 && t < minMillis:
+				cu.fail(check, "time stamp %.0f looks like Unix seconds; Grafana expects milliseconds", t)
+				return
+			case t >= maxMillis:
+				cu.fail(check, "time stamp %.0f looks like Unix micro- or nanoseconds; Grafana expects milliseconds", t)
+				return
+			case t < last:
+				cu.warn(check, "data points are not in time order; Grafana draws lines back and forth")
+			case t < float64(from.UnixMilli()) || t > float64(to.UnixMilli()):
+				cu.warn(check, "time stamp %s is outside the requested range; check the time zone of the server", time.UnixMilli(int64(t)).UTC().Format(time.RFC3339))
+			}
+			last = t
+			points++
+		}
+	}
+	if cu.failures > problems {
+		return
+	}
+	if points == 0 {
+		cu.warn(check, "%d series without data points in the last hour; Grafana shows \"No data\"", len(list))
+		return
+	}
+	cu.ok(check, "%d series, %d data points", len(list), points)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+func TestDoctor(t *testing.T) {
+	d := grada.NewDashboard()
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	m.Add(0.5)
+
+	// fake serves search and query responses as given, as text/plain if
+	// plain is set.
+	fake := func(search, query string, plain bool) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if plain {
+				w.Header().Set("Content-Type", "text/plain")
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+			}
+			switch r.URL.Path {
+			case "/":
+			case "/search":
+				fmt.Fprint(w, search)
+			case "/query":
+				if query == "" {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, query)
+			default:
+				http.NotFound(w, r)
+			}
+		})
+	}
+	now := time.Now()
+	series := func(t int64) string { return fmt.Sprintf(`[{"target":"a","datapoints":[[1,%d]]}]`, t) }
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"grada", d.Handler(), nil, []string{"ok    GET /", "ok    POST /search: 1 targets", `ok    POST /query "cpu": 1 series, 1 data points`}, false},
+		{"object targets", fake(`[{"text":"A","value":"a"}]`, series(now.UnixMilli()), false), nil, []string{"ok    POST /search: 1 targets", `ok    POST /query "a"`}, false},
+		{"no query endpoint", fake(`["a"]`, "", false), nil, []string{`FAIL  POST /query "a": 404 Not Found`}, true},
+		{"text/plain", fake(`["a"]`, series(now.UnixMilli()), true), nil, []string{"warn  POST /search: Content-Type \"text/plain\""}, false},
+		{"seconds", fake(`["a"]`, series(now.Unix()), false), nil, []string{"looks like Unix seconds"}, true},
+		{"nanoseconds", fake(`["a"]`, series(now.UnixNano()), false), nil, []string{"looks like Unix micro- or nanoseconds"}, true},
+		{"bad search", fake(`{"a":1}`, "", false), []string{"-target", "b"}, []string{"FAIL  POST /search: the response is not a JSON array", `FAIL  POST /query "b"`}, true},
+		{"no targets", fake(`[]`, "", false), nil, []string{"warn  POST /search: no targets", "warn  POST /query: skipped"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			var out bytes.Buffer
+			err := run(append([]string{"-url", srv.URL, "doctor"}, tt.args...), &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, want error %v", err, tt.wantErr)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("output:\n%s\nwant a line with %q", out.String(), w)
+				}
+			}
+		})
+	}
+}
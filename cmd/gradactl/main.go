@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "gradactl:", err)
+		os.Exit(1)
+	}
+}
+
+// errUsage is returned for invalid command lines.
+var errUsage = errors.New("usage: gradactl [-url url] [-token token] targets|query|push|table|doctor|replay [arguments]")
+
+// run executes the command line args and writes its output to out.
+func run(args []string, out io.Writer) error {
+	port := "3001"
+	if p := os.Getenv("GRADA_PORT"); p != "" {
+		port = p
+	}
+	fs := flag.NewFlagSet("gradactl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c := &client{http: &http.Client{Timeout: 30 * time.Second}}
+	fs.StringVar(&c.url, "url", "http://localhost:"+port, "address of the grada server")
+	fs.StringVar(&c.token, "token", "", "bearer token")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%w", err, errUsage)
+	}
+	c.url = strings.TrimSuffix(c.url, "/")
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "targets":
+		return c.targets(args, out)
+	case "query":
+		return c.query(args, out)
+	case "push":
+		return c.push(args, out)
+	case "table":
+		return c.table(args, out)
+	case "doctor":
+		return c.doctor(args, out)
+	case "replay":
+		return c.replay(args, out)
+	}
+	return fmt.Errorf("unknown command %q\n%w", cmd, errUsage)
+}
+
+// client sends requests to a grada server.
+type client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// do sends a request with the JSON encoding of body, unless body is nil,
+// and decodes the JSON response into v, unless v is nil.
+func (c *client) do(method, path string, body, v interface{}) error {
+	resp, b, err := c.send(method, path, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		if msg := errorMessage(b); msg != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, msg)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", method, path, err)
+	}
+	return nil
+}
+
+// send sends a request with the JSON encoding of body, unless body is
+// nil, and returns the response with its body.
+func (c *client) send(method, path string, body interface{}) (*http.Response, []byte, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.url+path, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return resp, b, err
+}
+
+// errorMessage returns the message of a grada error response, or "".
+func errorMessage(b []byte) string {
+	var e struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(b, &e)
+	return e.Error
+}
+
+// targets prints the targets that /search returns for the optional text.
+func (c *client) targets(args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	var req struct {
+		Target string `json:"target"`
+	}
+	if len(args) == 1 {
+		req.Target = args[0]
+	}
+	var targets []string
+	if err := c.do("POST", "/search", req, &targets); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		fmt.Fprintln(out, t)
+	}
+	return nil
+}
+
+// queryTarget is a target of a /query request.
+type queryTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+// queryRequest is a /query request.
+type queryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	MaxDataPoints int           `json:"maxDataPoints"`
+	Targets       []queryTarget `json:"targets"`
+}
+
+// rangeFlags adds the flags -from and -to to fs and returns a function that
+// creates a query for the targets of the command line of fs.
+func rangeFlags(fs *flag.FlagSet) func(targetType string) (*queryRequest, error) {
+	from := fs.String("from", "-1h", "start of the time range")
+	to := fs.String("to", "now", "end of the time range")
+	return func(targetType string) (*queryRequest, error) {
+		if fs.NArg() == 0 {
+			return nil, errUsage
+		}
+		now := time.Now()
+		q := &queryRequest{}
+		var err error
+		if q.Range.From, err = parseTime(*from, now); err != nil {
+			return nil, err
+		}
+		if q.Range.To, err = parseTime(*to, now); err != nil {
+			return nil, err
+		}
+		for i, t := range fs.Args() {
+			q.Targets = append(q.Targets, queryTarget{Target: t, RefID: string(rune('A' + i%26)), Type: targetType})
+		}
+		return q, nil
+	}
+}
+
+// query prints the data points of time series targets.
+func (c *client) query(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	newQuery := rangeFlags(fs)
+	maxDataPoints := fs.Int("max", 1000, "most data points per target")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	q, err := newQuery("timeserie")
+	if err != nil {
+		return err
+	}
+	q.MaxDataPoints = *maxDataPoints
+	var resp []struct {
+		Target     string        `json:"target"`
+		Datapoints [][2]*float64 `json:"datapoints"`
+	}
+	if err := c.do("POST", "/query", q, &resp); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, s := range resp {
+		for _, p := range s.Datapoints {
+			v := "null"
+			if p[0] != nil {
+				v = strconv.FormatFloat(*p[0], 'g', -1, 64)
+			}
+			t := ""
+			if p[1] != nil {
+				t = time.UnixMilli(int64(*p[1])).UTC().Format(time.RFC3339Nano)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Target, t, v)
+		}
+	}
+	return w.Flush()
+}
+
+// push adds values to a metric.
+func (c *client) push(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("push", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	at := fs.String("time", "now", "time of the data points")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errUsage
+	}
+	t, err := parseTime(*at, time.Now())
+	if err != nil {
+		return err
+	}
+	type sample struct {
+		Target string  `json:"target"`
+		Value  float64 `json:"value"`
+		Time   int64   `json:"time"`
+	}
+	var samples []sample
+	for _, s := range fs.Args()[1:] {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", s)
+		}
+		samples = append(samples, sample{fs.Arg(0), v, t.UnixMilli()})
+	}
+	if err := c.do("POST", "/push", samples, nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "pushed %d data points to %s\n", len(samples), fs.Arg(0))
+	return nil
+}
+
+// replay sends the requests of a recording to the server.
+func (c *client) replay(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg := grada.ReplayConfig{Client: c.http}
+	fs.Float64Var(&cfg.Speed, "speed", 1, "pace relative to the recording; 0 sends without pauses")
+	fs.BoolVar(&cfg.ShiftRanges, "shift", false, "move time ranges to the present")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if c.token != "" {
+		cfg.Header = http.Header{"Authorization": {"Bearer " + c.token}}
+	}
+	sent, failed, err := grada.Replay(context.Background(), r, c.url, cfg)
+	fmt.Fprintf(out, "replayed %d requests, %d failed\n", sent, failed)
+	return err
+}
+
+// table prints table targets as text tables.
+func (c *client) table(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("table", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	newQuery := rangeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	q, err := newQuery("table")
+	if err != nil {
+		return err
+	}
+	var resp []struct {
+		Name    string `json:"name"`
+		Columns []struct {
+			Text string `json:"text"`
+		} `json:"columns"`
+		Rows [][]interface{} `json:"rows"`
+	}
+	if err := c.do("POST", "/query", q, &resp); err != nil {
+		return err
+	}
+	for i, table := range resp {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if table.Name != "" {
+			fmt.Fprintf(out, "%s:\n", table.Name)
+		}
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		cells := make([]string, len(table.Columns))
+		for j, col := range table.Columns {
+			cells[j] = col.Text
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+		for _, row := range table.Rows {
+			cells = cells[:0]
+			for _, v := range row {
+				cells = append(cells, formatCell(v))
+			}
+			fmt.Fprintln(w, strings.Join(cells, "\t"))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatCell formats a JSON value of a table cell.
+func formatCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// parseTime parses "now", a duration relative to now, an RFC 3339 time
+// stamp, or Unix milliseconds.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+func TestRun(t *testing.T) {
+	d := grada.NewDashboard()
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	m.AddWithTime(0.5, t0)
+	d.CreateMetricWithBufSize("mem", 10)
+	d.CreateTable("hosts", func(from, to time.Time) (*grada.Table, error) {
+		return &grada.Table{
+			Columns: []grada.Column{{Text: "host", Type: "string"}, {Text: "load", Type: "number"}},
+			Rows:    [][]interface{}{{"web-1", 0.25}, {"db", 1.5}},
+		}, nil
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{"targets", []string{"targets"}, "cpu\nhosts\nmem\n", ""},
+		{"query", []string{"query", "-from", "2017-10-25T11:00:00Z", "-to", "1508932800000", "cpu"},
+			"cpu  2017-10-25T11:16:54Z  0.5\n", ""},
+		{"push", []string{"push", "-time", "2017-10-25T11:16:55Z", "mem", "1", "2"}, "pushed 2 data points to mem\n", ""},
+		{"table", []string{"table", "hosts"}, "host   load\nweb-1  0.25\ndb     1.5\n", ""},
+		{"unknown target", []string{"query", "nope"}, "", "404 Not Found: Cannot get metric for target nope"},
+		{"bad value", []string{"push", "mem", "x"}, "", `invalid value "x"`},
+		{"bad time", []string{"query", "-from", "yesterday", "cpu"}, "", `invalid time "yesterday"`},
+		{"unknown command", []string{"frobnicate"}, "", `unknown command "frobnicate"`},
+		{"no command", nil, "", "usage: gradactl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(append([]string{"-url", srv.URL}, tt.args...), &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("run() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"-url", srv.URL, "query", "-from", "2017-10-25T11:00:00Z", "mem"}, &out); err != nil ||
+		out.String() != "mem  2017-10-25T11:16:55Z  1\nmem  2017-10-25T11:16:55Z  2\n" {
+		t.Errorf("mem after push: %q, %v", out.String(), err)
+	}
+	if err := run([]string{"-url", srv.URL}, &bytes.Buffer{}); !errors.Is(err, errUsage) {
+		t.Errorf("run() without command: error = %v, want errUsage", err)
+	}
+}
+
+func TestRun_replay(t *testing.T) {
+	d := grada.NewDashboard()
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+	d.CreateMetricWithBufSize("cpu", 10)
+	f := filepath.Join(t.TempDir(), "recording.jsonl")
+	os.WriteFile(f, []byte(`{"time":1508929200000,"method":"POST","path":"/search","body":{"target":""}}
+{"time":1508929200001,"method":"POST","path":"/query","body":{"targets":[{"target":"cpu"}]}}
+{"time":1508929200002,"method":"POST","path":"/query","body":{"targets":[{"target":"nope"}]}}
+`), 0644)
+	var out bytes.Buffer
+	if err := run([]string{"-url", srv.URL, "replay", "-speed", "0", f}, &out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if want := "replayed 3 requests, 1 failed\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,401 @@
+package grada
+
+// Collectors and their scheduler.
+//
+// GET /collectors returns the status of all collectors:
+//
+//	[{"name": "db", "interval": 10000, "running": false, "runs": 42,
+//	  "lastRun": 1508929014000, "duration": 12.5, "samples": 4,
+//	  "nextRun": 1508929024000, "error": "..."}, ...]
+//
+// Times are Unix milliseconds, interval and duration are milliseconds.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a data point that a Collector delivers for a target.
+type Sample struct {
+	Target string
+	N      float64
+	T      time.Time // the time of collection if zero
+}
+
+// Collector collects data points at regular intervals, such as the
+// readings of a sensor or the statistics of a connection pool.
+// See Dashboard.AddCollector.
+type Collector interface {
+	// Name identifies the collector.
+	Name() string
+	// Interval is the time between two collections. Intervals that are
+	// not positive default to 10 seconds.
+	Interval() time.Duration
+	// Collect returns the current data points. ctx is canceled when the
+	// interval has passed or the dashboard shuts down.
+	Collect(ctx context.Context) []Sample
+}
+
+// defaultCollectInterval replaces intervals that are not positive.
+const defaultCollectInterval = 10 * time.Second
+
+// CollectorOption configures the schedule of a collector.
+// See Dashboard.AddCollector.
+type CollectorOption func(*collectorEntry)
+
+// Jitter delays every run of a collector by a random duration of up to max,
+// so that collectors with the same interval do not all run at once.
+func Jitter(max time.Duration) CollectorOption {
+	return func(e *collectorEntry) {
+		e.jitter = max
+	}
+}
+
+// Aligned runs a collector at multiples of its interval since the zero
+// time, for example every minute on the minute, so that the data points
+// of different collectors and applications line up. The first run waits
+// for the next multiple. Combine Aligned with Jitter to spread the runs
+// within a fixed offset from the multiples.
+func Aligned() CollectorOption {
+	return func(e *collectorEntry) {
+		e.aligned = true
+	}
+}
+
+// Cron runs a collector at the times of a cron expression rather than
+// every interval, such as "*/5 * * * *" for every five minutes or
+// "0 8-18 * * 1-5" for every working hour. The five fields are minute,
+// hour, day of month, month, and day of week (0 or 7 is Sunday), in local
+// time; each is "*", a number, a range "a-b", or a list of those, and "*"
+// and ranges may have a step, as in "*/15". The interval of the collector
+// still limits the duration of a collection. AddCollector fails if spec
+// is malformed or never matches.
+func Cron(spec string) CollectorOption {
+	return func(e *collectorEntry) {
+		c, err := parseCron(spec)
+		if err == nil && c.next(time.Now()).IsZero() {
+			err = fmt.Errorf("cron expression %q never matches", spec)
+		}
+		e.cron, e.err = c, err
+	}
+}
+
+// CollectorStatus is the status of a collector. See Dashboard.CollectorStatus.
+type CollectorStatus struct {
+	Name     string
+	Interval time.Duration
+	Running  bool          // a collection is in progress
+	Runs     int           // number of completed collections
+	LastRun  time.Time     // start of the last completed collection
+	Duration time.Duration // duration of the last completed collection
+	Samples  int           // number of samples of the last completed collection
+	Err      error         // failure of the last completed collection
+	NextRun  time.Time
+}
+
+// collectorResponse is an element of the response to a `/collectors` request.
+type collectorResponse struct {
+	Name     string  `json:"name"`
+	Interval int64   `json:"interval"`
+	Running  bool    `json:"running"`
+	Runs     int     `json:"runs"`
+	LastRun  int64   `json:"lastRun,omitempty"`
+	Duration float64 `json:"duration"`
+	Samples  int     `json:"samples"`
+	NextRun  int64   `json:"nextRun"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// errCollectTimeout is the failure of a collection that is still running
+// when its interval has passed.
+var errCollectTimeout = errors.New("collection took longer than the interval")
+
+// AddCollector schedules c to collect data points every c.Interval(),
+// starting now, and adds the data points to the metrics of their targets.
+// Metrics that do not exist yet are created as by Dashboard.Add.
+// Options such as Jitter, Aligned, and Cron change the schedule.
+//
+// A single scheduler runs all collectors of the dashboard, so that
+// applications need no ticker goroutine per data source. Each collection
+// runs in its own goroutine; if a collection takes longer than the
+// interval, the scheduler skips runs until it has finished.
+//
+// AddCollector fails with ErrCollectorExists if a collector of the same
+// name is registered.
+func (d *Dashboard) AddCollector(c Collector, opts ...CollectorOption) error {
+	return d.srv.collectors.add(d.srv, c, opts...)
+}
+
+// RemoveCollector stops scheduling the collector of the given name.
+// A collection in progress finishes. RemoveCollector fails with
+// ErrCollectorNotFound if no collector of this name is registered.
+func (d *Dashboard) RemoveCollector(name string) error {
+	return d.srv.collectors.remove(name)
+}
+
+// Collectors returns the names of all registered collectors, sorted.
+func (d *Dashboard) Collectors() []string {
+	s := &d.srv.collectors
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CollectorStatus returns the status of all registered collectors,
+// sorted by name. The server also responds with it to GET /collectors;
+// like the endpoints of WithPprof, /collectors responds with 403
+// Forbidden unless the server authenticates clients.
+func (d *Dashboard) CollectorStatus() []CollectorStatus {
+	return d.srv.collectors.status()
+}
+
+// collectorsHandler responds with the status of all collectors.
+func (srv *server) collectorsHandler(w http.ResponseWriter, r *http.Request) {
+	response := []collectorResponse{}
+	for _, s := range srv.collectors.status() {
+		cr := collectorResponse{
+			Name:     s.Name,
+			Interval: s.Interval.Milliseconds(),
+			Running:  s.Running,
+			Runs:     s.Runs,
+			Duration: float64(s.Duration) / float64(time.Millisecond),
+			Samples:  s.Samples,
+			NextRun:  s.NextRun.UnixNano() / int64(time.Millisecond),
+		}
+		if !s.LastRun.IsZero() {
+			cr.LastRun = s.LastRun.UnixNano() / int64(time.Millisecond)
+		}
+		if s.Err != nil {
+			cr.Error = s.Err.Error()
+		}
+		response = append(response, cr)
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal collectors response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// scheduler runs the collectors of a server.
+type scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*collectorEntry
+	wake    chan struct{}      // signals a new collector to the loop
+	cancel  context.CancelFunc // stops the loop and collections if running
+	wg      sync.WaitGroup     // the loop and collections in progress
+}
+
+// collectorEntry is a scheduled collector.
+type collectorEntry struct {
+	c        Collector
+	interval time.Duration
+	jitter   time.Duration // see Jitter
+	aligned  bool          // see Aligned
+	cron     *cronSchedule // see Cron
+	err      error         // invalid option
+	slot     time.Time     // time of the next run without jitter
+	next     time.Time     // time of the next run
+	running  bool          // a collection is in progress
+	status   CollectorStatus
+}
+
+// schedule sets the time of the next run to the slot t, or to the first
+// aligned or cron slot at or after t, plus jitter.
+func (e *collectorEntry) schedule(t time.Time) {
+	switch {
+	case e.cron != nil:
+		t = e.cron.next(t.Add(-time.Nanosecond))
+	case e.aligned:
+		if a := t.Truncate(e.interval); a.Before(t) {
+			t = a.Add(e.interval)
+		}
+	}
+	e.slot, e.next = t, t
+	if e.jitter > 0 {
+		e.next = t.Add(time.Duration(rand.Int63n(int64(e.jitter))))
+	}
+}
+
+// following returns the slot after the current one. Runs that were
+// missed because the scheduler is behind are skipped.
+func (e *collectorEntry) following(now time.Time) time.Time {
+	if e.cron != nil {
+		return e.cron.next(now)
+	}
+	slot := e.slot.Add(e.interval)
+	if !slot.After(now) {
+		slot = now.Add(e.interval)
+	}
+	return slot
+}
+
+// add registers c and starts the scheduler loop if needed.
+func (s *scheduler) add(srv *server, c Collector, opts ...CollectorOption) error {
+	e := &collectorEntry{c: c, interval: c.Interval()}
+	if e.interval <= 0 {
+		e.interval = defaultCollectInterval
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.err != nil {
+		return e.err
+	}
+	e.schedule(time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[c.Name()]; exists {
+		return fmt.Errorf("%w: %s", ErrCollectorExists, c.Name())
+	}
+	if s.entries == nil {
+		s.entries = map[string]*collectorEntry{}
+	}
+	s.entries[c.Name()] = e
+	if s.cancel == nil {
+		var ctx context.Context
+		ctx, s.cancel = context.WithCancel(context.Background())
+		s.wake = make(chan struct{}, 1)
+		s.wg.Add(1)
+		go s.loop(ctx, srv)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// remove unregisters the collector of the given name.
+func (s *scheduler) remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrCollectorNotFound, name)
+	}
+	delete(s.entries, name)
+	return nil
+}
+
+// stop stops the scheduler loop, cancels collections in progress, and
+// waits for them to return. A later add starts the loop again.
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		s.wg.Wait()
+	}
+}
+
+// loop starts the collections that are due, and sleeps until the next
+// one is due or a collector is added.
+func (s *scheduler) loop(ctx context.Context, srv *server) {
+	defer s.wg.Done()
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		var next time.Time
+		for _, e := range s.entries {
+			if !e.next.After(now) {
+				if !e.running {
+					e.running = true
+					s.wg.Add(1)
+					go s.collect(ctx, srv, e)
+				}
+				e.schedule(e.following(now))
+			}
+			if next.IsZero() || e.next.Before(next) {
+				next = e.next
+			}
+		}
+		s.mu.Unlock()
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = next.Sub(now)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// status returns the status of all collectors, sorted by name.
+func (s *scheduler) status() []CollectorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := make([]CollectorStatus, 0, len(s.entries))
+	for name, e := range s.entries {
+		st := e.status
+		st.Name, st.Interval, st.Running, st.NextRun = name, e.interval, e.running, e.next
+		status = append(status, st)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
+// collect runs a collection, adds its samples to metrics, and records
+// its status.
+func (s *scheduler) collect(ctx context.Context, srv *server, e *collectorEntry) {
+	defer s.wg.Done()
+	start := time.Now()
+	samples, err := s.run(ctx, srv, e, start)
+	if err != nil && srv.logger != nil {
+		srv.logger.Printf("grada: collector %q: %v", e.c.Name(), err)
+	}
+	s.mu.Lock()
+	e.running = false
+	e.status.Runs++
+	e.status.LastRun = start
+	e.status.Duration = time.Since(start)
+	e.status.Samples = samples
+	e.status.Err = err
+	s.mu.Unlock()
+}
+
+// run calls the collector and adds the samples to metrics. It returns the
+// number of samples, and an error if the collector panics or overruns
+// its interval.
+func (s *scheduler) run(ctx context.Context, srv *server, e *collectorEntry, start time.Time) (n int, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, e.interval)
+	defer cancel()
+	samples := e.c.Collect(ctx)
+	for _, sample := range samples {
+		if sample.T.IsZero() {
+			sample.T = start
+		}
+		srv.metrics.getOrCreate(sample.Target).AddCount(Count{sample.N, sample.T})
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = errCollectTimeout
+	}
+	return len(samples), err
+}
@@ -0,0 +1,212 @@
+package grada
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCollector counts its collections and delivers the count.
+type testCollector struct {
+	name     string
+	interval time.Duration
+	runs     atomic.Int64
+	block    bool // wait for the context to be done
+}
+
+func (c *testCollector) Name() string            { return c.name }
+func (c *testCollector) Interval() time.Duration { return c.interval }
+func (c *testCollector) Collect(ctx context.Context) []Sample {
+	n := c.runs.Add(1)
+	if c.block {
+		<-ctx.Done()
+	}
+	return []Sample{{Target: c.name, N: float64(n)}, {Target: c.name + ".fixed", N: 1, T: time.Unix(100, 0)}}
+}
+
+func TestDashboard_AddCollector(t *testing.T) {
+	d := NewDashboard()
+	fast := &testCollector{name: "fast", interval: 10 * time.Millisecond}
+	slow := &testCollector{name: "slow", interval: time.Hour}
+	for _, c := range []Collector{fast, slow} {
+		if err := d.AddCollector(c); err != nil {
+			t.Fatalf("AddCollector(%s): %v", c.Name(), err)
+		}
+	}
+	if err := d.AddCollector(&testCollector{name: "fast"}); !errors.Is(err, ErrCollectorExists) {
+		t.Errorf("AddCollector() for an existing name: error %v, want ErrCollectorExists", err)
+	}
+	if got := d.Collectors(); len(got) != 2 || got[0] != "fast" || got[1] != "slow" {
+		t.Errorf("Collectors() = %q", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fast.runs.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := d.RemoveCollector("fast"); err != nil {
+		t.Errorf("RemoveCollector(): %v", err)
+	}
+	if err := d.RemoveCollector("fast"); !errors.Is(err, ErrCollectorNotFound) {
+		t.Errorf("RemoveCollector() twice: error %v, want ErrCollectorNotFound", err)
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown(): %v", err)
+	}
+
+	if runs := fast.runs.Load(); runs < 3 {
+		t.Errorf("fast collector ran %d times, want at least 3", runs)
+	}
+	if runs := slow.runs.Load(); runs != 1 {
+		t.Errorf("slow collector ran %d times, want 1", runs)
+	}
+	metric, err := d.GetMetric("fast")
+	if err != nil {
+		t.Fatalf("GetMetric(): %v", err)
+	}
+	if metric.head < 3 || metric.list.at(0).N != 1 || metric.list.at(0).T.IsZero() {
+		t.Errorf("metric has head %d and first data point %v", metric.head, metric.list.at(0))
+	}
+	fixed, _ := d.GetMetric("slow.fixed")
+	if fixed == nil || !fixed.list.at(0).T.Equal(time.Unix(100, 0)) {
+		t.Errorf("sample time was not kept")
+	}
+}
+
+func TestScheduler_stop(t *testing.T) {
+	d := NewDashboard()
+	c := &testCollector{name: "blocking", interval: time.Hour, block: true}
+	d.AddCollector(c)
+	for c.runs.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		d.Shutdown(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown does not cancel collections in progress")
+	}
+
+	// A new collector restarts the scheduler.
+	again := &testCollector{name: "again", interval: time.Hour}
+	d.AddCollector(again)
+	for again.runs.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	d.srv.collectors.stop()
+}
+
+func TestCollectorEntry_schedule(t *testing.T) {
+	now := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	tests := []struct {
+		name     string
+		opts     []CollectorOption
+		from, to time.Time // range of the next run
+	}{
+		{"plain", nil, now, now},
+		{"aligned", []CollectorOption{Aligned()}, now.Add(6 * time.Second), now.Add(6 * time.Second)},
+		{"jitter", []CollectorOption{Jitter(5 * time.Second)}, now, now.Add(5 * time.Second)},
+		{"alignedJitter", []CollectorOption{Aligned(), Jitter(time.Second)}, now.Add(6 * time.Second), now.Add(7 * time.Second)},
+		{"cron", []CollectorOption{Cron("*/5 * * * *")}, now.Add(186 * time.Second), now.Add(186 * time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &collectorEntry{interval: time.Minute}
+			for _, opt := range tt.opts {
+				opt(e)
+			}
+			for i := 0; i < 20; i++ {
+				e.schedule(now)
+				if e.next.Before(tt.from) || e.next.After(tt.to) {
+					t.Fatalf("next run at %v, want between %v and %v", e.next, tt.from, tt.to)
+				}
+			}
+		})
+	}
+}
+
+// failingCollector panics or overruns its interval.
+type failingCollector struct {
+	name  string
+	panic bool
+}
+
+func (c failingCollector) Name() string            { return c.name }
+func (c failingCollector) Interval() time.Duration { return 20 * time.Millisecond }
+func (c failingCollector) Collect(ctx context.Context) []Sample {
+	if c.panic {
+		panic("boom")
+	}
+	<-ctx.Done()
+	return []Sample{{Target: c.name, N: 1}}
+}
+
+func TestServer_collectorsHandler(t *testing.T) {
+	anyone := AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		return Principal{Name: "anyone"}, nil
+	})
+	d := NewDashboard(WithAuthenticator(anyone))
+	d.AddCollector(failingCollector{name: "panics", panic: true})
+	d.AddCollector(failingCollector{name: "slow"})
+	d.AddCollector(&testCollector{name: "ok", interval: time.Hour}, Jitter(time.Millisecond))
+	defer d.Shutdown(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		done := 0
+		for _, s := range d.CollectorStatus() {
+			if s.Runs > 0 {
+				done++
+			}
+		}
+		if done == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	status := d.CollectorStatus()
+	if len(status) != 3 {
+		t.Fatalf("CollectorStatus() has %d elements, want 3", len(status))
+	}
+	wantErr := map[string]string{"ok": "", "panics": "panic: boom", "slow": errCollectTimeout.Error()}
+	for _, s := range status {
+		got := ""
+		if s.Err != nil {
+			got = s.Err.Error()
+		}
+		if got != wantErr[s.Name] {
+			t.Errorf("collector %s: error %q, want %q", s.Name, got, wantErr[s.Name])
+		}
+		if s.LastRun.IsZero() || s.NextRun.Before(s.LastRun) {
+			t.Errorf("collector %s: last run %v, next run %v", s.Name, s.LastRun, s.NextRun)
+		}
+	}
+	if status[0].Name != "ok" || status[0].Samples != 2 || status[0].Interval != time.Hour {
+		t.Errorf("status of collector ok: %+v", status[0])
+	}
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/collectors", nil))
+	body := w.Body.String()
+	for _, want := range []string{`"name":"ok","interval":3600000,`, `"samples":2,`, `"error":"panic: boom"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/collectors response %s does not contain %s", body, want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	NewDashboard().Handler().ServeHTTP(w, httptest.NewRequest("GET", "/collectors", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/collectors without authentication: status %d, want 403", w.Code)
+	}
+}
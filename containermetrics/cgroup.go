@@ -0,0 +1,84 @@
+package containermetrics
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// cgroupCollector reads the files of a cgroup v2.
+type cgroupCollector struct {
+	interval time.Duration
+	name     string
+	dir      string
+	rates    rates
+}
+
+// Cgroup returns a collector of the CPU and memory usage of the cgroup v2
+// at dir, such as "/sys/fs/cgroup/system.slice/docker-<id>.scope", with
+// targets for the container name. Use it for containers of other
+// runtimes than Docker, or without access to the Docker socket.
+func Cgroup(interval time.Duration, name, dir string) grada.Collector {
+	return &cgroupCollector{interval: interval, name: name, dir: dir}
+}
+
+// Name returns the name of the collector, "container.cgroup.<name>".
+func (c *cgroupCollector) Name() string { return Prefix + "cgroup." + c.name }
+
+// Interval returns the interval of the collector.
+func (c *cgroupCollector) Interval() time.Duration { return c.interval }
+
+// Collect reads the cgroup files.
+func (c *cgroupCollector) Collect(ctx context.Context) []grada.Sample {
+	t := time.Now()
+	prefix := Prefix + c.name + "."
+	var samples []grada.Sample
+	if usage, ok := c.readKey("cpu.stat", "usage_usec"); ok {
+		if r, ok := c.rates.rate("cpu", usage/1e6, t); ok {
+			samples = append(samples, grada.Sample{Target: prefix + "cpu.percent", N: 100 * r, T: t})
+		}
+	}
+	if current, ok := c.readValue("memory.current"); ok {
+		cache, _ := c.readKey("memory.stat", "inactive_file")
+		samples = append(samples, grada.Sample{Target: prefix + "mem.used", N: max(current-cache, 0), T: t})
+	}
+	// memory.max is "max" if the cgroup has no limit.
+	if limit, ok := c.readValue("memory.max"); ok {
+		samples = append(samples, grada.Sample{Target: prefix + "mem.limit", N: limit, T: t})
+	}
+	return samples
+}
+
+// readValue reads a file of the cgroup that contains a single number.
+func (c *cgroupCollector) readValue(file string) (float64, bool) {
+	b, err := os.ReadFile(filepath.Join(c.dir, file))
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+	return n, err == nil
+}
+
+// readKey reads the number of a key from a file of the cgroup that has
+// a "key value" pair per line.
+func (c *cgroupCollector) readKey(file, key string) (float64, bool) {
+	f, err := os.Open(filepath.Join(c.dir, file))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if k, v, ok := strings.Cut(s.Text(), " "); ok && k == key {
+			n, err := strconv.ParseFloat(v, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,61 @@
+/*
+Package containermetrics provides grada collectors for the CPU, memory, and
+network usage of containers on the local host, for single-host deployments
+without a dedicated container monitoring system. The collectors read the
+Docker Engine API, or the files of a cgroup v2.
+
+Register a collector with a dashboard:
+
+	d.AddCollector(containermetrics.Docker(10*time.Second, "web", "db"))
+
+The targets of a container start with "container.<name>.":
+
+	cpu.percent       CPU usage since the previous collection, where 100 is
+	                  one fully used CPU
+	mem.used          memory usage in bytes, without the page cache
+	mem.limit         memory limit in bytes, if any
+	net.recv_bytes    bytes per second received on all interfaces (Docker only)
+	net.sent_bytes    bytes per second sent on all interfaces (Docker only)
+
+CPU usage and network throughput start with the second collection.
+*/
+package containermetrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Prefix starts the target names of all collectors.
+const Prefix = "container."
+
+// rates turns cumulative counters, such as the CPU time of a container,
+// into rates per second.
+type rates struct {
+	mu   sync.Mutex
+	prev map[string]reading
+}
+
+// reading is a counter value at a time.
+type reading struct {
+	n float64
+	t time.Time
+}
+
+// rate records the counter value n at time t under key, and returns the
+// rate per second since the previous value. It reports false for the
+// first value and for counters that have been reset.
+func (r *rates) rate(key string, n float64, t time.Time) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.prev == nil {
+		r.prev = map[string]reading{}
+	}
+	prev, ok := r.prev[key]
+	r.prev[key] = reading{n, t}
+	secs := t.Sub(prev.t).Seconds()
+	if !ok || secs <= 0 || n < prev.n {
+		return 0, false
+	}
+	return (n - prev.n) / secs, true
+}
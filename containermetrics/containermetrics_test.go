@@ -0,0 +1,125 @@
+package containermetrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/christophberger/grada"
+	"github.com/google/go-cmp/cmp"
+)
+
+// byTarget returns the values of samples by target name.
+func byTarget(samples []grada.Sample) map[string]float64 {
+	m := map[string]float64{}
+	for _, s := range samples {
+		m[s.Target] = s.N
+	}
+	return m
+}
+
+func TestRates_rate(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	var r rates
+	tests := []struct {
+		n      float64
+		t      time.Time
+		want   float64
+		wantOK bool
+	}{
+		{100, t0, 0, false},
+		{300, t0.Add(2 * time.Second), 100, true},
+		{10, t0.Add(3 * time.Second), 0, false}, // reset
+		{20, t0.Add(3 * time.Second), 0, false}, // same time
+		{30, t0.Add(5 * time.Second), 5, true},
+	}
+	for i, tt := range tests {
+		if got, ok := r.rate("key", tt.n, tt.t); got != tt.want || ok != tt.wantOK {
+			t.Errorf("%d: rate() = %v, %v, want %v, %v", i, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestDocker(t *testing.T) {
+	cpu := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/web/stats" || r.URL.Query().Get("stream") != "false" {
+			http.NotFound(w, r)
+			return
+		}
+		cpu += 500
+		fmt.Fprintf(w, `{"cpu_stats": {"cpu_usage": {"total_usage": %d000000}},
+			"memory_stats": {"usage": 1000, "limit": 4000, "stats": {"inactive_file": 200}},
+			"networks": {"eth0": {"rx_bytes": %d, "tx_bytes": 10}, "eth1": {"rx_bytes": 5, "tx_bytes": 0}}}`, cpu, cpu)
+	}))
+	defer ts.Close()
+
+	c := Docker(time.Second, "web", "stopped").(*dockerCollector)
+	c.client, c.base = ts.Client(), ts.URL
+	if c.Name() != "container.docker" || c.Interval() != time.Second {
+		t.Errorf("collector has name %q and interval %v", c.Name(), c.Interval())
+	}
+	first := byTarget(c.Collect(context.Background()))
+	if want := map[string]float64{"container.web.mem.used": 800, "container.web.mem.limit": 4000}; !cmp.Equal(first, want) {
+		t.Errorf("first collection:\n%s", cmp.Diff(want, first))
+	}
+
+	stats, err := c.stats(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("stats(): %v", err)
+	}
+	now := time.Now()
+	c.samples("web", stats, now) // 1000ms CPU, 1005 bytes received
+	stats.CPUStats.CPUUsage.TotalUsage += uint64(time.Second)
+	stats.Networks["eth0"] = struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	}{RxBytes: 5000, TxBytes: 10}
+	got := byTarget(c.samples("/web", stats, now.Add(2*time.Second)))
+	want := map[string]float64{
+		"container.web.mem.used":       800,
+		"container.web.mem.limit":      4000,
+		"container.web.cpu.percent":    50,
+		"container.web.net.recv_bytes": 2000,
+		"container.web.net.sent_bytes": 0,
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("second collection:\n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestCgroup(t *testing.T) {
+	dir := t.TempDir()
+	write := func(file, content string) {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cpu.stat", "usage_usec 1000000\nuser_usec 800000\n")
+	write("memory.current", "5000\n")
+	write("memory.stat", "anon 3000\ninactive_file 1000\n")
+	write("memory.max", "max\n")
+
+	c := Cgroup(time.Second, "db", dir)
+	if c.Name() != "container.cgroup.db" {
+		t.Errorf("collector name %q", c.Name())
+	}
+	if got, want := byTarget(c.Collect(context.Background())), map[string]float64{"container.db.mem.used": 4000}; !cmp.Equal(got, want) {
+		t.Errorf("first collection:\n%s", cmp.Diff(want, got))
+	}
+
+	write("cpu.stat", "usage_usec 100000000\n")
+	write("memory.max", "8000\n")
+	got := byTarget(c.Collect(context.Background()))
+	if got["container.db.mem.limit"] != 8000 {
+		t.Errorf("memory limit %v, want 8000", got["container.db.mem.limit"])
+	}
+	if got["container.db.cpu.percent"] <= 0 {
+		t.Errorf("no CPU usage in %v", got)
+	}
+}
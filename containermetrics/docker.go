@@ -0,0 +1,130 @@
+package containermetrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// defaultDockerSocket is the socket of the Docker Engine API, unless
+// DOCKER_HOST names another one.
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// dockerStats is the part of a Docker stats response that the collector reads.
+type dockerStats struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"` // nanoseconds
+		} `json:"cpu_usage"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+}
+
+// dockerCollector reads container stats from the Docker Engine API.
+type dockerCollector struct {
+	interval   time.Duration
+	containers []string
+	client     *http.Client
+	base       string // URL of the API
+	rates      rates
+}
+
+// Docker returns a collector of the stats of the given containers, by name
+// or ID, from the Docker Engine API at the Unix socket of DOCKER_HOST, or
+// at /var/run/docker.sock. Containers that are not running have no data
+// points.
+func Docker(interval time.Duration, containers ...string) grada.Collector {
+	socket := defaultDockerSocket
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		socket = strings.TrimPrefix(host, "unix://")
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	return &dockerCollector{interval: interval, containers: containers, client: client, base: "http://docker"}
+}
+
+// Name returns the name of the collector, "container.docker".
+func (c *dockerCollector) Name() string { return Prefix + "docker" }
+
+// Interval returns the interval of the collector.
+func (c *dockerCollector) Interval() time.Duration { return c.interval }
+
+// Collect reads the stats of all containers.
+func (c *dockerCollector) Collect(ctx context.Context) []grada.Sample {
+	var samples []grada.Sample
+	for _, name := range c.containers {
+		stats, err := c.stats(ctx, name)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, c.samples(name, stats, time.Now())...)
+	}
+	return samples
+}
+
+// stats requests the current stats of a container.
+func (c *dockerCollector) stats(ctx context.Context, name string) (*dockerStats, error) {
+	u := c.base + "/containers/" + url.PathEscape(name) + "/stats?stream=false&one-shot=true"
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("container %s: %s", name, resp.Status)
+	}
+	stats := &dockerStats{}
+	return stats, json.NewDecoder(resp.Body).Decode(stats)
+}
+
+// samples turns the stats of a container, read at time t, into samples.
+func (c *dockerCollector) samples(name string, s *dockerStats, t time.Time) []grada.Sample {
+	prefix := Prefix + strings.TrimPrefix(name, "/") + "."
+	mem := s.MemoryStats
+	// The page cache is "inactive_file" with cgroup v2, and "cache" with v1.
+	used := mem.Usage - min(mem.Usage, mem.Stats["inactive_file"]+mem.Stats["cache"])
+	samples := []grada.Sample{{Target: prefix + "mem.used", N: float64(used), T: t}}
+	if mem.Limit > 0 {
+		samples = append(samples, grada.Sample{Target: prefix + "mem.limit", N: float64(mem.Limit), T: t})
+	}
+	cpuSecs := float64(s.CPUStats.CPUUsage.TotalUsage) / float64(time.Second)
+	if r, ok := c.rates.rate(prefix+"cpu", cpuSecs, t); ok {
+		samples = append(samples, grada.Sample{Target: prefix + "cpu.percent", N: 100 * r, T: t})
+	}
+	var rx, tx uint64
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	if r, ok := c.rates.rate(prefix+"rx", float64(rx), t); ok {
+		samples = append(samples, grada.Sample{Target: prefix + "net.recv_bytes", N: r, T: t})
+	}
+	if r, ok := c.rates.rate(prefix+"tx", float64(tx), t); ok {
+		samples = append(samples, grada.Sample{Target: prefix + "net.sent_bytes", N: r, T: t})
+	}
+	return samples
+}
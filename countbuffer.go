@@ -0,0 +1,122 @@
+package grada
+
+// Storage of the data points of a metric.
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// noTime is the time stamp of an empty slot of a countBuffer.
+const noTime = math.MinInt64
+
+// countBuffer holds the slots of the ring buffer of a metric in two
+// columns, one of values and one of time stamps, so that searching the
+// time stamps of a query reads no values. It stores the time stamps as
+// int64 offsets in nanoseconds from the Unix epoch rather than as
+// time.Time values, which take 24 bytes, so that a data point takes 16
+// bytes instead of 32. Time stamps therefore lose their time zone and
+// monotonic clock reading, and must lie between the years 1678 and 2262.
+//
+// The base of the offsets is the same for all buffers. A base per buffer,
+// such as the time stamp of its oldest data point, would allow a column
+// of int32 deltas, but int32 nanoseconds span only two seconds, and every
+// write that evicts the oldest data point would have to move the base
+// and rewrite all deltas.
+type countBuffer struct {
+	n  []float64
+	ns []int64 // noTime for empty slots
+}
+
+// newCountBuffer returns a buffer of size empty slots.
+func newCountBuffer(size int) countBuffer {
+	b := countBuffer{n: make([]float64, size), ns: make([]int64, size)}
+	for i := range b.ns {
+		b.ns[i] = noTime
+	}
+	return b
+}
+
+// countBufferOf returns a buffer with the Counts of list.
+func countBufferOf(list []Count) countBuffer {
+	b := newCountBuffer(len(list))
+	for i, c := range list {
+		b.set(i, c)
+	}
+	return b
+}
+
+// len returns the number of slots.
+func (b countBuffer) len() int { return len(b.n) }
+
+// at returns the Count in slot i. Empty slots have a zero time stamp.
+func (b countBuffer) at(i int) Count {
+	if b.ns[i] == noTime {
+		return Count{N: b.n[i]}
+	}
+	return Count{b.n[i], time.Unix(0, b.ns[i])}
+}
+
+// set stores c in slot i. A zero time stamp empties the slot.
+func (b countBuffer) set(i int, c Count) {
+	b.n[i] = c.N
+	b.ns[i] = nanos(c.T)
+}
+
+// nanos returns t in Unix nanoseconds, or noTime for the zero time.
+func nanos(t time.Time) int64 {
+	if t.IsZero() {
+		return noTime
+	}
+	return t.UnixNano()
+}
+
+// clampNanos returns t in Unix nanoseconds, clamped to the range of int64.
+// The zero time and other times before 1678 map to noTime.
+func clampNanos(t time.Time) int64 {
+	switch {
+	case t.Before(time.Unix(0, math.MinInt64)):
+		return noTime
+	case t.After(time.Unix(0, math.MaxInt64)):
+		return math.MaxInt64
+	}
+	return t.UnixNano()
+}
+
+// window returns the positions lo and hi, counted from slot head, of the
+// time stamps within the time range (from, to), which are the slots
+// (head+lo)%len through (head+hi-1)%len. The slots must be sorted by time
+// stamp starting at slot head. window takes time logarithmic in the
+// number of slots.
+func (b countBuffer) window(head int, from, to time.Time) (lo, hi int) {
+	n := b.len()
+	f, t := clampNanos(from), clampNanos(to)
+	lo = sort.Search(n, func(i int) bool { return b.ns[(head+i)%n] > f })
+	hi = sort.Search(n, func(i int) bool { return b.ns[(head+i)%n] >= t })
+	return lo, max(lo, hi)
+}
+
+// rotate returns a buffer with the slots of b starting at slot head.
+func (b countBuffer) rotate(head int) countBuffer {
+	r := countBuffer{n: make([]float64, 0, len(b.n)), ns: make([]int64, 0, len(b.ns))}
+	r.n = append(append(r.n, b.n[head:]...), b.n[:head]...)
+	r.ns = append(append(r.ns, b.ns[head:]...), b.ns[:head]...)
+	return r
+}
+
+// sortStable sorts the slots by time stamp, keeping slots of the same
+// time stamp in order. Empty slots go first.
+func (b countBuffer) sortStable() {
+	sort.Stable(byTime(b))
+}
+
+// byTime sorts a countBuffer by time stamp.
+type byTime countBuffer
+
+func (b byTime) Len() int           { return len(b.n) }
+func (b byTime) Less(i, j int) bool { return b.ns[i] < b.ns[j] }
+func (b byTime) Swap(i, j int) {
+	b.n[i], b.n[j] = b.n[j], b.n[i]
+	b.ns[i], b.ns[j] = b.ns[j], b.ns[i]
+}
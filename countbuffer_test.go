@@ -0,0 +1,84 @@
+package grada
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// counts returns the Counts of all slots of b.
+func (b countBuffer) counts() []Count {
+	list := make([]Count, b.len())
+	for i := range list {
+		list[i] = b.at(i)
+	}
+	return list
+}
+
+func TestCountBuffer(t *testing.T) {
+	t1 := time.Date(2017, time.October, 25, 11, 16, 54, 1, time.UTC)
+	t2 := t1.Add(time.Second)
+	tests := []struct {
+		name string
+		list []Count
+		head int
+		want []Count
+	}{
+		{"empty", nil, 0, []Count{}},
+		{"empty slots first", []Count{{2, t2}, {}, {1, t1}}, 0, []Count{{}, {1, t1}, {2, t2}}},
+		{"stable", []Count{{2, t1}, {1, t1}, {3, t2}}, 2, []Count{{2, t1}, {1, t1}, {3, t2}}},
+		{"rotated", []Count{{3, t2}, {1, t1}, {2, t1}}, 1, []Count{{1, t1}, {2, t1}, {3, t2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := countBufferOf(tt.list).rotate(tt.head)
+			b.sortStable()
+			if diff := cmp.Diff(tt.want, b.counts()); diff != "" {
+				t.Errorf("sorted buffer mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCountBuffer_at(t *testing.T) {
+	t1 := time.Date(2017, time.October, 25, 11, 16, 54, 1, time.UTC)
+	b := newCountBuffer(2)
+	b.set(1, Count{1.5, t1})
+	if c := b.at(0); !c.T.IsZero() {
+		t.Errorf("at(0) = %v, want an empty slot", c)
+	}
+	if c := b.at(1); c.N != 1.5 || !c.T.Equal(t1) {
+		t.Errorf("at(1) = %v, want {1.5 %v}", c, t1)
+	}
+	b.set(1, Count{N: 2})
+	if b.ns[1] != noTime {
+		t.Errorf("set() with a zero time stamp stored %d, want an empty slot", b.ns[1])
+	}
+}
+
+func TestCountBuffer_window(t *testing.T) {
+	t0 := time.Unix(1509369032, 0)
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+	// From slot 2, which is empty, slots 3, 4, 0, 1 hold the seconds 1 to 4.
+	b := countBufferOf([]Count{{3, at(3)}, {4, at(4)}, {}, {1, at(1)}, {2, at(2)}})
+	tests := []struct {
+		name     string
+		from, to time.Time
+		lo, hi   int
+	}{
+		{"all", time.Time{}, endOfTime, 1, 5},
+		{"exclusive", at(1), at(4), 2, 4},
+		{"inside", at(1).Add(-time.Nanosecond), at(3).Add(time.Nanosecond), 1, 4},
+		{"before", t0.Add(-time.Hour), t0, 1, 1},
+		{"after", at(4), endOfTime, 5, 5},
+		{"reversed", at(4), at(1), 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lo, hi := b.window(2, tt.from, tt.to); lo != tt.lo || hi != tt.hi {
+				t.Errorf("window() = %d, %d, want %d, %d", lo, hi, tt.lo, tt.hi)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package grada
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 8-18/2 1,15 * 1-5", false},
+		{"0 0 * * 7", false},
+		{"5/10 * * * *", false},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+		{"1-b * * * *", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := parseCron(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCron(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_next(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	date := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2017, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", date(time.October, 25, 11, 17)},
+		{"*/5 * * * *", date(time.October, 25, 11, 20)},
+		{"5/10 * * * *", date(time.October, 25, 11, 25)},
+		{"0 * * * *", date(time.October, 25, 12, 0)},
+		{"30 9 * * *", date(time.October, 26, 9, 30)},
+		{"0 8-18 * * 1-5", date(time.October, 25, 12, 0)},
+		{"0 0 * * 0", date(time.October, 29, 0, 0)},
+		{"0 0 * * 7", date(time.October, 29, 0, 0)},
+		{"0 0 1 * *", date(time.November, 1, 0, 0)},
+		{"0 0 1 * 5", date(time.October, 27, 0, 0)}, // day of month or week
+		{"0 0 1 1 *", time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("parseCron(): %v", err)
+			}
+			if got := c.next(now); !got.Equal(tt.want) {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package grada
+
+// CSV output for Grafana's CSV/Infinity data sources and for spreadsheet tools.
+//
+// GET /csv?target=<name>[&from=<time>&to=<time>]
+//
+// "from" and "to" accept either RFC 3339 timestamps or Unix milliseconds.
+// If "from" is omitted, the whole buffer is returned; if "to" is omitted,
+// it defaults to the current time.
+
+import (
+	"encoding/csv"
+	"errors"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// parseTimeParam parses a time value from a URL query parameter.
+// s can be an RFC 3339 timestamp or a Unix timestamp in milliseconds.
+// An empty string returns def.
+func parseTimeParam(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time " + s + ": use RFC 3339 or Unix milliseconds")
+	}
+	return t, nil
+}
+
+// csvHandler writes the data points of a single metric as CSV.
+// The first line is a header with the column names "time" and the target name,
+// so that Grafana uses the target name as the field name.
+func (srv *server) csvHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	target := params.Get("target")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, nil, "target is required")
+		return
+	}
+	from, err := parseTimeParam(params.Get("from"), time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot parse from")
+		return
+	}
+	to, err := parseTimeParam(params.Get("to"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot parse to")
+		return
+	}
+
+	points, err := srv.datapoints(target, from, to, math.MaxInt)
+	if err != nil {
+		writeError(w, statusFor(err), err, "Cannot get metric for target "+target)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": target + ".csv"}))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", target})
+	for _, p := range points {
+		ms := p[1].(int64)
+		cw.Write([]string{
+			time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(p[0].(float64), 'g', -1, 64),
+		})
+	}
+	cw.Flush()
+}
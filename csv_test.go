@@ -0,0 +1,96 @@
+package grada
+
+import (
+	"mime"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseTimeParam(t *testing.T) {
+	def := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"empty", "", def, false},
+		{"millis", "1508929014000", time.Date(2017, time.October, 25, 10, 56, 54, 0, time.UTC), false},
+		{"rfc3339", "2017-10-25T11:16:54Z", time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC), false},
+		{"invalid", "yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeParam(tt.s, def)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTimeParam() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTimeParam() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_csvHandler(t *testing.T) {
+	t1 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	t2 := time.Date(2017, time.October, 25, 11, 17, 54, 500000000, time.UTC)
+	srv := &server{
+		metrics: &metrics{
+			metric: map[string]*Metric{
+				"target1": {list: countBufferOf([]Count{{2.5, t2}, {1, t1}}), unsorted: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"all",
+			"/csv?target=target1&to=2017-10-25T12:00:00Z",
+			200,
+			"time,target1\n2017-10-25T11:16:54Z,1\n2017-10-25T11:17:54.5Z,2.5\n",
+		},
+		{
+			"range",
+			"/csv?target=target1&from=2017-10-25T11:17:00Z&to=2017-10-25T12:00:00Z",
+			200,
+			"time,target1\n2017-10-25T11:17:54.5Z,2.5\n",
+		},
+		{"noTarget", "/csv", 400, ""},
+		{"unknownTarget", "/csv?target=nope", 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.csvHandler(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("csvHandler(): status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("csvHandler():\ngot  %q\nwant %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_csvHandlerFilename(t *testing.T) {
+	d := NewDashboard()
+	for _, target := range []string{"cpu", `say "hi"; now`, "température"} {
+		d.CreateMetricWithBufSize(target, 1)
+		w := httptest.NewRecorder()
+		d.srv.csvHandler(w, httptest.NewRequest("GET", "/csv?target="+url.QueryEscape(target), nil))
+		disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+		if err != nil || disposition != "attachment" || params["filename"] != target+".csv" {
+			t.Errorf("Content-Disposition %q = %s %v, %v, want attachment with filename %q",
+				w.Header().Get("Content-Disposition"), disposition, params, err, target+".csv")
+		}
+	}
+}
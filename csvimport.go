@@ -0,0 +1,107 @@
+package grada
+
+// Import of data points from CSV and TSV files.
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVMapping describes the columns of a file for Metric.ImportCSV.
+type CSVMapping struct {
+	// TimeColumn and ValueColumn are the positions of the time stamp and
+	// the value in a row, starting with 1. Defaults are 1 and 2.
+	TimeColumn  int
+	ValueColumn int
+	// Comma separates the fields. Default is ','; use '\t' for TSV.
+	Comma rune
+	// Header skips the first row, which has the column names.
+	Header bool
+	// TimeLayout is the layout of the time stamps for time.Parse, or
+	// "unix" or "unixms" for Unix time stamps in seconds or milliseconds.
+	// Default is time.RFC3339.
+	TimeLayout string
+	// Location is the time zone of time stamps whose layout has none,
+	// such as "2006-01-02 15:04". Default is UTC.
+	Location *time.Location
+}
+
+// ImportCSV adds the data points of a CSV file from r, one per row, to
+// the metric, to seed it with demo data or history from a spreadsheet:
+//
+//	time,cpu
+//	2017-10-25T11:16:54Z,0.5
+//	2017-10-25T11:16:55Z,0.7
+//
+// Rows with an empty value and lines starting with '#' are skipped. Data
+// points whose time stamp the metric has already are skipped, too, so
+// that importing a file twice adds nothing. If the file has more data
+// points than the buffer, the newest remain.
+//
+// ImportCSV returns the number of data points that it has added. It reads
+// all of r before adding anything, and fails without adding anything if a
+// row cannot be parsed.
+func (g *Metric) ImportCSV(r io.Reader, mapping CSVMapping) (int, error) {
+	if mapping.TimeColumn <= 0 {
+		mapping.TimeColumn = 1
+	}
+	if mapping.ValueColumn <= 0 {
+		mapping.ValueColumn = 2
+	}
+	if mapping.TimeLayout == "" {
+		mapping.TimeLayout = time.RFC3339
+	}
+	if mapping.Location == nil {
+		mapping.Location = time.UTC
+	}
+	cr := csv.NewReader(r)
+	if mapping.Comma != 0 {
+		cr.Comma = mapping.Comma
+	}
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	if mapping.Header {
+		if _, err := cr.Read(); err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("import CSV: %w", err)
+		}
+	}
+
+	var counts []Count
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("import CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(row) < max(mapping.TimeColumn, mapping.ValueColumn) {
+			return 0, fmt.Errorf("import CSV: line %d: %d fields, want at least %d", line, len(row), max(mapping.TimeColumn, mapping.ValueColumn))
+		}
+		value := strings.TrimSpace(row[mapping.ValueColumn-1])
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("import CSV: line %d: invalid value %s", line, value)
+		}
+		ts := strings.TrimSpace(row[mapping.TimeColumn-1])
+		t, ok := parseTimeIn(ts, mapping.TimeLayout, mapping.Location)
+		if !ok {
+			return 0, fmt.Errorf("import CSV: line %d: invalid time stamp %s", line, ts)
+		}
+		counts = append(counts, Count{n, t})
+	}
+	// The newest data points are added last, so that they remain.
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].T.Before(counts[j].T) })
+	return g.merge(counts), nil
+}
@@ -0,0 +1,94 @@
+package grada
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetric_ImportCSV(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	tests := []struct {
+		name    string
+		input   string
+		mapping CSVMapping
+		size    int
+		want    []Count
+		wantErr bool
+	}{
+		{
+			name:    "RFC 3339 with header",
+			input:   "time,cpu\n2017-10-25T11:16:55Z,0.7\n2017-10-25T11:16:54Z,0.5\n2017-10-25T11:16:56Z,\n",
+			mapping: CSVMapping{Header: true},
+			want:    []Count{{0.5, t0}, {0.7, t0.Add(time.Second)}},
+		},
+		{
+			name:    "TSV with Unix milliseconds",
+			input:   "# exported\nhost1\t1508930214000\t3\n",
+			mapping: CSVMapping{Comma: '\t', TimeColumn: 2, ValueColumn: 3, TimeLayout: "unixms"},
+			want:    []Count{{3, t0}},
+		},
+		{
+			name:    "layout in local time",
+			input:   "2017-10-25 13:16:54;1\n",
+			mapping: CSVMapping{Comma: ';', TimeLayout: "2006-01-02 15:04:05", Location: berlin},
+			want:    []Count{{1, t0}},
+		},
+		{
+			name:  "newest remain",
+			input: "2017-10-25T11:16:56Z,3\n2017-10-25T11:16:54Z,1\n2017-10-25T11:16:55Z,2\n",
+			size:  2,
+			want:  []Count{{2, t0.Add(time.Second)}, {3, t0.Add(2 * time.Second)}},
+		},
+		{
+			name:    "invalid time stamp",
+			input:   "2017-10-25T11:16:54Z,1\nyesterday,2\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			input:   "2017-10-25T11:16:54Z,x\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing column",
+			input:   "2017-10-25T11:16:54Z\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard()
+			size := tt.size
+			if size == 0 {
+				size = 10
+			}
+			m, _ := d.CreateMetricWithBufSize("cpu", size)
+			added, err := m.ImportCSV(strings.NewReader(tt.input), tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if added != len(tt.want) && tt.size == 0 {
+				t.Errorf("ImportCSV() = %d, want %d", added, len(tt.want))
+			}
+			got := allCounts(t, d, "cpu")
+			for i := range tt.want {
+				tt.want[i].T = time.Unix(0, tt.want[i].T.UnixNano())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("data points mismatch (-want +got):\n%s", diff)
+			}
+
+			// A second import adds nothing.
+			if added, _ := m.ImportCSV(strings.NewReader(tt.input), tt.mapping); added != 0 && tt.size == 0 {
+				t.Errorf("second ImportCSV() = %d, want 0", added)
+			}
+		})
+	}
+}
@@ -46,6 +46,8 @@ Simply run
 package grada
 
 import (
+	"net/http"
+	"sync"
 	"time"
 )
 
@@ -66,12 +68,88 @@ type Dashboard struct {
 // This also starts the HTTP server that responds to queries from Grafana.
 // Default port is 3001. Overwrite this port by setting the environment
 // variable GRADA_PORT to the desired port number.
-func GetDashboard() *Dashboard {
+//
+// Options configure the HTTP server; see the With... functions.
+func GetDashboard(opts ...Option) *Dashboard {
 	d := &Dashboard{}
-	d.srv = startServer()
+	d.srv = startServer(opts...)
 	return d
 }
 
+// StartWithServer is like GetDashboard, but serves requests through hs.
+// Use it to control timeouts, logging, TLS, or the base context of the
+// HTTP server. StartWithServer sets hs.Handler and, if empty, hs.Addr;
+// options such as WithClientCerts and WithH2C extend hs.TLSConfig and
+// hs.Protocols. Call hs.Shutdown to stop the server.
+func StartWithServer(hs *http.Server, opts ...Option) *Dashboard {
+	srv := newServer(opts...)
+	if hs.Addr == "" {
+		hs.Addr = defaultAddr()
+	}
+	srv.configure(hs)
+	srv.httpServer = hs
+	go srv.serve()
+	return &Dashboard{srv: srv}
+}
+
+// NewDashboard creates a dashboard without starting an HTTP server.
+// Call Serve to start serving, or mount Handler in an existing server.
+//
+// Options configure the HTTP server; see the With... functions.
+func NewDashboard(opts ...Option) *Dashboard {
+	return &Dashboard{srv: newServer(opts...)}
+}
+
+// Serve accepts Grafana requests on the given TCP address, or on the port
+// that GetDashboard would use if addr is empty. Serve blocks until the
+// server fails, and always returns a non-nil error.
+func (d *Dashboard) Serve(addr string) error {
+	if addr == "" {
+		addr = defaultAddr()
+	}
+	d.srv.httpServer = d.srv.newHTTPServer(addr)
+	return d.srv.serve()
+}
+
+// Handler returns the HTTP handler that serves all endpoints of the dashboard.
+func (d *Dashboard) Handler() http.Handler {
+	return d.srv.handler
+}
+
+var (
+	defaultDashboard *Dashboard
+	defaultOnce      sync.Once
+)
+
+// Default returns the default dashboard that the package-level functions
+// Add and Serve use. The default dashboard has no options; it is created
+// on first use and does not serve requests until Serve is called.
+func Default() *Dashboard {
+	defaultOnce.Do(func() {
+		defaultDashboard = NewDashboard()
+	})
+	return defaultDashboard
+}
+
+// Add adds a value to the metric for the given target of the default
+// dashboard, creating the metric if necessary. See Dashboard.Add.
+func Add(target string, n float64) {
+	Default().Add(target, n)
+}
+
+// Serve serves the default dashboard on the given address. See Dashboard.Serve.
+//
+// A minimal program:
+//
+//	go grada.Serve(":3001")
+//	for {
+//		grada.Add("goroutines", float64(runtime.NumGoroutine()))
+//		time.Sleep(time.Second)
+//	}
+func Serve(addr string) error {
+	return Default().Serve(addr)
+}
+
 // CreateMetric creates a new metric for the given target name, time range, and
 // data update interval, and stores this metric in the server.
 //
@@ -89,8 +167,8 @@ func GetDashboard() *Dashboard {
 // Typically, the timeRange of a dashboard request should be much larger than
 // the interval for the incoming data.
 //
-// Creating a metric for an existing target is an error. To replace a metric
-// (which is rarely needed), call DeleteMetric first.
+// Creating a metric for an existing target fails with ErrMetricExists.
+// To replace a metric (which is rarely needed), call DeleteMetric first.
 func (d *Dashboard) CreateMetric(target string, timeRange, interval time.Duration) (*Metric, error) {
 	return d.CreateMetricWithBufSize(target, d.bufSizeFor(timeRange, interval))
 }
@@ -107,12 +185,20 @@ func (d *Dashboard) CreateMetric(target string, timeRange, interval time.Duratio
 // Example: If the dashboards's time range is 5 minutes and the incoming data arrives every
 // second, the buffer should hold 300 item (5*60*1) at least.
 //
-// Creating a metric for an existing target is an error. To replace a metric
-// (which is rarely needed), call DeleteMetric first.
+// Creating a metric for an existing target fails with ErrMetricExists.
+// To replace a metric (which is rarely needed), call DeleteMetric first.
 func (d *Dashboard) CreateMetricWithBufSize(target string, size int) (*Metric, error) {
 	return d.srv.metrics.Create(target, size)
 }
 
+// Add adds a value to the metric for the given target, along with the
+// current time stamp. If no metric exists for the target, Add creates one
+// with a buffer size of DefaultAutoCreateSize. A later call to CreateMetric
+// or CreateMetricWithBufSize for the target adopts this metric.
+func (d *Dashboard) Add(target string, n float64) {
+	d.srv.metrics.getOrCreate(target).Add(n)
+}
+
 // bufSizeFor takes a duration and a rate (number of data points per second)
 // and returns the required ring buffer size.
 // Used by CreateMetric().
@@ -123,7 +209,16 @@ func (d *Dashboard) bufSizeFor(timeRange, interval time.Duration) int {
 	return int(timeRange.Nanoseconds() / interval.Nanoseconds())
 }
 
+// GetMetric returns the metric for the given target.
+// If no metric exists for this target, GetMetric returns an error
+// that wraps ErrMetricNotFound.
+func (d *Dashboard) GetMetric(target string) (*Metric, error) {
+	return d.srv.metrics.Get(target)
+}
+
 // DeleteMetric deletes the metric for the given target from the server.
+// If no metric exists for this target, DeleteMetric returns an error
+// that wraps ErrMetricNotFound.
 func (d *Dashboard) DeleteMetric(target string) error {
 	return d.srv.metrics.Delete(target)
 }
@@ -14,7 +14,7 @@ func TestDashboard_CreateMetricWithBufSize(t *testing.T) {
 		size   int
 	}
 
-	mt := &metrics{sync.Mutex{}, map[string]*Metric{}}
+	mt := &metrics{m: sync.Mutex{}, metric: map[string]*Metric{}}
 
 	tests := []struct {
 		name    string
@@ -92,3 +92,44 @@ func TestDashboard_bufSizeFor(t *testing.T) {
 		})
 	}
 }
+
+func TestDashboard_Add(t *testing.T) {
+	d := NewDashboard()
+	d.Add("cpu", 0.5)
+	d.Add("cpu", 0.7)
+
+	metric, err := d.GetMetric("cpu")
+	if err != nil {
+		t.Fatalf("GetMetric(): %v", err)
+	}
+	if metric.list.len() != DefaultAutoCreateSize || metric.head != 2 {
+		t.Errorf("metric has size %d and head %d, want %d and 2", metric.list.len(), metric.head, DefaultAutoCreateSize)
+	}
+
+	adopted, err := d.CreateMetricWithBufSize("cpu", 10)
+	if err != nil {
+		t.Fatalf("CreateMetricWithBufSize(): %v", err)
+	}
+	if adopted.head != 2 {
+		t.Errorf("adopted metric has head %d, want 2", adopted.head)
+	}
+}
+
+func TestDashboard_AddDelete(t *testing.T) {
+	d := NewDashboard()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			d.Add("cpu", float64(i)) // panics on a nil metric
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			d.DeleteMetric("cpu")
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,191 @@
+package grada
+
+// Protocols of Grafana data source plugins.
+//
+// The server speaks the protocol of the Simple JSON data source at "/".
+// WithDialect serves the protocol of a plugin under another root as well,
+// so that Grafana installations that migrate from one plugin to another
+// can query the same metrics through both. The JSON data source
+// (simpod-json-datasource) differs from Simple JSON in these endpoints:
+//
+//	POST /metrics                 [{"label": "cpu", "value": "cpu"}, ...]
+//	POST /metric-payload-options  []
+//	POST /variable                [{"__text": "cpu", "__value": "cpu"}, ...]
+//	POST /tag-keys, /tag-values   []
+//
+// /variable takes the search text from the "target" of the payload of the
+// variable query. Its /query requests have no target type; the server
+// responds with a table for table targets, and with time series for all
+// other targets, or with data frames for targets with a unit, a range, or
+// decimals (see fieldconfig.go).
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Dialect is the protocol of a Grafana data source plugin.
+type Dialect int
+
+const (
+	// SimpleJSON is the protocol of the Simple JSON data source.
+	SimpleJSON Dialect = iota
+	// JSONDatasource is the protocol of the JSON data source
+	// (simpod-json-datasource).
+	JSONDatasource
+)
+
+// WithDialect serves the protocol d under the path root, such as
+// "/jsonds", in addition to the Simple JSON protocol at "/". Set the URL
+// of the Grafana data source to include the root. Pass the option once
+// per root; roots of several options must differ.
+func WithDialect(root string, d Dialect) Option {
+	return func(srv *server) {
+		root = "/" + strings.Trim(root, "/")
+		if srv.dialects == nil {
+			srv.dialects = map[string]Dialect{}
+		}
+		srv.dialects[root] = d
+	}
+}
+
+// installDialects serves the protocols of WithDialect.
+func (srv *server) installDialects() {
+	for root, d := range srv.dialects {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		mux.HandleFunc("/annotations", allowMethods(srv.annotationsHandler, "POST"))
+		switch d {
+		case SimpleJSON:
+			mux.HandleFunc("/query", allowMethods(srv.queryEndpoint(), "POST"))
+			mux.HandleFunc("/search", allowMethods(srv.searchHandler, "GET", "POST"))
+		case JSONDatasource:
+			mux.HandleFunc("/query", allowMethods(dataFrames(srv.inferTargetTypes(srv.queryEndpoint())), "POST"))
+			mux.HandleFunc("/metrics", allowMethods(srv.jsonMetricsHandler, "POST"))
+			mux.HandleFunc("/variable", allowMethods(srv.variableHandler, "POST"))
+			for _, p := range []string{"/metric-payload-options", "/tag-keys", "/tag-values"} {
+				mux.HandleFunc(p, allowMethods(emptyListHandler, "POST"))
+			}
+		}
+		srv.mux.Handle(root+"/", stripPrefix(root, mux))
+	}
+}
+
+// isTable reports whether target is a table target.
+func (srv *server) isTable(target string) bool {
+	srv.tablesMu.Lock()
+	defer srv.tablesMu.Unlock()
+	_, ok := srv.tables[target]
+	return ok
+}
+
+// inferTargetTypes sets the type of the targets of /query requests that
+// have none to "table" if the first target that is not hidden is a table
+// target, as the JSON data source does not send target types.
+func (srv *server) inferTargetTypes(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := readQueryBody(w, r)
+		r.Body = replayBody(body, err)
+		if err != nil {
+			h(w, r) // let h report the error
+			return
+		}
+		var q map[string]json.RawMessage
+		var targets []map[string]json.RawMessage
+		if json.Unmarshal(body, &q) != nil || json.Unmarshal(q["targets"], &targets) != nil || len(targets) == 0 {
+			h(w, r)
+			return
+		}
+		var first string
+		for _, t := range targets {
+			var hide bool
+			if json.Unmarshal(t["hide"], &hide); !hide {
+				json.Unmarshal(t["target"], &first)
+				break
+			}
+		}
+		if !srv.isTable(first) {
+			h(w, r)
+			return
+		}
+		for _, t := range targets {
+			if _, ok := t["type"]; !ok {
+				t["type"] = json.RawMessage(`"table"`)
+			}
+		}
+		q["targets"], _ = json.Marshal(targets)
+		body, _ = json.Marshal(q)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		h(w, r)
+	}
+}
+
+// metricOption is an element of the response to a `/metrics` request of
+// the JSON data source.
+type metricOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// jsonMetricsHandler responds with the targets for the metric picker of the
+// JSON data source.
+func (srv *server) jsonMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	response := []metricOption{}
+	for _, t := range srv.targets() {
+		response = append(response, metricOption{Label: t, Value: t})
+	}
+	writeJSON(w, response)
+}
+
+// variableRequest is the body of a `/variable` request of the JSON data
+// source.
+type variableRequest struct {
+	Payload struct {
+		Target string `json:"target"`
+	} `json:"payload"`
+}
+
+// variableValue is an element of the response to a `/variable` request.
+type variableValue struct {
+	Text  string `json:"__text"`
+	Value string `json:"__value"`
+}
+
+// variableHandler responds with the targets that match the search text
+// of a template variable query of the JSON data source.
+func (srv *server) variableHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := readQueryBody(w, r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	var req variableRequest
+	json.Unmarshal(body, &req)
+	response := []variableValue{}
+	for _, t := range srv.search(req.Payload.Target) {
+		response = append(response, variableValue{Text: t, Value: t})
+	}
+	writeJSON(w, response)
+}
+
+// emptyListHandler responds with an empty JSON array.
+func emptyListHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, []struct{}{})
+}
+
+// writeJSON writes the JSON encoding of v as the response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,54 @@
+package grada
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_dialects(t *testing.T) {
+	d := NewDashboard(WithDialect("/simplejson", SimpleJSON), WithDialect("jsonds/", JSONDatasource))
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	m.AddWithTime(0.5, time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC))
+	d.CreateStaticTable("hosts", &Table{Columns: []Column{{Text: "host", Type: "string"}}, Rows: [][]interface{}{{"web-1"}}})
+	const rng = `"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"maxDataPoints":100`
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{"root", "/jsonds/", "", 200, ""},
+		{"simplejson search", "/simplejson/search", `{"target":""}`, 200, `["cpu","hosts"]`},
+		{"simplejson query", "/simplejson/query", `{` + rng + `,"targets":[{"target":"cpu","type":"timeserie"}]}`, 200,
+			`[{"target":"cpu","datapoints":[[0.5,1508930214000]]}]`},
+		{"simplejson hidden target", "/simplejson/query", `{` + rng + `,"targets":[{"target":"nope","hide":true},{"target":"cpu"}]}`, 200,
+			`[{"target":"cpu","datapoints":[[0.5,1508930214000]]}]`},
+		{"simplejson all hidden", "/simplejson/query", `{` + rng + `,"targets":[{"target":"cpu","hide":true}]}`, 200, `[]`},
+		{"simplejson has no metrics", "/simplejson/metrics", `{}`, 200, ""},
+		{"jsonds metrics", "/jsonds/metrics", `{"metric":"","payload":{}}`, 200, `[{"label":"cpu","value":"cpu"},{"label":"hosts","value":"hosts"}]`},
+		{"jsonds variable", "/jsonds/variable", `{"payload":{"target":""},` + rng + `}`, 200,
+			`[{"__text":"cpu","__value":"cpu"},{"__text":"hosts","__value":"hosts"}]`},
+		{"jsonds tag keys", "/jsonds/tag-keys", `{}`, 200, `[]`},
+		{"jsonds time series", "/jsonds/query", `{` + rng + `,"targets":[{"target":"cpu","refId":"A","payload":{}}]}`, 200,
+			`[{"target":"cpu","datapoints":[[0.5,1508930214000]]}]`},
+		{"jsonds table", "/jsonds/query", `{` + rng + `,"targets":[{"target":"hosts","refId":"A"}]}`, 200,
+			`[{"columns":[{"text":"host","type":"string"}],"rows":[["web-1"]],"type":"table"}]`},
+		{"jsonds hidden table", "/jsonds/query", `{` + rng + `,"targets":[{"target":"hosts","hide":true},{"target":"cpu"}]}`, 200,
+			`[{"target":"cpu","datapoints":[[0.5,1508930214000]]}]`},
+		{"outside the roots", "/jsonds2/metrics", `{}`, 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+			// Error bodies carry a request ID; compare only their status.
+			if w.Code != tt.wantStatus || w.Code == http.StatusOK && strings.TrimSpace(w.Body.String()) != tt.want {
+				t.Errorf("POST %s = %d %s, want %d %s", tt.path, w.Code, w.Body, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package grada
+
+// Graceful shutdown.
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// drainState tracks requests in flight, so that Drain can wait for them.
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	inflight int
+	idle     chan struct{} // closed when the last request finishes while draining
+}
+
+// Drain stops accepting new requests and waits until all requests in flight
+// have finished, or until ctx is done. From the moment Drain is called, new
+// requests receive a 503 Service Unavailable response, so that load balancers
+// and Grafana retry them at another instance.
+//
+// Drain returns ctx.Err() if ctx is done before all requests have finished.
+// The dashboard does not accept requests again after Drain.
+func (d *Dashboard) Drain(ctx context.Context) error {
+	s := &d.srv.drain
+	s.mu.Lock()
+	s.draining = true
+	if s.inflight == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.idle == nil {
+		s.idle = make(chan struct{})
+	}
+	idle := s.idle
+	s.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown drains the dashboard, stops its collectors, writes a checkpoint
+// and closes the write-ahead log (see WithWAL), and then shuts down the
+// HTTP server started by GetDashboard, Serve, or StartWithServer. See
+// Drain and http.Server.Shutdown.
+func (d *Dashboard) Shutdown(ctx context.Context) error {
+	if err := d.Drain(ctx); err != nil {
+		return err
+	}
+	d.srv.collectors.stop()
+	if w := d.srv.metrics.wal; w != nil {
+		if w.cfg.CheckpointInterval > 0 {
+			if err := d.srv.checkpoint(); err != nil && d.srv.logger != nil {
+				d.srv.logger.Printf("grada: checkpoint: %v", err)
+			}
+		}
+		w.close()
+	}
+	if d.srv.httpServer == nil {
+		return nil
+	}
+	return d.srv.httpServer.Shutdown(ctx)
+}
+
+// trackInFlight counts the requests that h is serving, and rejects new
+// requests once the server is draining.
+func (srv *server) trackInFlight(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &srv.drain
+		s.mu.Lock()
+		if s.draining {
+			s.mu.Unlock()
+			w.Header().Set("Connection", "close")
+			writeError(w, http.StatusServiceUnavailable, nil, "server is shutting down")
+			return
+		}
+		s.inflight++
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			s.inflight--
+			if s.inflight == 0 && s.idle != nil {
+				close(s.idle)
+				s.idle = nil
+			}
+			s.mu.Unlock()
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
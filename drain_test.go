@@ -0,0 +1,50 @@
+package grada
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDashboard_Drain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := newServer()
+	srv.mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	d := &Dashboard{srv: srv}
+
+	slow := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		srv.handler.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+		slow <- w.Code
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain() with request in flight: error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("new request while draining: status %d, want 503", w.Code)
+	}
+
+	done := make(chan error)
+	go func() { done <- d.Drain(context.Background()) }()
+	close(release)
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("request in flight: status %d, want 200", code)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Drain(): %v", err)
+	}
+}
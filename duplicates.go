@@ -0,0 +1,135 @@
+package grada
+
+// Data points with the same time stamp.
+
+// DuplicatePolicy determines the value of a metric at a time stamp for
+// which the metric has received several data points, such as the
+// samples of a push that a producer has retried.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesKeepAll keeps all data points. This is the default.
+	DuplicatesKeepAll DuplicatePolicy = iota
+	// DuplicatesKeepFirst keeps the data point that was added first.
+	DuplicatesKeepFirst
+	// DuplicatesKeepLast keeps the data point that was added last.
+	DuplicatesKeepLast
+	// DuplicatesAverage replaces the data points by one with the mean of
+	// their values.
+	DuplicatesAverage
+)
+
+// DuplicateConfig configures WithDuplicates.
+type DuplicateConfig struct {
+	// Policy is the policy for data points with the same time stamp.
+	Policy DuplicatePolicy
+	// OnIngest applies the policy when a data point is added, so that
+	// duplicates take no room in the buffer. By default, the buffer keeps
+	// all data points, and the policy applies when they are queried.
+	OnIngest bool
+}
+
+// WithDuplicates sets the policy of every metric for data points with
+// the same time stamp.
+//
+// By default, the policy applies to the data points of queries, /csv,
+// /export, /value, and expressions. With cfg.OnIngest, Add, AddWithTime,
+// and AddCount apply it instead: a data point with the time stamp of a
+// data point in the buffer replaces or changes that data point rather
+// than taking a slot of its own. Subscribers are only notified of data
+// points that take a slot. The write-ahead log records the value that
+// results from DuplicatesKeepLast and DuplicatesAverage, and its replay
+// restores it. Replication, imports, and backfills skip data points whose
+// time stamp a metric has already, whatever the policy.
+func WithDuplicates(cfg DuplicateConfig) Option {
+	return func(srv *server) {
+		srv.metrics.dups = cfg
+	}
+}
+
+// dedupe replaces each run of data points with the same time stamp in
+// counts, which are sorted by time stamp, by one data point, and returns
+// the shortened counts.
+func (p DuplicatePolicy) dedupe(counts []Count) []Count {
+	out := counts[:0]
+	for i := 0; i < len(counts); {
+		j, sum := i+1, counts[i].N
+		for j < len(counts) && counts[j].T.Equal(counts[i].T) {
+			sum += counts[j].N
+			j++
+		}
+		c := counts[i]
+		switch p {
+		case DuplicatesKeepLast:
+			c = counts[j-1]
+		case DuplicatesAverage:
+			c.N = sum / float64(j-i)
+		}
+		out = append(out, c)
+		i = j
+	}
+	return out
+}
+
+// duplicate applies the policy of g to c if the buffer has a data point
+// with the time stamp of c, and reports whether it has done so. A changed
+// value goes to the write-ahead log. The caller must hold g.m.
+func (g *Metric) duplicate(c Count) bool {
+	g.sort()
+	n := g.list.len()
+	t := nanos(c.T)
+	for i := 1; i <= n; i++ {
+		j := (g.head + n - i) % n
+		if g.list.ns[j] < t {
+			return false
+		}
+		if g.list.ns[j] != t {
+			continue
+		}
+		switch g.dups.Policy {
+		case DuplicatesKeepLast:
+			g.list.n[j] = c.N
+		case DuplicatesAverage:
+			w := float64(max(g.weights[t], 1))
+			g.list.n[j] = (g.list.n[j]*w + c.N) / (w + 1)
+			if g.weights == nil {
+				g.weights = map[int64]int{}
+			}
+			g.weights[t] = int(w) + 1
+		}
+		if g.wal != nil && g.dups.Policy != DuplicatesKeepFirst {
+			g.wal.append(g.target, Count{g.list.n[j], c.T})
+		}
+		return true
+	}
+	return false
+}
+
+// replay adds the data points of the write-ahead log to g, like merge.
+// If g applies DuplicatesKeepLast or DuplicatesAverage on ingest, the log
+// has the resulting value of a data point after its first value, so the
+// last line of a time stamp determines the value.
+func (g *Metric) replay(counts []Count) {
+	g.m.Lock()
+	policy := g.dups.Policy
+	if !g.dups.OnIngest || policy != DuplicatesKeepLast && policy != DuplicatesAverage {
+		g.m.Unlock()
+		g.merge(counts)
+		return
+	}
+	last := make(map[int64]float64, len(counts))
+	for _, c := range counts {
+		last[nanos(c.T)] = c.N
+	}
+	for j, ns := range g.list.ns {
+		if n, ok := last[ns]; ok && ns != noTime {
+			g.list.n[j] = n
+			g.seq = nextSeq()
+		}
+	}
+	g.m.Unlock()
+	for i := range counts {
+		counts[i].N = last[nanos(counts[i].T)]
+	}
+	g.merge(counts)
+}
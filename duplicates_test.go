@@ -0,0 +1,92 @@
+package grada
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWithDuplicates(t *testing.T) {
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	added := []Count{{1, at(1)}, {2, at(2)}, {4, at(2)}, {3, at(3)}, {9, at(2)}}
+	tests := []struct {
+		name     string
+		cfg      DuplicateConfig
+		want     []Count
+		wantSlot int // slots in use
+	}{
+		{"keep all", DuplicateConfig{}, []Count{{1, at(1)}, {2, at(2)}, {4, at(2)}, {9, at(2)}, {3, at(3)}}, 5},
+		{"keep first", DuplicateConfig{Policy: DuplicatesKeepFirst}, []Count{{1, at(1)}, {2, at(2)}, {3, at(3)}}, 5},
+		{"keep last", DuplicateConfig{Policy: DuplicatesKeepLast}, []Count{{1, at(1)}, {9, at(2)}, {3, at(3)}}, 5},
+		{"average", DuplicateConfig{Policy: DuplicatesAverage}, []Count{{1, at(1)}, {5, at(2)}, {3, at(3)}}, 5},
+		{"keep first on ingest", DuplicateConfig{Policy: DuplicatesKeepFirst, OnIngest: true}, []Count{{1, at(1)}, {2, at(2)}, {3, at(3)}}, 3},
+		{"keep last on ingest", DuplicateConfig{Policy: DuplicatesKeepLast, OnIngest: true}, []Count{{1, at(1)}, {9, at(2)}, {3, at(3)}}, 3},
+		{"average on ingest", DuplicateConfig{Policy: DuplicatesAverage, OnIngest: true}, []Count{{1, at(1)}, {5, at(2)}, {3, at(3)}}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard(WithDuplicates(tt.cfg))
+			m, _ := d.CreateMetricWithBufSize("cpu", 10)
+			for _, c := range added {
+				m.AddCount(c)
+			}
+			if diff := cmp.Diff(tt.want, allCounts(t, d, "cpu")); diff != "" {
+				t.Errorf("data points mismatch (-want +got):\n%s", diff)
+			}
+			slots := 0
+			for _, ns := range m.list.ns {
+				if ns != noTime {
+					slots++
+				}
+			}
+			if slots != tt.wantSlot {
+				t.Errorf("%d slots in use, want %d", slots, tt.wantSlot)
+			}
+			v, _, _, err := d.srv.reduce("cpu", "sum", time.Time{}, endOfTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSum := 0.0
+			for _, c := range tt.want {
+				wantSum += c.N
+			}
+			if v != wantSum {
+				t.Errorf("sum = %v, want %v", v, wantSum)
+			}
+		})
+	}
+}
+
+func TestWithDuplicates_replay(t *testing.T) {
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	added := []Count{{1, at(1)}, {2, at(2)}, {4, at(2)}, {3, at(3)}, {9, at(2)}}
+	tests := []struct {
+		name string
+		cfg  DuplicateConfig
+		want []Count
+	}{
+		{"keep first on ingest", DuplicateConfig{Policy: DuplicatesKeepFirst, OnIngest: true}, []Count{{1, at(1)}, {2, at(2)}, {3, at(3)}}},
+		{"keep last on ingest", DuplicateConfig{Policy: DuplicatesKeepLast, OnIngest: true}, []Count{{1, at(1)}, {9, at(2)}, {3, at(3)}}},
+		{"average on ingest", DuplicateConfig{Policy: DuplicatesAverage, OnIngest: true}, []Count{{1, at(1)}, {5, at(2)}, {3, at(3)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wal := WithWAL(WALConfig{Path: filepath.Join(t.TempDir(), "grada.wal")})
+			d := NewDashboard(wal, WithDuplicates(tt.cfg))
+			m, _ := d.CreateMetricWithBufSize("cpu", 10)
+			for _, c := range added {
+				m.AddCount(c)
+			}
+			d.Shutdown(context.Background())
+
+			d = NewDashboard(wal, WithDuplicates(tt.cfg))
+			defer d.Shutdown(context.Background())
+			if diff := cmp.Diff(tt.want, allCounts(t, d, "cpu")); diff != "" {
+				t.Errorf("replayed data points mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package grada
+
+// Errors and error responses.
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Errors returned by Dashboard methods. The errors are wrapped with
+// details such as the target name; test for them with errors.Is.
+var (
+	// ErrMetricNotFound means that no metric exists for a target.
+	ErrMetricNotFound = errors.New("no such metric")
+	// ErrMetricExists means that a metric for a target exists already.
+	ErrMetricExists = errors.New("metric already exists")
+	// ErrBufferSize means that a buffer size is not positive.
+	ErrBufferSize = errors.New("buffer size must be positive")
+	// ErrBadTableQuery means that a table query has an invalid filter
+	// or sort directive.
+	ErrBadTableQuery = errors.New("invalid table query")
+	// ErrBadExpression means that an expression target cannot be parsed
+	// or evaluated.
+	ErrBadExpression = errors.New("invalid expression")
+	// ErrCollectorExists means that a collector of the same name is
+	// registered already.
+	ErrCollectorExists = errors.New("collector already exists")
+	// ErrCollectorNotFound means that no collector of a name is registered.
+	ErrCollectorNotFound = errors.New("no such collector")
+	// ErrUnordered means that data points to backfill are not sorted by
+	// time stamp, or lack a time stamp.
+	ErrUnordered = errors.New("data points out of order")
+	// ErrBackfillLimit means that a backfill would grow the buffer of a
+	// metric beyond its limit. See WithBackfillLimit.
+	ErrBackfillLimit = errors.New("backfill exceeds the buffer size limit")
+)
+
+// statusFor returns the HTTP status code for an error returned by
+// the metrics registry.
+func statusFor(e error) int {
+	switch {
+	case errors.Is(e, ErrMetricNotFound):
+		return http.StatusNotFound
+	case errors.Is(e, ErrMetricExists):
+		return http.StatusConflict
+	case errors.Is(e, ErrBackfillLimit):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(e, ErrBufferSize), errors.Is(e, ErrBadTableQuery), errors.Is(e, ErrBadExpression),
+		errors.Is(e, ErrUnordered):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// errorResponse is the JSON body of every error response.
+type errorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// writeError writes an error response with the given HTTP status code.
+// The message is m, followed by the error e unless e is nil.
+// The response includes the request ID if the request ID middleware
+// has set one.
+func writeError(w http.ResponseWriter, status int, e error, m string) {
+	if e != nil {
+		m += ": " + e.Error()
+	}
+	resp, _ := json.Marshal(errorResponse{
+		Error:     m,
+		RequestID: w.Header().Get(RequestIDHeader),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Disposition")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+// allowMethods responds with 405 Method Not Allowed to requests whose
+// method is not one of the given methods.
+func allowMethods(h http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				h(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, nil, "method "+r.Method+" not allowed")
+	}
+}
+
+// writeBodyError writes the response to a request whose body cannot be
+// read: 413 if the body exceeds its limit, 400 otherwise.
+func writeBodyError(w http.ResponseWriter, e error) {
+	var mbe *http.MaxBytesError
+	if errors.As(e, &mbe) {
+		writeError(w, http.StatusRequestEntityTooLarge, e, "request body too large")
+		return
+	}
+	writeError(w, http.StatusBadRequest, e, "Cannot read request body")
+}
@@ -0,0 +1,88 @@
+package grada
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_errorStatus(t *testing.T) {
+	srv := newServer()
+	srv.metrics.metric = map[string]*Metric{"target1": {list: newCountBuffer(1)}}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"badJSON", "POST", "/query", `{`, 400, ""},
+		{"noTargets", "POST", "/query", `{"targets": []}`, 400, ""},
+		{"badType", "POST", "/query", `{"targets": [{"target": "target1", "type": "graph"}]}`, 400, ""},
+		{"unknownTarget", "POST", "/query", `{"targets": [{"target": "nope", "type": "timeserie"}]}`, 404, ""},
+		{"queryGet", "GET", "/query", ``, 405, "POST"},
+		{"exportPost", "POST", "/export?target=target1", ``, 405, "GET, HEAD"},
+		{"unknownPath", "GET", "/nope", ``, 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			srv.handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if !strings.Contains(w.Body.String(), `"error":`) {
+				t.Errorf("body %s is not an error response", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetrics_errors(t *testing.T) {
+	m := &metrics{metric: map[string]*Metric{"target1": {list: newCountBuffer(1)}}}
+
+	tests := []struct {
+		name       string
+		f          func() error
+		want       error
+		wantStatus int
+	}{
+		{"get", func() error { _, err := m.Get("nope"); return err }, ErrMetricNotFound, 404},
+		{"delete", func() error { return m.Delete("nope") }, ErrMetricNotFound, 404},
+		{"exists", func() error { _, err := m.Create("target1", 1); return err }, ErrMetricExists, 409},
+		{"size", func() error { _, err := m.Create("target2", 0); return err }, ErrBufferSize, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error %v does not wrap %v", err, tt.want)
+			}
+			if got := statusFor(err); got != tt.wantStatus {
+				t.Errorf("statusFor(%v) = %d, want %d", err, got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestServer_bodyLimit(t *testing.T) {
+	d := NewDashboard(WithDialect("jsonds/", JSONDatasource))
+	huge := strings.Repeat(" ", maxQueryBytes+1)
+	for _, path := range []string{"/annotations", "/search", "/jsonds/variable"} {
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(huge)))
+		if w.Code != 413 {
+			t.Errorf("POST %s with a body over maxQueryBytes: status %d, want 413", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package grada
+
+// ETags for /query responses.
+//
+// Every change to a metric, a static table, or the metadata of a target
+// takes a number from a global write sequence. A hash of the query and the sequence numbers of its
+// targets changes whenever the response may change, so it serves as an
+// ETag without encoding the response first.
+
+import (
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// writeSeq is the global write sequence.
+var writeSeq atomic.Uint64
+
+// nextSeq returns the next number of the write sequence.
+func nextSeq() uint64 {
+	return writeSeq.Add(1)
+}
+
+// version returns the write sequence number of the last change to g.
+func (g *Metric) version() uint64 {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.seq
+}
+
+// queryETag returns the ETag for the response to q, or "" if a target of
+// q has no write sequence number, such as virtual series and tables that
+// are computed at query time.
+func (srv *server) queryETag(q *query, format string) string {
+	h := fnv.New64a()
+	h.Write([]byte(queryKey(q, format)))
+	var b []byte
+	for _, t := range q.Targets {
+		if t.Hide {
+			continue
+		}
+		var v uint64
+		if st, ok := srv.staticTable(t.Target); ok {
+			v = st.version()
+		} else {
+			srv.virtual.m.Lock()
+			_, virtual := srv.virtual.series[t.Target]
+			srv.virtual.m.Unlock()
+			if virtual {
+				return ""
+			}
+			metric, err := srv.metrics.Get(t.Target)
+			if err != nil {
+				return ""
+			}
+			v = metric.version()
+		}
+		b = strconv.AppendUint(b[:0], v, 10)
+		b = append(b, ',')
+		b = strconv.AppendUint(b, srv.meta.get(t.Target).seq, 10) // so does metadata, such as fill policies
+		b = append(b, srv.displayName(t.Target, "")...)
+		h.Write(append(b, ';'))
+	}
+	return `"` + strconv.FormatUint(h.Sum64(), 36) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header of r contains etag.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, header := range r.Header.Values("If-None-Match") {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// etagQueries adds an ETag header to /query responses, and responds with
+// 304 Not Modified if the client already has the current response.
+func (srv *server) etagQueries(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := peekQuery(w, r)
+		if err != nil {
+			h(w, r) // let h report the error
+			return
+		}
+		etag := srv.queryETag(q, responseFormat(r))
+		if etag == "" {
+			h(w, r)
+			return
+		}
+		if etagMatches(r, etag) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		h(&etagWriter{statusRecorder: statusRecorder{ResponseWriter: w}, etag: etag}, r)
+	}
+}
+
+// etagWriter sets the ETag header on successful, complete responses.
+type etagWriter struct {
+	statusRecorder
+	etag string
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.status == 0 && status == http.StatusOK {
+		ew.setETag()
+	}
+	ew.statusRecorder.WriteHeader(status)
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if ew.status == 0 {
+		ew.setETag()
+	}
+	return ew.statusRecorder.Write(b)
+}
+
+func (ew *etagWriter) setETag() {
+	if ew.Header().Get(PartialHeader) == "" {
+		ew.Header().Set("ETag", ew.etag)
+	}
+}
@@ -0,0 +1,75 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_etagQueries(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	d := NewDashboard()
+	metric, _ := d.CreateMetricWithBufSize("cpu", 10)
+	metric.AddWithTime(1, t0)
+	d.CreateForecast("cpu", "cpu:forecast", ForecastConfig{})
+	st, _ := d.CreateStaticTable("hosts", &Table{Columns: []Column{{"Host", ColumnString}}})
+
+	query := func(target, etag string) (int, string) {
+		typ := "timeserie"
+		if target == "hosts" {
+			typ = "table"
+		}
+		body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "targets": [{"target": "` + target + `", "type": "` + typ + `"}]}`
+		r := httptest.NewRequest("POST", "/query", strings.NewReader(body))
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, r)
+		return w.Code, w.Header().Get("ETag")
+	}
+
+	code, etag := query("cpu", "")
+	if code != 200 || etag == "" {
+		t.Fatalf("first query: status %d, ETag %q; want 200 and an ETag", code, etag)
+	}
+	if code, _ := query("cpu", etag); code != 304 {
+		t.Errorf("query with current ETag: status %d, want 304", code)
+	}
+	if code, _ := query("cpu", `"other", `+etag); code != 304 {
+		t.Errorf("query with an ETag list: status %d, want 304", code)
+	}
+
+	metric.AddWithTime(2, t0.Add(time.Second))
+	code, newTag := query("cpu", etag)
+	if code != 200 || newTag == etag {
+		t.Errorf("query after Add: status %d, ETag %q; want 200 and a new ETag", code, newTag)
+	}
+	for name, set := range map[string]func(){
+		"SetFill":        func() { d.SetFill("cpu", FillZero) },
+		"SetAggregation": func() { d.SetAggregation("cpu", "max") },
+	} {
+		_, etag := query("cpu", "")
+		set()
+		if code, _ := query("cpu", etag); code != 200 {
+			t.Errorf("query after %s: status %d, want 200", name, code)
+		}
+	}
+
+	_, tableTag := query("hosts", "")
+	if code, _ := query("hosts", tableTag); code != 304 {
+		t.Errorf("static table query with current ETag: status %d, want 304", code)
+	}
+	st.Update(&Table{Columns: []Column{{"Host", ColumnString}}, Rows: [][]interface{}{{"a"}}})
+	if code, _ := query("hosts", tableTag); code != 200 {
+		t.Errorf("static table query after Update: status %d, want 200", code)
+	}
+
+	if _, etag := query("cpu:forecast", ""); etag != "" {
+		t.Errorf("virtual series query: ETag %q, want none", etag)
+	}
+	if code, etag := query("nope", ""); code != 404 || etag != "" {
+		t.Errorf("unknown target: status %d, ETag %q; want 404 and no ETag", code, etag)
+	}
+}
@@ -0,0 +1,104 @@
+package grada
+
+// Event targets: string messages with time stamps.
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event is a ring buffer of messages with time stamps, for occurrences
+// such as "config reloaded" or "circuit breaker opened".
+//
+// Grafana receives the messages of an event target as annotations, through
+// the annotation query "event:<target>", and as a table with the columns
+// "Time" and "Message".
+type Event struct {
+	m    sync.Mutex
+	list []eventEntry
+	head int
+}
+
+// eventEntry is a single message of an Event.
+type eventEntry struct {
+	T   time.Time
+	Msg string
+}
+
+// Record adds a message to the event buffer, along with the current time stamp.
+// When the buffer is full, every new message overwrites the oldest one.
+func (e *Event) Record(msg string) {
+	e.RecordWithTime(msg, time.Now())
+}
+
+// RecordWithTime adds a message with the given time stamp to the event buffer.
+func (e *Event) RecordWithTime(msg string, t time.Time) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.list[e.head] = eventEntry{t, msg}
+	e.head = (e.head + 1) % len(e.list)
+}
+
+// fetch returns the messages within [from, to], sorted by time.
+func (e *Event) fetch(from, to time.Time) []eventEntry {
+	e.m.Lock()
+	defer e.m.Unlock()
+	var entries []eventEntry
+	for i := range e.list {
+		entry := e.list[(i+e.head)%len(e.list)]
+		if !entry.T.IsZero() && !entry.T.Before(from) && !entry.T.After(to) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].T.Before(entries[j].T) })
+	return entries
+}
+
+// CreateEvent creates an event target that holds up to size messages.
+// Creating an event for an existing target fails with ErrMetricExists.
+func (d *Dashboard) CreateEvent(target string, size int) (*Event, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrBufferSize, size)
+	}
+	e := &Event{list: make([]eventEntry, size)}
+	err := d.srv.addTable(target, func(from, to time.Time) (*Table, error) {
+		t := &Table{Columns: []Column{{Text: "Time", Type: ColumnTime}, {Text: "Message", Type: ColumnString}}}
+		for _, entry := range e.fetch(from, to) {
+			t.Rows = append(t.Rows, []interface{}{entry.T, entry.Msg})
+		}
+		return t, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.srv.eventsMu.Lock()
+	defer d.srv.eventsMu.Unlock()
+	if d.srv.events == nil {
+		d.srv.events = map[string]*Event{}
+	}
+	d.srv.events[target] = e
+	return e, nil
+}
+
+// eventAnnotations returns the messages of the event target within
+// [from, to] as annotations.
+func (srv *server) eventAnnotations(info annotationInfo, target string, from, to time.Time) ([]annotationResponse, error) {
+	srv.eventsMu.Lock()
+	e, ok := srv.events[target]
+	srv.eventsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMetricNotFound, target)
+	}
+	annotations := []annotationResponse{}
+	for _, entry := range e.fetch(from, to) {
+		annotations = append(annotations, annotationResponse{
+			Annotation: info,
+			Time:       entry.T.UnixNano() / int64(time.Millisecond),
+			Title:      entry.Msg,
+			Tags:       []string{target},
+		})
+	}
+	return annotations, nil
+}
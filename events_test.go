@@ -0,0 +1,53 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard_CreateEvent(t *testing.T) {
+	d := NewDashboard()
+	e, err := d.CreateEvent("breaker", 2)
+	if err != nil {
+		t.Fatalf("CreateEvent(): %v", err)
+	}
+	if _, err := d.CreateEvent("breaker", 2); err == nil {
+		t.Errorf("second CreateEvent(): no error")
+	}
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	e.RecordWithTime("opened", t0)
+	e.RecordWithTime("half-open", t0.Add(2*time.Minute))
+	e.RecordWithTime("closed", t0.Add(time.Minute)) // overwrites "opened"
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		want string
+	}{
+		{
+			"annotations",
+			"/annotations",
+			`{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "annotation": {"name": "b", "query": "event:breaker"}}`,
+			`[{"annotation":{"name":"b","datasource":"","iconColor":"","enable":false,"query":"event:breaker"},"time":1508929260000,"title":"closed","tags":["breaker"]},` +
+				`{"annotation":{"name":"b","datasource":"","iconColor":"","enable":false,"query":"event:breaker"},"time":1508929320000,"title":"half-open","tags":["breaker"]}]`,
+		},
+		{
+			"table",
+			"/query",
+			`{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T11:01:30Z"}, "targets": [{"target": "breaker", "type": "table"}]}`,
+			`[{"columns":[{"text":"Time","type":"time"},{"text":"Message","type":"string"}],"rows":[[1508929260000,"closed"]],"type":"table"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", tt.url, strings.NewReader(tt.body)))
+			if w.Body.String() != tt.want {
+				t.Errorf("%s:\ngot  %s\nwant %s", tt.url, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
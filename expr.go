@@ -0,0 +1,738 @@
+package grada
+
+// Expressions over metrics, in the style of PromQL.
+//
+// With WithExpressions, a time series target that does not name a target
+// may be an expression such as
+//
+//	rate(requests[1m])
+//	sum("cpu.*")
+//	errors / requests * 100
+//	max_over_time(latency[5m])
+//
+// Expressions consist of
+//
+//   - metric selectors: a metric name, or a pattern in double quotes with
+//     the wildcards * and ? that selects all matching metrics, such as
+//     "cpu.*" (see path.Match). Names that contain other characters than
+//     letters, digits, _, ., and :, such as "cpu-0", go in double quotes,
+//     too. A pattern that matches no metric is an error;
+//   - range selectors: a selector followed by a duration in brackets, such
+//     as requests[5m], as the argument of a range function;
+//   - range functions: rate, increase, resets, delta, avg_over_time,
+//     min_over_time, max_over_time, sum_over_time, count_over_time;
+//   - aggregations: sum, avg, min, max, count, which combine all selected
+//     series into one;
+//   - abs, numbers, the operators + - * /, and parentheses.
+//
+// rate and increase treat every decrease of a value as a reset of the
+// counter to zero, such as after a restart of the process that counts,
+// and extrapolate to the edges of the window, as Prometheus does.
+// resets counts the resets within the window.
+//
+// The server evaluates expressions at evenly spaced steps across the query
+// range, at most maxDataPoints of them. At each step, a selector yields
+// the latest data point of each metric within the last five minutes.
+// Operators between two selections match series by metric name; a single
+// series matches every series on the other side.
+//
+// A single resulting series is named after the expression; several
+// resulting series are named after their metrics.
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// lookback is how far a selector looks back for the latest data point.
+const lookback = 5 * time.Minute
+
+// WithExpressions lets time series queries use expressions over metrics
+// as targets. See expr.go for the supported syntax.
+func WithExpressions() Option {
+	return func(srv *server) {
+		srv.expressions = true
+	}
+}
+
+// isExpression reports whether target looks like an expression rather
+// than a target name.
+func isExpression(target string) bool {
+	return strings.ContainsAny(target, "()[]+*/? \"")
+}
+
+// exprSeries is a series evaluated at the steps of a query.
+// NaN values mark steps without a value.
+type exprSeries struct {
+	name   string
+	values []float64
+}
+
+// exprValue is the result of evaluating an expression: a scalar, or a set
+// of series.
+type exprValue struct {
+	scalar bool
+	v      float64
+	series []exprSeries
+}
+
+// exprContext holds the steps at which an expression is evaluated.
+type exprContext struct {
+	srv   *server
+	steps []time.Time
+}
+
+// exprNode is a node of the syntax tree of an expression.
+type exprNode interface {
+	eval(ctx *exprContext) (exprValue, error)
+}
+
+type (
+	numberNode   float64
+	selectorNode struct {
+		pattern string
+		window  time.Duration // range selector if > 0
+	}
+	callNode struct {
+		fn  string
+		arg exprNode
+	}
+	binaryNode struct {
+		op          byte
+		left, right exprNode
+	}
+	negNode struct{ arg exprNode }
+)
+
+// rangeFuncs compute a value from the data points within the window
+// (start, end].
+var rangeFuncs = map[string]func(cs []Count, start, end time.Time) float64{
+	"rate": func(cs []Count, start, end time.Time) float64 {
+		return extrapolatedIncrease(cs, start, end) / end.Sub(start).Seconds()
+	},
+	"increase": extrapolatedIncrease,
+	"resets": func(cs []Count, _, _ time.Time) float64 {
+		var resets float64
+		for i := 1; i < len(cs); i++ {
+			if cs[i].N < cs[i-1].N {
+				resets++
+			}
+		}
+		return resets
+	},
+	"delta": func(cs []Count, _, _ time.Time) float64 {
+		if len(cs) < 2 {
+			return math.NaN()
+		}
+		return cs[len(cs)-1].N - cs[0].N
+	},
+	"avg_over_time": func(cs []Count, _, _ time.Time) float64 {
+		var sum float64
+		for _, c := range cs {
+			sum += c.N
+		}
+		return sum / float64(len(cs))
+	},
+	"min_over_time": func(cs []Count, _, _ time.Time) float64 {
+		m := math.Inf(1)
+		for _, c := range cs {
+			m = math.Min(m, c.N)
+		}
+		return m
+	},
+	"max_over_time": func(cs []Count, _, _ time.Time) float64 {
+		m := math.Inf(-1)
+		for _, c := range cs {
+			m = math.Max(m, c.N)
+		}
+		return m
+	},
+	"sum_over_time": func(cs []Count, _, _ time.Time) float64 {
+		var sum float64
+		for _, c := range cs {
+			sum += c.N
+		}
+		return sum
+	},
+	"count_over_time": func(cs []Count, _, _ time.Time) float64 {
+		return float64(len(cs))
+	},
+}
+
+// extrapolatedIncrease returns the increase of a counter within the
+// window (start, end], as Prometheus computes it: the increase from the
+// first to the last data point, with every decrease treated as a counter
+// reset, extrapolated to the edges of the window. The extrapolation
+// reaches at most half an average interval beyond a data point that is
+// more than 1.1 average intervals away from the edge, as at the start or
+// end of a series, and never reaches below zero.
+func extrapolatedIncrease(cs []Count, start, end time.Time) float64 {
+	if len(cs) < 2 {
+		return math.NaN()
+	}
+	first, last := cs[0], cs[len(cs)-1]
+	sampled := last.T.Sub(first.T).Seconds()
+	if sampled <= 0 {
+		return math.NaN()
+	}
+	inc := counterIncrease(cs)
+	avg := sampled / float64(len(cs)-1)
+	toStart := first.T.Sub(start).Seconds()
+	toEnd := end.Sub(last.T).Seconds()
+	if inc > 0 && first.N >= 0 {
+		// The counter was zero at most this long before the first data point.
+		toStart = math.Min(toStart, sampled*first.N/inc)
+	}
+	extrapolated := sampled
+	for _, d := range []float64{toStart, toEnd} {
+		if d < 1.1*avg {
+			extrapolated += d
+		} else {
+			extrapolated += avg / 2
+		}
+	}
+	return inc * extrapolated / sampled
+}
+
+// counterIncrease returns the increase of a counter across cs, treating
+// every decrease as a counter reset: a restart of the process that
+// counts, after which the counter starts again at zero.
+func counterIncrease(cs []Count) float64 {
+	var inc float64
+	for i := 1; i < len(cs); i++ {
+		if d := cs[i].N - cs[i-1].N; d >= 0 {
+			inc += d
+		} else {
+			inc += cs[i].N // reset to 0 in between
+		}
+	}
+	return inc
+}
+
+// aggregations combine the values of several series at one step.
+var aggregations = map[string]func(vs []float64) float64{
+	"sum": func(vs []float64) float64 {
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+		return sum
+	},
+	"avg": func(vs []float64) float64 {
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+		return sum / float64(len(vs))
+	},
+	"min": func(vs []float64) float64 {
+		m := math.Inf(1)
+		for _, v := range vs {
+			m = math.Min(m, v)
+		}
+		return m
+	},
+	"max": func(vs []float64) float64 {
+		m := math.Inf(-1)
+		for _, v := range vs {
+			m = math.Max(m, v)
+		}
+		return m
+	},
+	"count": func(vs []float64) float64 {
+		return float64(len(vs))
+	},
+}
+
+func (n numberNode) eval(ctx *exprContext) (exprValue, error) {
+	return exprValue{scalar: true, v: float64(n)}, nil
+}
+
+// metrics returns the names of the metrics that the selector selects.
+func (n selectorNode) metrics(srv *server) ([]string, error) {
+	if !strings.ContainsAny(n.pattern, "*?[") {
+		if _, err := srv.metrics.Get(n.pattern); err != nil {
+			return nil, err
+		}
+		return []string{n.pattern}, nil
+	}
+	var names []string
+	srv.metrics.m.Lock()
+	for name := range srv.metrics.metric {
+		if ok, _ := path.Match(n.pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	srv.metrics.m.Unlock()
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: no metric matches %q", ErrBadExpression, n.pattern)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// counts returns the data points of a metric that the selector needs for
+// evaluating the steps of ctx.
+func (n selectorNode) counts(ctx *exprContext, name string) ([]Count, error) {
+	metric, err := ctx.srv.metrics.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	window := n.window
+	if window == 0 {
+		window = lookback
+	}
+	from := ctx.steps[0].Add(-window)
+	to := ctx.steps[len(ctx.steps)-1].Add(time.Nanosecond)
+	return metric.appendCounts(nil, from, to, math.MaxInt), nil
+}
+
+func (n selectorNode) eval(ctx *exprContext) (exprValue, error) {
+	if n.window > 0 {
+		return exprValue{}, fmt.Errorf("%w: range selector %s[%s] outside of a range function", ErrBadExpression, n.pattern, n.window)
+	}
+	return n.evalWindows(ctx, func(cs []Count, _, _ time.Time) float64 {
+		return cs[len(cs)-1].N // the latest data point
+	})
+}
+
+// evalWindows evaluates f at each step for the data points of each
+// selected metric within the window before the step. Steps with an empty
+// window have no value.
+func (n selectorNode) evalWindows(ctx *exprContext, f func(cs []Count, start, end time.Time) float64) (exprValue, error) {
+	names, err := n.metrics(ctx.srv)
+	if err != nil {
+		return exprValue{}, err
+	}
+	window := n.window
+	if window == 0 {
+		window = lookback
+	}
+	result := exprValue{series: make([]exprSeries, len(names))}
+	for i, name := range names {
+		cs, err := n.counts(ctx, name)
+		if err != nil {
+			return exprValue{}, err
+		}
+		values := make([]float64, len(ctx.steps))
+		start, end := 0, 0
+		for k, t := range ctx.steps {
+			for end < len(cs) && !cs[end].T.After(t) {
+				end++
+			}
+			for start < end && !cs[start].T.After(t.Add(-window)) {
+				start++
+			}
+			if start == end {
+				values[k] = math.NaN()
+				continue
+			}
+			values[k] = f(cs[start:end], t.Add(-window), t)
+		}
+		result.series[i] = exprSeries{name: name, values: values}
+	}
+	return result, nil
+}
+
+func (n callNode) eval(ctx *exprContext) (exprValue, error) {
+	if f, ok := rangeFuncs[n.fn]; ok {
+		sel, ok := n.arg.(selectorNode)
+		if !ok || sel.window == 0 {
+			return exprValue{}, fmt.Errorf("%w: %s requires a range selector such as x[5m]", ErrBadExpression, n.fn)
+		}
+		return sel.evalWindows(ctx, f)
+	}
+	arg, err := n.arg.eval(ctx)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if n.fn == "abs" {
+		return arg.apply(math.Abs), nil
+	}
+	agg := aggregations[n.fn]
+	if arg.scalar {
+		return exprValue{}, fmt.Errorf("%w: %s requires series, not a number", ErrBadExpression, n.fn)
+	}
+	values := make([]float64, len(ctx.steps))
+	vs := make([]float64, 0, len(arg.series))
+	for k := range values {
+		vs = vs[:0]
+		for _, s := range arg.series {
+			if !math.IsNaN(s.values[k]) {
+				vs = append(vs, s.values[k])
+			}
+		}
+		if len(vs) == 0 {
+			values[k] = math.NaN()
+			continue
+		}
+		values[k] = agg(vs)
+	}
+	return exprValue{series: []exprSeries{{values: values}}}, nil
+}
+
+// apply returns the result of f applied to every value of v.
+func (v exprValue) apply(f func(float64) float64) exprValue {
+	if v.scalar {
+		return exprValue{scalar: true, v: f(v.v)}
+	}
+	result := exprValue{series: make([]exprSeries, len(v.series))}
+	for i, s := range v.series {
+		values := make([]float64, len(s.values))
+		for k, x := range s.values {
+			values[k] = f(x)
+		}
+		result.series[i] = exprSeries{name: s.name, values: values}
+	}
+	return result
+}
+
+func (n negNode) eval(ctx *exprContext) (exprValue, error) {
+	arg, err := n.arg.eval(ctx)
+	if err != nil {
+		return exprValue{}, err
+	}
+	return arg.apply(func(x float64) float64 { return -x }), nil
+}
+
+// arith applies an arithmetic operator.
+func arith(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	}
+	if b == 0 {
+		return math.NaN() // no value rather than an infinite one
+	}
+	return a / b
+}
+
+func (n binaryNode) eval(ctx *exprContext) (exprValue, error) {
+	l, err := n.left.eval(ctx)
+	if err != nil {
+		return exprValue{}, err
+	}
+	r, err := n.right.eval(ctx)
+	if err != nil {
+		return exprValue{}, err
+	}
+	switch {
+	case l.scalar && r.scalar:
+		return exprValue{scalar: true, v: arith(n.op, l.v, r.v)}, nil
+	case r.scalar:
+		return l.apply(func(x float64) float64 { return arith(n.op, x, r.v) }), nil
+	case l.scalar:
+		return r.apply(func(x float64) float64 { return arith(n.op, l.v, x) }), nil
+	}
+
+	// Match series by name, or a single series with every series.
+	pair := func(ls, rs exprSeries, name string) exprSeries {
+		values := make([]float64, len(ls.values))
+		for k := range values {
+			values[k] = arith(n.op, ls.values[k], rs.values[k])
+		}
+		return exprSeries{name: name, values: values}
+	}
+	var result exprValue
+	switch {
+	case len(r.series) == 1:
+		for _, s := range l.series {
+			result.series = append(result.series, pair(s, r.series[0], s.name))
+		}
+	case len(l.series) == 1:
+		for _, s := range r.series {
+			result.series = append(result.series, pair(l.series[0], s, s.name))
+		}
+	default:
+		byName := map[string]exprSeries{}
+		for _, s := range r.series {
+			byName[s.name] = s
+		}
+		for _, s := range l.series {
+			if rs, ok := byName[s.name]; ok {
+				result.series = append(result.series, pair(s, rs, s.name))
+			}
+		}
+	}
+	return result, nil
+}
+
+// exprToken is a token of an expression.
+type exprToken struct {
+	kind byte // 'n'ame, 'q'uoted name, 'd'igits (a number), 'w'indow, 'o'perator, or 0 at the end
+	text string
+}
+
+// isExprNameRune reports whether r may be part of an unquoted metric name.
+// Patterns go in double quotes, so that * is always a multiplication.
+func isExprNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:", r)
+}
+
+// exprTokens splits an expression into tokens.
+func exprTokens(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	last := func() exprToken {
+		if len(tokens) == 0 {
+			return exprToken{}
+		}
+		return tokens[len(tokens)-1]
+	}
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		j := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case last().kind == 'o' && last().text == "[":
+			for j < len(rs) && rs[j] != ']' {
+				j++
+			}
+			tokens = append(tokens, exprToken{'w', strings.TrimSpace(string(rs[i:j]))})
+		case r == '"':
+			for j < len(rs) && rs[j] != '"' {
+				j++
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("%w: unterminated name", ErrBadExpression)
+			}
+			tokens = append(tokens, exprToken{'q', string(rs[i+1 : j])})
+			j++
+		case strings.ContainsRune("+-*/()[]", r):
+			tokens = append(tokens, exprToken{'o', string(r)})
+		case unicode.IsDigit(r):
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || strings.ContainsRune(".eE", rs[j]) ||
+				strings.ContainsRune("+-", rs[j]) && strings.ContainsRune("eE", rs[j-1])) {
+				j++
+			}
+			tokens = append(tokens, exprToken{'d', string(rs[i:j])})
+		case isExprNameRune(r):
+			for j < len(rs) && isExprNameRune(rs[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{'n', string(rs[i:j])})
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q", ErrBadExpression, r)
+		}
+		i = j
+	}
+	return tokens, nil
+}
+
+// exprParser is a recursive descent parser for expressions.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return exprToken{}
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// expect consumes the operator op.
+func (p *exprParser) expect(op string) error {
+	if t := p.next(); t.kind != 'o' || t.text != op {
+		return fmt.Errorf("%w: expected %q, found %q", ErrBadExpression, op, t.text)
+	}
+	return nil
+}
+
+// parseExpr parses an expression.
+func parseExpr(s string) (exprNode, error) {
+	tokens, err := exprTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	n, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrBadExpression, p.peek().text)
+	}
+	return n, nil
+}
+
+// sum parses terms separated by + and -.
+func (p *exprParser) sum() (exprNode, error) {
+	n, err := p.product()
+	for err == nil && p.peek().kind == 'o' && (p.peek().text == "+" || p.peek().text == "-") {
+		op := p.next().text[0]
+		var r exprNode
+		r, err = p.product()
+		n = binaryNode{op, n, r}
+	}
+	return n, err
+}
+
+// product parses factors separated by * and /.
+func (p *exprParser) product() (exprNode, error) {
+	n, err := p.unary()
+	for err == nil && p.peek().kind == 'o' && (p.peek().text == "*" || p.peek().text == "/") {
+		op := p.next().text[0]
+		var r exprNode
+		r, err = p.unary()
+		n = binaryNode{op, n, r}
+	}
+	return n, err
+}
+
+// unary parses a factor with an optional sign.
+func (p *exprParser) unary() (exprNode, error) {
+	if t := p.peek(); t.kind == 'o' && (t.text == "-" || t.text == "+") {
+		p.next()
+		n, err := p.unary()
+		if t.text == "-" {
+			n = negNode{n}
+		}
+		return n, err
+	}
+	return p.primary()
+}
+
+// primary parses a number, a selector, a call, or a parenthesized expression.
+func (p *exprParser) primary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case 'd':
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad number %q", ErrBadExpression, t.text)
+		}
+		return numberNode(v), nil
+	case 'o':
+		if t.text != "(" {
+			break
+		}
+		n, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case 'n', 'q':
+		if next := p.peek(); t.kind == 'n' && next.kind == 'o' && next.text == "(" {
+			return p.call(t.text)
+		}
+		sel := selectorNode{pattern: t.text}
+		if next := p.peek(); next.kind == 'o' && next.text == "[" {
+			p.next()
+			window, err := parseWindow(p.next().text)
+			if err != nil {
+				return nil, err
+			}
+			sel.window = window
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		return sel, nil
+	}
+	if t.kind == 0 {
+		return nil, fmt.Errorf("%w: unexpected end", ErrBadExpression)
+	}
+	return nil, fmt.Errorf("%w: unexpected %q", ErrBadExpression, t.text)
+}
+
+// call parses the argument of a function call.
+func (p *exprParser) call(fn string) (exprNode, error) {
+	if _, ok := rangeFuncs[fn]; !ok && aggregations[fn] == nil && fn != "abs" {
+		return nil, fmt.Errorf("%w: unknown function %s", ErrBadExpression, fn)
+	}
+	p.next() // (
+	arg, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return callNode{fn, arg}, p.expect(")")
+}
+
+// parseWindow parses the duration of a range selector, such as 30s, 5m,
+// or 1d.
+func parseWindow(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		var days int
+		days, err = strconv.Atoi(n)
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: bad range %q", ErrBadExpression, s)
+	}
+	return d, nil
+}
+
+// exprSteps returns the evaluation steps for a query range: at most
+// maxDataPoints steps that end at to, at least interval apart.
+func exprSteps(from, to time.Time, interval time.Duration, maxDataPoints int) []time.Time {
+	if maxDataPoints <= 0 || to.Before(from) {
+		return nil
+	}
+	step := max(interval, to.Sub(from)/time.Duration(maxDataPoints), time.Millisecond)
+	var steps []time.Time
+	for t := to; !t.Before(from) && len(steps) < maxDataPoints; t = t.Add(-step) {
+		steps = append(steps, t)
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return steps
+}
+
+// evalExpr evaluates an expression target for a query.
+func (srv *server) evalExpr(target string, from, to time.Time, interval time.Duration, maxDataPoints int) ([]series, error) {
+	n, err := parseExpr(target)
+	if err != nil {
+		return nil, err
+	}
+	ctx := &exprContext{srv: srv, steps: exprSteps(from, to, interval, maxDataPoints)}
+	if len(ctx.steps) == 0 {
+		return []series{{target: target, rows: []row{}}}, nil
+	}
+	v, err := n.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if v.scalar {
+		v = exprValue{series: []exprSeries{{values: make([]float64, len(ctx.steps))}}}.apply(func(float64) float64 { return v.v })
+	}
+	result := make([]series, len(v.series))
+	for i, s := range v.series {
+		name := s.name
+		if len(v.series) == 1 {
+			name = target
+		}
+		rows := []row{}
+		for k, x := range s.values {
+			if !math.IsNaN(x) {
+				rows = append(rows, row{x, ctx.steps[k].UnixNano() / int64(time.Millisecond)})
+			}
+		}
+		result[i] = series{target: name, rows: rows}
+	}
+	return result, nil
+}
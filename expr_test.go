@@ -0,0 +1,179 @@
+package grada
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExprTokens(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`sum("cpu.*")`, []string{"sum", "(", "cpu.*", ")"}},
+		{"a * b*c", []string{"a", "*", "b", "*", "c"}},
+		{"a/b*100", []string{"a", "/", "b", "*", "100"}},
+		{"2*3", []string{"2", "*", "3"}},
+		{"rate(x[1m]) / 1e3", []string{"rate", "(", "x", "[", "1m", "]", ")", "/", "1e3"}},
+		{`"cpu-0" - 1`, []string{"cpu-0", "-", "1"}},
+	}
+	for _, tt := range tests {
+		tokens, err := exprTokens(tt.expr)
+		if err != nil {
+			t.Errorf("exprTokens(%q): %v", tt.expr, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens {
+			got = append(got, tok.text)
+		}
+		if !cmp.Equal(got, tt.want) {
+			t.Errorf("exprTokens(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestServer_evalExpr(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	d := NewDashboard(WithExpressions())
+	requests, _ := d.CreateMetricWithBufSize("requests", 100)
+	errs, _ := d.CreateMetricWithBufSize("errors", 100)
+	cpu0, _ := d.CreateMetricWithBufSize("cpu.0", 100)
+	cpu1, _ := d.CreateMetricWithBufSize("cpu.1", 100)
+	// A counter that grows by 60 per minute, with a reset before 11:03.
+	for i := 0; i <= 5; i++ {
+		ti := t0.Add(time.Duration(i) * time.Minute)
+		n := float64(i * 60)
+		if i >= 3 {
+			n = float64((i-3)*60 + 30)
+		}
+		requests.AddWithTime(n, ti)
+		errs.AddWithTime(n/10, ti)
+		cpu0.AddWithTime(float64(i), ti)
+		cpu1.AddWithTime(float64(10*i), ti)
+	}
+
+	from, to := t0.Add(2*time.Minute), t0.Add(5*time.Minute)
+	tests := []struct {
+		name       string
+		expr       string
+		wantNames  []string
+		wantValues [][]float64 // per series, at 11:02..11:05
+		wantErr    error
+	}{
+		{"sum", `sum("cpu.*")`, []string{`sum("cpu.*")`}, [][]float64{{22, 33, 44, 55}}, nil},
+		{"glob", `"cpu.*"*2`, []string{"cpu.0", "cpu.1"}, [][]float64{{4, 6, 8, 10}, {40, 60, 80, 100}}, nil},
+		{"rate", "rate(requests[2m])", []string{"rate(requests[2m])"}, [][]float64{{1, 0.5, 0.75, 1}}, nil},
+		{"increase", "increase(requests[2m])", []string{"increase(requests[2m])"}, [][]float64{{120, 60, 90, 120}}, nil},
+		{"resets", "resets(requests[2m])", []string{"resets(requests[2m])"}, [][]float64{{0, 1, 0, 0}}, nil},
+		{"ratio", "errors / requests * 100", []string{"errors / requests * 100"}, [][]float64{{10, 10, 10, 10}}, nil},
+		{"ratioWithoutSpaces", "errors/requests*100", []string{"errors/requests*100"}, [][]float64{{10, 10, 10, 10}}, nil},
+		{"precedence", "-cpu.0 + 2 * (1 + 1)", []string{"-cpu.0 + 2 * (1 + 1)"}, [][]float64{{2, 1, 0, -1}}, nil},
+		{"maxOverTime", "max_over_time(cpu.1[3m])", []string{"max_over_time(cpu.1[3m])"}, [][]float64{{20, 30, 40, 50}}, nil},
+		{"scalar", "1 + 1", []string{"1 + 1"}, [][]float64{{2, 2, 2, 2}}, nil},
+		{"unknownMetric", "nope + 1", nil, nil, ErrMetricNotFound},
+		{"noMatch", `sum("mem.*")`, nil, nil, ErrBadExpression},
+		{"unquotedGlob", "sum(cpu.*)", nil, nil, ErrBadExpression},
+		{"unknownFunc", "foo(cpu.0)", nil, nil, ErrBadExpression},
+		{"rangeWithoutFunc", "cpu.0[1m]", nil, nil, ErrBadExpression},
+		{"rateWithoutRange", "rate(cpu.0)", nil, nil, ErrBadExpression},
+		{"syntax", "(cpu.0", nil, nil, ErrBadExpression},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.srv.evalExpr(tt.expr, from, to, time.Minute, 4)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("evalExpr() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var names []string
+			var values [][]float64
+			for _, s := range got {
+				names = append(names, s.target)
+				var vs []float64
+				for _, r := range s.rows {
+					vs = append(vs, r[0].(float64))
+				}
+				values = append(values, vs)
+			}
+			if !cmp.Equal(names, tt.wantNames) || !cmp.Equal(values, tt.wantValues) {
+				t.Errorf("evalExpr():\ngot  %v %v\nwant %v %v", names, values, tt.wantNames, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestExprSteps(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	steps := exprSteps(t0, t0.Add(time.Hour), 0, 60)
+	if len(steps) != 60 || !steps[59].Equal(t0.Add(time.Hour)) || steps[1].Sub(steps[0]) != time.Minute {
+		t.Errorf("exprSteps() = %d steps from %v to %v", len(steps), steps[0], steps[len(steps)-1])
+	}
+	if steps := exprSteps(t0, t0.Add(time.Hour), 10*time.Minute, 60); len(steps) != 7 {
+		t.Errorf("exprSteps() with interval = %d steps, want 7", len(steps))
+	}
+}
+
+func TestExtrapolatedIncrease(t *testing.T) {
+	points := func(values ...float64) []Count {
+		cs := make([]Count, len(values))
+		for i, v := range values {
+			cs[i] = Count{v, time.Unix(int64(10*(i+1)), 0)}
+		}
+		return cs
+	}
+	tests := []struct {
+		name       string
+		cs         []Count
+		start, end int64
+		want       float64
+	}{
+		{"from zero", points(0, 10, 20), 0, 30, 20},
+		{"reset", points(100, 110, 5), 0, 30, 22.5},
+		{"series starts late", points(100, 110), -40, 20, 15},
+		{"not below zero", points(10, 20), -40, 20, 20},
+		{"single point", points(10), 0, 10, math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extrapolatedIncrease(tt.cs, time.Unix(tt.start, 0), time.Unix(tt.end, 0))
+			if got != tt.want && !(math.IsNaN(got) && math.IsNaN(tt.want)) {
+				t.Errorf("extrapolatedIncrease() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_queryExpression(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	d := NewDashboard(WithExpressions())
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	m.AddWithTime(0.5, t0)
+
+	body := `{"range": {"from": "2017-10-25T10:59:00Z", "to": "2017-10-25T11:00:00Z"}, "maxDataPoints": 1, "targets": [{"target": "cpu * 100"}, {"target": "cpu"}]}`
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	var resp []timeseriesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot unmarshal %s: %v", w.Body.String(), err)
+	}
+	if len(resp) != 2 || resp[0].Target != "cpu * 100" || len(resp[0].Datapoints) != 1 || resp[0].Datapoints[0][0] != 50.0 {
+		t.Errorf("query: %s", w.Body.String())
+	}
+
+	body = `{"range": {"from": "2017-10-25T10:59:00Z", "to": "2017-10-25T11:00:00Z"}, "maxDataPoints": 1, "targets": [{"target": "cpu * (2"}]}`
+	w = httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	if w.Code != 400 {
+		t.Errorf("bad expression: status %d, want 400", w.Code)
+	}
+}
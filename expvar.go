@@ -0,0 +1,171 @@
+package grada
+
+// Discovery of expvar variables.
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExpvarConfig configures the discovery of expvar variables.
+// See DiscoverExpvar.
+type ExpvarConfig struct {
+	// Interval is the time between two samples. Default is 10 seconds.
+	Interval time.Duration
+	// Prefix is prepended to all target names, for example "app.".
+	Prefix string
+	// Separator joins the keys of nested variables. Default is ".".
+	Separator string
+	// Include selects variables by their target names without Prefix,
+	// with the wildcards of path.Match, such as "memstats.*". If Include
+	// is empty, all variables are included.
+	Include []string
+	// Exclude removes variables selected by Include.
+	Exclude []string
+}
+
+// DiscoverExpvar samples all numeric variables published through the
+// expvar package, now and then every cfg.Interval, and adds their values
+// to metrics. Existing instrumentation thus appears in Grafana without
+// further code.
+//
+// Nested variables, such as the keys of an expvar.Map or the fields of
+// the JSON object that an expvar.Func returns, become dotted target names:
+// the field NumGC of the standard "memstats" variable becomes the target
+// "memstats.NumGC". Booleans become 0 and 1; strings and arrays are
+// skipped. Metrics that do not exist yet are created as by Dashboard.Add.
+//
+// Every sample calls the String method of each variable that may contain
+// included targets. Use Include to avoid evaluating expensive variables
+// that are not needed.
+//
+// DiscoverExpvar fails if a pattern is malformed. Call stop to end the
+// sampling.
+func (d *Dashboard) DiscoverExpvar(cfg ExpvarConfig) (stop func(), err error) {
+	for _, p := range append(cfg.Include[:len(cfg.Include):len(cfg.Include)], cfg.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("expvar pattern %q: %w", p, err)
+		}
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Separator == "" {
+		cfg.Separator = "."
+	}
+
+	e := &expvarDiscovery{d: d, cfg: cfg}
+	e.sample()
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(cfg.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				e.sample()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// expvarDiscovery samples expvar variables into the metrics of a dashboard.
+type expvarDiscovery struct {
+	d   *Dashboard
+	cfg ExpvarConfig
+}
+
+// sample adds the current values of all included variables to metrics.
+func (e *expvarDiscovery) sample() {
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !e.mayInclude(kv.Key) {
+			return
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(kv.Value.String()), &v); err != nil {
+			return
+		}
+		e.walk(kv.Key, v)
+	})
+}
+
+// walk adds the numbers in the decoded JSON value v, named name, to
+// metrics, and descends into objects.
+func (e *expvarDiscovery) walk(name string, v interface{}) {
+	switch v := v.(type) {
+	case float64:
+		e.add(name, v)
+	case bool:
+		n := 0.0
+		if v {
+			n = 1
+		}
+		e.add(name, n)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			e.walk(name+e.cfg.Separator+k, v[k])
+		}
+	}
+}
+
+// add adds n to the metric of name, if name is included.
+func (e *expvarDiscovery) add(name string, n float64) {
+	if e.included(name) {
+		e.d.Add(e.cfg.Prefix+name, n)
+	}
+}
+
+// included reports whether the target name (without prefix) matches an
+// include pattern and no exclude pattern.
+func (e *expvarDiscovery) included(name string) bool {
+	return (len(e.cfg.Include) == 0 || matchAny(e.cfg.Include, name)) && !matchAny(e.cfg.Exclude, name)
+}
+
+// mayInclude reports whether the variable key or a variable nested in it
+// may match an include pattern, so that other variables are not evaluated.
+func (e *expvarDiscovery) mayInclude(key string) bool {
+	if len(e.cfg.Include) == 0 {
+		return true
+	}
+	nested := key + e.cfg.Separator
+	for _, p := range e.cfg.Include {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+		// Nested names start with key and the separator, so they can only
+		// match if the literal start of the pattern agrees with that.
+		lit := p
+		if i := strings.IndexAny(p, `*?[\`); i >= 0 {
+			lit = p[:i]
+		}
+		if strings.HasPrefix(nested, lit) || strings.HasPrefix(lit, nested) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether name matches one of the patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package grada
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func init() {
+	expvar.NewInt("gradatest.requests").Set(7)
+	m := expvar.NewMap("gradatest")
+	m.Add("hits", 3)
+	m.AddFloat("ratio", 0.5)
+	inner := new(expvar.Map).Init()
+	inner.Add("open", 2)
+	m.Set("conns", inner)
+	m.Set("name", stringVar("web"))
+	expvar.Publish("gradatest.func", expvar.Func(func() interface{} {
+		return map[string]interface{}{"up": true, "list": []int{1, 2}}
+	}))
+}
+
+type stringVar string
+
+func (s stringVar) String() string { return `"` + string(s) + `"` }
+
+func TestDashboard_DiscoverExpvar(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ExpvarConfig
+		want map[string]float64
+	}{
+		{"all", ExpvarConfig{Include: []string{"gradatest*"}}, map[string]float64{
+			"gradatest.requests":   7,
+			"gradatest.hits":       3,
+			"gradatest.ratio":      0.5,
+			"gradatest.conns.open": 2,
+			"gradatest.func.up":    1,
+		}},
+		{"exclude", ExpvarConfig{Include: []string{"gradatest.*"}, Exclude: []string{"gradatest.conns.*", "gradatest.func.*"}}, map[string]float64{
+			"gradatest.requests": 7,
+			"gradatest.hits":     3,
+			"gradatest.ratio":    0.5,
+		}},
+		{"prefix", ExpvarConfig{Include: []string{"gradatest/conns/*"}, Prefix: "app/", Separator: "/"}, map[string]float64{
+			"app/gradatest/conns/open": 2,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard()
+			stop, err := d.DiscoverExpvar(tt.cfg)
+			if err != nil {
+				t.Fatalf("DiscoverExpvar(): %v", err)
+			}
+			stop()
+			stop()
+			got := map[string]float64{}
+			for _, target := range d.srv.targets() {
+				m, _ := d.GetMetric(target)
+				got[target] = m.list.at(0).N
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("discovered metrics:\n%s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+
+	if _, err := NewDashboard().DiscoverExpvar(ExpvarConfig{Exclude: []string{"["}}); err == nil {
+		t.Errorf("DiscoverExpvar() with a malformed pattern succeeded")
+	}
+}
+
+func TestExpvarDiscovery_mayInclude(t *testing.T) {
+	e := &expvarDiscovery{cfg: ExpvarConfig{Include: []string{"memstats.Num*", "app", "ab*"}, Separator: "."}}
+	for key, want := range map[string]bool{"memstats": true, "memstats.x": false, "cmdline": false, "app": true, "abc": true, "a": false} {
+		if got := e.mayInclude(key); got != want {
+			t.Errorf("mayInclude(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
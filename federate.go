@@ -0,0 +1,262 @@
+package grada
+
+// Federation: metrics pulled from other grada servers.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FederationConfig configures Dashboard.Federate.
+type FederationConfig struct {
+	// URL is the base URL of the remote server, including the path
+	// prefix of its endpoints if it has one, as in "http://node1:3001".
+	URL string
+	// Targets are the remote targets to mirror, as patterns of path.Match
+	// such as "http.*". Default is all targets that /search returns.
+	Targets []string
+	// Prefix starts the local target names, as in "node1.", so that
+	// the targets of several servers do not collide.
+	Prefix string
+	// Interval is the time between two pulls. Default is 10 seconds.
+	Interval time.Duration
+	// Backfill is how far back the first pull reaches. Default is one
+	// interval.
+	Backfill time.Duration
+	// Client sends the requests. Default is http.DefaultClient.
+	Client *http.Client
+	// Header is added to every request, for example for authorization.
+	Header http.Header
+}
+
+// Federate mirrors the metrics of a remote grada server, so that a
+// central instance can serve Grafana for a fleet of applications. At
+// every interval, it asks the remote /search endpoint for the target
+// names, queries the data points since the previous pull from /query,
+// and adds them, with their original time stamps, to the local metrics
+// "<prefix><target>". Metrics that do not exist yet are created as by
+// Dashboard.Add.
+//
+// Targets that the remote server computes at query time, such as
+// virtual series, are mirrored like metrics. Remote servers with
+// WithSearchTree return only the top level of names from /search; list
+// their targets in cfg.Targets without wildcards.
+//
+// The pulls run as a collector named "federate.<name>"; remove it with
+// Dashboard.RemoveCollector. Failed pulls are logged. Remote targets that
+// the remote server rejects with 400 or 404, such as tables, are skipped
+// for ten minutes. Federate fails if cfg.URL is empty or a collector of
+// the same name exists.
+func (d *Dashboard) Federate(name string, cfg FederationConfig) error {
+	if cfg.URL == "" {
+		return errors.New("federate " + name + ": no URL")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultCollectInterval
+	}
+	if cfg.Backfill <= 0 {
+		cfg.Backfill = cfg.Interval
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return d.AddCollector(&federation{srv: d.srv, name: name, cfg: cfg,
+		last: map[string]time.Time{}, skip: map[string]time.Time{}})
+}
+
+// federation is the collector of Federate.
+type federation struct {
+	srv  *server
+	name string
+	cfg  FederationConfig
+	last map[string]time.Time // time of the last data point by remote target
+	skip map[string]time.Time // remote targets that cannot be queried, until when to skip them
+}
+
+// skipFor is how long a federation skips a remote target that cannot be
+// queried. The remote server may replace it with a metric of the same name.
+const skipFor = 10 * time.Minute
+
+// isRejected reports whether the remote server has rejected a query for
+// its targets, rather than failed to serve it.
+func isRejected(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && (se.code == http.StatusBadRequest || se.code == http.StatusNotFound)
+}
+
+func (f *federation) Name() string            { return "federate." + f.name }
+func (f *federation) Interval() time.Duration { return f.cfg.Interval }
+
+// Collect pulls the new data points. Failures are logged.
+func (f *federation) Collect(ctx context.Context) []Sample {
+	samples, err := f.pull(ctx, time.Now())
+	if err != nil && f.srv.logger != nil {
+		f.srv.logger.Printf("grada: federate %s: %v", f.name, err)
+	}
+	return samples
+}
+
+// pull returns the data points of the remote targets since the previous
+// pull, or since now minus the backfill for targets not pulled before.
+// The scheduler never runs two pulls of a collector at once.
+func (f *federation) pull(ctx context.Context, now time.Time) ([]Sample, error) {
+	var all []string
+	if err := f.post(ctx, "/search", map[string]string{"target": ""}, &all); err != nil {
+		return nil, err
+	}
+	for t, until := range f.skip {
+		if !now.Before(until) {
+			delete(f.skip, t)
+		}
+	}
+	var targets []string
+	for _, t := range all {
+		if _, skip := f.skip[t]; !skip && (len(f.cfg.Targets) == 0 || matchAny(f.cfg.Targets, t)) {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	from := now.Add(-f.cfg.Backfill)
+	for _, t := range targets {
+		if last, ok := f.last[t]; ok && last.Before(from) {
+			from = last
+		}
+	}
+	// The range extends into the future to tolerate clocks that are
+	// ahead of ours.
+	to := now.Add(time.Minute)
+	points, err := f.query(ctx, targets, from, to)
+	if isRejected(err) {
+		// A target that is no time series, such as a table, fails the
+		// whole query. Query the targets one by one to find it.
+		points, err = make([][][2]*float64, len(targets)), nil
+		for i, t := range targets {
+			p, err := f.query(ctx, targets[i:i+1], from, to)
+			if isRejected(err) {
+				f.skip[t] = now.Add(skipFor)
+				if f.srv.logger != nil {
+					f.srv.logger.Printf("grada: federate %s: skipping target %s: %v", f.name, t, err)
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			points[i] = p[0]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []Sample
+	for i, t := range targets {
+		last, ok := f.last[t]
+		if !ok {
+			last = now.Add(-f.cfg.Backfill)
+		}
+		newest := last
+		for _, p := range points[i] {
+			if p[0] == nil || p[1] == nil {
+				continue
+			}
+			ts := time.Unix(0, int64(*p[1])*int64(time.Millisecond))
+			if !ts.After(last) {
+				continue
+			}
+			samples = append(samples, Sample{Target: f.cfg.Prefix + t, N: *p[0], T: ts})
+			if ts.After(newest) {
+				newest = ts
+			}
+		}
+		f.last[t] = newest
+	}
+	return samples, nil
+}
+
+// query returns the data points [value, Unix milliseconds] of the remote
+// targets within the time range, in the order of targets.
+func (f *federation) query(ctx context.Context, targets []string, from, to time.Time) ([][][2]*float64, error) {
+	type target struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"`
+	}
+	q := struct {
+		Range struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+		} `json:"range"`
+		Targets       []target `json:"targets"`
+		MaxDataPoints int      `json:"maxDataPoints"`
+	}{MaxDataPoints: math.MaxInt32}
+	q.Range.From, q.Range.To = from, to
+	for i, t := range targets {
+		q.Targets = append(q.Targets, target{t, fmt.Sprint(i), "timeserie"})
+	}
+	// Responses are in the order of the query. Their target names may
+	// be aliases.
+	var response []struct {
+		Datapoints [][2]*float64 `json:"datapoints"`
+	}
+	if err := f.post(ctx, "/query", q, &response); err != nil {
+		return nil, err
+	}
+	if len(response) != len(targets) {
+		return nil, fmt.Errorf("/query: %d series for %d targets", len(response), len(targets))
+	}
+	points := make([][][2]*float64, len(response))
+	for i, s := range response {
+		points[i] = s.Datapoints
+	}
+	return points, nil
+}
+
+// statusError is an error status of a remote endpoint.
+type statusError struct {
+	endpoint, status string
+	code             int
+}
+
+func (e *statusError) Error() string { return e.endpoint + ": " + e.status }
+
+// post sends body as JSON to the remote endpoint and decodes the JSON
+// response into v.
+func (f *federation) post(ctx context.Context, endpoint string, body, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", f.cfg.URL+endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, vs := range f.cfg.Header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := f.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{endpoint, resp.Status, resp.StatusCode}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	return nil
+}
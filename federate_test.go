@@ -0,0 +1,143 @@
+package grada
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFederation_pull(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	remote := NewDashboard()
+	for _, name := range []string{"http.requests", "http.latency", "db.queries"} {
+		m, err := remote.CreateMetricWithBufSize(name, 10)
+		if err != nil {
+			t.Fatalf("CreateMetricWithBufSize(): %v", err)
+		}
+		m.AddCount(Count{1, now.Add(-time.Hour)}) // before the backfill
+		m.AddCount(Count{2, now.Add(-2 * time.Second)})
+	}
+	if err := remote.CreateTable("hosts", queuesTable); err != nil {
+		t.Fatalf("CreateTable(): %v", err)
+	}
+	ts := httptest.NewServer(remote.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		targets []string
+		want    []Sample
+	}{
+		{"all", nil, []Sample{
+			{Target: "node1.db.queries", N: 2, T: now.Add(-2 * time.Second)},
+			{Target: "node1.http.latency", N: 2, T: now.Add(-2 * time.Second)},
+			{Target: "node1.http.requests", N: 2, T: now.Add(-2 * time.Second)},
+		}},
+		{"patterns", []string{"http.*"}, []Sample{
+			{Target: "node1.http.latency", N: 2, T: now.Add(-2 * time.Second)},
+			{Target: "node1.http.requests", N: 2, T: now.Add(-2 * time.Second)},
+		}},
+		{"none", []string{"cpu.*"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &federation{
+				srv:  NewDashboard().srv,
+				name: "node1",
+				cfg: FederationConfig{URL: ts.URL, Targets: tt.targets, Prefix: "node1.",
+					Backfill: time.Minute, Client: ts.Client()},
+				last: map[string]time.Time{},
+				skip: map[string]time.Time{},
+			}
+			got, err := f.pull(context.Background(), now)
+			if err != nil {
+				t.Fatalf("pull(): %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("pull() mismatch (-want +got):\n%s", diff)
+			}
+			// The next pull returns only new data points.
+			got, err = f.pull(context.Background(), now.Add(time.Second))
+			if err != nil || len(got) != 0 {
+				t.Errorf("second pull() = %v, %v; want no samples", got, err)
+			}
+		})
+	}
+}
+
+func TestDashboard_Federate(t *testing.T) {
+	remote := NewDashboard()
+	remote.Add("temp", 21)
+	ts := httptest.NewServer(remote.Handler())
+	defer ts.Close()
+
+	d := NewDashboard()
+	if err := d.Federate("remote", FederationConfig{}); err == nil {
+		t.Error("Federate() without URL succeeded")
+	}
+	if err := d.Federate("remote", FederationConfig{URL: ts.URL + "/", Interval: time.Hour}); err != nil {
+		t.Fatalf("Federate(): %v", err)
+	}
+	defer d.RemoveCollector("federate.remote")
+	waitForRun(t, d)
+	m, err := d.GetMetric("temp")
+	if err != nil {
+		t.Fatalf("GetMetric(): %v", err)
+	}
+	if m.head == 0 || m.list.at(0).N != 21 {
+		t.Errorf("metric has head %d and first data point %v, want 21", m.head, m.list.at(0))
+	}
+}
+
+func TestFederation_pullSkip(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	remote := NewDashboard()
+	m, _ := remote.CreateMetricWithBufSize("cpu", 10)
+	m.AddCount(Count{1, now.Add(-time.Second)})
+	remote.CreateTable("hosts", queuesTable)
+	unavailable := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unavailable && r.URL.Path == "/query" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		remote.Handler().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	f := &federation{
+		srv:  NewDashboard().srv,
+		name: "node1",
+		cfg:  FederationConfig{URL: ts.URL, Backfill: time.Minute, Client: ts.Client()},
+		last: map[string]time.Time{},
+		skip: map[string]time.Time{},
+	}
+	if _, err := f.pull(context.Background(), now); err != nil {
+		t.Fatalf("pull(): %v", err)
+	}
+	if until, ok := f.skip["hosts"]; !ok || !until.Equal(now.Add(skipFor)) || len(f.skip) != 1 {
+		t.Fatalf("skip = %v, want hosts until %v", f.skip, now.Add(skipFor))
+	}
+
+	// Failures of the remote server do not skip targets.
+	unavailable = true
+	if _, err := f.pull(context.Background(), now.Add(skipFor)); err == nil {
+		t.Errorf("pull() from an unavailable server: no error")
+	}
+	if len(f.skip) != 0 {
+		t.Errorf("skip = %v after a 503 and an expired entry, want none", f.skip)
+	}
+
+	// Expired targets are queried again.
+	unavailable = false
+	if _, err := f.pull(context.Background(), now.Add(skipFor)); err != nil {
+		t.Fatalf("pull(): %v", err)
+	}
+	if until := f.skip["hosts"]; !until.Equal(now.Add(2 * skipFor)) {
+		t.Errorf("hosts skipped until %v, want %v", until, now.Add(2*skipFor))
+	}
+}
@@ -0,0 +1,343 @@
+package grada
+
+// The fetch and encode path of time series queries.
+//
+// Metrics copy their data points into []Count slices, which hold no
+// pointers, and the JSON response is encoded directly from these slices.
+// This avoids the allocation of a row, a boxed float64, and a boxed int64
+// per data point that encoding []row with encoding/json requires.
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// endOfTime is after every time stamp, for time ranges without an end.
+var endOfTime = time.Unix(1<<40, 0)
+
+// appendCounts appends the Counts of g within the time range (from, to) to
+// dst, oldest first, thinned out evenly to at most maxDataPoints items.
+// Data points of the same time stamp are merged as WithDuplicates says.
+func (g *Metric) appendCounts(dst []Count, from, to time.Time, maxDataPoints int) []Count {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.collect(dst, from, to, maxDataPoints)
+}
+
+// collect is appendCounts for callers that hold g.m.
+func (g *Metric) collect(dst []Count, from, to time.Time, maxDataPoints int) []Count {
+	length := g.list.len()
+
+	g.sort()
+	lo, hi := g.list.window(g.head, from, to)
+
+	// Without duplicates to merge, pick the data points to return by
+	// their position in the sorted time stamp column, so that thinning
+	// out a large buffer only reads the slots it returns.
+	if g.dups.Policy == DuplicatesKeepAll || g.dups.OnIngest {
+		points := hi - lo
+		if points > maxDataPoints {
+			points = max(maxDataPoints, 0)
+		}
+		ratio := 1.0
+		if points > 0 {
+			ratio = float64(hi-lo) / float64(points)
+		}
+		for i := 0; i < points; i++ {
+			dst = append(dst, g.list.at((g.head+lo+int(float64(i)*ratio))%length))
+		}
+		return dst
+	}
+
+	start := len(dst)
+	for i := lo; i < hi; i++ {
+		dst = append(dst, g.list.at((g.head+i)%length)) // wrap around
+	}
+	dst = dst[:start+len(g.dups.Policy.dedupe(dst[start:]))]
+
+	points := len(dst) - start
+	if points <= maxDataPoints {
+		return dst
+	}
+	if maxDataPoints < 0 {
+		maxDataPoints = 0
+	}
+
+	// Thin out in place. The source index is never less than the
+	// destination index, so no item is overwritten before it is read.
+	ratio := float64(points) / float64(maxDataPoints)
+	for i := 0; i < maxDataPoints; i++ {
+		dst[start+i] = dst[start+int(float64(i)*ratio)]
+	}
+	return dst[:start+maxDataPoints]
+}
+
+// fetchCounts returns the Counts of g like appendCounts, in the scratch
+// buffer of g if it is available. Pass the result to releaseCounts when
+// done with it, so that the next fetch can reuse the buffer.
+//
+// Each panel refresh fetches the same metric again, so reusing the buffer
+// saves allocating a buffer of up to g.list.len() Counts per request. If
+// concurrent requests fetch the same metric, only one of them gets the
+// scratch buffer and the others allocate.
+func (g *Metric) fetchCounts(from, to time.Time, maxDataPoints int) []Count {
+	g.m.Lock()
+	buf := g.scratch
+	g.scratch = nil
+	g.m.Unlock()
+	return g.appendCounts(buf[:0], from, to, maxDataPoints)
+}
+
+// releaseCounts returns a buffer obtained from fetchCounts to g.
+// The caller must not use buf afterwards.
+func (g *Metric) releaseCounts(buf []Count) {
+	g.m.Lock()
+	if g.scratch == nil || cap(buf) > cap(g.scratch) {
+		g.scratch = buf[:0]
+	}
+	g.m.Unlock()
+}
+
+// series is the data of one target of a time series query.
+// Metrics provide counts; virtual series and reduced values provide rows.
+type series struct {
+	target string
+	counts []Count
+	rows   []row
+	metric *Metric // owner of counts, see release
+
+	source   SeriesSource // streams the data points if set
+	from, to time.Time    // range for source
+	max      int          // maxDataPoints for source
+
+	config *fieldConfig // sends s as a data frame if set, see fieldconfig.go
+}
+
+// points returns the number of data points of s. For a source, this is
+// the most it streams.
+func (s series) points() int {
+	if s.source != nil {
+		return s.max
+	}
+	return len(s.rows) + len(s.counts)
+}
+
+// release returns the counts of s to their metric for reuse.
+// s must not be used afterwards.
+func (s series) release() {
+	if s.metric != nil && s.counts != nil {
+		s.metric.releaseCounts(s.counts)
+	}
+}
+
+// series returns the data points of a metric, virtual series, or rate
+// series within [from, to], with at most maxDataPoints items.
+func (srv *server) series(target string, from, to time.Time, maxDataPoints int) (series, error) {
+	return srv.seriesByInterval(target, from, to, maxDataPoints, 0)
+}
+
+// seriesByInterval is like series, but computes rate series for steps of
+// at least interval.
+func (srv *server) seriesByInterval(target string, from, to time.Time, maxDataPoints int, interval time.Duration) (series, error) {
+	srv.virtual.m.Lock()
+	f, ok := srv.virtual.series[target]
+	srv.virtual.m.Unlock()
+	if ok {
+		rows, err := f(from, to, maxDataPoints)
+		return series{target: target, rows: rows}, err
+	}
+	if src, ok := srv.source(target); ok {
+		return series{target: target, source: src, from: from, to: to, max: maxDataPoints}, nil
+	}
+	if m, ok := srv.rateMetric(target); ok {
+		return series{target: target, rows: rateRows(m.appendCounts(nil, from, to, math.MaxInt), rateStep(from, to, maxDataPoints, interval))}, nil
+	}
+	metric, err := srv.lookup(target)
+	if err != nil {
+		return series{}, err
+	}
+	return series{target: target, counts: metric.fetchCounts(from, to, maxDataPoints), metric: metric}, nil
+}
+
+// datapoints returns the data points of s as rows.
+func (s series) datapoints() ([]row, error) {
+	if s.source != nil {
+		rows := []row{}
+		err := s.sourceRange(func(c Count) error {
+			rows = append(rows, row{c.N, c.T.UnixNano() / int64(time.Millisecond)})
+			return nil
+		})
+		return rows, err
+	}
+	return s.rowsOrCounts(), nil
+}
+
+// rowsOrCounts returns the rows or counts of s as rows.
+func (s series) rowsOrCounts() []row {
+	if s.rows != nil || s.counts == nil {
+		if s.rows == nil {
+			return []row{}
+		}
+		return s.rows
+	}
+	rows := make([]row, len(s.counts))
+	for i, c := range s.counts {
+		rows[i] = row{c.N, c.T.UnixNano() / int64(time.Millisecond)}
+	}
+	return rows
+}
+
+// encodeBuffers holds buffers for encoding responses.
+var encodeBuffers = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// appendSeriesJSON appends the JSON encoding of a time series response,
+// as produced by encoding a []timeseriesResponse with encoding/json, to b.
+// Values that JSON cannot represent (NaN and infinities) become null.
+func appendSeriesJSON(b []byte, list []series) ([]byte, error) {
+	return (&streamWriter{}).writeSeriesJSON(b, list)
+}
+
+// writeSeriesJSON appends the JSON encoding of a time series response
+// to b, like appendSeriesJSON. If the response has grown large while
+// encoding series sources, it writes the response to sw in chunks.
+// The caller writes the returned rest.
+func (sw *streamWriter) writeSeriesJSON(b []byte, list []series) ([]byte, error) {
+	b = append(b, '[')
+	for i, s := range list {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		before := sw.points
+		if b, err = sw.writeSeriesObject(b, s); err != nil {
+			return nil, err
+		}
+		sw.written = append(sw.written, sw.points-before)
+	}
+	return append(b, ']'), nil
+}
+
+// writeSeriesObject appends the JSON encoding of a timeseriesResponse
+// to b, writing chunks to sw like writeSeriesJSON.
+func (sw *streamWriter) writeSeriesObject(b []byte, s series) ([]byte, error) {
+	if s.config != nil {
+		b, n, err := appendFrameJSON(b, s, s.config)
+		sw.points += n
+		return b, err
+	}
+	target, err := json.Marshal(s.target)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, `{"target":`...)
+	b = append(b, target...)
+	b = append(b, `,"datapoints":`...)
+	switch {
+	case s.source != nil:
+		b = append(b, '[')
+		first := true
+		err := s.sourceRange(func(c Count) error {
+			if !first {
+				b = append(b, ',')
+			}
+			first = false
+			sw.points++
+			b = appendCountJSON(b, c)
+			var err error
+			b, err = sw.flush(b)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, ']')
+	case s.counts == nil:
+		b = append(b, '[')
+		for j, r := range s.rowsOrCounts() {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			if b, err = appendRowJSON(b, r); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, ']')
+		sw.points += len(s.rows)
+	default:
+		sw.points += len(s.counts)
+		b = append(b, '[')
+		for j, c := range s.counts {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			b = appendCountJSON(b, c)
+		}
+		b = append(b, ']')
+	}
+	return append(b, '}'), nil
+}
+
+// appendCountJSON appends c as a JSON data point [value, Unix milliseconds].
+func appendCountJSON(b []byte, c Count) []byte {
+	b = append(b, '[')
+	b = appendJSONFloat(b, c.N)
+	b = append(b, ',')
+	b = strconv.AppendInt(b, c.T.UnixNano()/int64(time.Millisecond), 10)
+	return append(b, ']')
+}
+
+// appendRowJSON appends the JSON encoding of r to b. Float values are
+// encoded by appendJSONFloat, so that NaN and infinities become null.
+func appendRowJSON(b []byte, r row) ([]byte, error) {
+	b = append(b, '[')
+	for i, v := range r {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if f, ok := v.(float64); ok {
+			b = appendJSONFloat(b, f)
+			continue
+		}
+		e, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, e...)
+	}
+	return append(b, ']'), nil
+}
+
+// appendElement appends the JSON value v to the JSON array under
+// construction in b, which starts with '['.
+func appendElement(b, v []byte) []byte {
+	if b[len(b)-1] != '[' {
+		b = append(b, ',')
+	}
+	return append(b, v...)
+}
+
+// appendJSONFloat appends f in the format of encoding/json.
+func appendJSONFloat(b []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(b, "null"...)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9, as encoding/json does.
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
@@ -0,0 +1,184 @@
+package grada
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetric_appendCounts(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	g := &Metric{list: newCountBuffer(10)}
+	for i := 0; i < 10; i++ {
+		g.AddWithTime(float64(i), t0.Add(time.Duration(i)*time.Second))
+	}
+
+	tests := []struct {
+		name      string
+		max       int
+		wantLen   int
+		wantFirst float64
+	}{
+		{"all", 10, 10, 0},
+		{"thinned", 4, 4, 0},
+		{"zero", 0, 0, 0},
+		{"negative", -1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := []Count{{N: -1}}
+			got := g.appendCounts(prefix, t0.Add(-time.Second), t0.Add(time.Minute), tt.max)
+			if got[0].N != -1 {
+				t.Errorf("appendCounts() overwrote dst")
+			}
+			got = got[1:]
+			if len(got) != tt.wantLen {
+				t.Fatalf("appendCounts() returned %d counts, want %d", len(got), tt.wantLen)
+			}
+			if len(got) > 0 && got[0].N != tt.wantFirst {
+				t.Errorf("first count %v, want %v", got[0].N, tt.wantFirst)
+			}
+			for i := 1; i < len(got); i++ {
+				if !got[i-1].T.Before(got[i].T) {
+					t.Errorf("counts not in order at %d: %v", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMetric_fetchCounts(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	g := &Metric{list: newCountBuffer(10)}
+	for i := 0; i < 10; i++ {
+		g.AddWithTime(float64(i), t0.Add(time.Duration(i)*time.Second))
+	}
+	from, to := t0.Add(-time.Second), t0.Add(time.Minute)
+
+	first := g.fetchCounts(from, to, 10)
+	second := g.fetchCounts(from, to, 10)
+	if &first[0] == &second[0] {
+		t.Fatalf("fetchCounts() shares a buffer that has not been released")
+	}
+	g.releaseCounts(first)
+	g.releaseCounts(second)
+
+	third := g.fetchCounts(from, to, 5)
+	if &third[0] != &first[0] {
+		t.Errorf("fetchCounts() does not reuse the released buffer")
+	}
+	if len(third) != 5 || third[1].N != 2 {
+		t.Errorf("fetchCounts() = %v, want every second count", third)
+	}
+}
+
+func TestAppendSeriesJSON(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	values := []float64{0, 1, -2.5, 1e-7, 123456789, 1e21, -3e-9, 0.1}
+	counts := make([]Count, len(values))
+	for i, v := range values {
+		counts[i] = Count{v, t0.Add(time.Duration(i) * time.Millisecond)}
+	}
+	list := []series{
+		{target: `cpu "0"`, counts: counts},
+		{target: "virtual", rows: []row{{1.5, 1508930214000}}},
+		{target: "empty"},
+	}
+
+	got, err := appendSeriesJSON(nil, list)
+	if err != nil {
+		t.Fatalf("appendSeriesJSON(): %v", err)
+	}
+	response := make([]timeseriesResponse, len(list))
+	for i, s := range list {
+		response[i] = timeseriesResponse{Target: s.target, Datapoints: s.rowsOrCounts()}
+	}
+	want, _ := json.Marshal(response)
+	if string(got) != string(want) {
+		t.Errorf("appendSeriesJSON():\ngot  %s\nwant %s", got, want)
+	}
+
+	got, _ = appendSeriesJSON(nil, []series{{target: "nan", counts: []Count{{math.NaN(), t0}, {math.Inf(1), t0}}}})
+	if want := `[{"target":"nan","datapoints":[[null,1508930214000],[null,1508930214000]]}]`; string(got) != want {
+		t.Errorf("appendSeriesJSON() with NaN:\ngot  %s\nwant %s", got, want)
+	}
+	got, err = appendSeriesJSON(nil, []series{{target: "nan", rows: []row{{math.NaN(), int64(1508930214000)}, {math.Inf(-1), int64(1508930214000)}}}})
+	if want := `[{"target":"nan","datapoints":[[null,1508930214000],[null,1508930214000]]}]`; err != nil || string(got) != want {
+		t.Errorf("appendSeriesJSON() with NaN rows:\ngot  %s, %v\nwant %s", got, err, want)
+	}
+}
+
+// newBenchmarkDashboard returns a dashboard with a full metric "cpu" of
+// the given size.
+func newBenchmarkDashboard(size int) (*Dashboard, time.Time) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	d := NewDashboard()
+	metric, _ := d.CreateMetricWithBufSize("cpu", size)
+	for i := 0; i < size; i++ {
+		metric.AddWithTime(float64(i)/7, t0.Add(time.Duration(i)*time.Second))
+	}
+	return d, t0
+}
+
+func BenchmarkMetric_fetch(b *testing.B) {
+	d, t0 := newBenchmarkDashboard(10000)
+	metric, _ := d.GetMetric("cpu")
+	from, to := t0.Add(-time.Second), t0.Add(24*time.Hour)
+
+	b.Run("fetchDatapoints", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			metric.fetchDatapoints(from, to, 1000)
+		}
+	})
+	b.Run("fetchCounts", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			metric.releaseCounts(metric.fetchCounts(from, to, 1000))
+		}
+	})
+	b.Run("appendCounts", func(b *testing.B) {
+		b.ReportAllocs()
+		var buf []Count
+		for i := 0; i < b.N; i++ {
+			buf = metric.appendCounts(buf[:0], from, to, 1000)
+		}
+	})
+}
+
+func BenchmarkEncodeTimeseries(b *testing.B) {
+	d, t0 := newBenchmarkDashboard(1000)
+	metric, _ := d.GetMetric("cpu")
+	counts := metric.appendCounts(nil, t0.Add(-time.Second), t0.Add(time.Hour), 1000)
+	list := []series{{target: "cpu", counts: counts}}
+
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			json.Marshal([]timeseriesResponse{{Target: "cpu", Datapoints: list[0].rowsOrCounts()}})
+		}
+	})
+	b.Run("direct", func(b *testing.B) {
+		b.ReportAllocs()
+		var buf []byte
+		for i := 0; i < b.N; i++ {
+			buf, _ = appendSeriesJSON(buf[:0], list)
+		}
+	})
+}
+
+func BenchmarkServer_query(b *testing.B) {
+	d, _ := newBenchmarkDashboard(10000)
+	h := d.Handler()
+	body := fmt.Sprintf(`{"range": {"from": "2017-10-25T10:00:00Z", "to": "2017-10-26T00:00:00Z"}, "maxDataPoints": %d, "targets": [{"target": "cpu"}]}`, 1000)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	}
+}
@@ -0,0 +1,138 @@
+package grada
+
+// Field configuration of targets in data frames.
+//
+// The JSON data source (see WithDialect) accepts data frames as well as
+// time series in /query responses. It responds with a data frame for
+// every series whose target has a unit, a range, or a number of
+// decimals, so that Grafana shows the values right without field
+// overrides in the panel:
+//
+//	{"name": "latency", "fields": [
+//	  {"name": "Time", "type": "time", "values": [1508929200000, ...]},
+//	  {"name": "Value", "type": "number", "values": [12.5, ...],
+//	   "config": {"displayNameFromDS": "latency", "unit": "ms", "min": 0, "decimals": 1}}]}
+//
+// Simple JSON responses have no room for field configuration and stay
+// as they are.
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+)
+
+// SetRange sets the minimum and the maximum of the values of a target,
+// such as 0 and 100 for a percentage, which Grafana uses for the axes,
+// gauges, and thresholds of panels. NaN leaves the end of the range
+// open; two NaNs remove the range.
+func (d *Dashboard) SetRange(target string, min, max float64) {
+	d.srv.meta.update(target, func(m *targetMeta) {
+		m.min, m.max = nil, nil
+		if !math.IsNaN(min) {
+			m.min = &min
+		}
+		if !math.IsNaN(max) {
+			m.max = &max
+		}
+	})
+}
+
+// SetDecimals sets the number of decimals with which Grafana shows the
+// values of a target. A negative number removes the setting.
+func (d *Dashboard) SetDecimals(target string, decimals int) {
+	d.srv.meta.update(target, func(m *targetMeta) {
+		m.decimals = nil
+		if decimals >= 0 {
+			m.decimals = &decimals
+		}
+	})
+}
+
+// fieldConfig is the configuration of the value field of a data frame.
+type fieldConfig struct {
+	DisplayName string   `json:"displayNameFromDS"`
+	Unit        string   `json:"unit,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Decimals    *int     `json:"decimals,omitempty"`
+}
+
+// fieldConfig returns the field configuration of target under the
+// display name of a series, or nil if target has none.
+func (srv *server) fieldConfig(target, displayName string) *fieldConfig {
+	meta := srv.meta.get(target)
+	if meta.unit == "" && meta.min == nil && meta.max == nil && meta.decimals == nil {
+		return nil
+	}
+	return &fieldConfig{displayName, meta.unit, meta.min, meta.max, meta.decimals}
+}
+
+// framesKey is the context key of requests whose responses may contain
+// data frames.
+type framesKey struct{}
+
+// dataFrames makes the time series responses of h contain data frames
+// for series with field configuration.
+func dataFrames(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(w, r.WithContext(context.WithValue(r.Context(), framesKey{}, true)))
+	}
+}
+
+// wantsFrames reports whether the response to r may contain data frames.
+func wantsFrames(r *http.Request) bool {
+	ok, _ := r.Context().Value(framesKey{}).(bool)
+	return ok
+}
+
+// appendFrameJSON appends s as a data frame with the field configuration
+// fc to b. It returns the number of data points.
+func appendFrameJSON(b []byte, s series, fc *fieldConfig) ([]byte, int, error) {
+	rows, err := s.datapoints()
+	if err != nil {
+		return nil, 0, err
+	}
+	name, err := json.Marshal(s.target)
+	if err != nil {
+		return nil, 0, err
+	}
+	config, err := json.Marshal(fc)
+	if err != nil {
+		return nil, 0, err
+	}
+	b = append(b, `{"name":`...)
+	b = append(b, name...)
+	b = append(b, `,"fields":[{"name":"Time","type":"time","values":`...)
+	if b, err = appendColumnJSON(b, rows, 1); err != nil {
+		return nil, 0, err
+	}
+	b = append(b, `},{"name":"Value","type":"number","values":`...)
+	if b, err = appendColumnJSON(b, rows, 0); err != nil {
+		return nil, 0, err
+	}
+	b = append(b, `,"config":`...)
+	b = append(b, config...)
+	return append(b, "}]}"...), len(rows), nil
+}
+
+// appendColumnJSON appends column i of rows to b as a JSON array.
+func appendColumnJSON(b []byte, rows []row, i int) ([]byte, error) {
+	b = append(b, '[')
+	for j, r := range rows {
+		if j > 0 {
+			b = append(b, ',')
+		}
+		if f, ok := r[i].(float64); ok {
+			b = appendJSONFloat(b, f)
+			continue
+		}
+		v, err := json.Marshal(r[i])
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, v...)
+	}
+	return append(b, ']'), nil
+}
@@ -0,0 +1,51 @@
+package grada
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_dataFrames(t *testing.T) {
+	d := NewDashboard(WithDialect("/jsonds", JSONDatasource))
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	for _, target := range []string{"cpu", "latency", "plain"} {
+		m, _ := d.CreateMetricWithBufSize(target, 10)
+		m.AddWithTime(0.5, t0)
+		m.AddWithTime(math.NaN(), t0.Add(time.Second))
+	}
+	d.SetUnit("cpu", "percentunit")
+	d.SetRange("cpu", 0, 1)
+	d.SetDecimals("cpu", 2)
+	d.SetAlias("latency", "p99")
+	d.SetRange("latency", 0, math.NaN())
+	d.SetRange("plain", math.NaN(), math.NaN())
+	d.SetDecimals("plain", -1)
+
+	const rng = `"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"maxDataPoints":100`
+	frame := func(name, config string) string {
+		return `{"name":"` + name + `","fields":[{"name":"Time","type":"time","values":[1508930214000,1508930215000]},` +
+			`{"name":"Value","type":"number","values":[0.5,null],"config":` + config + `}]}`
+	}
+	tests := []struct {
+		name, path, target, want string
+	}{
+		{"unit, range, and decimals", "/jsonds/query", "cpu",
+			frame("cpu", `{"displayNameFromDS":"cpu","unit":"percentunit","min":0,"max":1,"decimals":2}`)},
+		{"open range", "/jsonds/query", "latency", frame("p99", `{"displayNameFromDS":"p99","min":0}`)},
+		{"removed", "/jsonds/query", "plain", `{"target":"plain","datapoints":[[0.5,1508930214000],[null,1508930215000]]}`},
+		{"simple json", "/query", "cpu", `{"target":"cpu","datapoints":[[0.5,1508930214000],[null,1508930215000]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{` + rng + `,"targets":[{"target":"` + tt.target + `","refId":"A"}]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", tt.path, strings.NewReader(body)))
+			if got := strings.TrimSpace(w.Body.String()); w.Code != 200 || got != "["+tt.want+"]" {
+				t.Errorf("POST %s %s = %d %s, want [%s]", tt.path, tt.target, w.Code, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package grada
+
+// Fill policies and aggregations of time series.
+//
+// A target can be downsampled to steps of the query: the longer of the
+// interval of the query and the time range divided by maxDataPoints, with
+// the steps aligned to the Unix epoch. Each step with data points gets
+// one data point, at the start of the step, that aggregates them with a
+// reduce function of /value. The fill policy decides what steps without
+// data points get. Dashboard.SetFill and Dashboard.SetAggregation set
+// the defaults of a target; a panel overrides them in the target's data:
+//
+//	{"target": "cpu", "data": {"fill": "previous", "aggregate": "max"}}
+//
+// "fill" is one of "none", "null", "zero", and "previous". Targets
+// without a fill policy and an aggregation are thinned out as before; a
+// fill policy alone aggregates with "last".
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// FillPolicy determines the value of the steps of a downsampled target
+// that have no data points.
+type FillPolicy int
+
+const (
+	// FillNone leaves out steps without data points. This is the default.
+	FillNone FillPolicy = iota
+	// FillNull gives steps without data points a null value, which
+	// Grafana shows as a gap.
+	FillNull
+	// FillZero gives steps without data points the value 0.
+	FillZero
+	// FillPrevious gives steps without data points the value of the
+	// previous step, or null if no step before has data points.
+	FillPrevious
+)
+
+// fillPolicies are the names of the fill policies in target data.
+var fillPolicies = map[string]FillPolicy{
+	"none":     FillNone,
+	"null":     FillNull,
+	"zero":     FillZero,
+	"previous": FillPrevious,
+}
+
+// SetFill sets the default fill policy of a target, which a panel can
+// override with "fill" in the target's data. See fill.go.
+func (d *Dashboard) SetFill(target string, fill FillPolicy) {
+	d.srv.meta.update(target, func(m *targetMeta) { m.fill = fill })
+}
+
+// SetAggregation sets the default aggregation of a target, one of the
+// reduce functions of /value: "last", "first", "mean", "min", "max",
+// "sum", or "count". A panel can override it with "aggregate" in the
+// target's data; see fill.go. An empty aggregation removes the default.
+func (d *Dashboard) SetAggregation(target, fn string) error {
+	if fn != "" && !validReduce(fn) {
+		return fmt.Errorf("grada: unknown aggregation %q", fn)
+	}
+	d.srv.meta.update(target, func(m *targetMeta) { m.aggregate = fn })
+	return nil
+}
+
+// downsampling returns the fill policy and the aggregation of target,
+// from the target data or the defaults of the target. The aggregation is
+// empty if the target is not downsampled.
+func (srv *server) downsampling(target string, data targetData) (FillPolicy, string, error) {
+	meta := srv.meta.get(target)
+	fill, agg := meta.fill, meta.aggregate
+	if data.Fill != "" {
+		f, ok := fillPolicies[data.Fill]
+		if !ok {
+			return 0, "", errors.New("unknown fill policy " + data.Fill)
+		}
+		fill = f
+	}
+	if data.Aggregate != "" {
+		if !validReduce(data.Aggregate) {
+			return 0, "", errors.New("unknown aggregation " + data.Aggregate)
+		}
+		agg = data.Aggregate
+	}
+	if fill != FillNone && agg == "" {
+		agg = "last"
+	}
+	return fill, agg, nil
+}
+
+// step returns the step of downsampled targets of q, see fill.go, or 0
+// if q asks for no data points.
+func (q *query) step(maxDataPoints int) time.Duration {
+	if maxDataPoints <= 0 {
+		return 0
+	}
+	n := time.Duration(maxDataPoints)
+	return max(q.interval(), (q.Range.To.Sub(q.Range.From)+n-1)/n, time.Millisecond)
+}
+
+// downsample replaces the data points of s by one data point per step
+// within [from, to), aggregated with agg and filled as fill says. A step
+// of 0 leaves s without data points.
+func (s *series) downsample(from, to time.Time, step time.Duration, fill FillPolicy, agg string) error {
+	rows, err := s.datapoints()
+	if err != nil {
+		return err
+	}
+	s.release()
+	*s = series{target: s.target, counts: []Count{}, config: s.config}
+	if step <= 0 || !from.Before(to) {
+		return nil
+	}
+	ms := int64(time.Millisecond)
+	prev := math.NaN()
+	i := 0
+	for k := intervalOf(from.UnixNano(), step); k <= intervalOf(to.UnixNano()-1, step); k++ {
+		red := reducer{fn: agg}
+		for ; i < len(rows); i++ {
+			t, ok := rows[i][1].(int64)
+			if ok && intervalOf(t*ms, step) > k {
+				break
+			}
+			if v, isFloat := rows[i][0].(float64); ok && isFloat {
+				red.add(v, t)
+			}
+		}
+		c := Count{T: time.Unix(0, k*int64(step))}
+		switch v, _, _ := red.result(); {
+		case red.n > 0:
+			c.N = v
+		case fill == FillNull:
+			c.N = math.NaN()
+		case fill == FillZero:
+			c.N = 0
+		case fill == FillPrevious:
+			c.N = prev
+		default:
+			continue
+		}
+		s.counts = append(s.counts, c)
+		prev = c.N
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_downsample(t *testing.T) {
+	d := NewDashboard()
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	for _, target := range []string{"cpu", "mem"} {
+		m, _ := d.CreateMetricWithBufSize(target, 10)
+		m.AddWithTime(1, t0)
+		m.AddWithTime(2, t0.Add(10*time.Second))
+		m.AddWithTime(4, t0.Add(40*time.Second))
+	}
+	d.SetFill("mem", FillZero)
+	if err := d.SetAggregation("mem", "max"); err != nil {
+		t.Fatalf("SetAggregation() error = %v", err)
+	}
+	if err := d.SetAggregation("mem", "median"); err == nil {
+		t.Error("SetAggregation() with an unknown aggregation: no error")
+	}
+
+	// The steps of 20 seconds start at 10:59:40, 11:00:00, 11:00:20, and 11:00:40.
+	tests := []struct {
+		name       string
+		target     string
+		data       string
+		wantStatus int
+		want       string
+	}{
+		{"thinned", "cpu", `{}`, 200, `[2,1508929210000],[4,1508929240000]`},
+		{"aggregate", "cpu", `{"aggregate":"mean"}`, 200, `[1.5,1508929200000],[4,1508929240000]`},
+		{"count", "cpu", `{"fill":"none","aggregate":"count"}`, 200, `[2,1508929200000],[1,1508929240000]`},
+		{"null", "cpu", `{"fill":"null"}`, 200, `[null,1508929180000],[2,1508929200000],[null,1508929220000],[4,1508929240000]`},
+		{"zero", "cpu", `{"fill":"zero","aggregate":"min"}`, 200, `[0,1508929180000],[1,1508929200000],[0,1508929220000],[4,1508929240000]`},
+		{"previous", "cpu", `{"fill":"previous"}`, 200, `[null,1508929180000],[2,1508929200000],[2,1508929220000],[4,1508929240000]`},
+		{"target default", "mem", `{}`, 200, `[0,1508929180000],[2,1508929200000],[0,1508929220000],[4,1508929240000]`},
+		{"panel override", "mem", `{"fill":"none","aggregate":"first"}`, 200, `[1,1508929200000],[4,1508929240000]`},
+		{"unknown fill", "cpu", `{"fill":"linear"}`, 400, ``},
+		{"unknown aggregation", "cpu", `{"aggregate":"median"}`, 400, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"range":{"from":"2017-10-25T10:59:40Z","to":"2017-10-25T11:01:00Z"},"interval":"20s","maxDataPoints":100,` +
+				`"targets":[{"target":"` + tt.target + `","data":` + tt.data + `}]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("POST /query = %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			want := `[{"target":"` + tt.target + `","datapoints":[` + tt.want + `]}]`
+			if got := strings.TrimSpace(w.Body.String()); tt.wantStatus == 200 && got != want {
+				t.Errorf("POST /query = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package grada
+
+// Forecasts of metrics.
+
+import (
+	"math"
+	"time"
+)
+
+// ForecastMethod selects the model of a forecast.
+type ForecastMethod int
+
+const (
+	// ForecastLinear fits a straight line through the data points.
+	ForecastLinear ForecastMethod = iota
+	// ForecastHoltWinters uses additive Holt-Winters exponential smoothing,
+	// with seasonality if ForecastConfig.Season is set.
+	ForecastHoltWinters
+)
+
+// ForecastConfig configures a forecast. See CreateForecast.
+type ForecastConfig struct {
+	Method ForecastMethod
+	// Season is the number of samples per season for ForecastHoltWinters.
+	// The metric needs at least two seasons of data points for a seasonal
+	// forecast; until then, the forecast has no seasonality.
+	Season int
+	// Alpha, Beta, and Gamma are the smoothing factors of level, trend,
+	// and season for ForecastHoltWinters, between 0 and 1.
+	// Defaults are 0.5, 0.1, and 0.1.
+	Alpha, Beta, Gamma float64
+}
+
+// CreateForecast creates a virtual target that Grafana can query like a
+// metric. Its data points are those of the metric of source, extended by
+// a forecast for the part of the queried time range that lies in the
+// future. Use it in capacity planning panels that show projected growth.
+//
+// The forecast is fitted to all data points in the buffer of the source
+// metric, and its data points are spaced by the average interval of
+// those data points.
+func (d *Dashboard) CreateForecast(source, target string, cfg ForecastConfig) error {
+	src, err := d.srv.metrics.Get(source)
+	if err != nil {
+		return err
+	}
+	if cfg.Alpha == 0 {
+		cfg.Alpha = 0.5
+	}
+	if cfg.Beta == 0 {
+		cfg.Beta = 0.1
+	}
+	if cfg.Gamma == 0 {
+		cfg.Gamma = 0.1
+	}
+	return d.srv.addVirtual(target, func(from, to time.Time, maxDataPoints int) ([]row, error) {
+		now := time.Now()
+		history := *src.fetchDatapoints(time.Time{}, now, math.MaxInt)
+		points := *src.fetchDatapoints(from, to, maxDataPoints)
+		if len(history) < 2 || !to.After(now) {
+			return points, nil
+		}
+
+		first, last := history[0][1].(int64), history[len(history)-1][1].(int64)
+		step := (last - first) / int64(len(history)-1)
+		if step <= 0 {
+			return points, nil
+		}
+		values := make([]float64, len(history))
+		for i, p := range history {
+			values[i] = p[0].(float64)
+		}
+		predict := cfg.model(values)
+
+		toMs := to.UnixNano() / int64(time.Millisecond)
+		fromMs := from.UnixNano() / int64(time.Millisecond)
+		for h := 1; len(points) < maxDataPoints; h++ {
+			t := last + int64(h)*step
+			if t >= toMs {
+				break
+			}
+			if t > fromMs {
+				points = append(points, row{predict(h), t})
+			}
+		}
+		return points, nil
+	})
+}
+
+// model fits the configured model to values and returns a function that
+// predicts the value h steps after the last value.
+func (cfg ForecastConfig) model(values []float64) func(h int) float64 {
+	if cfg.Method == ForecastHoltWinters {
+		return holtWinters(values, cfg.Season, cfg.Alpha, cfg.Beta, cfg.Gamma)
+	}
+	return linearFit(values)
+}
+
+// linearFit fits a least-squares line through values at positions
+// 0, 1, 2, ...
+func linearFit(values []float64) func(h int) float64 {
+	n := float64(len(values))
+	var sx, sy, sxx, sxy float64
+	for i, v := range values {
+		x := float64(i)
+		sx += x
+		sy += v
+		sxx += x * x
+		sxy += x * v
+	}
+	slope := (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	intercept := (sy - slope*sx) / n
+	last := n - 1
+	return func(h int) float64 {
+		return intercept + slope*(last+float64(h))
+	}
+}
+
+// holtWinters applies additive Holt-Winters smoothing to values with the
+// given season length. Without at least two seasons of values, it falls
+// back to Holt's linear trend method.
+func holtWinters(values []float64, season int, alpha, beta, gamma float64) func(h int) float64 {
+	if season < 2 || len(values) < 2*season {
+		level, trend := values[0], values[1]-values[0]
+		for _, v := range values[1:] {
+			prev := level
+			level = alpha*v + (1-alpha)*(level+trend)
+			trend = beta*(level-prev) + (1-beta)*trend
+		}
+		return func(h int) float64 {
+			return level + float64(h)*trend
+		}
+	}
+
+	var mean1, mean2 float64
+	for i := 0; i < season; i++ {
+		mean1 += values[i]
+		mean2 += values[season+i]
+	}
+	mean1 /= float64(season)
+	mean2 /= float64(season)
+	level, trend := mean1, (mean2-mean1)/float64(season)
+	seasonal := make([]float64, season)
+	for i := range seasonal {
+		seasonal[i] = values[i] - mean1
+	}
+	for i, v := range values {
+		s := seasonal[i%season]
+		prev := level
+		level = alpha*(v-s) + (1-alpha)*(level+trend)
+		trend = beta*(level-prev) + (1-beta)*trend
+		seasonal[i%season] = gamma*(v-level) + (1-gamma)*s
+	}
+	n := len(values)
+	return func(h int) float64 {
+		return level + float64(h)*trend + seasonal[(n+h-1)%season]
+	}
+}
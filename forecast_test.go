@@ -0,0 +1,60 @@
+package grada
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestForecastModels(t *testing.T) {
+	linear := []float64{1, 2, 3, 4, 5}
+	seasonal := []float64{1, 5, 1, 5, 1, 5, 1, 5}
+	tests := []struct {
+		name   string
+		cfg    ForecastConfig
+		values []float64
+		h      int
+		want   float64
+	}{
+		{"linear", ForecastConfig{Method: ForecastLinear}, linear, 2, 7},
+		{"holt", ForecastConfig{Method: ForecastHoltWinters, Alpha: 0.5, Beta: 0.1}, linear, 2, 7},
+		{"seasonalEven", ForecastConfig{Method: ForecastHoltWinters, Season: 2, Alpha: 0.5, Beta: 0.1, Gamma: 0.1}, seasonal, 2, 5},
+		{"seasonalOdd", ForecastConfig{Method: ForecastHoltWinters, Season: 2, Alpha: 0.5, Beta: 0.1, Gamma: 0.1}, seasonal, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cfg.model(tt.values)(tt.h)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("forecast(%d) = %v, want %v", tt.h, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDashboard_CreateForecast(t *testing.T) {
+	d := NewDashboard()
+	src, _ := d.CreateMetricWithBufSize("disk", 10)
+	now := time.Now().Truncate(time.Second)
+	for i := 0; i < 5; i++ {
+		src.AddWithTime(float64(i), now.Add(time.Duration(i-5)*time.Second))
+	}
+	if err := d.CreateForecast("disk", "disk:forecast", ForecastConfig{}); err != nil {
+		t.Fatalf("CreateForecast(): %v", err)
+	}
+	if err := d.CreateForecast("disk", "disk:forecast", ForecastConfig{}); err == nil {
+		t.Errorf("second CreateForecast(): no error")
+	}
+
+	points, err := d.srv.datapoints("disk:forecast", now.Add(-time.Minute), now.Add(3*time.Second), 100)
+	if err != nil {
+		t.Fatalf("datapoints(): %v", err)
+	}
+	// 5 data points until now-1s, then forecasts for now ... now+2s.
+	if len(points) != 8 {
+		t.Fatalf("got %d data points, want 8: %v", len(points), points)
+	}
+	last := points[7]
+	if last[0].(float64) != 7 || last[1].(int64) != now.Add(2*time.Second).UnixNano()/int64(time.Millisecond) {
+		t.Errorf("last data point %v, want 7 at now+2s", last)
+	}
+}
@@ -0,0 +1,105 @@
+package grada
+
+// Location tables for Grafana's Geomap and Worldmap panels.
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// GeoPoint is a measurement at a location.
+type GeoPoint struct {
+	Time      time.Time // optional
+	Name      string
+	Latitude  float64 // -90 to 90
+	Longitude float64 // -180 to 180
+	Value     float64
+}
+
+// geohashPrecision is the length of the geohashes in geo tables,
+// about 5 by 5 meters.
+const geohashPrecision = 9
+
+// GeoTable builds a table from points, with the column names that the
+// Geomap and Worldmap panels recognize: "time", "name", "latitude",
+// "longitude", "geohash", and "value". It returns an error if a point
+// has an invalid latitude or longitude.
+func GeoTable(points []GeoPoint) (*Table, error) {
+	t := &Table{Columns: []Column{
+		{Text: "time", Type: ColumnTime},
+		{Text: "name", Type: ColumnString},
+		{Text: "latitude", Type: ColumnNumber},
+		{Text: "longitude", Type: ColumnNumber},
+		{Text: "geohash", Type: ColumnString},
+		{Text: "value", Type: ColumnNumber},
+	}}
+	for i, p := range points {
+		hash, err := Geohash(p.Latitude, p.Longitude, geohashPrecision)
+		if err != nil {
+			return nil, fmt.Errorf("point %d (%s): %w", i, p.Name, err)
+		}
+		var tm interface{}
+		if !p.Time.IsZero() {
+			tm = p.Time
+		}
+		t.Rows = append(t.Rows, []interface{}{tm, p.Name, p.Latitude, p.Longitude, hash, p.Value})
+	}
+	return t, nil
+}
+
+// CreateGeoTable creates a table target from the points that f returns
+// for the time range of a query. See GeoTable.
+func (d *Dashboard) CreateGeoTable(target string, f func(from, to time.Time) ([]GeoPoint, error)) error {
+	return d.srv.addTable(target, func(from, to time.Time) (*Table, error) {
+		points, err := f(from, to)
+		if err != nil {
+			return nil, err
+		}
+		return GeoTable(points)
+	})
+}
+
+// geohashBase32 is the alphabet of geohashes.
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash encodes a location as a geohash with the given number of
+// characters (1 to 12).
+func Geohash(lat, lon float64, precision int) (string, error) {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return "", fmt.Errorf("latitude %v out of range [-90, 90]", lat)
+	}
+	if math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return "", fmt.Errorf("longitude %v out of range [-180, 180]", lon)
+	}
+	if precision < 1 || precision > 12 {
+		return "", fmt.Errorf("geohash precision %d out of range [1, 12]", precision)
+	}
+
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	even := true // bits alternate between longitude and latitude, starting with longitude
+	ch, bit := 0, 0
+	for len(hash) < precision {
+		r, v := &latRange, lat
+		if even {
+			r, v = &lonRange, lon
+		}
+		mid := (r[0] + r[1]) / 2
+		ch <<= 1
+		if v >= mid {
+			ch |= 1
+			r[0] = mid
+		} else {
+			r[1] = mid
+		}
+		even = !even
+		bit++
+		if bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			ch, bit = 0, 0
+		}
+	}
+	return string(hash), nil
+}
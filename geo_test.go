@@ -0,0 +1,45 @@
+package grada
+
+import (
+	"testing"
+)
+
+func TestGeohash(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, lon  float64
+		precision int
+		want      string
+		wantErr   bool
+	}{
+		{"jutland", 57.64911, 10.40744, 11, "u4pruydqqvj", false},
+		{"origin", 0, 0, 5, "s0000", false},
+		{"latitude", 91, 0, 5, "", true},
+		{"longitude", 0, -181, 5, "", true},
+		{"precision", 0, 0, 13, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Geohash(tt.lat, tt.lon, tt.precision)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Geohash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Geohash() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoTable(t *testing.T) {
+	table, err := GeoTable([]GeoPoint{{Name: "Aalborg", Latitude: 57.64911, Longitude: 10.40744, Value: 3}})
+	if err != nil {
+		t.Fatalf("GeoTable(): %v", err)
+	}
+	if got := table.Rows[0][4]; got != "u4pruydqq" {
+		t.Errorf("geohash %v, want u4pruydqq", got)
+	}
+	if _, err := GeoTable([]GeoPoint{{Name: "nowhere", Latitude: 100}}); err == nil {
+		t.Errorf("GeoTable() with invalid latitude: no error")
+	}
+}
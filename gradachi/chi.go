@@ -0,0 +1,47 @@
+//go:build chi
+
+package gradachi
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/christophberger/grada"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Middleware returns a chi middleware that records every request under
+// its method and route pattern, such as "GET /items/{id}", with
+// Dashboard.RecordRequest. Requests that match no route have the route
+// "unmatched".
+func Middleware(d *grada.Dashboard) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := "unmatched"
+			// chi completes the route pattern while routing the request.
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if p := rctx.RoutePattern(); p != "" {
+					route = r.Method + " " + p
+				}
+			}
+			d.RecordRequest(route, status, time.Since(start))
+		})
+	}
+}
+
+// Mount serves the endpoints of the dashboard below path, for example
+// "/grafana/query" for path "/grafana". Point the Grafana datasource to
+// the URL of path.
+func Mount(r chi.Router, path string, d *grada.Dashboard) {
+	path = strings.TrimSuffix(path, "/")
+	r.Mount(path, http.StripPrefix(path, d.Handler()))
+}
@@ -0,0 +1,17 @@
+/*
+Package gradachi adapts grada to the chi router (github.com/go-chi/chi/v5):
+it mounts the endpoints of a dashboard on a chi router and records the
+requests of chi routes like Dashboard.Instrument.
+
+The grada package does not depend on chi, so this package is only built
+with the build tag "chi":
+
+	go build -tags chi
+
+Usage:
+
+	r := chi.NewRouter()
+	r.Use(gradachi.Middleware(d))
+	gradachi.Mount(r, "/grafana", d)
+*/
+package gradachi
@@ -0,0 +1,18 @@
+/*
+Package gradaecho adapts grada to the Echo web framework
+(github.com/labstack/echo/v4): it mounts the endpoints of a dashboard on an
+Echo router and records the requests of Echo routes like
+Dashboard.Instrument.
+
+The grada package does not depend on Echo, so this package is only built
+with the build tag "echo":
+
+	go build -tags echo
+
+Usage:
+
+	e := echo.New()
+	e.Use(gradaecho.Middleware(d))
+	gradaecho.Mount(e, "/grafana", d)
+*/
+package gradaecho
@@ -0,0 +1,52 @@
+//go:build echo
+
+package gradaecho
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/christophberger/grada"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware returns an Echo middleware that records every request under
+// its method and route, such as "GET /items/:id", with
+// Dashboard.RecordRequest. Requests that match no route, and requests
+// whose handler returns echo.ErrNotFound, have the route "unmatched".
+//
+// If the handler returns an error, the middleware records the status of
+// an *echo.HTTPError, or 500, because Echo writes the error response
+// only after the middleware has returned.
+func Middleware(d *grada.Dashboard) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+				var he *echo.HTTPError
+				if errors.As(err, &he) {
+					status = he.Code
+				}
+			}
+			route := "unmatched"
+			if p := c.Path(); p != "" && !errors.Is(err, echo.ErrNotFound) {
+				route = c.Request().Method + " " + p
+			}
+			d.RecordRequest(route, status, time.Since(start))
+			return err
+		}
+	}
+}
+
+// Mount serves the endpoints of the dashboard below path, for example
+// "/grafana/query" for path "/grafana". Point the Grafana datasource to
+// the URL of path.
+func Mount(e *echo.Echo, path string, d *grada.Dashboard) {
+	path = strings.TrimSuffix(path, "/")
+	e.Any(path+"/*", echo.WrapHandler(http.StripPrefix(path, d.Handler())))
+}
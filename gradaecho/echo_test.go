@@ -0,0 +1,61 @@
+//go:build echo
+
+package gradaecho
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/christophberger/grada"
+	"github.com/labstack/echo/v4"
+)
+
+func TestEcho(t *testing.T) {
+	d := grada.NewDashboard()
+	d.CreateMetricWithBufSize("cpu", 10)
+	e := echo.New()
+	e.Use(Middleware(d))
+	e.GET("/items/:id", func(c echo.Context) error {
+		if c.Param("id") == "0" {
+			return echo.NewHTTPError(http.StatusBadRequest, "bad id")
+		}
+		return c.String(http.StatusOK, c.Param("id"))
+	})
+	Mount(e, "/grafana/", d)
+
+	for _, path := range []string{"/items/1", "/items/2", "/items/0", "/nope"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("POST", "/grafana/search", strings.NewReader(`{"target": ""}`)))
+	if !strings.Contains(w.Body.String(), `"cpu"`) {
+		t.Errorf("mounted /search response %d %s", w.Code, w.Body.String())
+	}
+
+	for target, want := range map[string]float64{
+		"http.GET /items/:id.requests":   3,
+		"http.GET /items/:id.status.2xx": 2,
+		"http.GET /items/:id.status.4xx": 1,
+		"http.unmatched.status.4xx":      1,
+		"http.POST /grafana/*.requests":  1,
+	} {
+		if got := last(t, d, target); got != want {
+			t.Errorf("%s = %v, want %v", target, got, want)
+		}
+	}
+}
+
+// last returns the last data point of the metric for target.
+func last(t *testing.T, d *grada.Dashboard, target string) float64 {
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/value?target="+url.QueryEscape(target), nil))
+	var resp []struct{ Value float64 }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp) != 1 {
+		t.Fatalf("/value response for %s: %s", target, w.Body.String())
+	}
+	return resp[0].Value
+}
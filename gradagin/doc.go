@@ -0,0 +1,17 @@
+/*
+Package gradagin adapts grada to the gin web framework
+(github.com/gin-gonic/gin): it mounts the endpoints of a dashboard on a gin
+router and records the requests of gin routes like Dashboard.Instrument.
+
+The grada package does not depend on gin, so this package is only built
+with the build tag "gin":
+
+	go build -tags gin
+
+Usage:
+
+	r := gin.Default()
+	r.Use(gradagin.Middleware(d))
+	gradagin.Mount(r, "/grafana", d)
+*/
+package gradagin
@@ -0,0 +1,36 @@
+//go:build gin
+
+package gradagin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/christophberger/grada"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware returns a gin middleware that records every request under
+// its method and route, such as "GET /items/:id", with
+// Dashboard.RecordRequest. Requests that match no route have the route
+// "unmatched".
+func Middleware(d *grada.Dashboard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := "unmatched"
+		if p := c.FullPath(); p != "" {
+			route = c.Request.Method + " " + p
+		}
+		d.RecordRequest(route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// Mount serves the endpoints of the dashboard below path, for example
+// "/grafana/query" for path "/grafana". Point the Grafana datasource to
+// the URL of path.
+func Mount(r gin.IRoutes, path string, d *grada.Dashboard) {
+	path = strings.TrimSuffix(path, "/")
+	r.Any(path+"/*grada", gin.WrapH(http.StripPrefix(path, d.Handler())))
+}
@@ -8,14 +8,23 @@ package grada
 // Grafana sends three queries:
 // * /search for retrieving the available targets
 // * /query for requesting new sets of data
-// * /annotation for requesting chart annotations
+// * /annotations for requesting chart annotations
+//
+// Additionally, /csv serves a single metric as CSV, /push and /export
+// let other producers and consumers write and read samples, /alerts
+// lists the state of threshold rules, and /replicate lets instances
+// exchange their data points (see WithReplication).
 
 import (
-	"bytes"
+	"crypto/x509"
 	"encoding/json"
-	"math/rand"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"net/netip"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -42,24 +51,34 @@ type query struct {
 	Interval   string `json:"interval"`
 	IntervalMs int    `json:"intervalMs"`
 	Targets    []struct {
-		Target string `json:"target"`
-		RefID  string `json:"refId"`
-		Type   string `json:"type"`
+		Target string          `json:"target"`
+		RefID  string          `json:"refId"`
+		Type   string          `json:"type"`
+		Data   json.RawMessage `json:"data"`
+		Hide   bool            `json:"hide"`
 	} `json:"targets"`
 	Format        string `json:"format"`
 	MaxDataPoints int    `json:"maxDataPoints"`
 }
 
+// dropHidden removes the targets that are hidden in the panel, which
+// Grafana sends with "hide": true, so that they cost no fetches and do
+// not show up in the response. It reports whether targets are left.
+func (q *query) dropHidden() bool {
+	visible := q.Targets[:0]
+	for _, t := range q.Targets {
+		if !t.Hide {
+			visible = append(visible, t)
+		}
+	}
+	q.Targets = visible
+	return len(visible) > 0
+}
+
 // row is used in timeseriesResponse and tableResponse.
 // Grafana's JSON contains weird arrays with mixed types!
 type row []interface{}
 
-// column is used in tableResponse.
-type column struct {
-	Text string `json:"text"`
-	Type string `json:"type"`
-}
-
 // timeseriesResponse is the response to a `/query` request
 // if "Type" is set to "timeserie".
 // It sends time series data back to Grafana.
@@ -70,9 +89,11 @@ type timeseriesResponse struct {
 
 // tableResponse is the response to send when "Type" is "table".
 type tableResponse struct {
-	Columns []column `json:"columns"`
-	Rows    []row    `json:"rows"`
-	Type    string   `json:"type"`
+	Name    string     `json:"name,omitempty"`
+	Columns []Column   `json:"columns"`
+	Rows    []row      `json:"rows"`
+	Type    string     `json:"type"`
+	Meta    *tableMeta `json:"meta,omitempty"`
 }
 
 var debug bool
@@ -83,141 +104,539 @@ var debug bool
 // by target name. When Grafana requests new data for a target,
 // the server returns the current list of metrics for that target.
 type server struct {
-	metrics *metrics
+	metrics    *metrics
+	mux        *http.ServeMux
+	handler    http.Handler // mux plus everything that wraps it
+	httpServer *http.Server
+
+	h2c           bool   // serve HTTP/2 without TLS
+	noCompression bool   // do not gzip responses
+	sql           bool   // accept SQL statements as table targets
+	expressions   bool   // accept expressions as time series targets
+	searchTree    bool   // search one level of hierarchical names at a time
+	strict        bool   // validate queries, see WithStrictProtocol
+	prefix        string // path prefix for all endpoints
+
+	dialects map[string]Dialect // protocols by root, see WithDialect
+
+	certFile, keyFile string              // serve HTTPS if set
+	clientCAs         *x509.CertPool      // require client certificates if set
+	cnAccess          map[string][]string // allowed endpoints per client certificate CN
+	authenticator     Authenticator       // authenticate every request if set
+	ipAllow, ipDeny   []netip.Prefix      // client address filters
+	logger            *log.Logger         // logs failed requests if set
+	pprof             bool                // serve /debug/pprof/
+	admin             bool                // serve /admin/metrics
+	onPanic           func(r *http.Request, v interface{}, stack []byte)
+
+	unknownTargets UnknownTargetPolicy // response to queries for unknown targets
+	autoCreateSize int                 // buffer size for UnknownTargetCreate
+	maxBackfill    int                 // see WithBackfillLimit
+
+	drain   drainState    // requests in flight, see Dashboard.Drain
+	virtual virtualSeries // targets computed at query time
+	names   sync.Mutex    // serializes the registration of targets, see addVirtual
+
+	annotations   annotationStore    // see Dashboard.AddAnnotation
+	meta          targetMetas        // aliases and labels, see Dashboard.SetAlias
+	collectors    scheduler          // see Dashboard.AddCollector
+	requestCounts requestCounters    // see Dashboard.Increment
+	queryStats    queryStatsStore    // see Dashboard.QueryStats
+	recorder      *requestRecorder   // see WithRecorder
+	protocol      protocolStore      // see Dashboard.ProtocolDrift
+	grafanaDrift  driftState         // see Dashboard.GrafanaDrift
+	replication   *ReplicationConfig // see WithReplication
+	cluster       *cluster           // see WithCluster
+	walConfig     *WALConfig         // see WithWAL
+
+	tablesMu     sync.Mutex              // protects tables and staticTables
+	tables       map[string]tablesFunc   // table targets, see Dashboard.CreateTable
+	staticTables map[string]*StaticTable // tables with cached responses, see Dashboard.CreateStaticTable
+	eventsMu     sync.Mutex              // protects events
+	events       map[string]*Event       // event targets, see Dashboard.CreateEvent
+
+	querySlots chan struct{} // limits concurrent queries if set
+	queryWait  time.Duration // how long queries wait for a slot
+
+	maxResponsePoints int           // data points per time series response if set
+	queryLimits       QueryLimits   // see WithQueryLimits
+	slowQuery         time.Duration // see WithSlowQueryLog
+
+	queryTimeout time.Duration // deadline for partial query results if set
+
+	cache responseCache // see WithResponseCache
+
+	webhook      string // receives alert notifications if set
+	webhookQueue chan alertNotification
+	webhookOnce  sync.Once
+	rulesMu      sync.Mutex // protects rules
+	rules        []*rule    // threshold rules, see Dashboard.AddRule
 }
 
-func writeError(w http.ResponseWriter, e error, m string) {
-	w.WriteHeader(http.StatusBadRequest)
-	w.Write([]byte("{\"error\": \"" + m + ": " + e.Error() + "\"}"))
+// maxQueryBytes bounds the size of the body of a /query request, and of
+// the other requests that the server reads in full, such as /push.
+const maxQueryBytes = 1 << 20
 
+// readQueryBody reads the body of the request r. Bodies larger than
+// maxQueryBytes fail with an *http.MaxBytesError.
+func readQueryBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, maxQueryBytes))
 }
 
 func (srv *server) queryHandler(w http.ResponseWriter, r *http.Request) {
-	var q bytes.Buffer
+	start := time.Now()
 
-	_, err := q.ReadFrom(r.Body)
+	body, err := readQueryBody(w, r)
 	if err != nil {
-		writeError(w, err, "Cannot read request body")
+		writeBodyError(w, err)
 		return
 	}
 
-	query := &query{}
-	err = json.Unmarshal(q.Bytes(), query)
+	query, err := unmarshalQuery(body)
 	if err != nil {
-		writeError(w, err, "cannot unmarshal request body")
+		writeError(w, http.StatusBadRequest, err, "cannot unmarshal request body")
 		return
 	}
+	srv.recordDrift(r, body)
 
-	// Our example should contain exactly one target.
+	if len(query.Targets) == 0 {
+		writeError(w, http.StatusBadRequest, nil, "query contains no targets")
+		return
+	}
+	if !query.dropHidden() {
+		writeJSON(w, []struct{}{})
+		return
+	}
+	if err := srv.queryLimits.check(query); err != nil {
+		writeError(w, http.StatusBadRequest, err, "query exceeds a limit")
+		return
+	}
+
+	r, cancel := srv.withQueryTimeout(r)
+	defer cancel()
 
 	// Depending on the type, we need to send either a timeseries response
 	// or a table response.
+	var points int
 	switch query.Targets[0].Type {
-	case "timeserie":
-		srv.sendTimeseries(w, query)
-	case "table":
-		srv.sendTable(w, query)
+	case "timeserie", "":
+		points = srv.sendTimeseries(w, r, query)
+	case "table", "logs":
+		points = srv.sendTable(w, r, query)
+	default:
+		writeError(w, http.StatusBadRequest, nil, "unsupported target type "+query.Targets[0].Type)
 	}
+	srv.logSlowQuery(r, query, time.Since(start), points)
 }
 
-// sendTimeseries creates and writes a JSON response to a request for time series data.
-func (srv *server) sendTimeseries(w http.ResponseWriter, q *query) {
-
-	response := []timeseriesResponse{}
+// queryEndpoint returns queryHandler with strict validation, ETags, the
+// response cache, the fan-out to the nodes of a cluster, and the
+// concurrency limit applied.
+// Cached responses do not take a query slot, and neither do the targets
+// of other nodes.
+func (srv *server) queryEndpoint() http.HandlerFunc {
+	return srv.strictQueries(srv.etagQueries(srv.cacheQueries(srv.clusterQueries(srv.limitQueries(srv.queryHandler)))))
+}
 
-	for _, t := range q.Targets {
+// sendTimeseries creates and writes a JSON response to a request for time series data.
+// Clients that accept protobuf, NDJSON, or CSV get a response in that format
+// instead (see query.proto and negotiate.go). Series have at most one data
+// point per interval of q (see interval.go).
+// It returns the number of data points it has written.
+func (srv *server) sendTimeseries(w http.ResponseWriter, r *http.Request, q *query) (points int) {
+
+	response := []series{}
+	defer func() {
+		for _, s := range response {
+			s.release()
+		}
+	}()
+	deadline := newQueryDeadline(r)
+	maxDataPoints, capped := srv.capDataPoints(q)
+	var owners []int         // the target of each series
+	var took []time.Duration // the time to get the series of each target
+
+	for i, t := range q.Targets {
+		if deadline.exceeded(i) {
+			markPartial(w, i, len(q.Targets))
+			break
+		}
+		start := time.Now()
+		n := len(response)
 		target := t.Target
-		metric, err := srv.metrics.Get(target)
-		if err != nil {
-			writeError(w, err, "Cannot get metric for target "+target)
-			return
+		var data targetData
+		if len(t.Data) > 0 {
+			json.Unmarshal(t.Data, &data)
+		}
+		switch {
+		case data.Reduce != "":
+			if !validReduce(data.Reduce) {
+				writeError(w, http.StatusBadRequest, nil, "unknown reduce function "+data.Reduce)
+				return
+			}
+			v, ms, ok, err := srv.reduce(target, data.Reduce, q.Range.From, q.Range.To)
+			if err != nil {
+				writeError(w, statusFor(err), err, "Cannot get metric for target "+target)
+				return
+			}
+			rows := []row{}
+			if ok {
+				rows = append(rows, row{v, ms})
+			}
+			response = append(response, series{target: srv.displayName(target, data.Alias), rows: rows})
+		case srv.expressions && isExpression(target) && !srv.targetExists(target):
+			list, err := srv.evalExpr(target, q.Range.From, q.Range.To, q.interval(), maxDataPoints)
+			if err != nil {
+				writeError(w, statusFor(err), err, "Cannot evaluate expression "+target)
+				return
+			}
+			for _, s := range list {
+				s.target = srv.displayName(s.target, data.Alias)
+				response = append(response, s)
+			}
+		default:
+			fill, agg, err := srv.downsampling(target, data)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err, "invalid data of target "+target)
+				return
+			}
+			limit := maxDataPoints
+			if agg != "" {
+				limit = math.MaxInt // all data points go into the aggregation
+			}
+			s, err := srv.seriesByInterval(target, q.Range.From, q.Range.To, limit, q.interval())
+			if err != nil {
+				writeError(w, statusFor(err), err, "Cannot get metric for target "+target)
+				return
+			}
+			if agg != "" {
+				if err := s.downsample(q.Range.From, q.Range.To, q.step(maxDataPoints), fill, agg); err != nil {
+					writeError(w, http.StatusInternalServerError, err, "Cannot get data points for target "+target)
+					return
+				}
+			}
+			s.target = srv.displayName(target, data.Alias)
+			response = append(response, s)
+		}
+		took = append(took, time.Since(start))
+		for ; n < len(response); n++ {
+			owners = append(owners, i)
+		}
+	}
+	for i := range response {
+		response[i].thinToInterval(q.interval())
+	}
+	if srv.capResponse(response) || capped {
+		srv.warnCapped(r)
+	}
+
+	format := responseFormat(r)
+	if format != "" && format != formatFrames {
+		list := make([]timeseriesResponse, len(response))
+		written := make([]int, len(response))
+		for i, s := range response {
+			rows, err := s.datapoints()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err, "Cannot get data points for target "+s.target)
+				return
+			}
+			list[i] = timeseriesResponse{Target: s.target, Datapoints: rows}
+			written[i] = len(rows)
+		}
+		if format == formatProtobuf {
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.Write(marshalProtoTimeseries(list))
+		} else {
+			writeSeriesText(w, format, list)
 		}
-		response = append(response, timeseriesResponse{
-			Target:     target,
-			Datapoints: *(metric.fetchDatapoints(q.Range.From, q.Range.To, q.MaxDataPoints)),
-		})
+		return srv.recordQueryStats(q, took, owners, written)
 	}
 
-	jsonResp, err := json.Marshal(response)
+	if format == formatFrames {
+		for i := range response {
+			response[i].config = srv.fieldConfig(q.Targets[owners[i]].Target, response[i].target)
+		}
+	}
+	buf := encodeBuffers.Get().(*[]byte)
+	defer encodeBuffers.Put(buf)
+	w.Header().Set("Content-Type", "application/json")
+	sw := &streamWriter{w: w}
+	jsonResp, err := sw.writeSeriesJSON((*buf)[:0], response)
 	if err != nil {
-		writeError(w, err, "cannot marshal timeseries response")
+		srv.streamError(w, r, sw, err, "cannot marshal timeseries response")
+		return
 	}
+	*buf = jsonResp
 
 	w.Write(jsonResp)
-
+	return srv.recordQueryStats(q, took, owners, sw.written)
 }
 
-// TODO: Just a dummy for now
-// sendTable creates and writes a JSON response to a request for table data
-func (srv *server) sendTable(w http.ResponseWriter, q *query) {
-
-	response := []tableResponse{
-		{
-			Columns: []column{
-				{Text: "Name", Type: "string"},
-				{Text: "Value", Type: "number"},
-				{Text: "Time", Type: "time"},
-			},
-			Rows: []row{
-				{"Alpha", rand.Intn(100), float64(int64(time.Now().UnixNano() / 1000000))},
-				{"Bravo", rand.Intn(100), float64(int64(time.Now().UnixNano() / 1000000))},
-				{"Charlie", rand.Intn(100), float64(int64(time.Now().UnixNano() / 1000000))},
-				{"Delta", rand.Intn(100), float64(int64(time.Now().UnixNano() / 1000000))},
-			},
-			Type: "table",
-		},
+// sendTable creates and writes a JSON response to a request for table data.
+// It returns the number of table rows it has written.
+func (srv *server) sendTable(w http.ResponseWriter, r *http.Request, q *query) (rows int) {
+
+	// The response is a JSON array of table responses. Static tables
+	// contribute their cached JSON; all other tables are marshaled here.
+	buf := encodeBuffers.Get().(*[]byte)
+	defer encodeBuffers.Put(buf)
+	jsonResp := append((*buf)[:0], '[')
+	deadline := newQueryDeadline(r)
+	format := responseFormat(r)
+	if format == formatProtobuf || format == formatFrames {
+		format = "" // tables have no protobuf or data frame encoding
 	}
-
-	jsonResp, err := json.Marshal(response)
-	if err != nil {
-		writeError(w, err, "cannot marshal table response")
+	var text []tableResponse   // the tables of an NDJSON or CSV response
+	var targets, written []int // the index and the rows of each target
+	var took []time.Duration   // the time to get the tables of each target
+
+	for i, t := range q.Targets {
+		if deadline.exceeded(i) {
+			markPartial(w, i, len(q.Targets))
+			break
+		}
+		start, before := time.Now(), rows
+		var data targetData
+		if len(t.Data) > 0 {
+			json.Unmarshal(t.Data, &data)
+		}
+		paged := data.Limit > 0
+		shaped := paged || len(data.Filter) > 0 || len(data.Sort) > 0
+		if st, ok := srv.staticTable(t.Target); ok && !shaped && format == "" {
+			b, n := st.cached()
+			rows += n
+			if err := srv.queryLimits.checkRows(rows); err != nil {
+				writeError(w, http.StatusBadRequest, err, "query exceeds a limit")
+				return
+			}
+			jsonResp = appendElement(jsonResp, b)
+			targets, written, took = append(targets, i), append(written, n), append(took, time.Since(start))
+			continue
+		}
+		var tables []*Table
+		var err error
+		if srv.sql && isSQL(t.Target) {
+			tables, err = srv.sqlTables(t.Target, q.Range.From, q.Range.To)
+		} else {
+			tables, err = srv.tablesFor(t.Target, q.Range.From, q.Range.To)
+		}
+		if err != nil {
+			writeError(w, statusFor(err), err, "Cannot get table for target "+t.Target)
+			return
+		}
+		for _, table := range tables {
+			if len(data.Filter) > 0 || len(data.Sort) > 0 {
+				table, err = table.filterSort(data.Filter, data.Sort)
+				if err != nil {
+					writeError(w, statusFor(err), err, "cannot filter or sort table "+t.Target)
+					return
+				}
+			}
+			var meta *tableMeta
+			if paged {
+				table, meta = table.page(data.Page, data.Limit)
+			}
+			rows += len(table.Rows)
+			if err := srv.queryLimits.checkRows(rows); err != nil {
+				writeError(w, http.StatusBadRequest, err, "query exceeds a limit")
+				return
+			}
+			resp, err := table.response()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err, "cannot convert table "+t.Target)
+				return
+			}
+			resp.Meta = meta
+			if format != "" {
+				text = append(text, resp)
+				continue
+			}
+			b, err := json.Marshal(resp)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err, "cannot marshal table response")
+				return
+			}
+			jsonResp = appendElement(jsonResp, b)
+		}
+		targets, written, took = append(targets, i), append(written, rows-before), append(took, time.Since(start))
+	}
+	if format != "" {
+		writeTablesText(w, format, text)
+		return srv.recordQueryStats(q, took, targets, written)
 	}
+	jsonResp = append(jsonResp, ']')
+	*buf = jsonResp
 
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonResp)
-
+	return srv.recordQueryStats(q, took, targets, written)
 }
 
 // A search request from Grafana expects a list of target names as a response.
 // These names are shown in the metrics dropdown when selecting a metric in
-// the Metrics tab of a panel.
+// the Metrics tab of a panel. See search.go for hierarchical search.
 func (srv *server) searchHandler(w http.ResponseWriter, r *http.Request) {
-	var targets []string
-	for t, _ := range srv.metrics.metric {
-		targets = append(targets, t)
+	req, err := parseSearch(w, r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	var v interface{} = srv.search(req.Target)
+	if srv.cluster != nil && !req.Grouped && r.Header.Get(clusterHeader) == "" {
+		v = srv.clusterSearch(r.Context(), req.Target, v.([]string))
 	}
-	resp, err := json.Marshal(targets)
+	if req.Grouped {
+		v = srv.groupByCategory(v.([]string))
+	}
+	resp, err := json.Marshal(v)
 	if err != nil {
-		writeError(w, err, "cannot marshal targets response")
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal targets response")
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
 
-// startServer creates and starts the API server.
-func startServer() *server {
+// newServer creates the API server, applies the options, and installs
+// the handlers. It does not start listening.
+func newServer(opts ...Option) *server {
 
-	server := &server{
+	srv := &server{
 		metrics: &metrics{
 			metric: map[string]*Metric{},
 		},
+		mux: http.NewServeMux(),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	if srv.walConfig != nil {
+		srv.openWAL()
+	}
+
+	if srv.annotations.path != "" {
+		if err := srv.annotations.load(); err != nil && srv.logger != nil {
+			srv.logger.Printf("grada: cannot load annotations: %v", err)
+		}
 	}
 
 	// Grafana expects a "200 OK" status for "/" when testing the connection.
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	srv.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			writeError(w, http.StatusNotFound, nil, "no such endpoint")
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	})
 
-	http.HandleFunc("/query", server.queryHandler)
-	http.HandleFunc("/search", server.searchHandler)
+	srv.mux.HandleFunc("/query", allowMethods(srv.queryEndpoint(), "POST"))
+	srv.mux.HandleFunc("/search", allowMethods(srv.searchHandler, "GET", "POST"))
+	srv.mux.HandleFunc("/annotations", allowMethods(srv.annotationsHandler, "POST"))
+	srv.mux.HandleFunc("/alerts", allowMethods(srv.alertsHandler, "GET", "HEAD"))
+	srv.mux.Handle("/collectors", srv.guarded(allowMethods(srv.collectorsHandler, "GET", "HEAD")))
+	srv.mux.Handle("/querystats", srv.guarded(allowMethods(srv.queryStatsHandler, "GET", "HEAD")))
+	srv.mux.Handle("/debug/protocol", srv.guarded(allowMethods(srv.protocolHandler, "GET", "HEAD")))
+	srv.mux.HandleFunc("/csv", allowMethods(srv.csvHandler, "GET", "HEAD"))
+	srv.mux.HandleFunc("/push", allowMethods(srv.pushHandler, "POST"))
+	srv.mux.HandleFunc("/export", allowMethods(srv.exportHandler, "GET", "HEAD"))
+	srv.mux.HandleFunc("/value", allowMethods(srv.valueHandler, "GET", "HEAD"))
+	if srv.dialects != nil {
+		srv.installDialects()
+	}
+	if srv.pprof {
+		srv.installPprof()
+	}
+	if srv.admin {
+		srv.installAdmin()
+	}
+	if srv.replication != nil {
+		srv.startReplication()
+	}
 
-	// Determine the port. Default is 3001 but can be changed via
-	// environment variable GRADA_PORT.
+	srv.handler = srv.mux
+	if srv.recorder != nil {
+		srv.handler = srv.record(srv.handler)
+	}
+	if srv.cnAccess != nil {
+		srv.handler = srv.authorizeClientCert(srv.handler)
+	}
+	if srv.authenticator != nil {
+		srv.handler = srv.authenticate(srv.handler)
+	}
+	if srv.prefix != "" {
+		srv.handler = stripPrefix(srv.prefix, srv.handler)
+	}
+	if srv.ipAllow != nil || srv.ipDeny != nil {
+		srv.handler = srv.filterIP(srv.handler)
+	}
+	srv.handler = srv.trackInFlight(srv.handler)
+	if !srv.noCompression {
+		srv.handler = srv.compress(srv.handler)
+	}
+	srv.handler = srv.recoverPanic(srv.handler)
+	srv.handler = srv.requestID(srv.handler)
+
+	return srv
+}
+
+// newHTTPServer creates the http.Server that serves the API at addr.
+func (srv *server) newHTTPServer(addr string) *http.Server {
+	hs := &http.Server{Addr: addr}
+	srv.configure(hs)
+	return hs
+}
+
+// configure installs the server's handler in hs and applies the TLS and
+// protocol options. Other settings of hs remain as they are.
+func (srv *server) configure(hs *http.Server) {
+	hs.Handler = srv.handler
+	if cfg := srv.tlsConfig(); cfg != nil {
+		if hs.TLSConfig == nil {
+			hs.TLSConfig = cfg
+		} else {
+			hs.TLSConfig = hs.TLSConfig.Clone()
+			hs.TLSConfig.ClientCAs = cfg.ClientCAs
+			hs.TLSConfig.ClientAuth = cfg.ClientAuth
+		}
+	}
+	if srv.h2c {
+		if hs.Protocols == nil {
+			hs.Protocols = &http.Protocols{}
+			hs.Protocols.SetHTTP1(true)
+		}
+		hs.Protocols.SetUnencryptedHTTP2(true)
+	}
+}
+
+// startServer creates and starts the API server.
+func startServer(opts ...Option) *server {
+
+	srv := newServer(opts...)
+	srv.httpServer = srv.newHTTPServer(defaultAddr())
+	go srv.serve()
+	return srv
+}
+
+// defaultAddr returns the listen address of the server.
+// Default port is 3001 but can be changed via environment variable GRADA_PORT.
+func defaultAddr() string {
 	port := "3001"
 	portenv := os.Getenv("GRADA_PORT")
 	if portenv != "" {
 		port = portenv
 	}
+	return ":" + port
+}
 
-	// Start the server.
-	go http.ListenAndServe(":"+port, nil)
-	return server
+// serve runs srv.httpServer until it is closed. It serves HTTPS if
+// WithTLS is set or if the TLS configuration of srv.httpServer
+// contains certificates.
+func (srv *server) serve() error {
+	cfg := srv.httpServer.TLSConfig
+	if srv.certFile != "" || cfg != nil && (len(cfg.Certificates) > 0 || cfg.GetCertificate != nil) {
+		return srv.httpServer.ListenAndServeTLS(srv.certFile, srv.keyFile)
+	}
+	return srv.httpServer.ListenAndServe()
 }
@@ -0,0 +1,162 @@
+package grada
+
+// Grafana alert rules for the threshold rules of a dashboard.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GrafanaAlertConfig configures Dashboard.GrafanaAlertRules.
+type GrafanaAlertConfig struct {
+	// DatasourceUID is the UID of the data source in Grafana, which its
+	// URL in Grafana shows. It is required.
+	DatasourceUID string
+	// Folder is the title of the folder of the alert rules. The default
+	// is "grada".
+	Folder string
+	// Group is the name of the rule group. The default is "grada".
+	Group string
+	// Interval is the evaluation interval of the rule group. The default
+	// is one minute.
+	Interval time.Duration
+	// Labels are added to the labels of every alert rule, such as a team
+	// or a severity for notification policies.
+	Labels map[string]string
+}
+
+// grafanaAlertRules is the JSON model of a Grafana alerting provisioning
+// file.
+type grafanaAlertRules struct {
+	APIVersion int                `json:"apiVersion"`
+	Groups     []grafanaRuleGroup `json:"groups"`
+}
+
+type grafanaRuleGroup struct {
+	OrgID    int                `json:"orgId"`
+	Name     string             `json:"name"`
+	Folder   string             `json:"folder"`
+	Interval string             `json:"interval"`
+	Rules    []grafanaAlertRule `json:"rules"`
+}
+
+type grafanaAlertRule struct {
+	UID          string             `json:"uid"`
+	Title        string             `json:"title"`
+	Condition    string             `json:"condition"`
+	Data         []grafanaAlertData `json:"data"`
+	NoDataState  string             `json:"noDataState"`
+	ExecErrState string             `json:"execErrState"`
+	For          string             `json:"for"`
+	Annotations  map[string]string  `json:"annotations"`
+	Labels       map[string]string  `json:"labels,omitempty"`
+}
+
+// grafanaAlertData is a query or an expression of a grafanaAlertRule.
+type grafanaAlertData struct {
+	RefID             string                 `json:"refId"`
+	RelativeTimeRange *grafanaTimeRange      `json:"relativeTimeRange,omitempty"`
+	DatasourceUID     string                 `json:"datasourceUid"`
+	Model             map[string]interface{} `json:"model"`
+}
+
+// grafanaTimeRange is a time range in seconds before now.
+type grafanaTimeRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// GrafanaAlertRules returns a Grafana alerting provisioning file in JSON
+// with a Grafana-managed alert rule for every threshold rule of the
+// dashboard (see Dashboard.AddRule), so that alerts fire in Grafana even
+// when no one watches /alerts or a webhook, while the rules stay in the
+// code next to the metrics. Put the file into Grafana's
+// provisioning/alerting directory.
+//
+// Each alert rule queries the target of a Rule over the last ten
+// evaluation intervals, and compares the last value with the threshold.
+// A rule with For samples must be breached for For-1 evaluation
+// intervals, since Grafana evaluates the last value once per interval.
+// The labels of the target (see Dashboard.SetLabels) and cfg.Labels
+// become the labels of the alert rule. Grafana evaluates alert rules
+// only through data source plugins with a backend, such as the plugin
+// of JSONDatasource.
+//
+// GrafanaAlertRules fails if cfg.DatasourceUID is empty.
+func (d *Dashboard) GrafanaAlertRules(cfg GrafanaAlertConfig) ([]byte, error) {
+	if cfg.DatasourceUID == "" {
+		return nil, errors.New("grada: alert rules need the UID of the data source")
+	}
+	if cfg.Folder == "" {
+		cfg.Folder = "grada"
+	}
+	if cfg.Group == "" {
+		cfg.Group = "grada"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	group := grafanaRuleGroup{OrgID: 1, Name: cfg.Group, Folder: cfg.Folder, Interval: grafanaDuration(cfg.Interval), Rules: []grafanaAlertRule{}}
+	for _, a := range d.srv.alerts() {
+		group.Rules = append(group.Rules, d.srv.grafanaAlertRule(a.Rule, cfg))
+	}
+	return json.MarshalIndent(grafanaAlertRules{APIVersion: 1, Groups: []grafanaRuleGroup{group}}, "", "  ")
+}
+
+// grafanaAlertRule returns the alert rule of r: query A selects the
+// target, expression B reduces it to its last value, and expression C,
+// the condition, compares that value with the threshold.
+func (srv *server) grafanaAlertRule(r Rule, cfg GrafanaAlertConfig) grafanaAlertRule {
+	query := grafanaAlertData{
+		RefID:             "A",
+		RelativeTimeRange: &grafanaTimeRange{From: int(10 * cfg.Interval / time.Second)},
+		DatasourceUID:     cfg.DatasourceUID,
+		Model:             map[string]interface{}{"refId": "A", "target": r.Target, "type": "timeserie"},
+	}
+	evaluator, direction := "gt", "above"
+	if r.Below {
+		evaluator, direction = "lt", "below"
+	}
+	rule := grafanaAlertRule{
+		UID:       grafanaUID("grada-" + r.Name),
+		Title:     r.Name,
+		Condition: "C",
+		Data: []grafanaAlertData{query,
+			{RefID: "B", DatasourceUID: "__expr__", Model: map[string]interface{}{
+				"refId": "B", "type": "reduce", "expression": "A", "reducer": "last",
+			}},
+			{RefID: "C", DatasourceUID: "__expr__", Model: map[string]interface{}{
+				"refId": "C", "type": "threshold", "expression": "B",
+				"conditions": []interface{}{map[string]interface{}{
+					"evaluator": map[string]interface{}{"type": evaluator, "params": []float64{r.Threshold}},
+				}},
+			}},
+		},
+		NoDataState:  "NoData",
+		ExecErrState: "Error",
+		For:          grafanaDuration(time.Duration(max(r.For-1, 0)) * cfg.Interval),
+		Annotations:  map[string]string{"summary": fmt.Sprintf("%s is %s %g", srv.displayName(r.Target, ""), direction, r.Threshold)},
+	}
+	labels := srv.meta.get(r.Target).labels
+	if len(labels)+len(cfg.Labels) > 0 {
+		rule.Labels = map[string]string{}
+		for k, v := range labels {
+			rule.Labels[k] = v
+		}
+		for k, v := range cfg.Labels {
+			rule.Labels[k] = v
+		}
+	}
+	return rule
+}
+
+// grafanaDuration returns d in whole seconds or minutes, as Grafana's
+// alerting expects, such as "30s" or "5m".
+func grafanaDuration(d time.Duration) string {
+	if d > 0 && d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", (d+time.Second-1)/time.Second)
+}
@@ -0,0 +1,60 @@
+package grada
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard_GrafanaAlertRules(t *testing.T) {
+	d := NewDashboard()
+	d.CreateMetricWithBufSize("cpu", 10)
+	d.CreateMetricWithBufSize("disk.free", 10)
+	d.SetLabels("cpu", map[string]string{"host": "web1"})
+	d.SetAlias("disk.free", "free disk")
+	d.AddRule(Rule{Name: "CPU high", Target: "cpu", Threshold: 0.9, For: 3})
+	d.AddRule(Rule{Name: "Disk full", Target: "disk.free", Threshold: 1e9, Below: true})
+
+	if _, err := d.GrafanaAlertRules(GrafanaAlertConfig{}); err == nil {
+		t.Error("GrafanaAlertRules() without a data source UID: no error")
+	}
+	b, err := d.GrafanaAlertRules(GrafanaAlertConfig{DatasourceUID: "ds1", Interval: 30 * time.Second, Labels: map[string]string{"team": "ops"}})
+	if err != nil {
+		t.Fatalf("GrafanaAlertRules() error = %v", err)
+	}
+	var got grafanaAlertRules
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("GrafanaAlertRules() returned invalid JSON: %v", err)
+	}
+
+	// rule is an alert rule in short: its query, condition, and duration.
+	type rule struct {
+		UID, Title, Target string
+		From               int
+		Evaluator          string
+		Threshold          float64
+		For, Summary       string
+		Labels             map[string]string
+	}
+	var rules []rule
+	for _, r := range got.Groups[0].Rules {
+		cond := r.Data[2].Model["conditions"].([]interface{})[0].(map[string]interface{})["evaluator"].(map[string]interface{})
+		rules = append(rules, rule{
+			r.UID, r.Title, r.Data[0].Model["target"].(string), r.Data[0].RelativeTimeRange.From,
+			cond["type"].(string), cond["params"].([]interface{})[0].(float64),
+			r.For, r.Annotations["summary"], r.Labels,
+		})
+	}
+	want := []rule{
+		{"grada-cpu-high", "CPU high", "cpu", 300, "gt", 0.9, "1m", "cpu is above 0.9", map[string]string{"host": "web1", "team": "ops"}},
+		{"grada-disk-full", "Disk full", "disk.free", 300, "lt", 1e9, "0s", "free disk is below 1e+09", map[string]string{"team": "ops"}},
+	}
+	if diff := cmp.Diff(want, rules); diff != "" {
+		t.Errorf("alert rules mismatch (-want +got):\n%s", diff)
+	}
+	if g := got.Groups[0]; g.Name != "grada" || g.Folder != "grada" || g.Interval != "30s" {
+		t.Errorf("group = %s in %s every %s, want grada in grada every 30s", g.Name, g.Folder, g.Interval)
+	}
+}
@@ -0,0 +1,205 @@
+package grada
+
+// Starter dashboards for Grafana.
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// GrafanaDashboardConfig configures Dashboard.GrafanaDashboard.
+type GrafanaDashboardConfig struct {
+	// Title is the title of the dashboard. The default is "grada".
+	Title string
+	// UID is the unique ID of the dashboard in Grafana. By default,
+	// Grafana assigns one on import.
+	UID string
+	// Datasource is the name of the data source of the panels. The
+	// default is "grada", the default name of DatasourceProvisioning.
+	Datasource string
+	// GroupByCategory puts the targets of each category (see
+	// Dashboard.SetCategories) into one panel. By default, and for
+	// targets without a category, every target has a panel of its own.
+	GroupByCategory bool
+	// Refresh is the refresh interval of the dashboard, such as "5s".
+	// The default is not to refresh.
+	Refresh string
+}
+
+// grafanaDashboard is the JSON model of a Grafana dashboard.
+type grafanaDashboard struct {
+	UID           string `json:"uid,omitempty"`
+	Title         string `json:"title"`
+	Timezone      string `json:"timezone"`
+	Refresh       string `json:"refresh,omitempty"`
+	SchemaVersion int    `json:"schemaVersion"`
+	Time          struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"time"`
+	Panels []grafanaPanel `json:"panels"`
+}
+
+// grafanaPanel is a panel of a grafanaDashboard.
+type grafanaPanel struct {
+	ID          int                `json:"id"`
+	Type        string             `json:"type"`
+	Title       string             `json:"title"`
+	Datasource  string             `json:"datasource"`
+	GridPos     grafanaGridPos     `json:"gridPos"`
+	Targets     []grafanaTarget    `json:"targets"`
+	FieldConfig grafanaFieldConfig `json:"fieldConfig"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	RefID  string `json:"refId"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+type grafanaFieldConfig struct {
+	Defaults struct {
+		Unit string `json:"unit,omitempty"`
+	} `json:"defaults"`
+	Overrides []grafanaOverride `json:"overrides"`
+}
+
+// grafanaOverride sets the unit of the series with a display name.
+type grafanaOverride struct {
+	Matcher struct {
+		ID      string `json:"id"`
+		Options string `json:"options"`
+	} `json:"matcher"`
+	Properties []grafanaProperty `json:"properties"`
+}
+
+type grafanaProperty struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+}
+
+// GrafanaDashboard returns the JSON model of a Grafana dashboard with a
+// panel for every target of the dashboard, or for every category of
+// targets, as a starting point for the dashboard of a service. Import it
+// in Grafana, or provision it as a file. Time series panels use the
+// units of Dashboard.SetUnit; table targets get table panels.
+func (d *Dashboard) GrafanaDashboard(cfg GrafanaDashboardConfig) ([]byte, error) {
+	return json.MarshalIndent(d.srv.grafanaDashboard(cfg), "", "  ")
+}
+
+// grafanaDashboard returns the dashboard model of GrafanaDashboard.
+func (srv *server) grafanaDashboard(cfg GrafanaDashboardConfig) grafanaDashboard {
+	if cfg.Title == "" {
+		cfg.Title = "grada"
+	}
+	if cfg.Datasource == "" {
+		cfg.Datasource = "grada"
+	}
+	db := grafanaDashboard{UID: cfg.UID, Title: cfg.Title, Timezone: "browser", Refresh: cfg.Refresh, SchemaVersion: 39}
+	db.Time.From, db.Time.To = "now-1h", "now"
+	db.Panels = []grafanaPanel{}
+
+	// The targets of each panel, with the title of the panel.
+	type group struct {
+		title   string
+		targets []string
+	}
+	var groups, tables []group
+	var series []string
+	for _, t := range srv.targets() {
+		if srv.isTable(t) {
+			tables = append(tables, group{t, []string{t}})
+		} else {
+			series = append(series, t)
+		}
+	}
+	if cfg.GroupByCategory {
+		for _, g := range srv.groupByCategory(series) {
+			if g.Category != "" {
+				groups = append(groups, group{g.Category, g.Targets})
+				continue
+			}
+			for _, t := range g.Targets {
+				groups = append(groups, group{t, []string{t}})
+			}
+		}
+	} else {
+		for _, t := range series {
+			groups = append(groups, group{t, []string{t}})
+		}
+	}
+
+	// Two panels per row, time series first.
+	add := func(g group, typ, targetType string) {
+		n := len(db.Panels)
+		p := grafanaPanel{
+			ID:         n + 1,
+			Type:       typ,
+			Title:      g.title,
+			Datasource: cfg.Datasource,
+			GridPos:    grafanaGridPos{H: 8, W: 12, X: 12 * (n % 2), Y: 8 * (n / 2)},
+		}
+		p.FieldConfig.Overrides = []grafanaOverride{}
+		units := map[string]string{}
+		for i, t := range g.targets {
+			p.Targets = append(p.Targets, grafanaTarget{RefID: refID(i), Target: t, Type: targetType})
+			units[srv.displayName(t, "")] = srv.meta.get(t).unit
+		}
+		if unit, ok := commonUnit(units); ok {
+			p.FieldConfig.Defaults.Unit = unit
+		} else {
+			for _, t := range g.targets {
+				name := srv.displayName(t, "")
+				if units[name] == "" {
+					continue
+				}
+				var o grafanaOverride
+				o.Matcher.ID, o.Matcher.Options = "byName", name
+				o.Properties = []grafanaProperty{{"unit", units[name]}}
+				p.FieldConfig.Overrides = append(p.FieldConfig.Overrides, o)
+			}
+		}
+		db.Panels = append(db.Panels, p)
+	}
+	for _, g := range groups {
+		add(g, "timeseries", "timeserie")
+	}
+	for _, g := range tables {
+		add(g, "table", "table")
+	}
+	return db
+}
+
+// commonUnit returns the unit of units if all have the same.
+func commonUnit(units map[string]string) (string, bool) {
+	unit, first := "", true
+	for _, u := range units {
+		if !first && u != unit {
+			return "", false
+		}
+		unit, first = u, false
+	}
+	return unit, true
+}
+
+// refID returns the reference ID of the i-th target of a panel: A to Z,
+// then AA, AB, and so on, as Grafana assigns them.
+func refID(i int) string {
+	var b strings.Builder
+	for ; i >= 26; i = i/26 - 1 {
+		b.WriteByte(byte('A' + i%26))
+	}
+	b.WriteByte(byte('A' + i))
+	s := []byte(b.String())
+	for l, r := 0, len(s)-1; l < r; l, r = l+1, r-1 {
+		s[l], s[r] = s[r], s[l]
+	}
+	return string(s)
+}
@@ -0,0 +1,91 @@
+package grada
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard_GrafanaDashboard(t *testing.T) {
+	d := NewDashboard()
+	for _, target := range []string{"db.conns", "db.latency", "uptime"} {
+		d.CreateMetricWithBufSize(target, 10)
+	}
+	d.CreateStaticTable("hosts", &Table{Columns: []Column{{Text: "host", Type: "string"}}})
+	d.SetCategories("db.conns", "db")
+	d.SetCategories("db.latency", "db")
+	d.SetUnit("db.latency", "ms")
+	d.SetAlias("db.latency", "latency")
+	d.SetUnit("uptime", "s")
+
+	// panel is a panel in short: title, type, targets, default unit, and
+	// overrides by display name.
+	type panel struct {
+		Title, Type string
+		Targets     []string
+		Unit        string
+		Overrides   map[string]string
+		X, Y        int
+	}
+	tests := []struct {
+		name string
+		cfg  GrafanaDashboardConfig
+		want []panel
+	}{
+		{"per target", GrafanaDashboardConfig{}, []panel{
+			{"db.conns", "timeseries", []string{"db.conns"}, "", nil, 0, 0},
+			{"db.latency", "timeseries", []string{"db.latency"}, "ms", nil, 12, 0},
+			{"uptime", "timeseries", []string{"uptime"}, "s", nil, 0, 8},
+			{"hosts", "table", []string{"hosts"}, "", nil, 12, 8},
+		}},
+		{"per category", GrafanaDashboardConfig{GroupByCategory: true}, []panel{
+			{"db", "timeseries", []string{"db.conns", "db.latency"}, "", map[string]string{"latency": "ms"}, 0, 0},
+			{"uptime", "timeseries", []string{"uptime"}, "s", nil, 12, 0},
+			{"hosts", "table", []string{"hosts"}, "", nil, 0, 8},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := d.GrafanaDashboard(tt.cfg)
+			if err != nil {
+				t.Fatalf("GrafanaDashboard() error = %v", err)
+			}
+			var db grafanaDashboard
+			if err := json.Unmarshal(b, &db); err != nil {
+				t.Fatalf("GrafanaDashboard() = %s: %v", b, err)
+			}
+			if db.Title != "grada" || db.Time.From != "now-1h" {
+				t.Errorf("GrafanaDashboard() title %q, time from %q, want grada, now-1h", db.Title, db.Time.From)
+			}
+			var got []panel
+			for _, p := range db.Panels {
+				if p.Datasource != "grada" {
+					t.Errorf("panel %s: datasource %q, want grada", p.Title, p.Datasource)
+				}
+				sp := panel{Title: p.Title, Type: p.Type, Unit: p.FieldConfig.Defaults.Unit, X: p.GridPos.X, Y: p.GridPos.Y}
+				for _, t := range p.Targets {
+					sp.Targets = append(sp.Targets, t.Target)
+				}
+				for _, o := range p.FieldConfig.Overrides {
+					if sp.Overrides == nil {
+						sp.Overrides = map[string]string{}
+					}
+					sp.Overrides[o.Matcher.Options] = o.Properties[0].Value
+				}
+				got = append(got, sp)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("GrafanaDashboard() panels mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRefID(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := refID(i); got != want {
+			t.Errorf("refID(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package grada
+
+// Drift between the generated dashboard and the one in Grafana.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DriftPolicy determines what SyncGrafana does when the dashboard or the
+// folder in Grafana differs from the generated one.
+type DriftPolicy int
+
+const (
+	// DriftOverwrite replaces the dashboard in Grafana with the generated
+	// one, and restores the title of the folder. This is the default.
+	DriftOverwrite DriftPolicy = iota
+	// DriftReport leaves Grafana as it is, and reports the differences
+	// through Dashboard.GrafanaDrift and the logger of WithLogger. Missing
+	// dashboards and folders are created nevertheless.
+	DriftReport
+)
+
+// driftState holds the drift that the last sync of SyncGrafana has left.
+type driftState struct {
+	m    sync.Mutex
+	list []string
+}
+
+// set replaces the drift.
+func (s *driftState) set(list []string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.list = list
+}
+
+// GrafanaDrift returns the differences between Grafana and the generated
+// dashboard and folder that the last sync of SyncGrafana has found and
+// left, such as a panel that a user has added in Grafana, for teams that
+// generate their dashboards from code. With DriftOverwrite, the sync
+// removes the differences, and GrafanaDrift returns nil.
+func (d *Dashboard) GrafanaDrift() []string {
+	d.srv.grafanaDrift.m.Lock()
+	defer d.srv.grafanaDrift.m.Unlock()
+	return append([]string(nil), d.srv.grafanaDrift.list...)
+}
+
+// isNotFound reports whether err is a 404 Not Found status of Grafana.
+func isNotFound(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code == http.StatusNotFound
+}
+
+// syncDashboard creates the generated dashboard in Grafana, or updates it
+// if it differs and the policy is DriftOverwrite. It returns the drift
+// that remains.
+func (g *grafanaSync) syncDashboard(ctx context.Context) ([]string, error) {
+	want := g.srv.grafanaDashboard(g.cfg.Dashboard)
+	var existing struct {
+		Dashboard json.RawMessage `json:"dashboard"`
+	}
+	err := g.do(ctx, "GET", "/api/dashboards/uid/"+url.PathEscape(want.UID), nil, &existing)
+	var drift []string
+	switch {
+	case isNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		// Grafana adds fields and may change the types of others, such as
+		// data sources that become objects; compare what can be decoded.
+		var got grafanaDashboard
+		var te *json.UnmarshalTypeError
+		if err := json.Unmarshal(existing.Dashboard, &got); err != nil && !errors.As(err, &te) {
+			return nil, fmt.Errorf("GET /api/dashboards/uid/%s: %w", want.UID, err)
+		}
+		drift = dashboardDrift(want, got)
+		if len(drift) == 0 {
+			return nil, nil
+		}
+		if g.cfg.Drift == DriftReport {
+			if g.srv.logger != nil {
+				g.srv.logger.Printf("grada: sync Grafana: dashboard %s drifted: %s", want.UID, strings.Join(drift, "; "))
+			}
+			return drift, nil
+		}
+	}
+	req := struct {
+		Dashboard grafanaDashboard `json:"dashboard"`
+		FolderUID string           `json:"folderUid,omitempty"`
+		Overwrite bool             `json:"overwrite"`
+		Message   string           `json:"message"`
+	}{want, g.cfg.FolderUID, true, "grada: sync"}
+	if err := g.do(ctx, "POST", "/api/dashboards/db", req, nil); err != nil {
+		return nil, err
+	}
+	if drift != nil && g.srv.logger != nil {
+		g.srv.logger.Printf("grada: sync Grafana: overwrote dashboard %s: %s", want.UID, strings.Join(drift, "; "))
+	}
+	return nil, nil
+}
+
+// syncFolder creates the folder in Grafana, or restores its title if
+// the policy is DriftOverwrite. It returns the drift that remains.
+func (g *grafanaSync) syncFolder(ctx context.Context) ([]string, error) {
+	path := "/api/folders/" + url.PathEscape(g.cfg.FolderUID)
+	var folder struct {
+		Title string `json:"title"`
+	}
+	err := g.do(ctx, "GET", path, nil, &folder)
+	switch {
+	case isNotFound(err):
+		body := map[string]string{"uid": g.cfg.FolderUID, "title": g.cfg.FolderTitle}
+		return nil, g.do(ctx, "POST", "/api/folders", body, nil)
+	case err != nil:
+		return nil, err
+	case folder.Title == g.cfg.FolderTitle:
+		return nil, nil
+	}
+	drift := []string{fmt.Sprintf("folder %s: title %q, want %q", g.cfg.FolderUID, folder.Title, g.cfg.FolderTitle)}
+	if g.cfg.Drift == DriftReport {
+		if g.srv.logger != nil {
+			g.srv.logger.Printf("grada: sync Grafana: %s", drift[0])
+		}
+		return drift, nil
+	}
+	body := map[string]interface{}{"title": g.cfg.FolderTitle, "overwrite": true}
+	return nil, g.do(ctx, "PUT", path, body, nil)
+}
+
+// dashboardDrift returns the differences of the dashboard got in Grafana
+// from the generated dashboard want. It matches panels by title, and
+// compares their type, position, targets, and units.
+func dashboardDrift(want, got grafanaDashboard) []string {
+	var drift []string
+	if got.Title != want.Title {
+		drift = append(drift, fmt.Sprintf("title %q, want %q", got.Title, want.Title))
+	}
+	panels := map[string]grafanaPanel{}
+	for _, p := range got.Panels {
+		panels[p.Title] = p
+	}
+	for _, w := range want.Panels {
+		p, ok := panels[w.Title]
+		delete(panels, w.Title)
+		switch {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("panel %q: missing", w.Title))
+			continue
+		case p.Type != w.Type:
+			drift = append(drift, fmt.Sprintf("panel %q: type %q, want %q", w.Title, p.Type, w.Type))
+		case p.GridPos != w.GridPos:
+			drift = append(drift, fmt.Sprintf("panel %q: moved", w.Title))
+		}
+		if a, b := panelTargets(p), panelTargets(w); a != b {
+			drift = append(drift, fmt.Sprintf("panel %q: targets %s, want %s", w.Title, a, b))
+		}
+		if a, b := panelUnits(p), panelUnits(w); a != b {
+			drift = append(drift, fmt.Sprintf("panel %q: units %s, want %s", w.Title, a, b))
+		}
+	}
+	for _, p := range got.Panels {
+		if _, ok := panels[p.Title]; ok {
+			drift = append(drift, fmt.Sprintf("panel %q: not generated", p.Title))
+		}
+	}
+	return drift
+}
+
+// panelTargets returns the targets of p as text.
+func panelTargets(p grafanaPanel) string {
+	names := make([]string, len(p.Targets))
+	for i, t := range p.Targets {
+		names[i] = t.Target
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+// panelUnits returns the default unit and the unit overrides of p as
+// text.
+func panelUnits(p grafanaPanel) string {
+	units := []string{p.FieldConfig.Defaults.Unit}
+	for _, o := range p.FieldConfig.Overrides {
+		for _, prop := range o.Properties {
+			if prop.ID == "unit" {
+				units = append(units, o.Matcher.Options+"="+prop.Value)
+			}
+		}
+	}
+	return "[" + strings.Join(units, " ") + "]"
+}
@@ -0,0 +1,232 @@
+package grada
+
+// Synchronization of the data source and dashboard in Grafana.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// GrafanaSyncConfig configures Dashboard.SyncGrafana.
+type GrafanaSyncConfig struct {
+	// URL is the base URL of Grafana, as in "http://localhost:3000".
+	URL string
+	// Token is the token of a Grafana service account with the Editor
+	// role, or of an API key, sent as bearer token.
+	Token string
+	// Header is added to every request, for example for basic
+	// authentication instead of a token.
+	Header http.Header
+	// Client sends the requests. Default is http.DefaultClient.
+	Client *http.Client
+	// Interval is the time between two checks for changes. Default is one
+	// minute.
+	Interval time.Duration
+	// Datasource describes the data source, as for DatasourceProvisioning.
+	Datasource ProvisioningConfig
+	// Dashboard describes the dashboard, as for GrafanaDashboard. Its
+	// data source is Datasource. The default UID is derived from the
+	// title, so that every sync updates the same dashboard.
+	Dashboard GrafanaDashboardConfig
+	// FolderUID is the UID of the folder of the dashboard. Default is
+	// the General folder.
+	FolderUID string
+	// FolderTitle makes the sync create the folder of FolderUID with this
+	// title if it does not exist, and keep its title.
+	FolderTitle string
+	// Drift is what the sync does when the dashboard or the folder in
+	// Grafana differs from the generated one. Default is DriftOverwrite.
+	Drift DriftPolicy
+}
+
+// SyncGrafana keeps the data source and a dashboard of the targets of the
+// dashboard up to date in Grafana, through Grafana's HTTP API. It creates
+// or updates the data source by name, and creates or updates the
+// dashboard by UID, so that restarts and several instances of a service
+// do not create duplicates. The data source is updated when its
+// configuration has changed. At every interval, the sync compares the
+// dashboard in Grafana with the one that GrafanaDashboard generates,
+// which changes when metrics are created, and handles differences, the
+// drift, as cfg.Drift says; see Dashboard.GrafanaDrift.
+//
+// The syncs run as a collector named "grafana.sync"; remove it with
+// Dashboard.RemoveCollector. Failed syncs are logged and retried at the
+// next interval. With DriftOverwrite, changes that users make to the
+// dashboard in Grafana are overwritten by the next sync; save a copy
+// under another UID to keep them. SyncGrafana fails if cfg.URL is empty,
+// if the data source cannot be described (see DatasourceProvisioning),
+// or if a collector of the same name exists.
+func (d *Dashboard) SyncGrafana(cfg GrafanaSyncConfig) error {
+	if cfg.URL == "" {
+		return errors.New("grada: sync Grafana: no URL")
+	}
+	if _, err := d.srv.datasource(cfg.Datasource); err != nil {
+		return err
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	if cfg.Datasource.Name == "" {
+		cfg.Datasource.Name = "grada"
+	}
+	cfg.Dashboard.Datasource = cfg.Datasource.Name
+	if cfg.Dashboard.Title == "" {
+		cfg.Dashboard.Title = "grada"
+	}
+	if cfg.Dashboard.UID == "" {
+		cfg.Dashboard.UID = grafanaUID(cfg.Dashboard.Title)
+	}
+	return d.AddCollector(&grafanaSync{srv: d.srv, cfg: cfg})
+}
+
+// grafanaSync is the collector of SyncGrafana.
+type grafanaSync struct {
+	srv        *server
+	cfg        GrafanaSyncConfig
+	datasource []byte // the last synced data source
+}
+
+func (g *grafanaSync) Name() string            { return "grafana.sync" }
+func (g *grafanaSync) Interval() time.Duration { return g.cfg.Interval }
+
+// Collect syncs Grafana. Failures are logged.
+func (g *grafanaSync) Collect(ctx context.Context) []Sample {
+	if err := g.sync(ctx); err != nil && g.srv.logger != nil {
+		g.srv.logger.Printf("grada: sync Grafana: %v", err)
+	}
+	return nil
+}
+
+// sync updates the data source in Grafana if it has changed since the
+// last sync, and the folder and the dashboard if they differ from the
+// generated ones. The scheduler never runs two syncs of a collector at
+// once.
+func (g *grafanaSync) sync(ctx context.Context) error {
+	ds, err := g.srv.datasource(g.cfg.Datasource)
+	if err != nil {
+		return err
+	}
+	dsJSON, err := json.Marshal(ds)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(dsJSON, g.datasource) {
+		if err := g.syncDatasource(ctx, ds); err != nil {
+			return err
+		}
+		g.datasource = dsJSON
+	}
+
+	var drift []string
+	if g.cfg.FolderUID != "" && g.cfg.FolderTitle != "" {
+		d, err := g.syncFolder(ctx)
+		if err != nil {
+			return err
+		}
+		drift = append(drift, d...)
+	}
+	d, err := g.syncDashboard(ctx)
+	if err != nil {
+		return err
+	}
+	g.srv.grafanaDrift.set(append(drift, d...))
+	return nil
+}
+
+// syncDatasource creates the data source ds, or updates the data source
+// of the same name.
+func (g *grafanaSync) syncDatasource(ctx context.Context, ds grafanaDatasource) error {
+	var existing struct {
+		UID string `json:"uid"`
+	}
+	err := g.do(ctx, "GET", "/api/datasources/name/"+url.PathEscape(ds.Name), nil, &existing)
+	var se *statusError
+	switch {
+	case errors.As(err, &se) && se.code == http.StatusNotFound:
+		return g.do(ctx, "POST", "/api/datasources", ds, nil)
+	case err != nil:
+		return err
+	}
+	return g.do(ctx, "PUT", "/api/datasources/uid/"+url.PathEscape(existing.UID), ds, nil)
+}
+
+// do sends a request to the Grafana API with the JSON encoding of body,
+// unless body is nil, and decodes the JSON response into v, unless v is
+// nil.
+func (g *grafanaSync) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.cfg.URL+path, r)
+	if err != nil {
+		return err
+	}
+	for k, vs := range g.cfg.Header {
+		req.Header[k] = vs
+	}
+	if g.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.cfg.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := g.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Grafana explains errors in "message".
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+		status := resp.Status
+		if e.Message != "" {
+			status += ": " + e.Message
+		}
+		return &statusError{endpoint: method + " " + path, status: status, code: resp.StatusCode}
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// grafanaUID returns a dashboard UID for title: its letters and digits
+// in lower case, with dashes for other characters, and at most 40
+// characters long, as Grafana requires.
+func grafanaUID(title string) string {
+	uid := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, title)
+	if len(uid) > 40 {
+		uid = uid[:40]
+	}
+	return uid
+}
@@ -0,0 +1,161 @@
+package grada
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeGrafana records the requests to Grafana's HTTP API.
+type fakeGrafana struct {
+	m           sync.Mutex
+	requests    []string
+	datasources map[string]string // uid by name
+	folders     map[string]string // title by uid
+	dashboard   map[string]interface{}
+}
+
+func (f *fakeGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("Authorization") != "Bearer glsa_token" {
+		http.Error(w, `{"message":"invalid API key"}`, http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	switch r.Method + " " + r.URL.Path {
+	case "GET /api/datasources/name/grada":
+		uid, ok := f.datasources["grada"]
+		if !ok {
+			http.Error(w, `{"message":"Data source not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"uid": uid})
+	case "POST /api/datasources":
+		f.datasources["grada"] = "ds1"
+	case "PUT /api/datasources/uid/ds1":
+	case "GET /api/dashboards/uid/my-app":
+		if f.dashboard == nil {
+			http.Error(w, `{"message":"Dashboard not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"dashboard": f.dashboard["dashboard"]})
+	case "POST /api/dashboards/db":
+		var req map[string]interface{}
+		json.Unmarshal(body, &req)
+		f.dashboard = req
+	case "GET /api/folders/apps":
+		title, ok := f.folders["apps"]
+		if !ok {
+			http.Error(w, `{"message":"folder not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"uid": "apps", "title": title})
+	case "POST /api/folders", "PUT /api/folders/apps":
+		var req map[string]interface{}
+		json.Unmarshal(body, &req)
+		f.folders["apps"] = req["title"].(string)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// edit changes the panels of the dashboard as a user in Grafana would.
+func (f *fakeGrafana) edit(fn func(panels []interface{}) []interface{}) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	db := f.dashboard["dashboard"].(map[string]interface{})
+	db["panels"] = fn(db["panels"].([]interface{}))
+}
+
+// calls returns and clears the recorded requests.
+func (f *fakeGrafana) calls() []string {
+	f.m.Lock()
+	defer f.m.Unlock()
+	calls := f.requests
+	f.requests = nil
+	return calls
+}
+
+func TestGrafanaSync(t *testing.T) {
+	grafana := &fakeGrafana{datasources: map[string]string{}, folders: map[string]string{}}
+	gs := httptest.NewServer(grafana)
+	defer gs.Close()
+	d := NewDashboard()
+	d.CreateMetricWithBufSize("cpu", 10)
+	newSync := func(token string) *grafanaSync {
+		return &grafanaSync{srv: d.srv, cfg: GrafanaSyncConfig{
+			URL: gs.URL, Token: token, Client: gs.Client(),
+			Datasource: ProvisioningConfig{Name: "grada", URL: "http://app:3001"},
+			Dashboard:  GrafanaDashboardConfig{Title: "My App", UID: grafanaUID("My App"), Datasource: "grada"},
+		}}
+	}
+	ctx := context.Background()
+
+	if err := newSync("wrong").sync(ctx); err == nil || err.Error() != "GET /api/datasources/name/grada: 401 Unauthorized: invalid API key" {
+		t.Errorf("sync() with a wrong token: error = %v", err)
+	}
+	grafana.calls()
+
+	g := newSync("glsa_token")
+	steps := []struct {
+		name      string
+		change    func()
+		want      []string
+		wantDrift []string
+	}{
+		{"first", func() {}, []string{"GET /api/datasources/name/grada", "POST /api/datasources", "GET /api/dashboards/uid/my-app", "POST /api/dashboards/db"}, nil},
+		{"unchanged", func() {}, []string{"GET /api/dashboards/uid/my-app"}, nil},
+		{"new metric", func() { d.CreateMetricWithBufSize("mem", 10) }, []string{"GET /api/dashboards/uid/my-app", "POST /api/dashboards/db"}, nil},
+		{"panel removed", func() {
+			grafana.edit(func(p []interface{}) []interface{} { return p[:1] })
+		}, []string{"GET /api/dashboards/uid/my-app", "POST /api/dashboards/db"}, nil},
+		{"restart", func() { g = newSync("glsa_token") }, []string{"GET /api/datasources/name/grada", "PUT /api/datasources/uid/ds1", "GET /api/dashboards/uid/my-app"}, nil},
+		{"report", func() {
+			g.cfg.Drift = DriftReport
+			grafana.edit(func(p []interface{}) []interface{} {
+				return append(p, map[string]interface{}{"type": "text", "title": "Notes"})
+			})
+		}, []string{"GET /api/dashboards/uid/my-app"}, []string{`panel "Notes": not generated`}},
+		{"folder", func() {
+			g.cfg.FolderUID, g.cfg.FolderTitle = "apps", "Apps"
+		}, []string{"GET /api/folders/apps", "POST /api/folders", "GET /api/dashboards/uid/my-app"}, []string{`panel "Notes": not generated`}},
+		{"folder renamed", func() {
+			grafana.folders["apps"] = "Old"
+			g.cfg.Drift = DriftOverwrite
+		}, []string{"GET /api/folders/apps", "PUT /api/folders/apps", "GET /api/dashboards/uid/my-app", "POST /api/dashboards/db"}, nil},
+	}
+	for _, step := range steps {
+		step.change()
+		if err := g.sync(ctx); err != nil {
+			t.Fatalf("%s: sync() error = %v", step.name, err)
+		}
+		if diff := cmp.Diff(step.want, grafana.calls()); diff != "" {
+			t.Errorf("%s: requests mismatch (-want +got):\n%s", step.name, diff)
+		}
+		if diff := cmp.Diff(step.wantDrift, d.GrafanaDrift()); diff != "" {
+			t.Errorf("%s: GrafanaDrift() mismatch (-want +got):\n%s", step.name, diff)
+		}
+	}
+	if grafana.folders["apps"] != "Apps" || grafana.dashboard["folderUid"] != "apps" {
+		t.Errorf("folder = %q, dashboard folderUid = %v, want Apps and apps", grafana.folders["apps"], grafana.dashboard["folderUid"])
+	}
+	db, _ := grafana.dashboard["dashboard"].(map[string]interface{})
+	if db["uid"] != "my-app" || grafana.dashboard["overwrite"] != true || len(db["panels"].([]interface{})) != 2 {
+		t.Errorf("dashboard request = %v, want uid my-app, overwrite, and 2 panels", grafana.dashboard)
+	}
+
+	if err := d.SyncGrafana(GrafanaSyncConfig{}); err == nil {
+		t.Error("SyncGrafana() without URL: no error")
+	}
+	if err := d.SyncGrafana(GrafanaSyncConfig{URL: gs.URL}); err == nil {
+		t.Error("SyncGrafana() without a data source URL: no error")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Package grpcmetrics provides gRPC interceptors that record the calls of a
+gRPC server or client in the metrics of a grada dashboard, like
+Dashboard.Instrument does for HTTP handlers.
+
+Install the interceptors when creating the server or the client connection:
+
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcmetrics.UnaryServerInterceptor(d)),
+		grpc.StreamInterceptor(grpcmetrics.StreamServerInterceptor(d)),
+	)
+
+	conn, err := grpc.NewClient(addr,
+		grpc.WithUnaryInterceptor(grpcmetrics.UnaryClientInterceptor(d)),
+		grpc.WithStreamInterceptor(grpcmetrics.StreamClientInterceptor(d)),
+	)
+
+The metrics of a method, such as "grpc.server.shop.Cart/Add.requests", are:
+
+	<method>.requests    number of calls so far
+	<method>.latency     duration of each call, in seconds
+	<method>.code.<code> number of calls that ended with a status code
+	                     so far, such as "code.OK" or "code.NotFound"
+
+Server methods start with "grpc.server.", client methods with
+"grpc.client.". The latency of a stream is the time until the stream
+ends.
+*/
+package grpcmetrics
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/christophberger/grada"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Prefixes of the target names of server and client methods.
+const (
+	ServerPrefix = "grpc.server."
+	ClientPrefix = "grpc.client."
+)
+
+// record adds a call of the method to the metrics whose target names
+// start with prefix.
+func record(d *grada.Dashboard, prefix, fullMethod string, err error, latency time.Duration) {
+	name := prefix + strings.TrimPrefix(fullMethod, "/") + "."
+	d.Add(name+"latency", latency.Seconds())
+	d.Increment(name + "requests")
+	d.Increment(name + "code." + status.Code(err).String())
+}
+
+// UnaryServerInterceptor returns an interceptor that records the unary
+// calls of a server.
+func UnaryServerInterceptor(d *grada.Dashboard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		record(d, ServerPrefix, info.FullMethod, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that records the
+// streaming calls of a server.
+func StreamServerInterceptor(d *grada.Dashboard) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		record(d, ServerPrefix, info.FullMethod, err, time.Since(start))
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns an interceptor that records the unary
+// calls of a client.
+func UnaryClientInterceptor(d *grada.Dashboard) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		record(d, ClientPrefix, method, err, time.Since(start))
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that records the
+// streaming calls of a client. A call ends when receiving from the
+// stream fails, either with io.EOF after the last message, or with the
+// error of the call.
+func StreamClientInterceptor(d *grada.Dashboard) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			record(d, ClientPrefix, method, err, time.Since(start))
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, done: func(err error) {
+			record(d, ClientPrefix, method, err, time.Since(start))
+		}}, nil
+	}
+}
+
+// clientStream calls done once, when the stream ends.
+type clientStream struct {
+	grpc.ClientStream
+	once sync.Once
+	done func(error)
+}
+
+// RecvMsg receives a message and ends the call when receiving fails.
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		callErr := err
+		if err == io.EOF {
+			callErr = nil
+		}
+		s.once.Do(func() { s.done(callErr) })
+	}
+	return err
+}
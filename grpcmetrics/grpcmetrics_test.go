@@ -0,0 +1,106 @@
+package grpcmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/christophberger/grada"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream is a client stream that delivers n messages.
+type fakeStream struct {
+	grpc.ClientStream
+	n   int
+	err error // returned after the messages instead of io.EOF
+}
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	if s.n == 0 {
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+	s.n--
+	return nil
+}
+
+// points returns the number of data points of the metric for target.
+func points(t *testing.T, d *grada.Dashboard, target string) int {
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/value?reduce=count&target="+url.QueryEscape(target), nil))
+	var resp []struct{ Value float64 }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp) != 1 {
+		t.Fatalf("/value response %s", w.Body.String())
+	}
+	return int(resp[0].Value)
+}
+
+func TestInterceptors(t *testing.T) {
+	d := grada.NewDashboard()
+	ctx := context.Background()
+
+	unary := UnaryServerInterceptor(d)
+	info := &grpc.UnaryServerInfo{FullMethod: "/shop.Cart/Add"}
+	unary(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	unary(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such item")
+	})
+
+	stream := StreamServerInterceptor(d)
+	stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/shop.Cart/Watch"}, func(srv interface{}, ss grpc.ServerStream) error {
+		return errors.New("plain error")
+	})
+
+	client := UnaryClientInterceptor(d)
+	client(ctx, "/shop.Cart/Add", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	})
+
+	clientStream := StreamClientInterceptor(d)
+	for _, fs := range []*fakeStream{{n: 2}, {n: 1, err: status.Error(codes.Unavailable, "gone")}} {
+		cs, err := clientStream(ctx, nil, nil, "/shop.Cart/Watch", func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return fs, nil
+		})
+		if err != nil {
+			t.Fatalf("stream client interceptor: %v", err)
+		}
+		for cs.RecvMsg(nil) == nil {
+		}
+		cs.RecvMsg(nil) // ends the call only once
+	}
+	clientStream(ctx, nil, nil, "/shop.Cart/Fail", func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, status.Error(codes.PermissionDenied, "no")
+	})
+
+	tests := []struct {
+		target string
+		want   int // number of data points
+	}{
+		{"grpc.server.shop.Cart/Add.requests", 2},
+		{"grpc.server.shop.Cart/Add.latency", 2},
+		{"grpc.server.shop.Cart/Add.code.OK", 1},
+		{"grpc.server.shop.Cart/Add.code.NotFound", 1},
+		{"grpc.server.shop.Cart/Watch.code.Unknown", 1},
+		{"grpc.client.shop.Cart/Add.code.OK", 1},
+		{"grpc.client.shop.Cart/Watch.requests", 2},
+		{"grpc.client.shop.Cart/Watch.code.OK", 1},
+		{"grpc.client.shop.Cart/Watch.code.Unavailable", 1},
+		{"grpc.client.shop.Cart/Fail.code.PermissionDenied", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if got := points(t, d, tt.target); got != tt.want {
+				t.Errorf("metric has %d data points, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package grpcpush
+
+// Hand-written protobuf encoding of the messages defined in push.proto.
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// message is implemented by all messages of the Push service.
+type message interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+// Sample is a single data point for a target.
+// TimeMs is a Unix timestamp in milliseconds. If TimeMs is 0, the sample
+// gets the time of its arrival.
+type Sample struct {
+	Target string
+	Value  float64
+	TimeMs int64
+}
+
+// Batch is a list of samples, possibly for different targets.
+type Batch struct {
+	Samples []*Sample
+}
+
+// PushReply reports the number of samples that were added.
+type PushReply struct {
+	Accepted uint64
+}
+
+// CreateMetricRequest describes a new metric. If Size is 0, the buffer size
+// is calculated from TimeRangeMs and IntervalMs.
+type CreateMetricRequest struct {
+	Target      string
+	Size        int64
+	TimeRangeMs int64
+	IntervalMs  int64
+}
+
+// CreateMetricReply is the (empty) reply to CreateMetric.
+type CreateMetricReply struct{}
+
+// consumeFields walks through the fields of an encoded message and calls
+// field for each of them. field returns the number of bytes it consumed.
+func consumeFields(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n = field(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func (s *Sample) marshal() []byte {
+	b := appendString(nil, 1, s.Target)
+	if s.Value != 0 {
+		b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(s.Value))
+	}
+	return appendVarint(b, 3, uint64(s.TimeMs))
+}
+
+func (s *Sample) unmarshal(b []byte) error {
+	*s = Sample{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			s.Target = v
+			return n
+		case num == 2 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			s.Value = math.Float64frombits(v)
+			return n
+		case num == 3 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			s.TimeMs = int64(v)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+func (m *Batch) marshal() []byte {
+	var b []byte
+	for _, s := range m.Samples {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.marshal())
+	}
+	return b
+}
+
+func (m *Batch) unmarshal(b []byte) error {
+	*m = Batch{}
+	var err error
+	perr := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			s := &Sample{}
+			if e := s.unmarshal(v); e != nil && err == nil {
+				err = e
+			}
+			m.Samples = append(m.Samples, s)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if perr != nil {
+		return perr
+	}
+	return err
+}
+
+func (m *PushReply) marshal() []byte {
+	return appendVarint(nil, 1, m.Accepted)
+}
+
+func (m *PushReply) unmarshal(b []byte) error {
+	*m = PushReply{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			m.Accepted = v
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+func (m *CreateMetricRequest) marshal() []byte {
+	b := appendString(nil, 1, m.Target)
+	b = appendVarint(b, 2, uint64(m.Size))
+	b = appendVarint(b, 3, uint64(m.TimeRangeMs))
+	return appendVarint(b, 4, uint64(m.IntervalMs))
+}
+
+func (m *CreateMetricRequest) unmarshal(b []byte) error {
+	*m = CreateMetricRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			m.Target = v
+			return n
+		}
+		if typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 2:
+				m.Size = int64(v)
+			case 3:
+				m.TimeRangeMs = int64(v)
+			case 4:
+				m.IntervalMs = int64(v)
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+func (m *CreateMetricReply) marshal() []byte { return nil }
+
+func (m *CreateMetricReply) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// codec encodes and decodes the messages of the Push service.
+// Its wire format is plain protobuf, so clients generated from push.proto
+// can talk to the server.
+type codec struct{}
+
+func (codec) Name() string { return "proto" }
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("grpcpush: cannot marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("grpcpush: cannot unmarshal into %T", v)
+	}
+	return m.unmarshal(data)
+}
@@ -0,0 +1,43 @@
+package grpcpush
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCodec_roundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   message
+		out  message
+	}{
+		{"sample", &Sample{Target: "target1", Value: 2.5, TimeMs: 1508929014000}, &Sample{}},
+		{"sampleNow", &Sample{Target: "target1", Value: -1}, &Sample{}},
+		{"batch", &Batch{Samples: []*Sample{{Target: "a", Value: 1}, {Target: "b", Value: 2, TimeMs: 3}}}, &Batch{}},
+		{"reply", &PushReply{Accepted: 300}, &PushReply{}},
+		{"create", &CreateMetricRequest{Target: "target1", TimeRangeMs: 300000, IntervalMs: 1000}, &CreateMetricRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := codec{}
+			b, err := c.Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if err := c.Unmarshal(b, tt.out); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !cmp.Equal(tt.in, tt.out) {
+				t.Errorf("round trip:\ngot  %v\nwant %v", tt.out, tt.in)
+			}
+		})
+	}
+}
+
+func TestCodec_Unmarshal_truncated(t *testing.T) {
+	b := (&Sample{Target: "target1", Value: 2.5}).marshal()
+	if err := (codec{}).Unmarshal(b[:len(b)-2], &Sample{}); err == nil {
+		t.Errorf("Unmarshal() of truncated message: want error")
+	}
+}
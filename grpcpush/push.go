@@ -0,0 +1,302 @@
+/*
+Package grpcpush serves a gRPC ingestion API for a grada dashboard.
+
+High-throughput producers can use this API to feed samples into grada with
+less overhead than JSON over HTTP. The service is defined in push.proto:
+
+	* PushSample adds a single sample to a metric.
+	* PushBatch adds a stream of sample batches.
+	* CreateMetric creates a new metric.
+
+Start the gRPC server alongside the HTTP server of the dashboard:
+
+	d := grada.GetDashboard()
+	grpcpush.Start(d)
+
+Go producers can use Client; producers in other languages can generate
+their stubs from push.proto.
+*/
+package grpcpush
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/christophberger/grada"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const serviceName = "grada.push.Push"
+
+// pushServer is the interface that the service implementation must satisfy.
+// grpc.Server.RegisterService uses it for a type check.
+type pushServer interface {
+	PushSample(context.Context, *Sample) (*PushReply, error)
+	CreateMetric(context.Context, *CreateMetricRequest) (*CreateMetricReply, error)
+	pushBatch(grpc.ServerStream) error
+}
+
+// service implements the Push service on top of a Dashboard.
+type service struct {
+	d *grada.Dashboard
+}
+
+// add adds a single sample to its metric.
+func (s *service) add(sample *Sample) error {
+	metric, err := s.d.GetMetric(sample.Target)
+	if err != nil {
+		return status.Error(codeFor(err), err.Error())
+	}
+	if sample.TimeMs == 0 {
+		metric.Add(sample.Value)
+		return nil
+	}
+	metric.AddWithTime(sample.Value, time.Unix(0, sample.TimeMs*int64(time.Millisecond)))
+	return nil
+}
+
+// PushSample adds a single sample to an existing metric.
+func (s *service) PushSample(ctx context.Context, in *Sample) (*PushReply, error) {
+	if err := s.add(in); err != nil {
+		return nil, err
+	}
+	return &PushReply{Accepted: 1}, nil
+}
+
+// pushBatch receives batches until the client closes the stream.
+// Samples for unknown targets abort the stream.
+func (s *service) pushBatch(stream grpc.ServerStream) error {
+	reply := &PushReply{}
+	for {
+		batch := &Batch{}
+		err := stream.RecvMsg(batch)
+		if err == io.EOF {
+			return stream.SendMsg(reply)
+		}
+		if err != nil {
+			return err
+		}
+		for _, sample := range batch.Samples {
+			if err := s.add(sample); err != nil {
+				return err
+			}
+			reply.Accepted++
+		}
+	}
+}
+
+// MaxBufSize is the largest buffer size that CreateMetric accepts, either
+// as an explicit size or derived from time range and interval.
+const MaxBufSize = 1 << 22
+
+// CreateMetric creates a new metric with either an explicit buffer size
+// or a buffer size derived from time range and interval. Sizes above
+// MaxBufSize fail with codes.InvalidArgument.
+func (s *service) CreateMetric(ctx context.Context, in *CreateMetricRequest) (*CreateMetricReply, error) {
+	if in.Target == "" {
+		return nil, status.Error(codes.InvalidArgument, "target is required")
+	}
+	var err error
+	switch {
+	case in.Size > MaxBufSize,
+		in.Size <= 0 && in.TimeRangeMs > 0 && in.IntervalMs > 0 && in.TimeRangeMs/in.IntervalMs > MaxBufSize:
+		return nil, status.Errorf(codes.InvalidArgument, "buffer size exceeds %d", MaxBufSize)
+	case in.Size > 0:
+		_, err = s.d.CreateMetricWithBufSize(in.Target, int(in.Size))
+	case in.TimeRangeMs > 0 && in.IntervalMs > 0:
+		_, err = s.d.CreateMetric(in.Target,
+			time.Duration(in.TimeRangeMs)*time.Millisecond,
+			time.Duration(in.IntervalMs)*time.Millisecond)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "either size or time range and interval are required")
+	}
+	if err != nil {
+		return nil, status.Error(codeFor(err), err.Error())
+	}
+	return &CreateMetricReply{}, nil
+}
+
+// codeFor returns the gRPC status code for an error returned by the dashboard.
+func codeFor(err error) codes.Code {
+	switch {
+	case errors.Is(err, grada.ErrMetricNotFound):
+		return codes.NotFound
+	case errors.Is(err, grada.ErrMetricExists):
+		return codes.AlreadyExists
+	case errors.Is(err, grada.ErrBufferSize):
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
+
+func pushSampleHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := &Sample{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(pushServer).PushSample(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/PushSample"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(pushServer).PushSample(ctx, req.(*Sample))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func createMetricHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := &CreateMetricRequest{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(pushServer).CreateMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/CreateMetric"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(pushServer).CreateMetric(ctx, req.(*CreateMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func pushBatchHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(pushServer).pushBatch(stream)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*pushServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "PushSample", Handler: pushSampleHandler},
+		{MethodName: "CreateMetric", Handler: createMetricHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "PushBatch", Handler: pushBatchHandler, ClientStreams: true},
+	},
+	Metadata: "push.proto",
+}
+
+// recoverUnary turns a panic of a unary handler into an Internal error,
+// as gRPC does not recover handler panics and one would end the process.
+func recoverUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = status.Errorf(codes.Internal, "panic: %v", p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream is recoverUnary for streaming handlers.
+func recoverStream(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = status.Errorf(codes.Internal, "panic: %v", p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// NewServer creates a gRPC server that serves the Push service for d.
+// Panics of the handlers fail the call with codes.Internal.
+//
+// The server uses the hand-written codec of this package, hence it
+// cannot serve other (generated) gRPC services at the same time.
+func NewServer(d *grada.Dashboard, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ForceServerCodec(codec{}),
+		grpc.ChainUnaryInterceptor(recoverUnary),
+		grpc.ChainStreamInterceptor(recoverStream),
+	}, opts...)
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&serviceDesc, &service{d: d})
+	return s
+}
+
+// Start creates a gRPC server for d and starts serving in the background.
+// Default port is 3002. Overwrite this port by setting the environment
+// variable GRADA_GRPC_PORT to the desired port number.
+func Start(d *grada.Dashboard, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	port := "3002"
+	portenv := os.Getenv("GRADA_GRPC_PORT")
+	if portenv != "" {
+		port = portenv
+	}
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	s := NewServer(d, opts...)
+	go s.Serve(lis)
+	return s, nil
+}
+
+// Client is a Go client for the Push service.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient creates a Push client on top of an existing connection.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// PushSample sends a single sample.
+func (c *Client) PushSample(ctx context.Context, in *Sample, opts ...grpc.CallOption) (*PushReply, error) {
+	out := &PushReply{}
+	opts = append(opts, grpc.ForceCodec(codec{}))
+	err := c.cc.Invoke(ctx, "/"+serviceName+"/PushSample", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateMetric creates a new metric on the server.
+func (c *Client) CreateMetric(ctx context.Context, in *CreateMetricRequest, opts ...grpc.CallOption) (*CreateMetricReply, error) {
+	out := &CreateMetricReply{}
+	opts = append(opts, grpc.ForceCodec(codec{}))
+	err := c.cc.Invoke(ctx, "/"+serviceName+"/CreateMetric", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BatchStream is an open PushBatch stream.
+type BatchStream struct {
+	stream grpc.ClientStream
+}
+
+// PushBatch opens a stream for sending batches of samples.
+func (c *Client) PushBatch(ctx context.Context, opts ...grpc.CallOption) (*BatchStream, error) {
+	opts = append(opts, grpc.ForceCodec(codec{}))
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/PushBatch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &BatchStream{stream: stream}, nil
+}
+
+// Send sends a batch of samples.
+func (b *BatchStream) Send(batch *Batch) error {
+	return b.stream.SendMsg(batch)
+}
+
+// CloseAndRecv closes the stream and returns the server's reply.
+func (b *BatchStream) CloseAndRecv() (*PushReply, error) {
+	if err := b.stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	reply := &PushReply{}
+	if err := b.stream.RecvMsg(reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -0,0 +1,162 @@
+package grpcpush
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christophberger/grada"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves the Push service for d in memory, and returns a
+// client for it.
+func newTestClient(t *testing.T, d *grada.Dashboard) *Client {
+	lis := bufconn.Listen(1 << 20)
+	s := NewServer(d)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+// record returns the values added to the metric of target from now on.
+func record(t *testing.T, d *grada.Dashboard, target string) func() []float64 {
+	m, err := d.GetMetric(target)
+	if err != nil {
+		t.Fatalf("GetMetric(%s) error = %v", target, err)
+	}
+	var mu sync.Mutex
+	var values []float64
+	m.Subscribe(func(c grada.Count) {
+		mu.Lock()
+		defer mu.Unlock()
+		values = append(values, c.N)
+	})
+	return func() []float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]float64(nil), values...)
+	}
+}
+
+func TestService_CreateMetric(t *testing.T) {
+	d := grada.NewDashboard()
+	c := newTestClient(t, d)
+	tests := []struct {
+		name string
+		in   *CreateMetricRequest
+		want codes.Code
+	}{
+		{"size", &CreateMetricRequest{Target: "cpu", Size: 10}, codes.OK},
+		{"time range", &CreateMetricRequest{Target: "mem", TimeRangeMs: 60000, IntervalMs: 1000}, codes.OK},
+		{"exists", &CreateMetricRequest{Target: "cpu", Size: 10}, codes.AlreadyExists},
+		{"no target", &CreateMetricRequest{Size: 10}, codes.InvalidArgument},
+		{"no size", &CreateMetricRequest{Target: "disk"}, codes.InvalidArgument},
+		{"too large", &CreateMetricRequest{Target: "disk", Size: 1 << 62}, codes.InvalidArgument},
+		{"time range too large", &CreateMetricRequest{Target: "disk", TimeRangeMs: 1 << 62, IntervalMs: 1}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.CreateMetric(context.Background(), tt.in)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("CreateMetric() code = %v, want %v (error %v)", got, tt.want, err)
+			}
+		})
+	}
+	if _, err := d.GetMetric("mem"); err != nil {
+		t.Errorf("metric created from time range and interval: %v", err)
+	}
+}
+
+func TestService_PushSample(t *testing.T) {
+	d := grada.NewDashboard()
+	d.CreateMetricWithBufSize("cpu", 10)
+	values := record(t, d, "cpu")
+	c := newTestClient(t, d)
+	ms := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+
+	tests := []struct {
+		name string
+		in   *Sample
+		want codes.Code
+	}{
+		{"now", &Sample{Target: "cpu", Value: 1}, codes.OK},
+		{"with time", &Sample{Target: "cpu", Value: 2, TimeMs: ms}, codes.OK},
+		{"unknown target", &Sample{Target: "nope", Value: 3}, codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := c.PushSample(context.Background(), tt.in)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("PushSample() code = %v, want %v (error %v)", got, tt.want, err)
+			}
+			if err == nil && reply.Accepted != 1 {
+				t.Errorf("PushSample() accepted %d, want 1", reply.Accepted)
+			}
+		})
+	}
+	if diff := cmp.Diff([]float64{1, 2}, values()); diff != "" {
+		t.Errorf("added values mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestService_PushBatch(t *testing.T) {
+	d := grada.NewDashboard()
+	d.CreateMetricWithBufSize("cpu", 10)
+	d.CreateMetricWithBufSize("mem", 10)
+	cpu, mem := record(t, d, "cpu"), record(t, d, "mem")
+	c := newTestClient(t, d)
+
+	stream, err := c.PushBatch(context.Background())
+	if err != nil {
+		t.Fatalf("PushBatch() error = %v", err)
+	}
+	stream.Send(&Batch{Samples: []*Sample{{Target: "cpu", Value: 1}, {Target: "mem", Value: 10}}})
+	stream.Send(&Batch{Samples: []*Sample{{Target: "cpu", Value: 2}}})
+	reply, err := stream.CloseAndRecv()
+	if err != nil || reply.Accepted != 3 {
+		t.Fatalf("CloseAndRecv() = %v, %v, want 3 accepted", reply, err)
+	}
+	if diff := cmp.Diff([]float64{1, 2}, cpu()); diff != "" {
+		t.Errorf("cpu values mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]float64{10}, mem()); diff != "" {
+		t.Errorf("mem values mismatch (-want +got):\n%s", diff)
+	}
+
+	// A sample of an unknown target aborts the stream.
+	stream, err = c.PushBatch(context.Background())
+	if err != nil {
+		t.Fatalf("PushBatch() error = %v", err)
+	}
+	stream.Send(&Batch{Samples: []*Sample{{Target: "cpu", Value: 3}, {Target: "nope", Value: 4}, {Target: "cpu", Value: 5}}})
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.NotFound {
+		t.Errorf("CloseAndRecv() with an unknown target: error = %v, want code NotFound", err)
+	}
+	if diff := cmp.Diff([]float64{1, 2, 3}, cpu()); diff != "" {
+		t.Errorf("cpu values after abort mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRecoverUnary(t *testing.T) {
+	_, err := recoverUnary(context.Background(), nil, nil, func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if got := status.Code(err); got != codes.Internal {
+		t.Errorf("recoverUnary() code = %v, want %v (error %v)", got, codes.Internal, err)
+	}
+}
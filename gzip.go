@@ -0,0 +1,182 @@
+package grada
+
+// Transparent gzip compression of responses.
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// minGzipSize is the size below which responses are sent uncompressed.
+// Compressing small responses costs more CPU time than it saves on the wire.
+const minGzipSize = 1024
+
+// WithoutCompression disables gzip compression of responses.
+//
+// By default, the server compresses text, JSON, CSV, protobuf, and msgpack
+// responses of at least 1 KiB for clients that send
+// "Accept-Encoding: gzip", which includes Grafana and Go's http.Client.
+// Disable compression if a reverse proxy in front of the server
+// compresses responses already.
+func WithoutCompression() Option {
+	return func(srv *server) {
+		srv.noCompression = true
+	}
+}
+
+// gzipWriters holds gzip writers for reuse.
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// acceptsGzip reports whether the client accepts gzip-encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+				continue
+			}
+			_, q, _ := strings.Cut(strings.ReplaceAll(params, " ", ""), "q=")
+			return q == "" || strings.Trim(q, "0.") != ""
+		}
+	}
+	return false
+}
+
+// compressible reports whether responses of the given content type
+// benefit from compression.
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"), strings.HasSuffix(mt, "json"):
+		return true
+	}
+	switch mt {
+	case "application/x-protobuf", "application/protobuf", "application/msgpack":
+		return true
+	}
+	return false
+}
+
+// compress gzips the responses of h for clients that accept gzip.
+func (srv *server) compress(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		h.ServeHTTP(gw, r)
+	})
+}
+
+// gzipWriter compresses a response if it is large enough and of
+// a compressible type. It holds back the status and the first bytes of the
+// body until it has decided whether to compress.
+type gzipWriter struct {
+	http.ResponseWriter
+	status  int          // status held back until decided
+	buf     []byte       // body held back until decided
+	decided bool         // whether the status has been written
+	gz      *gzip.Writer // compresses the body if set
+}
+
+func (gw *gzipWriter) WriteHeader(status int) {
+	if gw.decided {
+		gw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if gw.status == 0 {
+		gw.status = status
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.decided {
+		gw.buf = append(gw.buf, b...)
+		if len(gw.buf) < minGzipSize {
+			return len(b), nil
+		}
+		return len(b), gw.decide(true)
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// decide writes the status and decides whether to compress the body.
+// The body is compressed only if large is set. It then writes the held
+// back bytes.
+func (gw *gzipWriter) decide(large bool) error {
+	gw.decided = true
+	h := gw.Header()
+	if h.Get("Content-Type") == "" && len(gw.buf) > 0 {
+		// Sniff now, as net/http would sniff the compressed body.
+		h.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+	if large && (gw.status == 0 || gw.status == http.StatusOK) &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			// The compressed body is not byte-for-byte the same.
+			h.Set("ETag", "W/"+etag)
+		}
+		gw.gz = gzipWriters.Get().(*gzip.Writer)
+		gw.gz.Reset(gw.ResponseWriter)
+	}
+	if gw.status != 0 {
+		gw.ResponseWriter.WriteHeader(gw.status)
+	}
+	if len(gw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(gw.buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(gw.buf)
+	}
+	gw.buf = nil
+	return err
+}
+
+// Flush implements http.Flusher. A response that is flushed is compressed
+// regardless of its size, as more data is likely to follow.
+func (gw *gzipWriter) Flush() {
+	if !gw.decided {
+		gw.decide(true)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// close writes any held back data and completes the compressed stream.
+func (gw *gzipWriter) close() {
+	if !gw.decided {
+		gw.decide(false)
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+		gw.gz.Reset(nil)
+		gzipWriters.Put(gw.gz)
+		gw.gz = nil
+	}
+}
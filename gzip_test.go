@@ -0,0 +1,116 @@
+package grada
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"none", "", false},
+		{"gzip", "gzip", true},
+		{"list", "deflate, gzip;q=0.5, br", true},
+		{"q0", "gzip;q=0", false},
+		{"q0.0", "gzip; q=0.0", false},
+		{"other", "br", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Accept-Encoding", tt.header)
+			}
+			if got := acceptsGzip(r); got != tt.want {
+				t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_compress(t *testing.T) {
+	large := strings.Repeat(`{"target":"cpu"},`, 100)
+	srv := &server{}
+
+	tests := []struct {
+		name        string
+		encoding    string
+		contentType string
+		status      int
+		body        string
+		wantGzip    bool
+	}{
+		{"large", "gzip", "", 200, large, true},
+		{"small", "gzip", "", 200, "[]", false},
+		{"notAccepted", "", "", 200, large, false},
+		{"binary", "gzip", "application/octet-stream", 200, large, false},
+		{"error", "gzip", "application/json", 500, large, false},
+		{"csv", "gzip", "text/csv; charset=utf-8", 200, large, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := srv.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.Header().Set("ETag", `"abc"`)
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body[:len(tt.body)/2])
+				io.WriteString(w, tt.body[len(tt.body)/2:])
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.encoding != "" {
+				r.Header.Set("Accept-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.wantGzip)
+			}
+			body := w.Body.String()
+			if gzipped {
+				if etag := w.Header().Get("ETag"); etag != `W/"abc"` {
+					t.Errorf("ETag %s, want a weak ETag", etag)
+				}
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader(): %v", err)
+				}
+				b, _ := io.ReadAll(zr)
+				body = string(b)
+			}
+			if body != tt.body {
+				t.Errorf("body %q, want %q", body, tt.body)
+			}
+			if tt.encoding != "" && w.Header().Get("Content-Type") == "" {
+				t.Errorf("no Content-Type")
+			}
+		})
+	}
+}
+
+func TestWithoutCompression(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithoutCompression()}} {
+		d := NewDashboard(opts...)
+		d.CreateStaticTable("t", &Table{Columns: []Column{{strings.Repeat("x", 2000), ColumnString}}})
+		r := httptest.NewRequest("POST", "/query", strings.NewReader(`{"targets": [{"target": "t", "type": "table"}]}`))
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, r)
+		if gzipped, want := w.Header().Get("Content-Encoding") == "gzip", opts == nil; gzipped != want {
+			t.Errorf("options %v: gzipped = %v, want %v", opts, gzipped, want)
+		}
+	}
+}
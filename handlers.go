@@ -0,0 +1,29 @@
+package grada
+
+// Handlers for mounting grada endpoints in other routers.
+
+import "net/http"
+
+// QueryHandler returns the handler for Grafana's /query requests.
+//
+// Use QueryHandler, SearchHandler, and AnnotationsHandler to mount the
+// Grafana endpoints in a router of your choice, under paths that end in
+// "/query", "/search", and "/annotations", next to a route for the data
+// source root that responds with 200 OK. Unlike Handler, these handlers do
+// not apply the authentication, filtering, and logging options of the
+// dashboard; use your router's middleware instead. Drain does apply.
+func (d *Dashboard) QueryHandler() http.Handler {
+	return d.srv.trackInFlight(allowMethods(d.srv.queryEndpoint(), "POST"))
+}
+
+// SearchHandler returns the handler for Grafana's /search requests.
+// See QueryHandler.
+func (d *Dashboard) SearchHandler() http.Handler {
+	return d.srv.trackInFlight(allowMethods(d.srv.searchHandler, "GET", "POST"))
+}
+
+// AnnotationsHandler returns the handler for Grafana's /annotations requests.
+// See QueryHandler.
+func (d *Dashboard) AnnotationsHandler() http.Handler {
+	return d.srv.trackInFlight(allowMethods(d.srv.annotationsHandler, "POST"))
+}
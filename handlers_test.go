@@ -0,0 +1,37 @@
+package grada
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard_handlers(t *testing.T) {
+	d := NewDashboard()
+	d.CreateMetricWithBufSize("target1", 1)
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		method   string
+		body     string
+		wantBody string
+	}{
+		{"search", d.SearchHandler(), "POST", `{"target": ""}`, `["target1"]`},
+		{"annotations", d.AnnotationsHandler(), "POST", `{"annotation": {"name": "deploys"}}`, `[]`},
+		{"query", d.QueryHandler(), "POST", `{"targets": [{"target": "target1", "type": "timeserie"}], "maxDataPoints": 1}`, `[{"target":"target1","datapoints":[]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle("/grafana/"+tt.name, tt.handler)
+			r := httptest.NewRequest(tt.method, "/grafana/"+tt.name, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != 200 || w.Body.String() != tt.wantBody {
+				t.Errorf("%s: status %d, body %s; want 200, %s", tt.name, w.Code, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+/*
+Package hostmetrics provides grada collectors for the health of the host:
+CPU usage, load average, memory, disk usage and I/O, and network throughput.
+
+The collectors read the system statistics through gopsutil
+(github.com/shirou/gopsutil), which the grada package itself does not
+depend on. They are therefore only built with the build tag "gopsutil":
+
+	go build -tags gopsutil
+
+Register the collectors with a dashboard:
+
+	for _, c := range hostmetrics.All(10 * time.Second) {
+		d.AddCollector(c, grada.Jitter(time.Second))
+	}
+
+All target names start with "host.", for example "host.cpu.percent" or
+"host.net.eth0.recv_bytes". Throughputs are in units per second, computed
+from the difference between two collections; they start with the second
+collection.
+*/
+package hostmetrics
@@ -0,0 +1,175 @@
+//go:build gopsutil
+
+package hostmetrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/christophberger/grada"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/shirou/gopsutil/v4/net"
+)
+
+// collector is a grada.Collector made of a function.
+type collector struct {
+	name     string
+	interval time.Duration
+	collect  func(ctx context.Context) []grada.Sample
+}
+
+func (c *collector) Name() string                               { return c.name }
+func (c *collector) Interval() time.Duration                    { return c.interval }
+func (c *collector) Collect(ctx context.Context) []grada.Sample { return c.collect(ctx) }
+
+// All returns all collectors of the package, with the given interval.
+// Disk usage is collected for the root file system.
+func All(interval time.Duration) []grada.Collector {
+	return []grada.Collector{
+		CPU(interval),
+		Load(interval),
+		Memory(interval),
+		DiskUsage(interval, "/"),
+		DiskIO(interval),
+		Network(interval),
+	}
+}
+
+// CPU returns a collector of the CPU usage in percent since the previous
+// collection, averaged over all CPUs: "host.cpu.percent".
+func CPU(interval time.Duration) grada.Collector {
+	return &collector{"host.cpu", interval, func(ctx context.Context) []grada.Sample {
+		// An interval of 0 compares with the previous call.
+		p, err := cpu.PercentWithContext(ctx, 0, false)
+		if err != nil || len(p) == 0 {
+			return nil
+		}
+		return []grada.Sample{{Target: Prefix + "cpu.percent", N: p[0]}}
+	}}
+}
+
+// Load returns a collector of the load averages: "host.load.1",
+// "host.load.5", and "host.load.15".
+func Load(interval time.Duration) grada.Collector {
+	return &collector{"host.load", interval, func(ctx context.Context) []grada.Sample {
+		avg, err := load.AvgWithContext(ctx)
+		if err != nil {
+			return nil
+		}
+		return []grada.Sample{
+			{Target: Prefix + "load.1", N: avg.Load1},
+			{Target: Prefix + "load.5", N: avg.Load5},
+			{Target: Prefix + "load.15", N: avg.Load15},
+		}
+	}}
+}
+
+// Memory returns a collector of the virtual memory in bytes and the used
+// memory in percent: "host.mem.total", "host.mem.used",
+// "host.mem.available", and "host.mem.percent".
+func Memory(interval time.Duration) grada.Collector {
+	return &collector{"host.mem", interval, func(ctx context.Context) []grada.Sample {
+		vm, err := mem.VirtualMemoryWithContext(ctx)
+		if err != nil {
+			return nil
+		}
+		return []grada.Sample{
+			{Target: Prefix + "mem.total", N: float64(vm.Total)},
+			{Target: Prefix + "mem.used", N: float64(vm.Used)},
+			{Target: Prefix + "mem.available", N: float64(vm.Available)},
+			{Target: Prefix + "mem.percent", N: vm.UsedPercent},
+		}
+	}}
+}
+
+// DiskUsage returns a collector of the usage of the file systems at the
+// given paths, in bytes and percent: "host.disk.<path>.used",
+// "host.disk.<path>.free", and "host.disk.<path>.percent". The path of the
+// root file system is "root"; other paths lose their leading slash and
+// have their slashes replaced by underscores.
+func DiskUsage(interval time.Duration, paths ...string) grada.Collector {
+	return &collector{"host.disk", interval, func(ctx context.Context) []grada.Sample {
+		var result []grada.Sample
+		for _, p := range paths {
+			u, err := disk.UsageWithContext(ctx, p)
+			if err != nil {
+				continue
+			}
+			name := Prefix + "disk." + pathName(p) + "."
+			result = append(result,
+				grada.Sample{Target: name + "used", N: float64(u.Used)},
+				grada.Sample{Target: name + "free", N: float64(u.Free)},
+				grada.Sample{Target: name + "percent", N: u.UsedPercent},
+			)
+		}
+		return result
+	}}
+}
+
+// pathName turns a file system path into a part of a target name.
+func pathName(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return "root"
+	}
+	return strings.ReplaceAll(p, "/", "_")
+}
+
+// DiskIO returns a collector of the I/O throughput of all disks, in bytes
+// and operations per second: "host.diskio.<device>.read_bytes",
+// "host.diskio.<device>.write_bytes", "host.diskio.<device>.reads", and
+// "host.diskio.<device>.writes".
+func DiskIO(interval time.Duration) grada.Collector {
+	var r rates
+	return &collector{"host.diskio", interval, func(ctx context.Context) []grada.Sample {
+		io, err := disk.IOCountersWithContext(ctx)
+		if err != nil {
+			return nil
+		}
+		counters := map[string]uint64{}
+		for dev, c := range io {
+			name := Prefix + "diskio." + dev + "."
+			counters[name+"read_bytes"] = c.ReadBytes
+			counters[name+"write_bytes"] = c.WriteBytes
+			counters[name+"reads"] = c.ReadCount
+			counters[name+"writes"] = c.WriteCount
+		}
+		return samples(r.update(time.Now(), counters))
+	}}
+}
+
+// Network returns a collector of the throughput of all network interfaces,
+// in bytes and packets per second: "host.net.<interface>.recv_bytes",
+// "host.net.<interface>.sent_bytes", "host.net.<interface>.recv_packets",
+// and "host.net.<interface>.sent_packets".
+func Network(interval time.Duration) grada.Collector {
+	var r rates
+	return &collector{"host.net", interval, func(ctx context.Context) []grada.Sample {
+		io, err := net.IOCountersWithContext(ctx, true)
+		if err != nil {
+			return nil
+		}
+		counters := map[string]uint64{}
+		for _, c := range io {
+			name := Prefix + "net." + c.Name + "."
+			counters[name+"recv_bytes"] = c.BytesRecv
+			counters[name+"sent_bytes"] = c.BytesSent
+			counters[name+"recv_packets"] = c.PacketsRecv
+			counters[name+"sent_packets"] = c.PacketsSent
+		}
+		return samples(r.update(time.Now(), counters))
+	}}
+}
+
+// samples turns rates by target name into samples.
+func samples(perSecond map[string]float64) []grada.Sample {
+	s := make([]grada.Sample, 0, len(perSecond))
+	for target, n := range perSecond {
+		s = append(s, grada.Sample{Target: target, N: n})
+	}
+	return s
+}
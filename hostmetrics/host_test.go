@@ -0,0 +1,39 @@
+//go:build gopsutil
+
+package hostmetrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+func TestPathName(t *testing.T) {
+	for p, want := range map[string]string{"/": "root", "": "root", "/var/lib/": "var_lib", "/data": "data"} {
+		if got := pathName(p); got != want {
+			t.Errorf("pathName(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range All(time.Second) {
+		if !strings.HasPrefix(c.Name(), Prefix) {
+			t.Errorf("collector name %q does not start with %q", c.Name(), Prefix)
+		}
+		for _, s := range c.Collect(ctx) {
+			if !strings.HasPrefix(s.Target, Prefix) {
+				t.Errorf("collector %s: target %q does not start with %q", c.Name(), s.Target, Prefix)
+			}
+		}
+	}
+	for _, c := range []grada.Collector{Memory(time.Second), Load(time.Second)} {
+		if len(c.Collect(ctx)) == 0 {
+			t.Errorf("collector %s delivers no samples", c.Name())
+		}
+	}
+}
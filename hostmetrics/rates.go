@@ -0,0 +1,35 @@
+package hostmetrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Prefix starts the target names of all collectors.
+const Prefix = "host."
+
+// rates turns monotonic counters, such as the bytes received by a network
+// interface, into rates per second.
+type rates struct {
+	mu   sync.Mutex
+	last map[string]uint64 // counter values of the previous collection
+	t    time.Time         // time of the previous collection
+}
+
+// update records the counters at time t and returns the rate of each
+// counter since the previous update. Counters that are new, or that have
+// been reset since, have no rate.
+func (r *rates) update(t time.Time, counters map[string]uint64) map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := map[string]float64{}
+	if secs := t.Sub(r.t).Seconds(); !r.t.IsZero() && secs > 0 {
+		for name, n := range counters {
+			if prev, ok := r.last[name]; ok && n >= prev {
+				result[name] = float64(n-prev) / secs
+			}
+		}
+	}
+	r.last, r.t = counters, t
+	return result
+}
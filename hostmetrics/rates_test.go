@@ -0,0 +1,31 @@
+package hostmetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRates_update(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	var r rates
+	tests := []struct {
+		name     string
+		t        time.Time
+		counters map[string]uint64
+		want     map[string]float64
+	}{
+		{"first", t0, map[string]uint64{"a": 100, "b": 50}, map[string]float64{}},
+		{"second", t0.Add(2 * time.Second), map[string]uint64{"a": 300, "b": 50, "c": 1}, map[string]float64{"a": 100, "b": 0}},
+		{"reset", t0.Add(3 * time.Second), map[string]uint64{"a": 10, "b": 60, "c": 4}, map[string]float64{"b": 10, "c": 3}},
+		{"sameTime", t0.Add(3 * time.Second), map[string]uint64{"a": 20}, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.update(tt.t, tt.counters); !cmp.Equal(got, tt.want) {
+				t.Errorf("update():\n%s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
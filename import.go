@@ -0,0 +1,249 @@
+package grada
+
+// Import of Prometheus data: OpenMetrics text exports, the Prometheus
+// text format, and the output of "promtool tsdb dump".
+//
+// OpenMetrics and Prometheus text lines have the metric name, optional
+// labels, the value, and an optional time stamp:
+//
+//	http_requests_total{code="200",method="get"} 1027 1508929014.123
+//
+// promtool tsdb dump lines have the metric name as the label __name__,
+// and time stamps in milliseconds:
+//
+//	{__name__="http_requests_total", code="200", method="get"} 1027 1508929014123
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportConfig configures Dashboard.ImportOpenMetrics.
+type ImportConfig struct {
+	// Series selects the series to import by metric name, as patterns of
+	// path.Match such as "http_*". Default is all series.
+	Series []string
+	// Labels selects the series that have all of these label values.
+	Labels map[string]string
+	// Target is the template of the target names, with the placeholders
+	// {{__name__}}, for the metric name, {{label}}, for the value of a
+	// label, and {{target}}, for the default name. Default is the metric
+	// name followed by the labels, sorted, as in
+	// `http_requests_total{code="200",method="get"}`, or the metric name
+	// alone for series without labels.
+	Target string
+	// TimeUnit is the unit of the time stamps. Default is seconds for
+	// OpenMetrics lines and milliseconds for promtool dump lines. Set it to
+	// time.Millisecond for the Prometheus text format.
+	TimeUnit time.Duration
+	// BufSize is the buffer size of the metrics that the import creates.
+	// Default is the number of data points of the series, but at least
+	// DefaultAutoCreateSize.
+	BufSize int
+}
+
+// ImportOpenMetrics reads the data points of Prometheus series from r, in
+// the OpenMetrics or Prometheus text format or as the output of
+// "promtool tsdb dump", and adds the selected series to metrics, to
+// backfill history when dashboards move from Prometheus to grada. Each
+// series becomes the target that cfg.Target names; its labels are set
+// as with Dashboard.SetLabels, for alias templates.
+//
+// Metrics that do not exist yet are created as by Dashboard.Add, with
+// the buffer size of cfg.BufSize. Data points are merged into existing
+// metrics, skipping data points whose time stamp a metric has already,
+// so that importing a file twice adds nothing. Samples without a time
+// stamp, comments, and exemplars are skipped.
+//
+// ImportOpenMetrics returns the number of data points that it has added.
+// It reads all of r before adding anything, and fails without adding
+// anything if a line cannot be parsed.
+func (d *Dashboard) ImportOpenMetrics(r io.Reader, cfg ImportConfig) (int, error) {
+	type series struct {
+		labels map[string]string
+		counts []Count
+	}
+	all := map[string]*series{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "# EOF" {
+			break
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, labels, c, ok, err := parseSample(line, cfg.TimeUnit)
+		if err != nil {
+			return 0, fmt.Errorf("import: line %d: %w", n, err)
+		}
+		if !ok || (len(cfg.Series) > 0 && !matchAny(cfg.Series, name)) || !hasLabels(labels, cfg.Labels) {
+			continue
+		}
+		target := seriesName(name, labels)
+		if cfg.Target != "" {
+			labels["__name__"] = name
+			target = expandAlias(cfg.Target, target, labels)
+			delete(labels, "__name__")
+		}
+		s, ok := all[target]
+		if !ok {
+			s = &series{labels: labels}
+			all[target] = s
+		}
+		s.counts = append(s.counts, c)
+	}
+	if err := sc.Err(); err != nil {
+		return 0, fmt.Errorf("import: %w", err)
+	}
+
+	targets := make([]string, 0, len(all))
+	for target := range all {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	added := 0
+	for _, target := range targets {
+		s := all[target]
+		m, err := d.srv.metrics.Get(target)
+		if err != nil {
+			size := cfg.BufSize
+			if size <= 0 {
+				size = max(len(s.counts), DefaultAutoCreateSize)
+			}
+			if m, err = d.srv.metrics.createAuto(target, size); err != nil {
+				m = d.srv.metrics.getOrCreate(target) // created concurrently
+			}
+		}
+		added += m.merge(s.counts)
+		if len(s.labels) > 0 {
+			d.SetLabels(target, s.labels)
+		}
+	}
+	return added, nil
+}
+
+// parseSample parses a sample line. It reports ok == false for a sample
+// without a time stamp.
+func parseSample(line string, unit time.Duration) (name string, labels map[string]string, c Count, ok bool, err error) {
+	dump := line[0] == '{'
+	i := strings.IndexAny(line, "{ \t")
+	if i < 0 {
+		return "", nil, Count{}, false, errors.New("no value")
+	}
+	name, rest := line[:i], line[i:]
+	labels = map[string]string{}
+	if rest[0] == '{' {
+		if rest, err = parseLabels(rest[1:], labels); err != nil {
+			return "", nil, Count{}, false, err
+		}
+	}
+	if dump {
+		name = labels["__name__"]
+		delete(labels, "__name__")
+		if unit <= 0 {
+			unit = time.Millisecond
+		}
+	}
+	if name == "" {
+		return "", nil, Count{}, false, errors.New("no metric name")
+	}
+	if unit <= 0 {
+		unit = time.Second
+	}
+	rest, _, _ = strings.Cut(rest, " # ") // exemplar
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", nil, Count{}, false, fmt.Errorf("%s: want a value and a time stamp", name)
+	}
+	if c.N, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return "", nil, Count{}, false, fmt.Errorf("%s: invalid value %s", name, fields[0])
+	}
+	if len(fields) == 1 {
+		return name, labels, c, false, nil
+	}
+	if ts, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+		c.T = time.Unix(0, ts*int64(unit))
+	} else if f, err := strconv.ParseFloat(fields[1], 64); err == nil {
+		c.T = time.Unix(0, int64(f*float64(unit)))
+	} else {
+		return "", nil, Count{}, false, fmt.Errorf("%s: invalid time stamp %s", name, fields[1])
+	}
+	return name, labels, c, true, nil
+}
+
+// parseLabels parses the labels after the opening brace of s into labels,
+// and returns the rest of s after the closing brace.
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return "", errors.New("unterminated labels")
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return "", errors.New("invalid label")
+		}
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return "", errors.New("unterminated label value")
+		}
+		value, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid label value %s", rest[:end+1])
+		}
+		labels[strings.TrimSpace(key)] = value
+		s = rest[end+1:]
+	}
+}
+
+// hasLabels reports whether labels has all label values of want.
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesName returns the metric name followed by the sorted labels.
+func seriesName(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
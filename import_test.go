@@ -0,0 +1,118 @@
+package grada
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard_ImportOpenMetrics(t *testing.T) {
+	const openMetrics = `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 10 1508929014
+http_requests_total{method="get",code="200"} 12 1508929015.5 # {trace_id="abc"} 1 1508929015
+http_requests_total{method="post",code="500"} 1 1508929014
+up 1 1508929014
+up 1
+# EOF
+up 0 1508929099
+`
+	const dump = `{__name__="up", instance="a:9090", job="prometheus"} 1 1508929014000
+{__name__="up", instance="b:9090", job="prometheus"} 0 1508929014000
+{__name__="up", instance="a:9090", job="prometheus"} 1 1508929015000
+`
+	t0 := time.Unix(1508929014, 0)
+	tests := []struct {
+		name    string
+		input   string
+		cfg     ImportConfig
+		want    map[string][]Count
+		added   int
+		wantErr bool
+	}{
+		{
+			name:  "OpenMetrics",
+			input: openMetrics,
+			want: map[string][]Count{
+				`http_requests_total{code="200",method="get"}`:  {{10, t0}, {12, t0.Add(1500 * time.Millisecond)}},
+				`http_requests_total{code="500",method="post"}`: {{1, t0}},
+				"up": {{1, t0}},
+			},
+			added: 4,
+		},
+		{
+			name:  "selected series",
+			input: openMetrics,
+			cfg:   ImportConfig{Series: []string{"http_*"}, Labels: map[string]string{"method": "get"}, Target: "{{__name__}}.{{code}}"},
+			want: map[string][]Count{
+				"http_requests_total.200": {{10, t0}, {12, t0.Add(1500 * time.Millisecond)}},
+			},
+			added: 2,
+		},
+		{
+			name:  "promtool dump",
+			input: dump,
+			cfg:   ImportConfig{Target: "{{__name__}}.{{instance}}"},
+			want: map[string][]Count{
+				"up.a:9090": {{1, t0}, {1, t0.Add(time.Second)}},
+				"up.b:9090": {{0, t0}},
+			},
+			added: 3,
+		},
+		{
+			name:  "Prometheus text format",
+			input: "up 1 1508929014000\n",
+			cfg:   ImportConfig{TimeUnit: time.Millisecond},
+			want:  map[string][]Count{"up": {{1, t0}}},
+			added: 1,
+		},
+		{
+			name:    "invalid value",
+			input:   "up 1 1508929014\nup x 1508929015\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated labels",
+			input:   `up{job="a" 1 1508929014`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard()
+			added, err := d.ImportOpenMetrics(strings.NewReader(tt.input), tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportOpenMetrics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if added != tt.added {
+				t.Errorf("ImportOpenMetrics() = %d, want %d", added, tt.added)
+			}
+			got := map[string][]Count{}
+			for target := range d.srv.metrics.metric {
+				got[target] = allCounts(t, d, target)
+			}
+			if len(tt.want) == 0 {
+				tt.want = map[string][]Count{}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("metrics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDashboard_ImportOpenMetrics_twice(t *testing.T) {
+	d := NewDashboard()
+	input := "up{job=\"a\"} 1 1508929014\n"
+	if _, err := d.ImportOpenMetrics(strings.NewReader(input), ImportConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if added, _ := d.ImportOpenMetrics(strings.NewReader(input), ImportConfig{}); added != 0 {
+		t.Errorf("second import added %d data points, want 0", added)
+	}
+	if got := d.srv.meta.get(`up{job="a"}`).labels; !cmp.Equal(got, map[string]string{"job": "a"}) {
+		t.Errorf("labels = %v, want job=a", got)
+	}
+}
@@ -0,0 +1,151 @@
+package grada
+
+// Column type inference for tables.
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ColumnBool is the column type of boolean values. Inferred columns of
+// Go bool values have this type.
+const ColumnBool = "boolean"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// columnType returns the column type for values of type t.
+func columnType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return ColumnTime
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return ColumnNumber
+	case reflect.String:
+		return ColumnString
+	case reflect.Bool:
+		return ColumnBool
+	}
+	return ColumnJSON
+}
+
+// inferColumns derives the columns of rows from the first non-nil value
+// in each column. Columns are named "Column 1", "Column 2", and so on;
+// columns without any non-nil value are string columns.
+func inferColumns(rows [][]interface{}) []Column {
+	var columns []Column
+	for _, r := range rows {
+		for j, v := range r {
+			if j == len(columns) {
+				columns = append(columns, Column{Text: fmt.Sprintf("Column %d", j+1)})
+			}
+			if columns[j].Type == "" && v != nil {
+				columns[j].Type = columnType(reflect.TypeOf(v))
+			}
+		}
+	}
+	for j := range columns {
+		if columns[j].Type == "" {
+			columns[j].Type = ColumnString
+		}
+	}
+	return columns
+}
+
+// structField is a struct field that becomes a table column.
+type structField struct {
+	index  []int
+	column Column
+}
+
+// structColumns returns the columns of the exported fields of struct
+// type t, including the fields of embedded structs.
+func structColumns(t reflect.Type) []structField {
+	var fields []structField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous && f.Type.Kind() == reflect.Struct {
+			continue
+		}
+		c := Column{Text: f.Name, Type: columnType(f.Type)}
+		if tag, ok := f.Tag.Lookup("grada"); ok {
+			name, typ, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				continue
+			}
+			if name != "" {
+				c.Text = name
+			}
+			if typ != "" {
+				c.Type = typ
+			}
+		}
+		fields = append(fields, structField{f.Index, c})
+	}
+	return fields
+}
+
+// TableOf creates a table from a slice of structs or pointers to structs.
+// Each exported field becomes a column with a type that matches the field
+// type: number for integers and floats, string, time for time.Time,
+// boolean, and json for everything else. Fields of embedded structs
+// become columns of their own.
+//
+// A field tag of the form `grada:"name,type"` overrides the column name,
+// the type, or both; `grada:"-"` omits the field:
+//
+//	type host struct {
+//		Name    string
+//		Started time.Time
+//		Load    float64 `grada:"Load (1m)"`
+//		Config  string  `grada:",json"`
+//		secret  string  // unexported fields are omitted
+//	}
+//
+// Nil pointers in the slice become rows of nil values.
+func TableOf(rows interface{}) (*Table, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return nil, errors.New("TableOf: rows must be a slice of structs")
+	}
+	elem := v.Type().Elem()
+	ptr := elem.Kind() == reflect.Pointer
+	if ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("TableOf: rows must be a slice of structs, not %s", v.Type())
+	}
+
+	fields := structColumns(elem)
+	t := &Table{Columns: make([]Column, len(fields)), Rows: make([][]interface{}, v.Len())}
+	for j, f := range fields {
+		t.Columns[j] = f.column
+	}
+	for i := range t.Rows {
+		r := make([]interface{}, len(fields))
+		t.Rows[i] = r
+		s := v.Index(i)
+		if ptr {
+			if s.IsNil() {
+				continue
+			}
+			s = s.Elem()
+		}
+		for j, f := range fields {
+			fv, err := s.FieldByIndexErr(f.index)
+			if err != nil {
+				continue // field of a nil embedded struct pointer
+			}
+			r[j] = fv.Interface()
+		}
+	}
+	return t, nil
+}
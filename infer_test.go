@@ -0,0 +1,89 @@
+package grada
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInferColumns(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	rows := [][]interface{}{
+		{"a", 1, nil, t0, true, map[string]int{"x": 1}},
+		{"b", 2.5, uint8(3), t0, false, nil, nil},
+	}
+	want := []Column{
+		{"Column 1", ColumnString},
+		{"Column 2", ColumnNumber},
+		{"Column 3", ColumnNumber},
+		{"Column 4", ColumnTime},
+		{"Column 5", ColumnBool},
+		{"Column 6", ColumnJSON},
+		{"Column 7", ColumnString},
+	}
+	if got := inferColumns(rows); !cmp.Equal(got, want) {
+		t.Errorf("inferColumns():\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestTableOf(t *testing.T) {
+	type Meta struct {
+		Region string
+	}
+	type host struct {
+		Meta
+		Name    string
+		Started time.Time
+		Load    float64 `grada:"Load (1m)"`
+		Tags    []string
+		Config  string `grada:",json"`
+		Up      *bool
+		Secret  string `grada:"-"`
+		private int
+	}
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	up := true
+
+	tests := []struct {
+		name     string
+		rows     interface{}
+		wantJSON string
+		wantErr  bool
+	}{
+		{
+			"structs",
+			[]host{{Meta{"eu"}, "a", t0, 0.5, []string{"x"}, `{"k":1}`, &up, "s", 1}},
+			`{"columns":[{"text":"Region","type":"string"},{"text":"Name","type":"string"},{"text":"Started","type":"time"},{"text":"Load (1m)","type":"number"},{"text":"Tags","type":"json"},{"text":"Config","type":"json"},{"text":"Up","type":"boolean"}],"rows":[["eu","a",1508929200000,0.5,["x"],"{\"k\":1}",true]],"type":"table"}`,
+			false,
+		},
+		{
+			"pointers",
+			[]*host{nil},
+			`{"columns":[{"text":"Region","type":"string"},{"text":"Name","type":"string"},{"text":"Started","type":"time"},{"text":"Load (1m)","type":"number"},{"text":"Tags","type":"json"},{"text":"Config","type":"json"},{"text":"Up","type":"boolean"}],"rows":[[null,null,null,null,null,null,null]],"type":"table"}`,
+			false,
+		},
+		{"notSlice", host{}, "", true},
+		{"notStructs", []int{1}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := TableOf(tt.rows)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TableOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			resp, err := table.response()
+			if err != nil {
+				t.Fatalf("response(): %v", err)
+			}
+			got, _ := json.Marshal(resp)
+			if string(got) != tt.wantJSON {
+				t.Errorf("TableOf():\ngot  %s\nwant %s", got, tt.wantJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package grada
+
+// Instrumentation of HTTP handlers.
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// InstrumentPrefix starts the target names of the metrics that
+// Dashboard.Instrument and Dashboard.InstrumentRoute record.
+const InstrumentPrefix = "http."
+
+// Instrument wraps h, typically an http.ServeMux, so that every request
+// is recorded in metrics of its route, the pattern of the ServeMux that
+// matched it, such as "GET /items/{id}". Requests that match no pattern
+// have the route "unmatched". Charting the traffic of a web application
+// thus takes a single line:
+//
+//	http.ListenAndServe(":8080", d.Instrument(mux))
+//
+// The metrics of a route, such as "http.GET /items/{id}.requests", are:
+//
+//	<route>.requests   number of requests so far
+//	<route>.latency    duration of each request, in seconds
+//	<route>.status.2xx number of requests with a 2xx status so far,
+//	                   and likewise for 1xx, 3xx, 4xx, and 5xx
+//
+// The counters only increase; chart them with an expression such as
+//
+//	rate("http.GET /items/{id}.requests"[1m])
+//
+// (see WithExpressions), which quotes the name for the spaces and slashes
+// of routes. Requests whose handler panics count as 5xx. Metrics that do
+// not exist yet are created as by Dashboard.Add.
+func (d *Dashboard) Instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.srv.instrument(w, r, h, "")
+	})
+}
+
+// InstrumentRoute is like Instrument, but records all requests under the
+// given route name. Use it for handlers of routers other than
+// http.ServeMux.
+func (d *Dashboard) InstrumentRoute(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.srv.instrument(w, r, h, route)
+	})
+}
+
+// requestCounters are the counters of Dashboard.Increment.
+type requestCounters struct {
+	mu     sync.Mutex
+	counts map[string]float64 // by target name
+}
+
+// instrument serves the request through h and records it under route, or
+// under the pattern that matched the request if route is empty.
+func (srv *server) instrument(w http.ResponseWriter, r *http.Request, h http.Handler, route string) {
+	start := time.Now()
+	sr := &statusRecorder{ResponseWriter: w}
+	completed := false
+	defer func() {
+		status := sr.status
+		switch {
+		case !completed:
+			status = http.StatusInternalServerError
+		case status == 0:
+			status = http.StatusOK
+		}
+		if route == "" {
+			// ServeMux sets the pattern of the request it routes.
+			route = r.Pattern
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		srv.recordRequest(route, status, time.Since(start))
+	}()
+	h.ServeHTTP(sr, r)
+	completed = true
+}
+
+// RecordRequest adds a request of route, with its response status and
+// latency, to the metrics that Instrument records. Use it in middleware
+// for routers that know the route of a request, such as those of web
+// frameworks.
+func (d *Dashboard) RecordRequest(route string, status int, latency time.Duration) {
+	d.srv.recordRequest(route, status, latency)
+}
+
+// recordRequest implements RecordRequest.
+func (srv *server) recordRequest(route string, status int, latency time.Duration) {
+	prefix := InstrumentPrefix + route + "."
+	srv.metrics.getOrCreate(prefix + "latency").Add(latency.Seconds())
+	srv.increment(prefix+"requests", time.Time{})
+	srv.increment(prefix+"status."+strconv.Itoa(status/100)+"xx", time.Time{})
+}
+
+// Increment adds one to the counter of target, and adds the new count
+// to the metric of target, so that the metric counts events such as
+// requests or errors. Counters start at zero and are independent of the
+// values added by other means. Metrics that do not exist yet are created
+// as by Dashboard.Add.
+func (d *Dashboard) Increment(target string) {
+	d.srv.increment(target, time.Time{})
+}
+
+// increment implements Increment. The data point has the time stamp t,
+// or the current time if t is zero. Adding under the lock keeps the data
+// points of the metric in increasing order.
+func (srv *server) increment(target string, t time.Time) {
+	c := &srv.requestCounts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = map[string]float64{}
+	}
+	c.counts[target]++
+	if t.IsZero() {
+		srv.metrics.getOrCreate(target).Add(c.counts[target])
+		return
+	}
+	srv.metrics.getOrCreate(target).AddCount(Count{c.counts[target], t})
+}
@@ -0,0 +1,99 @@
+package grada
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard_Instrument(t *testing.T) {
+	d := NewDashboard(WithExpressions())
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("item"))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	h := d.Instrument(mux)
+	other := d.InstrumentRoute("other", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	serve := func(h http.Handler, url string) {
+		defer func() { recover() }()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+	}
+	serve(h, "/items/1")
+	serve(h, "/items/2")
+	serve(h, "/items/0")
+	serve(h, "/nope")
+	serve(h, "/panic")
+	serve(other, "/anything")
+
+	tests := []struct {
+		target string
+		want   float64 // last data point
+		points int
+	}{
+		{"http.GET /items/{id}.requests", 3, 3},
+		{"http.GET /items/{id}.status.2xx", 2, 2},
+		{"http.GET /items/{id}.status.4xx", 1, 1},
+		{"http.unmatched.status.4xx", 1, 1},
+		{"http./panic.status.5xx", 1, 1},
+		{"http.other.status.2xx", 1, 1},
+		{"http.other.requests", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			m, err := d.GetMetric(tt.target)
+			if err != nil {
+				t.Fatalf("GetMetric(): %v", err)
+			}
+			if m.head != tt.points || m.list.at(m.head-1).N != tt.want {
+				t.Errorf("metric has %d data points, last %v; want %d, last %v", m.head, m.list.at(m.head-1).N, tt.points, tt.want)
+			}
+		})
+	}
+	if m, err := d.GetMetric("http.GET /items/{id}.latency"); err != nil || m.head != 3 || m.list.at(0).N <= 0 {
+		t.Errorf("latency metric %v, error %v", m, err)
+	}
+	// The documented expression for charting a route.
+	now := time.Now()
+	expr := `count_over_time("http.GET /items/{id}.requests"[1m])`
+	got, err := d.srv.evalExpr(expr, now.Add(-time.Minute), now, 0, 1)
+	if err != nil || len(got) != 1 || len(got[0].rows) != 1 || got[0].rows[0][0] != 3.0 {
+		t.Errorf("evalExpr(%s) = %v, %v; want 3 requests", expr, got, err)
+	}
+}
+
+func TestDashboard_Increment(t *testing.T) {
+	d := NewDashboard()
+	d.Add("errors", 10) // not a count
+	for i := 0; i < 3; i++ {
+		d.Increment("errors")
+	}
+	m, _ := d.GetMetric("errors")
+	got := []float64{m.list.at(0).N, m.list.at(1).N, m.list.at(2).N, m.list.at(3).N}
+	if want := []float64{10, 1, 2, 3}; !cmp.Equal(got, want) {
+		t.Errorf("data points %v, want %v", got, want)
+	}
+}
+
+func TestDashboard_RecordRequest(t *testing.T) {
+	d := NewDashboard()
+	d.RecordRequest("GET /x/:id", 503, 250*time.Millisecond)
+	for target, want := range map[string]float64{"http.GET /x/:id.latency": 0.25, "http.GET /x/:id.requests": 1, "http.GET /x/:id.status.5xx": 1} {
+		m, err := d.GetMetric(target)
+		if err != nil || m.list.at(0).N != want {
+			t.Errorf("metric %s: %v, error %v; want %v", target, m, err, want)
+		}
+	}
+}
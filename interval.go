@@ -0,0 +1,102 @@
+package grada
+
+// Thinning of time series to the interval of a query.
+//
+// Grafana sends the width of a pixel of the panel as the interval of a
+// query, both as a string, "interval": "30s", and in milliseconds,
+// "intervalMs": 30000. The server responds with at most one data point
+// per interval and series, the last one, so that zoomed-out panels get
+// no more data points than they can show, even if maxDataPoints allows
+// more.
+
+import (
+	"strconv"
+	"time"
+)
+
+// intervalUnits are the units of Grafana intervals.
+var intervalUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// parseInterval returns the duration of a Grafana interval such as "30s",
+// "1m", or "1d", or false if s is no such interval.
+func parseInterval(s string) (time.Duration, bool) {
+	m := grafanaInterval.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-len(m[1])], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * intervalUnits[m[1]], true
+}
+
+// interval returns the interval of q: the longer of "interval" and
+// "intervalMs", or 0 if q has neither. Intervals that cannot be parsed
+// are ignored.
+func (q *query) interval() time.Duration {
+	d := time.Duration(q.IntervalMs) * time.Millisecond
+	if s, ok := parseInterval(q.Interval); ok && s > d {
+		d = s
+	}
+	return max(d, 0)
+}
+
+// thinToInterval keeps the last data point of every interval of s, with
+// the intervals aligned to the Unix epoch. It limits series sources to as
+// many data points as their range has intervals.
+func (s *series) thinToInterval(interval time.Duration) {
+	switch {
+	case interval <= 0:
+	case s.source != nil:
+		if n := int64(s.to.Sub(s.from)/interval) + 1; n > 0 && n < int64(s.max) {
+			s.max = int(n)
+		}
+	case s.counts != nil:
+		out := s.counts[:0]
+		for i, c := range s.counts {
+			if i+1 < len(s.counts) && intervalOf(c.T.UnixNano(), interval) == intervalOf(s.counts[i+1].T.UnixNano(), interval) {
+				continue
+			}
+			out = append(out, c)
+		}
+		s.counts = out
+	case s.rows != nil:
+		// Rows may be shared with a virtual series.
+		var out []row
+		for i, r := range s.rows {
+			if i+1 < len(s.rows) && sameInterval(r, s.rows[i+1], interval) {
+				continue
+			}
+			out = append(out, r)
+		}
+		if len(out) < len(s.rows) {
+			s.rows = out
+		}
+	}
+}
+
+// sameInterval reports whether the rows a and b lie in the same interval.
+func sameInterval(a, b row, interval time.Duration) bool {
+	ta, ok1 := a[1].(int64)
+	tb, ok2 := b[1].(int64)
+	ms := int64(time.Millisecond)
+	return ok1 && ok2 && intervalOf(ta*ms, interval) == intervalOf(tb*ms, interval)
+}
+
+// intervalOf returns the number of the interval of the Unix time ns.
+func intervalOf(ns int64, interval time.Duration) int64 {
+	n := ns / int64(interval)
+	if ns < 0 && ns%int64(interval) != 0 {
+		n--
+	}
+	return n
+}
@@ -0,0 +1,63 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"100ms", 100 * time.Millisecond, true},
+		{"30s", 30 * time.Second, true},
+		{"1m", time.Minute, true},
+		{"1h", time.Hour, true},
+		{"2d", 48 * time.Hour, true},
+		{"", 0, false},
+		{"30 sec", 0, false},
+		{"1.5s", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseInterval(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("parseInterval(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestServer_thinToInterval(t *testing.T) {
+	d := NewDashboard()
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		m.AddWithTime(float64(i), t0.Add(time.Duration(10*i)*time.Second))
+	}
+	tests := []struct {
+		name     string
+		interval string
+		want     string
+	}{
+		{"none", ``, `[0,1508929200000],[1,1508929210000],[2,1508929220000],[3,1508929230000],[4,1508929240000],[5,1508929250000]`},
+		{"finer", `"interval":"1s",`, `[0,1508929200000],[1,1508929210000],[2,1508929220000],[3,1508929230000],[4,1508929240000],[5,1508929250000]`},
+		{"interval", `"interval":"30s",`, `[2,1508929220000],[5,1508929250000]`},
+		{"intervalMs", `"intervalMs":20000,`, `[1,1508929210000],[3,1508929230000],[5,1508929250000]`},
+		{"longer wins", `"interval":"1m","intervalMs":20000,`, `[5,1508929250000]`},
+		{"unparsable", `"interval":"1 m",`, `[0,1508929200000],[1,1508929210000],[2,1508929220000],[3,1508929230000],[4,1508929240000],[5,1508929250000]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"range":{"from":"2017-10-25T10:59:00Z","to":"2017-10-25T11:01:00Z"},` + tt.interval +
+				`"maxDataPoints":100,"targets":[{"target":"cpu"}]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			want := `[{"target":"cpu","datapoints":[` + tt.want + `]}]`
+			if got := strings.TrimSpace(w.Body.String()); got != want {
+				t.Errorf("POST /query = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package grada
+
+// CIDR-based client address filtering.
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// WithIPAllowlist accepts requests only from clients whose address lies
+// within one of the given prefixes, for example the addresses of the
+// Grafana hosts:
+//
+//	grada.WithIPAllowlist(netip.MustParsePrefix("10.1.2.0/24"))
+//
+// The client address is the remote address of the connection. Headers like
+// X-Forwarded-For are ignored, as they can be forged.
+func WithIPAllowlist(prefixes ...netip.Prefix) Option {
+	return func(srv *server) {
+		srv.ipAllow = append(srv.ipAllow, prefixes...)
+	}
+}
+
+// WithIPDenylist rejects requests from clients whose address lies within
+// one of the given prefixes. The denylist takes precedence over the allowlist.
+func WithIPDenylist(prefixes ...netip.Prefix) Option {
+	return func(srv *server) {
+		srv.ipDeny = append(srv.ipDeny, prefixes...)
+	}
+}
+
+// containsAddr reports whether one of the prefixes contains addr.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed reports whether a client with the given remote address
+// ("host:port") may access the server.
+func (srv *server) ipAllowed(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap() // match IPv4 clients on dual-stack listeners
+	if containsAddr(srv.ipDeny, addr) {
+		return false
+	}
+	return len(srv.ipAllow) == 0 || containsAddr(srv.ipAllow, addr)
+}
+
+// filterIP rejects requests from clients that are not allowed.
+func (srv *server) filterIP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.ipAllowed(r.RemoteAddr) {
+			writeError(w, http.StatusForbidden, nil, "client address not allowed")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package grada
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestServer_ipAllowed(t *testing.T) {
+	allow := WithIPAllowlist(netip.MustParsePrefix("10.1.0.0/16"), netip.MustParsePrefix("fd00::/8"))
+	deny := WithIPDenylist(netip.MustParsePrefix("10.1.2.0/24"))
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		remoteAddr string
+		want       bool
+	}{
+		{"noLists", nil, "192.0.2.1:1234", true},
+		{"allowed", []Option{allow}, "10.1.3.4:1234", true},
+		{"notAllowed", []Option{allow}, "192.0.2.1:1234", false},
+		{"ipv6", []Option{allow}, "[fd00::1]:1234", true},
+		{"mappedIPv4", []Option{allow}, "[::ffff:10.1.3.4]:1234", true},
+		{"denied", []Option{allow, deny}, "10.1.2.3:1234", false},
+		{"denyOnly", []Option{deny}, "192.0.2.1:1234", true},
+		{"garbage", []Option{deny}, "nonsense", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &server{}
+			for _, opt := range tt.opts {
+				opt(srv)
+			}
+			if got := srv.ipAllowed(tt.remoteAddr); got != tt.want {
+				t.Errorf("ipAllowed(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+			}
+		})
+	}
+}
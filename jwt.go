@@ -0,0 +1,186 @@
+package grada
+
+// JWT bearer-token authentication (HS256 and RS256).
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTConfig configures the validation of JWT bearer tokens.
+//
+// Set HMACKey to accept HS256 tokens, RSAKey to accept RS256 tokens, or both.
+// Tokens must not be expired ("exp") and must be valid already ("nbf").
+// If Issuer or Audience is set, the "iss" claim must match Issuer, and the
+// "aud" claim must contain Audience.
+type JWTConfig struct {
+	HMACKey  []byte
+	RSAKey   *rsa.PublicKey
+	Issuer   string
+	Audience string
+	Leeway   time.Duration // tolerated clock skew for "exp" and "nbf"
+}
+
+// WithJWT requires every request to carry a valid JWT in an
+// "Authorization: Bearer <token>" header. Requests without a valid token
+// receive a 401 Unauthorized response.
+// It is a shortcut for WithAuthenticator(NewJWTAuthenticator(cfg)).
+//
+// In Grafana, forward the user's OAuth identity or set a custom
+// Authorization header with a service token in the data source settings.
+func WithJWT(cfg JWTConfig) Option {
+	return WithAuthenticator(NewJWTAuthenticator(cfg))
+}
+
+var (
+	errJWTMalformed = errors.New("malformed token")
+	errJWTSignature = errors.New("invalid signature")
+)
+
+// jwtClaims is the payload of a JWT.
+type jwtClaims map[string]interface{}
+
+// timeClaim returns a NumericDate claim as time.
+func (c jwtClaims) timeClaim(name string) (time.Time, bool) {
+	f, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// hasAudience reports whether the "aud" claim, which can be a string or
+// a list of strings, contains aud.
+func (c jwtClaims) hasAudience(aud string) bool {
+	switch a := c["aud"].(type) {
+	case string:
+		return a == aud
+	case []interface{}:
+		for _, v := range a {
+			if v == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validate checks the signature and the claims of a token and returns the claims.
+func (cfg *JWTConfig) validate(token string, now time.Time) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errJWTMalformed
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+
+	// The algorithm must match a configured key, so that an RSA public key
+	// can never be abused as an HMAC secret.
+	switch {
+	case header.Alg == "HS256" && cfg.HMACKey != nil:
+		mac := hmac.New(sha256.New, cfg.HMACKey)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errJWTSignature
+		}
+	case header.Alg == "RS256" && cfg.RSAKey != nil:
+		if rsa.VerifyPKCS1v15(cfg.RSAKey, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errJWTSignature
+		}
+	default:
+		return nil, errors.New("unsupported algorithm " + header.Alg)
+	}
+
+	claims := jwtClaims{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims.timeClaim("exp"); ok && now.After(exp.Add(cfg.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims.timeClaim("nbf"); ok && now.Add(cfg.Leeway).Before(nbf) {
+		return nil, errors.New("token not valid yet")
+	}
+	if cfg.Issuer != "" && claims["iss"] != cfg.Issuer {
+		return nil, errors.New("wrong issuer")
+	}
+	if cfg.Audience != "" && !claims.hasAudience(cfg.Audience) {
+		return nil, errors.New("wrong audience")
+	}
+	return claims, nil
+}
+
+// decodeJWTPart decodes a base64url-encoded JSON part of a token into v.
+func decodeJWTPart(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errJWTMalformed
+	}
+	if json.Unmarshal(b, v) != nil {
+		return errJWTMalformed
+	}
+	return nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(auth[7:]), true
+}
+
+// jwtAuthenticator authenticates requests by their bearer token.
+type jwtAuthenticator struct {
+	cfg JWTConfig
+}
+
+// NewJWTAuthenticator returns an Authenticator that requires a valid JWT in an
+// "Authorization: Bearer <token>" header. The name of the Principal is the
+// "sub" claim; its attributes are all claims of the token.
+func NewJWTAuthenticator(cfg JWTConfig) Authenticator {
+	return &jwtAuthenticator{cfg: cfg}
+}
+
+// Authenticate implements Authenticator.
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return Principal{}, &bearerError{"Bearer", errors.New("missing bearer token")}
+	}
+	claims, err := a.cfg.validate(token, time.Now())
+	if err != nil {
+		return Principal{}, &bearerError{`Bearer error="invalid_token"`, err}
+	}
+	sub, _ := claims["sub"].(string)
+	return Principal{Name: sub, Attributes: claims}, nil
+}
+
+// bearerError is an authentication error together with the challenge of the
+// WWW-Authenticate header that the 401 response carries (RFC 6750).
+type bearerError struct {
+	challenge string
+	err       error
+}
+
+func (e *bearerError) Error() string { return e.err.Error() }
+func (e *bearerError) Unwrap() error { return e.err }
@@ -0,0 +1,110 @@
+package grada
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signJWT creates a token for the given header and payload JSON.
+// key is either a []byte HMAC secret or an *rsa.PrivateKey.
+func signJWT(t *testing.T, header, payload string, key interface{}) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(payload))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + enc.EncodeToString(sig)
+}
+
+func TestJWTConfig_validate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+	cfg := &JWTConfig{
+		HMACKey:  secret,
+		RSAKey:   &rsaKey.PublicKey,
+		Issuer:   "grafana",
+		Audience: "grada",
+		Leeway:   time.Minute,
+	}
+	now := time.Unix(1508929014, 0)
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	rs256 := `{"alg":"RS256","typ":"JWT"}`
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"hs256", signJWT(t, hs256, `{"iss":"grafana","aud":"grada","exp":1508929100}`, secret), false},
+		{"rs256", signJWT(t, rs256, `{"iss":"grafana","aud":["x","grada"]}`, rsaKey), false},
+		{"leeway", signJWT(t, hs256, `{"iss":"grafana","aud":"grada","exp":1508929000}`, secret), false},
+		{"expired", signJWT(t, hs256, `{"iss":"grafana","aud":"grada","exp":1508928000}`, secret), true},
+		{"notYet", signJWT(t, hs256, `{"iss":"grafana","aud":"grada","nbf":1508930000}`, secret), true},
+		{"wrongIssuer", signJWT(t, hs256, `{"iss":"mallory","aud":"grada"}`, secret), true},
+		{"wrongAudience", signJWT(t, hs256, `{"iss":"grafana","aud":"other"}`, secret), true},
+		{"wrongSecret", signJWT(t, hs256, `{"iss":"grafana","aud":"grada"}`, []byte("guess")), true},
+		{"none", signJWT(t, `{"alg":"none"}`, `{"iss":"grafana","aud":"grada"}`, []byte{}), true},
+		{"malformed", "abc.def", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cfg.validate(tt.token, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithJWT(t *testing.T) {
+	secret := []byte("secret")
+	srv := newServer(WithJWT(JWTConfig{HMACKey: secret}))
+	token := signJWT(t, `{"alg":"HS256"}`, `{"sub":"grafana"}`, secret)
+
+	tests := []struct {
+		name          string
+		auth          string
+		wantStatus    int
+		wantChallenge string
+	}{
+		{"valid", "Bearer " + token, 200, ""},
+		{"missing", "", 401, "Bearer"},
+		{"basic", "Basic Zm9vOmJhcg==", 401, "Bearer"},
+		{"invalid", "Bearer " + token + "x", 401, `Bearer error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", tt.auth)
+			w := httptest.NewRecorder()
+			srv.handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("Authorization %q: status %d, want %d", tt.auth, w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("Authorization %q: WWW-Authenticate %q, want %q", tt.auth, got, tt.wantChallenge)
+			}
+		})
+	}
+}
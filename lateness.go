@@ -0,0 +1,57 @@
+package grada
+
+// Out-of-order data points.
+
+import "time"
+
+// WithLateness makes every metric keep its buffer in time stamp order.
+// Add, AddWithTime, and AddCount insert a data point that is older than
+// the newest data point of the metric at its place in time, rather than
+// at the head of the buffer, so that producers that deliver late do not
+// break charts. The data point still replaces the oldest one of a full
+// buffer.
+//
+// Data points that are more than window older than the newest data point
+// of the metric are dropped, as are data points older than all data
+// points of a full buffer. Inserting a late data point costs time in
+// proportion to the number of data points that are newer than it.
+func WithLateness(window time.Duration) Option {
+	return func(srv *server) {
+		srv.metrics.lateness = window
+	}
+}
+
+// insert adds c in time stamp order, and reports whether it has added c.
+// See WithLateness. The caller must hold g.m.
+func (g *Metric) insert(c Count) bool {
+	g.sort()
+	n := g.list.len()
+	newest := g.list.at((g.head + n - 1) % n)
+	if !c.T.Before(newest.T) {
+		g.list.set(g.head, c)
+		g.head = (g.head + 1) % n
+		return true
+	}
+	if c.T.Before(newest.T.Add(-g.lateness)) {
+		return false
+	}
+
+	// k data points are newer than c.
+	t := nanos(c.T)
+	k := 0
+	for k < n && g.list.ns[(g.head+n-1-k)%n] > t {
+		k++
+	}
+	if k == n {
+		return false
+	}
+	// Drop the oldest data point, move the newer ones up by one into its
+	// slot, which is now the newest, and put c before them.
+	g.head = (g.head + 1) % n
+	for i := 0; i < k; i++ {
+		dst, src := (g.head+n-1-i)%n, (g.head+n-2-i)%n
+		g.list.n[dst], g.list.ns[dst] = g.list.n[src], g.list.ns[src]
+	}
+	g.list.set((g.head+n-1-k)%n, c)
+	return true
+}
@@ -0,0 +1,62 @@
+package grada
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetric_insert(t *testing.T) {
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	tests := []struct {
+		name  string
+		size  int
+		times []int64 // added in this order, with the time as the value
+		want  []int64
+	}{
+		{"in order", 3, []int64{1, 2, 3, 4}, []int64{2, 3, 4}},
+		{"late", 5, []int64{1, 2, 4, 5, 3}, []int64{1, 2, 3, 4, 5}},
+		{"late into a full buffer", 4, []int64{1, 2, 4, 5, 3}, []int64{2, 3, 4, 5}},
+		{"wraps around", 3, []int64{1, 2, 3, 5, 6, 4}, []int64{4, 5, 6}},
+		{"too late", 5, []int64{1, 20, 5}, []int64{1, 20}},
+		{"older than a full buffer", 2, []int64{3, 4, 2}, []int64{3, 4}},
+		{"equal time stamps", 3, []int64{1, 2, 2}, []int64{1, 2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard(WithLateness(10 * time.Second))
+			m, _ := d.CreateMetricWithBufSize("cpu", tt.size)
+			for _, s := range tt.times {
+				m.AddWithTime(float64(s), at(s))
+			}
+			var got []int64
+			m.m.Lock()
+			if m.unsorted {
+				t.Error("buffer is marked unsorted")
+			}
+			for i := 0; i < m.list.len(); i++ {
+				if c := m.list.at((m.head + i) % m.list.len()); !c.T.IsZero() {
+					got = append(got, int64(c.N))
+				}
+			}
+			m.m.Unlock()
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("buffer mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithLateness_subscribers(t *testing.T) {
+	d := NewDashboard(WithLateness(time.Second))
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	var got []float64
+	m.Subscribe(func(c Count) { got = append(got, c.N) })
+	m.AddWithTime(1, time.Unix(10, 0))
+	m.AddWithTime(2, time.Unix(1, 0)) // dropped
+	m.Add(3)
+	if diff := cmp.Diff([]float64{1, 3}, got); diff != "" {
+		t.Errorf("notified values mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,193 @@
+package grada
+
+// Limits on the load that Grafana can put on the host application.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WithMaxConcurrentQueries limits the number of /query requests that the
+// server executes at the same time to n, so that many dashboards refreshing
+// at once cannot starve the host application.
+//
+// Excess requests wait up to wait for a slot. If wait is 0, or if no slot
+// becomes free in time, the server responds with 429 Too Many Requests
+// and a Retry-After header.
+func WithMaxConcurrentQueries(n int, wait time.Duration) Option {
+	return func(srv *server) {
+		if n > 0 {
+			srv.querySlots = make(chan struct{}, n)
+		}
+		srv.queryWait = wait
+	}
+}
+
+// limitQueries passes a request on to h only when a query slot is free.
+func (srv *server) limitQueries(h http.HandlerFunc) http.HandlerFunc {
+	if srv.querySlots == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case srv.querySlots <- struct{}{}:
+		default:
+			if !srv.waitForSlot(r) {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusTooManyRequests, nil, "too many concurrent queries")
+				return
+			}
+		}
+		defer func() { <-srv.querySlots }()
+		h(w, r)
+	}
+}
+
+// waitForSlot waits for a free query slot until queryWait has passed or
+// the request is canceled. It reports whether it has acquired a slot.
+func (srv *server) waitForSlot(r *http.Request) bool {
+	if srv.queryWait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(srv.queryWait)
+	defer timer.Stop()
+	select {
+	case srv.querySlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// WithMaxDatapointsPerResponse limits the data points of a time series
+// response to n in total, so that a panel that asks for more data points
+// than its pixels, or a query with many targets, cannot send millions of
+// data points to Grafana.
+//
+// Each target gets an equal share of n. The server lowers the
+// maxDataPoints of queries that ask for more, so that metrics thin out
+// their data points before they are fetched, and thins out the series of
+// virtual series and expressions that still exceed their share. It logs a
+// warning for each capped response.
+func WithMaxDatapointsPerResponse(n int) Option {
+	return func(srv *server) {
+		srv.maxResponsePoints = n
+	}
+}
+
+// capDataPoints returns the maxDataPoints of q, lowered to the share of
+// each target of the data points per response, and reports whether it
+// has lowered it.
+func (srv *server) capDataPoints(q *query) (int, bool) {
+	if srv.maxResponsePoints <= 0 {
+		return q.MaxDataPoints, false
+	}
+	share := srv.maxResponsePoints / max(len(q.Targets), 1)
+	if q.MaxDataPoints > share {
+		return share, true
+	}
+	return q.MaxDataPoints, false
+}
+
+// capResponse thins out the series of response to an equal share of the
+// data points per response, and reports whether it has thinned out any.
+func (srv *server) capResponse(response []series) bool {
+	if srv.maxResponsePoints <= 0 || len(response) == 0 {
+		return false
+	}
+	total := 0
+	for _, s := range response {
+		total += s.points()
+	}
+	if total <= srv.maxResponsePoints {
+		return false
+	}
+	for i := range response {
+		s := &response[i]
+		share := srv.maxResponsePoints / len(response)
+		if i < srv.maxResponsePoints%len(response) {
+			share++
+		}
+		switch {
+		case s.source != nil:
+			s.max = min(s.max, share)
+		case len(s.rows) > share:
+			s.rows = thinRows(s.rows, share)
+		case len(s.counts) > share:
+			s.counts = thinCounts(s.counts, share)
+		}
+	}
+	return true
+}
+
+// warnCapped logs that the response to r has been capped.
+func (srv *server) warnCapped(r *http.Request) {
+	if srv.logger != nil {
+		srv.logger.Printf("grada: request %s: time series response capped at %d data points", RequestIDFromContext(r.Context()), srv.maxResponsePoints)
+	}
+}
+
+// thinRows returns n rows evenly chosen from rows, in a new slice, as rows
+// may be shared with a virtual series.
+func thinRows(rows []row, n int) []row {
+	ratio := float64(len(rows)) / float64(n)
+	thinned := make([]row, n)
+	for i := range thinned {
+		thinned[i] = rows[int(float64(i)*ratio)]
+	}
+	return thinned
+}
+
+// thinCounts thins out counts in place to n evenly chosen Counts, like
+// Metric.appendCounts.
+func thinCounts(counts []Count, n int) []Count {
+	ratio := float64(len(counts)) / float64(n)
+	for i := 0; i < n; i++ {
+		counts[i] = counts[int(float64(i)*ratio)]
+	}
+	return counts[:n]
+}
+
+// QueryLimits configures WithQueryLimits. Zero fields impose no limit.
+type QueryLimits struct {
+	// MaxRange is the longest time range of a query.
+	MaxRange time.Duration
+	// MaxTargets is the most targets of a query.
+	MaxTargets int
+	// MaxTableRows is the most rows of all tables of a table query
+	// together, after filters and paging.
+	MaxTableRows int
+}
+
+// WithQueryLimits rejects queries that exceed l with 400 Bad Request and
+// an error that names the limit, so that a misconfigured panel, such as
+// one with a range of years or hundreds of targets, cannot make the
+// server do pathological work. A table query fails as soon as its tables
+// exceed l.MaxTableRows, before the remaining tables are computed.
+func WithQueryLimits(l QueryLimits) Option {
+	return func(srv *server) {
+		srv.queryLimits = l
+	}
+}
+
+// check returns an error if the range or the targets of q exceed l.
+func (l QueryLimits) check(q *query) error {
+	if r := q.Range.To.Sub(q.Range.From); l.MaxRange > 0 && r > l.MaxRange {
+		return fmt.Errorf("time range of %v is longer than the limit of %v", r, l.MaxRange)
+	}
+	if l.MaxTargets > 0 && len(q.Targets) > l.MaxTargets {
+		return fmt.Errorf("%d targets are more than the limit of %d", len(q.Targets), l.MaxTargets)
+	}
+	return nil
+}
+
+// checkRows returns an error if rows table rows exceed l.
+func (l QueryLimits) checkRows(rows int) error {
+	if l.MaxTableRows > 0 && rows > l.MaxTableRows {
+		return fmt.Errorf("tables have more rows than the limit of %d", l.MaxTableRows)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package grada
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_limitQueries(t *testing.T) {
+	tests := []struct {
+		name       string
+		wait       time.Duration
+		release    bool // free the slot while the second request waits
+		wantStatus int
+	}{
+		{"shed", 0, false, http.StatusTooManyRequests},
+		{"timeout", 10 * time.Millisecond, false, http.StatusTooManyRequests},
+		{"queued", 5 * time.Second, true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(WithMaxConcurrentQueries(1, tt.wait))
+			started := make(chan struct{}, 2)
+			release := make(chan struct{})
+			h := srv.limitQueries(func(w http.ResponseWriter, r *http.Request) {
+				started <- struct{}{}
+				<-release
+			})
+
+			go h(httptest.NewRecorder(), httptest.NewRequest("POST", "/query", nil))
+			<-started
+			if tt.release {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					close(release)
+				}()
+			}
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("POST", "/query", nil))
+			if !tt.release {
+				close(release)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Errorf("no Retry-After header")
+			}
+		})
+	}
+}
+
+func TestServer_maxDatapointsPerResponse(t *testing.T) {
+	var logs bytes.Buffer
+	d := NewDashboard(WithMaxDatapointsPerResponse(10), WithLogger(log.New(&logs, "", 0)))
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	for _, target := range []string{"a", "b"} {
+		m, _ := d.CreateMetricWithBufSize(target, 20)
+		for i := 0; i < 20; i++ {
+			m.AddWithTime(float64(i), t0.Add(time.Duration(i)*time.Second))
+		}
+	}
+	// The virtual series ignores maxDataPoints.
+	d.srv.addVirtual("v", func(from, to time.Time, maxDataPoints int) ([]row, error) {
+		rows := make([]row, 20)
+		for i := range rows {
+			rows[i] = row{float64(i), int64(i)}
+		}
+		return rows, nil
+	})
+
+	tests := []struct {
+		name          string
+		targets       string
+		maxDataPoints int
+		want          []int
+		wantLog       bool
+	}{
+		{"within", `{"target": "a"}`, 10, []int{10}, false},
+		{"one target", `{"target": "a"}`, 1000, []int{10}, true},
+		{"shared", `{"target": "a"}, {"target": "b"}`, 1000, []int{5, 5}, true},
+		{"uneven", `{"target": "a"}, {"target": "b"}, {"target": "a"}`, 1000, []int{3, 3, 3}, true},
+		{"virtual", `{"target": "a"}, {"target": "v"}`, 5, []int{5, 5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			body := `{"range": {"from": "2017-10-25T10:00:00Z", "to": "2017-10-25T12:00:00Z"}, "maxDataPoints": ` +
+				strconv.Itoa(tt.maxDataPoints) + `, "targets": [` + tt.targets + `]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			var resp []timeseriesResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("cannot unmarshal %s: %v", w.Body.String(), err)
+			}
+			var got []int
+			for _, r := range resp {
+				got = append(got, len(r.Datapoints))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("data points per target %v, want %v", got, tt.want)
+			}
+			if logged := strings.Contains(logs.String(), "capped at 10 data points"); logged != tt.wantLog {
+				t.Errorf("logged %q, want a warning: %v", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestServer_queryLimits(t *testing.T) {
+	d := NewDashboard(WithQueryLimits(QueryLimits{MaxRange: 24 * time.Hour, MaxTargets: 2, MaxTableRows: 3}))
+	d.CreateMetricWithBufSize("cpu", 10)
+	rows := func(n int) TableFunc {
+		return func(from, to time.Time) (*Table, error) {
+			t := &Table{Columns: []Column{{Text: "n", Type: "number"}}}
+			for i := 0; i < n; i++ {
+				t.Rows = append(t.Rows, []interface{}{i})
+			}
+			return t, nil
+		}
+	}
+	d.CreateTable("two", rows(2))
+	d.CreateTable("four", rows(4))
+	d.CreateStaticTable("static", &Table{Columns: []Column{{Text: "n", Type: "number"}}, Rows: [][]interface{}{{1}, {2}}})
+
+	tests := []struct {
+		name       string
+		to         string
+		targets    string
+		wantStatus int
+		wantErr    string
+	}{
+		{"within", "2017-10-26T00:00:00Z", `{"target": "cpu"}, {"target": "cpu"}`, http.StatusOK, ""},
+		{"range", "2017-10-26T00:00:01Z", `{"target": "cpu"}`, http.StatusBadRequest, "time range of 24h0m1s is longer than the limit of 24h0m0s"},
+		{"targets", "2017-10-26T00:00:00Z", `{"target": "cpu"}, {"target": "cpu"}, {"target": "cpu"}`, http.StatusBadRequest, "3 targets are more than the limit of 2"},
+		{"rows", "2017-10-26T00:00:00Z", `{"target": "four", "type": "table"}`, http.StatusBadRequest, "more rows than the limit of 3"},
+		{"paged rows", "2017-10-26T00:00:00Z", `{"target": "four", "type": "table", "data": {"limit": 3}}`, http.StatusOK, ""},
+		{"rows of all tables", "2017-10-26T00:00:00Z", `{"target": "two", "type": "table"}, {"target": "static", "type": "table"}`, http.StatusBadRequest, "more rows than the limit of 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"range": {"from": "2017-10-25T00:00:00Z", "to": "` + tt.to + `"}, "maxDataPoints": 10, "targets": [` + tt.targets + `]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var resp errorResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if !strings.Contains(resp.Error, tt.wantErr) {
+				t.Errorf("error %q, want %q", resp.Error, tt.wantErr)
+			}
+		})
+	}
+}
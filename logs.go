@@ -0,0 +1,102 @@
+package grada
+
+// Log targets for Grafana's logs panel.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLine is a single line of a LogBuffer.
+type LogLine struct {
+	Time    time.Time
+	Level   string // such as "info" or "error"
+	Message string
+	Labels  map[string]string
+}
+
+// LogBuffer is a ring buffer of log lines that Grafana's logs panel can
+// display. Query a log target with the "table" or "logs" format; the
+// response is a table with the columns "Time", "Level", "Message", and
+// "Labels", which holds the labels as "key=value" pairs.
+//
+// LogBuffer is an io.Writer, so that it can be the output of a log.Logger.
+type LogBuffer struct {
+	m    sync.Mutex
+	list []LogLine
+	head int
+}
+
+// CreateLogBuffer creates a log target that holds up to size lines.
+// Creating a log buffer for an existing target fails with ErrMetricExists.
+func (d *Dashboard) CreateLogBuffer(target string, size int) (*LogBuffer, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrBufferSize, size)
+	}
+	b := &LogBuffer{list: make([]LogLine, size)}
+	err := d.srv.addTable(target, b.table)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Log adds a line to the buffer, along with the current time stamp.
+// When the buffer is full, every new line overwrites the oldest one.
+func (b *LogBuffer) Log(level, msg string, labels map[string]string) {
+	b.Add(LogLine{Time: time.Now(), Level: level, Message: msg, Labels: labels})
+}
+
+// Add adds a complete LogLine to the buffer.
+func (b *LogBuffer) Add(l LogLine) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.list[b.head] = l
+	b.head = (b.head + 1) % len(b.list)
+}
+
+// Write adds every line of p to the buffer, with level "info".
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		b.Log("info", line, nil)
+	}
+	return len(p), nil
+}
+
+// table returns the lines within [from, to], sorted by time.
+func (b *LogBuffer) table(from, to time.Time) (*Table, error) {
+	b.m.Lock()
+	var lines []LogLine
+	for i := range b.list {
+		l := b.list[(i+b.head)%len(b.list)]
+		if !l.Time.IsZero() && !l.Time.Before(from) && !l.Time.After(to) {
+			lines = append(lines, l)
+		}
+	}
+	b.m.Unlock()
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+
+	t := &Table{Columns: []Column{
+		{Text: "Time", Type: ColumnTime},
+		{Text: "Level", Type: ColumnString},
+		{Text: "Message", Type: ColumnString},
+		{Text: "Labels", Type: ColumnString},
+	}}
+	for _, l := range lines {
+		t.Rows = append(t.Rows, []interface{}{l.Time, l.Level, l.Message, formatLabels(l.Labels)})
+	}
+	return t, nil
+}
+
+// formatLabels formats labels as "key=value" pairs, sorted by key.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
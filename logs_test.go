@@ -0,0 +1,35 @@
+package grada
+
+import (
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard_CreateLogBuffer(t *testing.T) {
+	d := NewDashboard()
+	b, err := d.CreateLogBuffer("app", 3)
+	if err != nil {
+		t.Fatalf("CreateLogBuffer(): %v", err)
+	}
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	b.Add(LogLine{Time: t0.Add(time.Minute), Level: "error", Message: "disk full", Labels: map[string]string{"host": "a", "disk": "sda"}})
+	b.Add(LogLine{Time: t0, Level: "info", Message: "started"})
+	log.New(b, "", 0).Print("now")
+
+	body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "targets": [{"target": "app", "type": "logs"}]}`
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	want := `[{"columns":[{"text":"Time","type":"time"},{"text":"Level","type":"string"},{"text":"Message","type":"string"},{"text":"Labels","type":"string"}],` +
+		`"rows":[[1508929200000,"info","started",""],[1508929260000,"error","disk full","disk=sda host=a"]],"type":"table"}]`
+	if w.Body.String() != want {
+		t.Errorf("/query:\ngot  %s\nwant %s", w.Body.String(), want)
+	}
+
+	table, _ := b.table(time.Now().Add(-time.Minute), time.Now())
+	if len(table.Rows) != 1 || table.Rows[0][2] != "now" {
+		t.Errorf("lines written through log.Logger: %v", table.Rows)
+	}
+}
@@ -1,8 +1,7 @@
 package grada
 
 import (
-	"errors"
-	"sort"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -18,22 +17,55 @@ type Count struct {
 
 // Metric is a ring buffer of Counts. It collects time series data that a Grafana
 // dashboard panel can request at regular intervals.
+// A Metric stores time stamps as nanoseconds since the Unix epoch; the Counts it
+// returns have local time stamps without a monotonic clock reading.
 // Each Metric has a name that Grafana uses for selecting the desired data stream.
 // See Dashboard.CreateMetric().
 type Metric struct {
 	m        sync.Mutex
-	list     []Count
+	list     countBuffer
 	head     int
-	unsorted bool // AddWithTime() and AddCount() do not add in a sorted manner.
+	unsorted bool            // AddWithTime() and AddCount() do not add in a sorted manner.
+	subs     []*subscription // replaced, not modified, by Subscribe and cancel
+	scratch  []Count         // reusable fetch buffer, see fetchCounts
+	seq      uint64          // write sequence number of the last change, see nextSeq
+	wal      *wal            // logs every Count before it is added, see WithWAL
+	target   string          // name of the metric in the write-ahead log
+	lateness time.Duration   // insert in time stamp order, see WithLateness
+	dups     DuplicateConfig // see WithDuplicates
+	weights  map[int64]int   // number of averaged data points by time stamp, see duplicate
+}
+
+// subscription is a callback registered through Metric.Subscribe.
+type subscription struct {
+	fn func(Count)
 }
 
 // Add a single value to the Metric buffer, along with the current time stamp.
 // When the buffer is full, every new value overwrites the oldest one.
 func (g *Metric) Add(n float64) {
+	c := Count{n, time.Now()}
 	g.m.Lock()
-	defer g.m.Unlock()
-	g.list[g.head] = Count{n, time.Now()}
-	g.head = (g.head + 1) % len(g.list)
+	if g.lateness > 0 || g.dups.OnIngest {
+		g.m.Unlock()
+		g.AddCount(c)
+		return
+	}
+	if g.wal != nil {
+		g.wal.append(g.target, c)
+	}
+	size := g.list.len()
+	if nanos(c.T) < g.list.ns[(g.head+size-1)%size] {
+		g.unsorted = true // AddWithTime() added a data point after now
+	}
+	g.list.set(g.head, c)
+	g.head = (g.head + 1) % size
+	g.seq = nextSeq()
+	subs := g.subs
+	g.m.Unlock()
+	for _, s := range subs {
+		s.fn(c)
+	}
 }
 
 // AddWithTime adds a single (value, timestamp) tuple to the ring buffer.
@@ -43,11 +75,63 @@ func (g *Metric) AddWithTime(n float64, t time.Time) {
 
 // AddCount adds a complete Count object to the metric data.
 func (g *Metric) AddCount(c Count) {
+	g.m.Lock()
+	if g.dups.OnIngest && g.dups.Policy != DuplicatesKeepAll && g.duplicate(c) {
+		g.seq = nextSeq()
+		g.m.Unlock()
+		return
+	}
+	evicted := g.list.ns[g.head]
+	if g.lateness > 0 {
+		if !g.insert(c) {
+			g.m.Unlock()
+			return
+		}
+	} else {
+		n := g.list.len()
+		if nanos(c.T) < g.list.ns[(g.head+n-1)%n] {
+			g.unsorted = true
+		}
+		g.list.set(g.head, c)
+		g.head = (g.head + 1) % n
+	}
+	if g.weights != nil {
+		delete(g.weights, evicted)
+	}
+	if g.wal != nil {
+		g.wal.append(g.target, c)
+	}
+	g.seq = nextSeq()
+	subs := g.subs
+	g.m.Unlock()
+	for _, s := range subs {
+		s.fn(c)
+	}
+}
+
+// Subscribe calls fn for every Count that is added to the metric from now on,
+// until the returned cancel function is called. Use it for in-process
+// consumers such as alert evaluators that would otherwise poll the buffer.
+//
+// fn is called synchronously by the goroutine that adds the Count, after
+// the Count is stored. Hand the Count over to a channel or another
+// goroutine if processing takes long.
+func (g *Metric) Subscribe(fn func(Count)) (cancel func()) {
+	s := &subscription{fn: fn}
 	g.m.Lock()
 	defer g.m.Unlock()
-	g.unsorted = true
-	g.list[g.head] = c
-	g.head = (g.head + 1) % len(g.list)
+	g.subs = append(g.subs[:len(g.subs):len(g.subs)], s)
+	return func() {
+		g.m.Lock()
+		defer g.m.Unlock()
+		subs := make([]*subscription, 0, len(g.subs))
+		for _, sub := range g.subs {
+			if sub != s {
+				subs = append(subs, sub)
+			}
+		}
+		g.subs = subs
+	}
 }
 
 // sort sorts the list of metrics by timestamp.
@@ -59,12 +143,12 @@ func (g *Metric) sort() {
 
 	// the ring buffer is unsorted.
 
-	// sooner implements the less func for sort.Slice.
-	sooner := func(i, j int) bool {
-		return g.list[i].T.UnixNano() < g.list[j].T.UnixNano()
+	// Start the list with the oldest slot, and sort stably, so that data
+	// points of the same time stamp stay in the order they were added.
+	if h := g.head % g.list.len(); h > 0 {
+		g.list = g.list.rotate(h)
 	}
-
-	sort.Slice(g.list, sooner)
+	g.list.sortStable()
 	g.head = 0
 	g.unsorted = false
 }
@@ -73,36 +157,9 @@ func (g *Metric) sort() {
 // It extracts all datapoints from g.list that fall within the time range [from, to],
 // with at most maxDataPoints items.
 func (g *Metric) fetchDatapoints(from, to time.Time, maxDataPoints int) *[]row {
-
-	g.m.Lock()
-	defer g.m.Unlock()
-	length := len(g.list)
-
-	g.sort()
-
-	// Stage 1: extract all data points within the given time range.
-	pointsInRange := make([]row, 0, length)
-	for i := 0; i < length; i++ {
-		count := g.list[(i+g.head)%length] // wrap around
-		if count.T.After(from) && count.T.Before(to) {
-			pointsInRange = append(pointsInRange, row{count.N, count.T.UnixNano() / 1000000}) // need ms
-		}
-	}
-
-	points := len(pointsInRange)
-
-	if points <= maxDataPoints {
-		return &pointsInRange
-	}
-
-	// Stage 2: if more data points than requested exist in the time range,
-	// thin out the slice evenly
-	rows := make([]row, maxDataPoints)
-	ratio := float64(len(pointsInRange)) / float64(len(rows))
-	for i := range rows {
-		rows[i] = pointsInRange[int(float64(i)*ratio)]
-	}
-
+	s := series{counts: g.fetchCounts(from, to, maxDataPoints), metric: g}
+	rows := s.rowsOrCounts()
+	s.release()
 	return &rows
 }
 
@@ -111,6 +168,14 @@ func (g *Metric) fetchDatapoints(from, to time.Time, maxDataPoints int) *[]row {
 type metrics struct {
 	m      sync.Mutex
 	metric map[string]*Metric
+	auto   map[string]bool // metrics created on first query, see createAuto
+
+	watchers    map[int]func(MetricEvent) // see Dashboard.Watch
+	nextWatcher int
+
+	wal      *wal            // attached to every metric, see WithWAL
+	lateness time.Duration   // of every metric, see WithLateness
+	dups     DuplicateConfig // of every metric, see WithDuplicates
 }
 
 // Get gets the metric with name "target" from the Metrics map. If a metric of that name
@@ -120,7 +185,7 @@ func (m *metrics) Get(target string) (*Metric, error) {
 	mt, ok := m.metric[target]
 	m.m.Unlock()
 	if !ok {
-		return nil, errors.New("no such metric: " + target)
+		return nil, fmt.Errorf("%w: %s", ErrMetricNotFound, target)
 	}
 	return mt, nil
 }
@@ -129,26 +194,67 @@ func (m *metrics) Get(target string) (*Metric, error) {
 // is an error.
 func (m *metrics) Put(target string, metric *Metric) error {
 	m.m.Lock()
-	defer m.m.Unlock()
+	adopted, err := m.put(target, metric)
+	m.m.Unlock()
+	if err == nil && !adopted {
+		m.notify(MetricEvent{Kind: MetricCreated, Target: target})
+	}
+	return err
+}
 
-	_, exists := m.metric[target]
+// put implements Put. It reports whether it has adopted an auto-created
+// metric. The caller must hold m.m.
+func (m *metrics) put(target string, metric *Metric) (adopted bool, err error) {
+	old, exists := m.metric[target]
 	if exists {
-		return errors.New("metric " + target + " already exists")
+		if !m.auto[target] {
+			return false, fmt.Errorf("%w: %s", ErrMetricExists, target)
+		}
+		// Adopt the auto-created metric, including its data points
+		// and subscriptions.
+		old.m.Lock()
+		old.sort()
+		for i := 0; i < old.list.len(); i++ {
+			c := old.list.at((i + old.head) % old.list.len())
+			if !c.T.IsZero() {
+				metric.AddCount(c)
+			}
+		}
+		metric.subs = old.subs
+		old.m.Unlock()
+		delete(m.auto, target)
+	}
+	if m.wal != nil || m.lateness > 0 || m.dups.Policy != DuplicatesKeepAll {
+		metric.m.Lock()
+		if m.wal != nil {
+			metric.wal, metric.target = m.wal, target
+		}
+		metric.lateness, metric.dups = m.lateness, m.dups
+		metric.m.Unlock()
 	}
 	m.metric[target] = metric
-	return nil
+	return exists, nil
 }
 
 // Delete removes a metric from the Metrics map. Deleting a non-existing
 // metric is an error.
 func (m *metrics) Delete(target string) error {
 	m.m.Lock()
-	defer m.m.Unlock()
-	_, exists := m.metric[target]
+	metric, exists := m.metric[target]
 	if !exists {
-		return errors.New("cannot delete metric: " + target + " does not exist")
+		m.m.Unlock()
+		return fmt.Errorf("cannot delete metric: %w: %s", ErrMetricNotFound, target)
 	}
 	delete(m.metric, target)
+	delete(m.auto, target)
+	metric.m.Lock()
+	if metric.wal != nil {
+		metric.wal.log(appendWALRecord(nil, "delete", target))
+		metric.wal = nil // data points added to the deleted metric are not logged
+	}
+	metric.m.Unlock()
+	m.m.Unlock()
+	m.notify(MetricEvent{Kind: MetricDeleted, Target: target})
 	return nil
 }
 
@@ -156,9 +262,62 @@ func (m *metrics) Delete(target string) error {
 // and adds it to the Metrics map.
 // If a metric for target "target" exists already, Create returns an error.
 func (m *metrics) Create(target string, size int) (*Metric, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrBufferSize, size)
+	}
 	metric := &Metric{
-		list: make([]Count, size, size),
+		list: newCountBuffer(size),
 	}
 	err := m.Put(target, metric)
 	return metric, err
 }
+
+// getOrCreate returns the metric for target. If no metric exists, it
+// creates one like createAuto, with a buffer size of DefaultAutoCreateSize.
+// Lookup and creation happen under one lock, so that a concurrent Delete
+// cannot make getOrCreate return nil.
+func (m *metrics) getOrCreate(target string) *Metric {
+	m.m.Lock()
+	metric, exists := m.metric[target]
+	if !exists {
+		metric = m.newAuto(target, DefaultAutoCreateSize)
+	}
+	m.m.Unlock()
+	if !exists {
+		m.notify(MetricEvent{Kind: MetricCreated, Target: target})
+	}
+	return metric
+}
+
+// createAuto creates a metric like Create, but marks it as auto-created.
+// A later Put or Create for the same target adopts an auto-created metric
+// instead of failing.
+func (m *metrics) createAuto(target string, size int) (*Metric, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrBufferSize, size)
+	}
+	m.m.Lock()
+	if _, exists := m.metric[target]; exists {
+		m.m.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrMetricExists, target)
+	}
+	metric := m.newAuto(target, size)
+	m.m.Unlock()
+	m.notify(MetricEvent{Kind: MetricCreated, Target: target})
+	return metric, nil
+}
+
+// newAuto adds an auto-created metric for target. The caller must hold m.m.
+func (m *metrics) newAuto(target string, size int) *Metric {
+	metric := &Metric{
+		list: newCountBuffer(size),
+	}
+	metric.wal, metric.target = m.wal, target
+	metric.lateness, metric.dups = m.lateness, m.dups
+	m.metric[target] = metric
+	if m.auto == nil {
+		m.auto = map[string]bool{}
+	}
+	m.auto[target] = true
+	return metric
+}
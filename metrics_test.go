@@ -1,6 +1,7 @@
 package grada
 
 import (
+	"math"
 	"sync"
 	"testing"
 	"time"
@@ -10,7 +11,7 @@ import (
 
 func TestMetric_Add(t *testing.T) {
 	type fields struct {
-		list []Count
+		list countBuffer
 		head int
 	}
 	type args struct {
@@ -25,7 +26,7 @@ func TestMetric_Add(t *testing.T) {
 		{
 			name: "target1",
 			fields: fields{
-				list: []Count{{1, time.Now()}, {2, time.Now()}, {3, time.Now()}},
+				list: countBufferOf([]Count{{1, time.Now()}, {2, time.Now()}, {3, time.Now()}}),
 				head: 1},
 			args:    args{n: 4},
 			newHead: 2,
@@ -34,7 +35,7 @@ func TestMetric_Add(t *testing.T) {
 		{
 			name: "target2",
 			fields: fields{
-				list: []Count{{4, time.Now()}, {5, time.Now()}, {6, time.Now()}},
+				list: countBufferOf([]Count{{4, time.Now()}, {5, time.Now()}, {6, time.Now()}}),
 				head: 2},
 			args:    args{n: 7},
 			newHead: 0,
@@ -49,16 +50,39 @@ func TestMetric_Add(t *testing.T) {
 				head: tt.fields.head,
 			}
 			g.Add(tt.args.n)
-			if tt.fields.list[tt.fields.head].N != tt.args.n {
+			if tt.fields.list.at(tt.fields.head).N != tt.args.n {
 				t.Errorf("failed adding %f to metric for target %s", tt.args.n, tt.name)
 			}
 		})
 	}
 }
 
+func TestMetric_Add_afterFuturePoint(t *testing.T) {
+	g := &Metric{list: newCountBuffer(5)}
+	now := time.Now()
+	g.AddWithTime(1, now.Add(-time.Hour))
+	g.AddWithTime(2, now.Add(time.Hour))
+	g.Add(3)
+	g.Add(4)
+	var got []float64
+	for _, c := range g.appendCounts(nil, now.Add(-2*time.Hour), now.Add(2*time.Hour), math.MaxInt) {
+		got = append(got, c.N)
+	}
+	if diff := cmp.Diff([]float64{1, 3, 4, 2}, got); diff != "" {
+		t.Errorf("appendCounts() mismatch (-want +got):\n%s", diff)
+	}
+	var narrow []float64
+	for _, c := range g.appendCounts(nil, now.Add(-2*time.Hour), now.Add(time.Minute), math.MaxInt) {
+		narrow = append(narrow, c.N)
+	}
+	if diff := cmp.Diff([]float64{1, 3, 4}, narrow); diff != "" {
+		t.Errorf("appendCounts() of a narrower range mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestMetric_AddWithTime(t *testing.T) {
 	type fields struct {
-		list []Count
+		list countBuffer
 		head int
 	}
 	type args struct {
@@ -74,7 +98,7 @@ func TestMetric_AddWithTime(t *testing.T) {
 		{
 			name: "target1",
 			fields: fields{
-				list: []Count{{1, time.Now()}, {2, time.Now()}, {3, time.Now()}},
+				list: countBufferOf([]Count{{1, time.Now()}, {2, time.Now()}, {3, time.Now()}}),
 				head: 1},
 			args:    args{n: 4, t: time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)},
 			newHead: 2,
@@ -83,7 +107,7 @@ func TestMetric_AddWithTime(t *testing.T) {
 		{
 			name: "target2",
 			fields: fields{
-				list: []Count{{4, time.Now()}, {5, time.Now()}, {6, time.Now()}},
+				list: countBufferOf([]Count{{4, time.Now()}, {5, time.Now()}, {6, time.Now()}}),
 				head: 2},
 			args:    args{n: 7, t: time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)},
 			newHead: 0,
@@ -97,10 +121,10 @@ func TestMetric_AddWithTime(t *testing.T) {
 				head: tt.fields.head,
 			}
 			g.AddWithTime(tt.args.n, tt.args.t)
-			if tt.fields.list[tt.fields.head].N != tt.args.n {
+			if tt.fields.list.at(tt.fields.head).N != tt.args.n {
 				t.Errorf("failed adding %f to metric for target %s", tt.args.n, tt.name)
 			}
-			if tt.fields.list[tt.fields.head].T != tt.args.t {
+			if !tt.fields.list.at(tt.fields.head).T.Equal(tt.args.t) {
 				t.Errorf("failed adding time %s to metric for target %s", tt.args.t.String(), tt.name)
 			}
 		})
@@ -109,7 +133,7 @@ func TestMetric_AddWithTime(t *testing.T) {
 
 func TestMetric_AddCount(t *testing.T) {
 	type fields struct {
-		list []Count
+		list countBuffer
 		head int
 	}
 	type args struct {
@@ -124,7 +148,7 @@ func TestMetric_AddCount(t *testing.T) {
 		{
 			name: "target1",
 			fields: fields{
-				list: []Count{{1, time.Now()}, {2, time.Now()}, {3, time.Now()}},
+				list: countBufferOf([]Count{{1, time.Now()}, {2, time.Now()}, {3, time.Now()}}),
 				head: 1},
 			args:    args{c: Count{N: 4, T: time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)}},
 			newHead: 2,
@@ -133,7 +157,7 @@ func TestMetric_AddCount(t *testing.T) {
 		{
 			name: "target2",
 			fields: fields{
-				list: []Count{{4, time.Now()}, {5, time.Now()}, {6, time.Now()}},
+				list: countBufferOf([]Count{{4, time.Now()}, {5, time.Now()}, {6, time.Now()}}),
 				head: 2},
 			args:    args{c: Count{N: 7, T: time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)}},
 			newHead: 0,
@@ -147,10 +171,10 @@ func TestMetric_AddCount(t *testing.T) {
 				head: tt.fields.head,
 			}
 			g.AddCount(tt.args.c)
-			if got := tt.fields.list[tt.fields.head].N; got != tt.args.c.N {
+			if got := tt.fields.list.at(tt.fields.head).N; got != tt.args.c.N {
 				t.Errorf("AddCount(%f, %s) failed for %s", tt.args.c.N, tt.args.c.T.String(), tt.name, got)
 			}
-			if got := tt.fields.list[tt.fields.head].T; got != tt.args.c.T {
+			if got := tt.fields.list.at(tt.fields.head).T; !got.Equal(tt.args.c.T) {
 				t.Errorf("AddCount(%f, %s) failed for %s - got ", tt.args.c.N, tt.args.c.T.String(), tt.name, got)
 			}
 		})
@@ -159,7 +183,7 @@ func TestMetric_AddCount(t *testing.T) {
 
 func TestMetric_fetchDatapoints(t *testing.T) {
 	type fields struct {
-		list []Count
+		list countBuffer
 		head int
 	}
 
@@ -179,7 +203,7 @@ func TestMetric_fetchDatapoints(t *testing.T) {
 	}{
 		{
 			"fetchAll",
-			fields{[]Count{{3, t3}, {1, t1}, {2, t2}}, 1},
+			fields{countBufferOf([]Count{{3, t3}, {1, t1}, {2, t2}}), 1},
 			time.Date(2017, time.October, 25, 11, 15, 54, 0, time.UTC),
 			time.Date(2017, time.October, 25, 11, 20, 54, 0, time.UTC),
 			3,
@@ -187,7 +211,7 @@ func TestMetric_fetchDatapoints(t *testing.T) {
 		},
 		{
 			"fetchTimeRange",
-			fields{[]Count{{3, t3}, {1, t1}, {2, t2}}, 1},
+			fields{countBufferOf([]Count{{3, t3}, {1, t1}, {2, t2}}), 1},
 			time.Date(2017, time.October, 25, 11, 17, 00, 0, time.UTC),
 			time.Date(2017, time.October, 25, 11, 20, 54, 0, time.UTC),
 			3,
@@ -195,7 +219,7 @@ func TestMetric_fetchDatapoints(t *testing.T) {
 		},
 		{
 			"fetchMaxPoints",
-			fields{[]Count{{3, t3}, {1, t1}, {2, t2}}, 1},
+			fields{countBufferOf([]Count{{3, t3}, {1, t1}, {2, t2}}), 1},
 			time.Date(2017, time.October, 25, 11, 15, 00, 0, time.UTC),
 			time.Date(2017, time.October, 25, 11, 20, 00, 0, time.UTC),
 			2,
@@ -229,7 +253,7 @@ func TestMetrics_Get(t *testing.T) {
 	t2 := time.Date(2017, time.October, 25, 11, 17, 54, 0, time.UTC)
 	t3 := time.Date(2017, time.October, 25, 11, 18, 54, 0, time.UTC)
 
-	metric := &Metric{sync.Mutex{}, []Count{{3, t3}, {1, t1}, {2, t2}}, 1, false}
+	metric := &Metric{m: sync.Mutex{}, list: countBufferOf([]Count{{3, t3}, {1, t1}, {2, t2}}), head: 1, unsorted: false}
 
 	tests := []struct {
 		name    string
@@ -275,7 +299,7 @@ func TestMetrics_Put(t *testing.T) {
 	t1 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
 	t2 := time.Date(2017, time.October, 25, 11, 17, 54, 0, time.UTC)
 	t3 := time.Date(2017, time.October, 25, 11, 18, 54, 0, time.UTC)
-	metric := &Metric{sync.Mutex{}, []Count{{3, t3}, {1, t1}, {2, t2}}, 1, false}
+	metric := &Metric{m: sync.Mutex{}, list: countBufferOf([]Count{{3, t3}, {1, t1}, {2, t2}}), head: 1, unsorted: false}
 
 	tests := []struct {
 		name    string
@@ -317,7 +341,7 @@ func TestMetrics_Delete(t *testing.T) {
 	t1 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
 	t2 := time.Date(2017, time.October, 25, 11, 17, 54, 0, time.UTC)
 	t3 := time.Date(2017, time.October, 25, 11, 18, 54, 0, time.UTC)
-	metric := &Metric{sync.Mutex{}, []Count{{3, t3}, {1, t1}, {2, t2}}, 1, false}
+	metric := &Metric{m: sync.Mutex{}, list: countBufferOf([]Count{{3, t3}, {1, t1}, {2, t2}}), head: 1, unsorted: false}
 
 	tests := []struct {
 		name    string
@@ -386,8 +410,8 @@ func TestMetrics_Create(t *testing.T) {
 			if !cmp.Equal(got, want, cmp.AllowUnexported((*got), (*got).m)) {
 				t.Errorf("Metrics.Create():\ngot  %v\nwant %v\ndiff:\n%s", got, want, cmp.Diff(got, want, cmp.AllowUnexported(*got, (*got).m)))
 			}
-			if cap(got.list) != tt.args.size {
-				t.Errorf("Metrics.Create(): got size %d, want %d", cap(got.list), tt.args.size)
+			if got.list.len() != tt.args.size {
+				t.Errorf("Metrics.Create(): got size %d, want %d", got.list.len(), tt.args.size)
 			}
 		})
 	}
@@ -483,12 +507,12 @@ func TestMetric_sort(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			g := &Metric{
-				list:     tt.fields.list,
+				list:     countBufferOf(tt.fields.list),
 				head:     tt.fields.head,
 				unsorted: tt.fields.unsorted,
 			}
 			g.sort()
-			got := g.list
+			got := g.list.counts()
 			want := tt.want.list
 			if !cmp.Equal(got, want) {
 				t.Errorf("Metric.sort(): got %v,\nwant %v\ndiff:\n%s", got, want, cmp.Diff(got, want))
@@ -496,3 +520,22 @@ func TestMetric_sort(t *testing.T) {
 		})
 	}
 }
+
+func TestMetric_Subscribe(t *testing.T) {
+	g := &Metric{list: newCountBuffer(2)}
+	var got1, got2 []float64
+	cancel1 := g.Subscribe(func(c Count) { got1 = append(got1, c.N) })
+	g.Subscribe(func(c Count) { got2 = append(got2, c.N) })
+
+	g.Add(1)
+	g.AddWithTime(2, time.Now())
+	cancel1()
+	g.AddCount(Count{3, time.Now()})
+
+	if !cmp.Equal(got1, []float64{1, 2}) {
+		t.Errorf("canceled subscriber got %v, want [1 2]", got1)
+	}
+	if !cmp.Equal(got2, []float64{1, 2, 3}) {
+		t.Errorf("subscriber got %v, want [1 2 3]", got2)
+	}
+}
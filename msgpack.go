@@ -0,0 +1,339 @@
+package grada
+
+// A minimal MessagePack encoder and decoder for the push and export endpoints.
+// See https://github.com/msgpack/msgpack/blob/master/spec.md for the format.
+//
+// The decoder produces nil, bool, int64, uint64, float64, string, []byte,
+// time.Time (timestamp extension), []interface{}, and map[string]interface{} values.
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+// maxMsgpackDepth bounds the nesting of arrays and maps, so that deeply
+// nested input cannot exhaust the stack of the recursive decoder.
+const maxMsgpackDepth = 32
+
+// isMsgpack reports whether the request body is MessagePack-encoded.
+func isMsgpack(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt == "application/msgpack" || mt == "application/x-msgpack"
+}
+
+// wantsMsgpack reports whether the client asked for a MessagePack response.
+func wantsMsgpack(r *http.Request) bool {
+	return accepts(r, "application/msgpack", "application/x-msgpack")
+}
+
+func appendMsgpackNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func appendMsgpackFloat(b []byte, f float64) []byte {
+	b = append(b, 0xcb)
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+}
+
+// appendMsgpackRows appends data points as an array of [value, time] arrays,
+// mirroring the JSON encoding of Grafana's datapoints.
+func appendMsgpackRows(b []byte, rows []row) []byte {
+	b = appendMsgpackArrayHeader(b, len(rows))
+	for _, r := range rows {
+		b = append(b, 0x92)
+		b = appendMsgpackFloat(b, r[0].(float64))
+		b = appendMsgpackInt(b, r[1].(int64))
+	}
+	return b
+}
+
+// msgpackDecoder decodes a MessagePack byte slice.
+type msgpackDecoder struct {
+	b     []byte
+	depth int // of the arrays and maps being decoded
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.b) < n {
+		return nil, errMsgpackShort
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p, nil
+}
+
+// uint reads an n-byte big-endian unsigned integer.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range p {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// decode decodes the next value.
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return d.mapping(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if u <= math.MaxInt64 {
+			return int64(u), err
+		}
+		return u, err
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.next(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapping(int(n))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(int(n))
+	}
+	return nil, errors.New("msgpack: unsupported type 0x" + strconv.FormatUint(uint64(c), 16))
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(p), nil
+}
+
+// enter returns an error if another array or map would exceed
+// maxMsgpackDepth. Callers that succeed must call d.leave.
+func (d *msgpackDecoder) enter() error {
+	if d.depth >= maxMsgpackDepth {
+		return errors.New("msgpack: nesting exceeds " + strconv.Itoa(maxMsgpackDepth) + " levels")
+	}
+	d.depth++
+	return nil
+}
+
+func (d *msgpackDecoder) leave() { d.depth-- }
+
+func (d *msgpackDecoder) array(n int) (interface{}, error) {
+	if n > len(d.b) {
+		return nil, errMsgpackShort // each element needs at least one byte
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) mapping(n int) (interface{}, error) {
+	if 2*n > len(d.b) {
+		return nil, errMsgpackShort
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.New("msgpack: map keys must be strings")
+		}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// ext decodes an extension value with a data length of n bytes.
+// Only the timestamp extension (type -1) is supported.
+func (d *msgpackDecoder) ext(n int) (interface{}, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	if int8(p[0]) != -1 {
+		return nil, errors.New("msgpack: unsupported extension type " + strconv.Itoa(int(int8(p[0]))))
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&0x3ffffffff), int64(u>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))), nil
+	}
+	return nil, errors.New("msgpack: invalid timestamp length")
+}
+
+// decodeMsgpack decodes a single MessagePack value from b.
+func decodeMsgpack(b []byte) (interface{}, error) {
+	d := &msgpackDecoder{b: b}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if len(d.b) > 0 {
+		return nil, errors.New("msgpack: trailing data")
+	}
+	return v, nil
+}
+
+// msgpackFloat converts a decoded numeric value to float64.
+func msgpackFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
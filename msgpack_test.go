@@ -0,0 +1,84 @@
+package grada
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAppendMsgpackInt(t *testing.T) {
+	tests := []struct {
+		name string
+		i    int64
+		want []byte
+	}{
+		{"fixint", 5, []byte{0x05}},
+		{"negFixint", -3, []byte{0xfd}},
+		{"int8", -100, []byte{0xd0, 0x9c}},
+		{"int16", 1000, []byte{0xd1, 0x03, 0xe8}},
+		{"int32", 100000, []byte{0xd2, 0x00, 0x01, 0x86, 0xa0}},
+		{"int64", 1508929014000, []byte{0xd3, 0, 0, 0x01, 0x5f, 0x53, 0x2d, 0x88, 0xf0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendMsgpackInt(nil, tt.i)
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("appendMsgpackInt(%d) = % x, want % x", tt.i, got, tt.want)
+			}
+			v, err := decodeMsgpack(got)
+			if err != nil || v != tt.i {
+				t.Errorf("decodeMsgpack(% x) = %v, %v, want %d", got, v, err, tt.i)
+			}
+		})
+	}
+}
+
+func TestDecodeMsgpack(t *testing.T) {
+	var b []byte
+	b = appendMsgpackArrayHeader(b, 1)
+	b = appendMsgpackMapHeader(b, 3)
+	b = appendMsgpackString(b, "target")
+	b = appendMsgpackString(b, "cpu")
+	b = appendMsgpackString(b, "value")
+	b = appendMsgpackFloat(b, 0.5)
+	b = appendMsgpackString(b, "time")
+	b = append(b, 0xd6, 0xff, 0x59, 0xf0, 0x6f, 0x76) // timestamp 32
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			"samples",
+			b,
+			[]interface{}{map[string]interface{}{
+				"target": "cpu",
+				"value":  0.5,
+				"time":   time.Unix(1508929398, 0),
+			}},
+			false,
+		},
+		{"nil", []byte{0xc0}, nil, false},
+		{"bool", []byte{0xc3}, true, false},
+		{"truncated", b[:len(b)-1], nil, true},
+		{"trailing", []byte{0xc0, 0xc0}, nil, true},
+		{"badKey", []byte{0x81, 0x01, 0x01}, nil, true},
+		{"tooDeep", append(bytes.Repeat([]byte{0x91}, maxMsgpackDepth+1), 0xc0), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMsgpack(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeMsgpack() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("decodeMsgpack():\ngot  %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package grada
+
+// Content negotiation of /query and /export responses.
+//
+// Clients other than Grafana can ask for another format than JSON with
+// the Accept header:
+//
+//	application/x-ndjson  one JSON object per line: a data point
+//	                      {"target": "cpu", "time": 1508929200000, "value": 0.5},
+//	                      or a table row {"<column>": <value>, ...}
+//	text/csv              a header line and one line per data point,
+//	                      target,time,value, or per table row, with the
+//	                      column names as the header of each table
+//
+// Times are Unix milliseconds in NDJSON, like in JSON, and RFC 3339 in
+// CSV, like in /csv. The tables of a CSV response are separated by an
+// empty line. /query also serves protobuf (see protobuf.go), and /export
+// MessagePack (see msgpack.go).
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Response formats other than JSON.
+const (
+	formatProtobuf = "protobuf"
+	formatNDJSON   = "ndjson"
+	formatCSV      = "csv"
+	formatFrames   = "frames" // JSON with data frames, see fieldconfig.go
+)
+
+// responseFormat returns the format that the Accept header of r asks
+// for, or "" for JSON. JSON responses that may contain data frames are
+// formatFrames.
+func responseFormat(r *http.Request) string {
+	switch {
+	case wantsProtobuf(r):
+		return formatProtobuf
+	case accepts(r, "application/x-ndjson", "application/ndjson"):
+		return formatNDJSON
+	case accepts(r, "text/csv"):
+		return formatCSV
+	case wantsFrames(r):
+		return formatFrames
+	}
+	return ""
+}
+
+// pointRecord is a line of an NDJSON time series response.
+type pointRecord struct {
+	Target string      `json:"target"`
+	Time   interface{} `json:"time"`
+	Value  interface{} `json:"value"`
+}
+
+// writeSeriesText writes the time series list in the NDJSON or CSV
+// format.
+func writeSeriesText(w http.ResponseWriter, format string, list []timeseriesResponse) {
+	var b bytes.Buffer
+	if format == formatNDJSON {
+		enc := json.NewEncoder(&b)
+		for _, s := range list {
+			for _, p := range s.Datapoints {
+				value := p[0]
+				if f, ok := value.(float64); ok {
+					value = json.RawMessage(appendJSONFloat(nil, f)) // NaN and infinities become null
+				}
+				if err := enc.Encode(pointRecord{s.Target, p[1], value}); err != nil {
+					writeError(w, http.StatusInternalServerError, err, "cannot encode data point of "+s.Target)
+					return
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write(b.Bytes())
+		return
+	}
+	cw := csv.NewWriter(&b)
+	cw.Write([]string{"target", "time", "value"})
+	for _, s := range list {
+		for _, p := range s.Datapoints {
+			ms, _ := p[1].(int64)
+			cw.Write([]string{s.Target, time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), csvCell(p[0])})
+		}
+	}
+	cw.Flush()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// writeTablesText writes the tables in the NDJSON or CSV format.
+func writeTablesText(w http.ResponseWriter, format string, tables []tableResponse) {
+	var b bytes.Buffer
+	if format == formatNDJSON {
+		for _, t := range tables {
+			for _, r := range t.Rows {
+				b.WriteByte('{')
+				for j, v := range r {
+					if j >= len(t.Columns) {
+						break
+					}
+					if j > 0 {
+						b.WriteByte(',')
+					}
+					k, _ := json.Marshal(t.Columns[j].Text)
+					e, err := json.Marshal(v)
+					if err != nil {
+						e = []byte("null")
+					}
+					b.Write(k)
+					b.WriteByte(':')
+					b.Write(e)
+				}
+				b.WriteString("}\n")
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write(b.Bytes())
+		return
+	}
+	cw := csv.NewWriter(&b)
+	for i, t := range tables {
+		if i > 0 {
+			cw.Flush()
+			b.WriteString("\n")
+		}
+		header := make([]string, len(t.Columns))
+		for j, c := range t.Columns {
+			header[j] = c.Text
+		}
+		cw.Write(header)
+		for _, r := range t.Rows {
+			record := make([]string, len(r))
+			for j, v := range r {
+				record[j] = csvCell(v)
+			}
+			cw.Write(record)
+		}
+	}
+	cw.Flush()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// csvCell formats a value of a data point or a table cell for CSV.
+func csvCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "" // like null in JSON
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case json.RawMessage:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
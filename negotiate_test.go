@@ -0,0 +1,79 @@
+package grada
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_contentNegotiation(t *testing.T) {
+	d := NewDashboard()
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	m.AddWithTime(0.5, t0)
+	m.AddWithTime(1.5, t0.Add(time.Second))
+	nan, _ := d.CreateMetricWithBufSize("nan", 10)
+	nan.AddWithTime(math.NaN(), t0)
+	d.CreateStaticTable("hosts", &Table{
+		Columns: []Column{{Text: "host", Type: "string"}, {Text: "load", Type: "number"}},
+		Rows:    [][]interface{}{{"web-1", 0.25}, {"db, primary", 1.5}},
+	})
+	query := func(target, typ string) string {
+		return `{"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"maxDataPoints":100,` +
+			`"targets":[{"target":"` + target + `","type":"` + typ + `"}]}`
+	}
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		accept   string
+		wantType string
+		want     string
+	}{
+		{"query JSON", "POST", "/query", query("cpu", "timeserie"), "", "application/json",
+			`[{"target":"cpu","datapoints":[[0.5,1508930214000],[1.5,1508930215000]]}]`},
+		{"query NDJSON", "POST", "/query", query("cpu", "timeserie"), "application/x-ndjson", "application/x-ndjson",
+			`{"target":"cpu","time":1508930214000,"value":0.5}` + "\n" + `{"target":"cpu","time":1508930215000,"value":1.5}` + "\n"},
+		{"query CSV", "POST", "/query", query("cpu", "timeserie"), "text/csv, application/json;q=0.5", "text/csv; charset=utf-8",
+			"target,time,value\ncpu,2017-10-25T11:16:54Z,0.5\ncpu,2017-10-25T11:16:55Z,1.5\n"},
+		{"query NDJSON NaN", "POST", "/query", query("nan", "timeserie"), "application/x-ndjson", "application/x-ndjson",
+			`{"target":"nan","time":1508930214000,"value":null}` + "\n"},
+		{"query CSV NaN", "POST", "/query", query("nan", "timeserie"), "text/csv", "text/csv; charset=utf-8",
+			"target,time,value\nnan,2017-10-25T11:16:54Z,\n"},
+		{"table NDJSON", "POST", "/query", query("hosts", "table"), "application/x-ndjson", "application/x-ndjson",
+			`{"host":"web-1","load":0.25}` + "\n" + `{"host":"db, primary","load":1.5}` + "\n"},
+		{"table CSV", "POST", "/query", query("hosts", "table"), "text/csv", "text/csv; charset=utf-8",
+			"host,load\nweb-1,0.25\n\"db, primary\",1.5\n"},
+		{"table protobuf", "POST", "/query", query("hosts", "table"), "application/x-protobuf", "application/json",
+			`[{"columns":[{"text":"host","type":"string"},{"text":"load","type":"number"}],"rows":[["web-1",0.25],["db, primary",1.5]],"type":"table"}]`},
+		{"export NDJSON", "GET", "/export?target=cpu", "", "application/x-ndjson", "application/x-ndjson",
+			`{"target":"cpu","time":1508930214000,"value":0.5}` + "\n" + `{"target":"cpu","time":1508930215000,"value":1.5}` + "\n"},
+		{"export CSV", "GET", "/export?target=cpu", "", "text/csv", "text/csv; charset=utf-8",
+			"target,time,value\ncpu,2017-10-25T11:16:54Z,0.5\ncpu,2017-10-25T11:16:55Z,1.5\n"},
+		{"export refused CSV", "GET", "/export?target=cpu", "", "text/csv;q=0", "application/json",
+			`{"target":"cpu","datapoints":[[0.5,1508930214000],[1.5,1508930215000]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, r)
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantType)
+			}
+			got := w.Body.String()
+			if tt.wantType == "application/json" {
+				got = strings.TrimSpace(got)
+			}
+			if got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
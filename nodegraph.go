@@ -0,0 +1,130 @@
+package grada
+
+// Node graph targets for Grafana's node graph panel.
+
+import (
+	"sort"
+	"time"
+)
+
+// Node is a node of a node graph, such as a service.
+type Node struct {
+	ID            string
+	Title         string
+	Subtitle      string
+	MainStat      float64
+	SecondaryStat float64
+	Color         string             // optional
+	Arcs          map[string]float64 // fractions of the node circle per name; should add up to 1
+	Details       map[string]string  // shown in the node's context menu
+}
+
+// Edge is a directed edge of a node graph, such as calls between services.
+type Edge struct {
+	ID            string
+	Source        string // ID of the source node
+	Target        string // ID of the target node
+	MainStat      float64
+	SecondaryStat float64
+}
+
+// NodeGraphSource provides the nodes and edges of a node graph for
+// the time range of a query.
+type NodeGraphSource interface {
+	NodeGraph(from, to time.Time) ([]Node, []Edge, error)
+}
+
+// NodeGraphFunc is an adapter that makes a function a NodeGraphSource.
+type NodeGraphFunc func(from, to time.Time) ([]Node, []Edge, error)
+
+// NodeGraph calls f(from, to).
+func (f NodeGraphFunc) NodeGraph(from, to time.Time) ([]Node, []Edge, error) {
+	return f(from, to)
+}
+
+// CreateNodeGraph creates a node graph target. Queried with the "table"
+// format, the target returns the two tables "nodes" and "edges" that
+// Grafana's node graph panel expects.
+//
+// Creating a node graph for an existing target fails with ErrMetricExists.
+func (d *Dashboard) CreateNodeGraph(target string, src NodeGraphSource) error {
+	return d.srv.addTables(target, func(from, to time.Time) ([]*Table, error) {
+		nodes, edges, err := src.NodeGraph(from, to)
+		if err != nil {
+			return nil, err
+		}
+		return []*Table{nodesTable(nodes), edgesTable(edges)}, nil
+	})
+}
+
+// nodesTable converts nodes into a table in the node graph format.
+// Optional columns appear only if at least one node has a value for them.
+func nodesTable(nodes []Node) *Table {
+	var arcs, details []string
+	hasColor := false
+	seen := map[string]bool{}
+	for _, n := range nodes {
+		for k := range n.Arcs {
+			if !seen["arc__"+k] {
+				seen["arc__"+k] = true
+				arcs = append(arcs, k)
+			}
+		}
+		for k := range n.Details {
+			if !seen["detail__"+k] {
+				seen["detail__"+k] = true
+				details = append(details, k)
+			}
+		}
+		hasColor = hasColor || n.Color != ""
+	}
+	sort.Strings(arcs)
+	sort.Strings(details)
+
+	t := &Table{Name: "nodes", Columns: []Column{
+		{Text: "id", Type: ColumnString},
+		{Text: "title", Type: ColumnString},
+		{Text: "subtitle", Type: ColumnString},
+		{Text: "mainstat", Type: ColumnNumber},
+		{Text: "secondarystat", Type: ColumnNumber},
+	}}
+	if hasColor {
+		t.Columns = append(t.Columns, Column{Text: "color", Type: ColumnString})
+	}
+	for _, k := range arcs {
+		t.Columns = append(t.Columns, Column{Text: "arc__" + k, Type: ColumnNumber})
+	}
+	for _, k := range details {
+		t.Columns = append(t.Columns, Column{Text: "detail__" + k, Type: ColumnString})
+	}
+
+	for _, n := range nodes {
+		r := []interface{}{n.ID, n.Title, n.Subtitle, n.MainStat, n.SecondaryStat}
+		if hasColor {
+			r = append(r, n.Color)
+		}
+		for _, k := range arcs {
+			r = append(r, n.Arcs[k])
+		}
+		for _, k := range details {
+			r = append(r, n.Details[k])
+		}
+		t.Rows = append(t.Rows, r)
+	}
+	return t
+}
+
+// edgesTable converts edges into a table in the node graph format.
+func edgesTable(edges []Edge) *Table {
+	t := &Table{Name: "edges", Columns: []Column{
+		{Text: "id", Type: ColumnString},
+		{Text: "source", Type: ColumnString},
+		{Text: "target", Type: ColumnString},
+		{Text: "mainstat", Type: ColumnNumber},
+		{Text: "secondarystat", Type: ColumnNumber},
+	}}
+	for _, e := range edges {
+		t.Rows = append(t.Rows, []interface{}{e.ID, e.Source, e.Target, e.MainStat, e.SecondaryStat})
+	}
+	return t
+}
@@ -0,0 +1,37 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard_CreateNodeGraph(t *testing.T) {
+	d := NewDashboard()
+	err := d.CreateNodeGraph("topology", NodeGraphFunc(func(from, to time.Time) ([]Node, []Edge, error) {
+		return []Node{
+			{ID: "api", Title: "API", MainStat: 120, Arcs: map[string]float64{"ok": 0.9, "errors": 0.1}},
+			{ID: "db", Title: "DB", Details: map[string]string{"version": "15"}},
+		}, []Edge{
+			{ID: "api-db", Source: "api", Target: "db", MainStat: 80},
+		}, nil
+	}))
+	if err != nil {
+		t.Fatalf("CreateNodeGraph(): %v", err)
+	}
+
+	body := `{"targets": [{"target": "topology", "type": "table"}]}`
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	want := `[{"name":"nodes","columns":[{"text":"id","type":"string"},{"text":"title","type":"string"},{"text":"subtitle","type":"string"},` +
+		`{"text":"mainstat","type":"number"},{"text":"secondarystat","type":"number"},` +
+		`{"text":"arc__errors","type":"number"},{"text":"arc__ok","type":"number"},{"text":"detail__version","type":"string"}],` +
+		`"rows":[["api","API","",120,0,0.1,0.9,""],["db","DB","",0,0,0,0,"15"]],"type":"table"},` +
+		`{"name":"edges","columns":[{"text":"id","type":"string"},{"text":"source","type":"string"},{"text":"target","type":"string"},` +
+		`{"text":"mainstat","type":"number"},{"text":"secondarystat","type":"number"}],` +
+		`"rows":[["api-db","api","db",80,0]],"type":"table"}]`
+	if w.Body.String() != want {
+		t.Errorf("/query:\ngot  %s\nwant %s", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,61 @@
+package grada
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Option configures the server of a dashboard. Pass options to GetDashboard().
+type Option func(*server)
+
+// WithH2C enables HTTP/2 over cleartext TCP ("h2c") in addition to HTTP/1.1.
+//
+// Reverse proxies and Grafana backends that speak h2c can then multiplex
+// many panel queries over a single connection, which reduces connection
+// churn during dashboard refreshes. Clients must use "prior knowledge" h2c;
+// HTTP/1.1 upgrade requests are not supported.
+func WithH2C() Option {
+	return func(srv *server) {
+		srv.h2c = true
+	}
+}
+
+// WithPathPrefix mounts all endpoints under the given path prefix,
+// for deployments behind a reverse proxy that forwards, say, /grada/
+// to the grada server without rewriting the path.
+// Set the URL of the Grafana data source to include the prefix.
+//
+// Requests outside the prefix receive a 404 Not Found response.
+func WithPathPrefix(prefix string) Option {
+	return func(srv *server) {
+		prefix = strings.TrimRight(prefix, "/")
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		srv.prefix = prefix
+	}
+}
+
+// stripPrefix serves requests for paths below prefix by passing them
+// to h with the prefix removed. A request for the prefix itself is
+// passed on as a request for "/".
+func stripPrefix(prefix string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		if len(p) == len(r.URL.Path) || (p != "" && p[0] != '/') {
+			writeError(w, http.StatusNotFound, nil, "no such endpoint")
+			return
+		}
+		if p == "" {
+			p = "/"
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,96 @@
+package grada
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithH2C(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantProto int
+	}{
+		{"http1", nil, 1},
+		{"h2c", []Option{WithH2C()}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(tt.opts...)
+			ts := httptest.NewUnstartedServer(nil)
+			ts.Config = srv.newHTTPServer("")
+			ts.Start()
+			defer ts.Close()
+
+			tr := &http.Transport{Protocols: &http.Protocols{}}
+			tr.Protocols.SetHTTP1(tt.wantProto == 1)
+			tr.Protocols.SetUnencryptedHTTP2(tt.wantProto == 2)
+			resp, err := (&http.Client{Transport: tr}).Get(ts.URL + "/")
+			if err != nil {
+				t.Fatalf("GET /: %v", err)
+			}
+			resp.Body.Close()
+			if resp.ProtoMajor != tt.wantProto {
+				t.Errorf("GET /: got HTTP/%d, want HTTP/%d", resp.ProtoMajor, tt.wantProto)
+			}
+		})
+	}
+}
+
+func TestWithPathPrefix(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		path       string
+		wantStatus int
+	}{
+		{"root", "/grada", "/grada", 200},
+		{"rootSlash", "/grada/", "/grada/", 200},
+		{"endpoint", "grada", "/grada/csv", 400}, // reaches the handler, which wants a target
+		{"outside", "/grada", "/csv", 404},
+		{"similar", "/grada", "/gradax/csv", 404},
+		{"noPrefix", "", "/csv", 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(WithPathPrefix(tt.prefix))
+			w := httptest.NewRecorder()
+			srv.handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("GET %s with prefix %q: status %d, want %d", tt.path, tt.prefix, w.Code, tt.wantStatus)
+			}
+			var e errorResponse
+			if w.Code == 404 && (json.Unmarshal(w.Body.Bytes(), &e) != nil || e.Error == "") {
+				t.Errorf("GET %s with prefix %q: body %q, want a JSON error", tt.path, tt.prefix, w.Body)
+			}
+		})
+	}
+}
+
+func TestServer_configure(t *testing.T) {
+	pool := x509.NewCertPool()
+	srv := newServer(WithClientCerts(pool, nil), WithH2C())
+	hs := &http.Server{
+		ReadTimeout: time.Second,
+		TLSConfig:   &tls.Config{MinVersion: tls.VersionTLS13},
+	}
+	srv.configure(hs)
+
+	if hs.Handler == nil {
+		t.Errorf("handler not installed")
+	}
+	if hs.ReadTimeout != time.Second || hs.TLSConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("caller settings not preserved")
+	}
+	if hs.TLSConfig.ClientCAs != pool || hs.TLSConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("client certificates not required")
+	}
+	if !hs.Protocols.UnencryptedHTTP2() {
+		t.Errorf("h2c not enabled")
+	}
+}
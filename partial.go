@@ -0,0 +1,72 @@
+package grada
+
+// Partial query results when a query runs out of time.
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PartialHeader is the response header that marks partial query results.
+// Its value is "<targets answered>/<targets requested>".
+const PartialHeader = "X-Grada-Partial"
+
+// WithQueryTimeout sets a deadline for /query requests. When a query with
+// many targets is about to exceed the deadline, the server responds with the
+// targets collected so far, rather than blocking or failing the whole query.
+// Such partial responses carry the header X-Grada-Partial and a Warning header.
+//
+// A deadline of the request context, such as one set by a caller-provided
+// handler, has the same effect.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(srv *server) {
+		srv.queryTimeout = d
+	}
+}
+
+// withQueryTimeout returns r with the query timeout applied to its context.
+func (srv *server) withQueryTimeout(r *http.Request) (*http.Request, context.CancelFunc) {
+	if srv.queryTimeout <= 0 {
+		return r, func() {}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), srv.queryTimeout)
+	return r.WithContext(ctx), cancel
+}
+
+// queryDeadline decides whether a query should stop early.
+type queryDeadline struct {
+	ctx      context.Context
+	start    time.Time
+	deadline time.Time
+	ok       bool // the context has a deadline
+}
+
+func newQueryDeadline(r *http.Request) *queryDeadline {
+	d := &queryDeadline{ctx: r.Context(), start: time.Now()}
+	d.deadline, d.ok = d.ctx.Deadline()
+	return d
+}
+
+// exceeded reports whether the query should stop after done targets:
+// either the context is done, or the time left is less than the average
+// time per target so far.
+func (d *queryDeadline) exceeded(done int) bool {
+	if d.ctx.Err() != nil {
+		return true
+	}
+	if !d.ok || done == 0 {
+		return false
+	}
+	now := time.Now()
+	perTarget := now.Sub(d.start) / time.Duration(done)
+	return d.deadline.Sub(now) < perTarget
+}
+
+// markPartial sets the headers of a partial response.
+func markPartial(w http.ResponseWriter, done, total int) {
+	w.Header().Set(PartialHeader, strconv.Itoa(done)+"/"+strconv.Itoa(total))
+	w.Header().Set("Warning", `199 grada "partial results: query deadline exceeded after `+
+		strconv.Itoa(done)+` of `+strconv.Itoa(total)+` targets"`)
+}
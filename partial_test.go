@@ -0,0 +1,58 @@
+package grada
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_partialResults(t *testing.T) {
+	d := NewDashboard(WithQueryTimeout(100 * time.Millisecond))
+	d.CreateMetricWithBufSize("fast", 1)
+	d.srv.addVirtual("slow", func(from, to time.Time, maxDataPoints int) ([]row, error) {
+		time.Sleep(70 * time.Millisecond)
+		return []row{}, nil
+	})
+
+	tests := []struct {
+		name        string
+		targets     []string
+		wantPartial string
+		wantBody    string
+	}{
+		{"complete", []string{"fast", "slow"}, "", `[{"target":"fast","datapoints":[]},{"target":"slow","datapoints":[]}]`},
+		{"partial", []string{"fast", "slow", "slow", "fast"}, "2/4", `[{"target":"fast","datapoints":[]},{"target":"slow","datapoints":[]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var targets []string
+			for _, target := range tt.targets {
+				targets = append(targets, `{"target": "`+target+`", "type": "timeserie"}`)
+			}
+			body := `{"targets": [` + strings.Join(targets, ",") + `], "maxDataPoints": 10}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			if got := w.Header().Get(PartialHeader); got != tt.wantPartial {
+				t.Errorf("%s = %q, want %q", PartialHeader, got, tt.wantPartial)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body:\ngot  %s\nwant %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestQueryDeadline_exceeded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("POST", "/query", nil).WithContext(ctx)
+	d := newQueryDeadline(r)
+	if d.exceeded(0) {
+		t.Errorf("exceeded() without deadline")
+	}
+	cancel()
+	if !d.exceeded(0) {
+		t.Errorf("exceeded() = false for canceled request")
+	}
+}
@@ -0,0 +1,129 @@
+package grada
+
+// Profiling endpoints for the datasource itself.
+//
+// These handlers mirror net/http/pprof. They are implemented on top of
+// runtime/pprof because importing net/http/pprof would register its
+// handlers on http.DefaultServeMux of every application that imports grada.
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithPprof serves Go profiles under /debug/pprof/, compatible with
+// "go tool pprof", so that performance problems of the datasource can be
+// profiled in production.
+//
+// The endpoints are guarded: they respond with 403 Forbidden unless the
+// server authenticates clients, through WithAuthenticator, WithJWT,
+// or WithClientCerts.
+func WithPprof() Option {
+	return func(srv *server) {
+		srv.pprof = true
+	}
+}
+
+// guarded returns 403 Forbidden for all requests unless the server is
+// configured to authenticate its clients.
+func (srv *server) guarded(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.authenticator == nil && srv.cnAccess == nil {
+			writeError(w, http.StatusForbidden, nil, "this endpoint requires authentication to be configured")
+			return
+		}
+		h(w, r)
+	})
+}
+
+// installPprof adds the profiling endpoints to the server's mux.
+func (srv *server) installPprof() {
+	srv.mux.Handle("/debug/pprof/", srv.guarded(pprofIndex))
+	srv.mux.Handle("/debug/pprof/cmdline", srv.guarded(pprofCmdline))
+	srv.mux.Handle("/debug/pprof/profile", srv.guarded(pprofProfile))
+	srv.mux.Handle("/debug/pprof/trace", srv.guarded(pprofTrace))
+}
+
+// seconds returns the "seconds" parameter of a profiling request.
+func seconds(r *http.Request, def int) int {
+	sec, err := strconv.Atoi(r.FormValue("seconds"))
+	if err != nil || sec <= 0 {
+		return def
+	}
+	return sec
+}
+
+// pprofIndex lists the available profiles, or serves the profile
+// named in the path, such as /debug/pprof/heap.
+func pprofIndex(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+	if name != "" {
+		p := pprof.Lookup(name)
+		if p == nil {
+			http.Error(w, "unknown profile "+name, http.StatusNotFound)
+			return
+		}
+		debug, _ := strconv.Atoi(r.FormValue("debug"))
+		if debug == 0 {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		p.WriteTo(w, debug)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(w, "<html><head><title>/debug/pprof/</title></head><body><ul>")
+	for _, p := range pprof.Profiles() {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(w, "<li><a href=\"%s?debug=1\">%s</a> (%d)</li>\n", name, name, p.Count())
+	}
+	fmt.Fprintln(w, `<li><a href="profile">profile</a> (CPU, 30s)</li>`)
+	fmt.Fprintln(w, `<li><a href="trace?seconds=5">trace</a> (5s)</li>`)
+	fmt.Fprintln(w, "</ul></body></html>")
+}
+
+// pprofCmdline responds with the command line of the running program.
+func pprofCmdline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+}
+
+// pprofProfile responds with a CPU profile over the requested number of seconds.
+func pprofProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		http.Error(w, "cannot start CPU profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	select {
+	case <-time.After(time.Duration(seconds(r, 30)) * time.Second):
+	case <-r.Context().Done():
+	}
+	pprof.StopCPUProfile()
+}
+
+// pprofTrace responds with an execution trace over the requested number of seconds.
+func pprofTrace(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="trace"`)
+	if err := trace.Start(w); err != nil {
+		http.Error(w, "cannot start trace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	select {
+	case <-time.After(time.Duration(seconds(r, 1)) * time.Second):
+	case <-r.Context().Done():
+	}
+	trace.Stop()
+}
@@ -0,0 +1,40 @@
+package grada
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithPprof(t *testing.T) {
+	anyone := AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		return Principal{Name: "anyone"}, nil
+	})
+	tests := []struct {
+		name       string
+		opts       []Option
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"unauthenticated", []Option{WithPprof()}, "/debug/pprof/", 403, ""},
+		{"index", []Option{WithPprof(), WithAuthenticator(anyone)}, "/debug/pprof/", 200, "goroutine"},
+		{"profile", []Option{WithPprof(), WithAuthenticator(anyone)}, "/debug/pprof/goroutine?debug=1", 200, "goroutine profile"},
+		{"unknown", []Option{WithPprof(), WithAuthenticator(anyone)}, "/debug/pprof/nope", 404, ""},
+		{"notMounted", []Option{WithAuthenticator(anyone)}, "/debug/pprof/", 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(tt.opts...)
+			w := httptest.NewRecorder()
+			srv.handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("GET %s: status %d, want %d", tt.path, w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s: body does not contain %q", tt.path, tt.wantBody)
+			}
+		})
+	}
+}
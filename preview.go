@@ -0,0 +1,35 @@
+package grada
+
+// Previews of /query responses.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Preview handles req, the JSON body of a /query request as Grafana posts
+// it, as the dashboard's server would, and returns the JSON body of the
+// response, so that tests and developers can inspect the exact payload
+// without an HTTP round trip. The response cache, query limits, and the
+// targets of other nodes of a cluster apply; authentication and the other
+// request filters do not.
+//
+// If the server would respond with an error, Preview returns an error
+// with the status and the message of the error response.
+func (d *Dashboard) Preview(req []byte) ([]byte, error) {
+	r, err := http.NewRequest("POST", "/query", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	bw := &bufferWriter{header: http.Header{}}
+	d.srv.queryEndpoint()(bw, r)
+	if bw.status != http.StatusOK && bw.status != 0 {
+		var e errorResponse
+		json.Unmarshal(bw.body.Bytes(), &e)
+		return nil, fmt.Errorf("%d %s: %s", bw.status, http.StatusText(bw.status), e.Error)
+	}
+	return bw.body.Bytes(), nil
+}
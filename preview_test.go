@@ -0,0 +1,47 @@
+package grada
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard_Preview(t *testing.T) {
+	d := NewDashboard()
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	m.AddWithTime(0.5, t0)
+	m.AddWithTime(1.5, t0.Add(time.Second))
+	body := func(target, typ string) string {
+		return `{"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"maxDataPoints":100,` +
+			`"targets":[{"target":"` + target + `","refId":"A","type":"` + typ + `"}]}`
+	}
+	tests := []struct {
+		name    string
+		req     string
+		want    string
+		wantErr string
+	}{
+		{"timeserie", body("cpu", "timeserie"), `[{"target":"cpu","datapoints":[[0.5,1508930214000],[1.5,1508930215000]]}]`, ""},
+		{"unknown target", body("nope", "timeserie"), "", "404 Not Found: Cannot get metric for target nope"},
+		{"bad type", body("cpu", "graph"), "", "400 Bad Request: unsupported target type graph"},
+		{"invalid JSON", "{", "", "400 Bad Request: cannot unmarshal request body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Preview([]byte(tt.req))
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("Preview() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Preview() error = %v", err)
+			}
+			if strings.TrimSpace(string(got)) != tt.want {
+				t.Errorf("Preview() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
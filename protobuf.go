@@ -0,0 +1,85 @@
+package grada
+
+// Protobuf encoding of time series responses, for non-Grafana consumers
+// that request "application/x-protobuf". The schema is in query.proto.
+// The few wire-format primitives needed are implemented here to keep
+// grada free of dependencies.
+
+import (
+	"encoding/binary"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// protoWireBytes is the wire type for length-delimited fields.
+const protoWireBytes = 2
+
+// accepts reports whether the Accept header of r explicitly lists one of
+// the given media types with a non-zero quality.
+func accepts(r *http.Request, mediaTypes ...string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok && strings.Trim(q, "0.") == "" {
+			continue // q=0 means "not acceptable"
+		}
+		for _, t := range mediaTypes {
+			if mt == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wantsProtobuf reports whether the client asked for a protobuf response.
+func wantsProtobuf(r *http.Request) bool {
+	return accepts(r, "application/x-protobuf", "application/protobuf")
+}
+
+func appendProtoTag(b []byte, num, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(num<<3|wireType))
+}
+
+func appendProtoBytes(b []byte, num int, v []byte) []byte {
+	b = appendProtoTag(b, num, protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendProtoSeries appends a Series message (without tag and length)
+// for the given target and rows.
+func appendProtoSeries(b []byte, target string, rows []row) []byte {
+	b = appendProtoBytes(b, 1, []byte(target))
+	if len(rows) == 0 {
+		return b
+	}
+
+	// values: packed doubles
+	b = appendProtoTag(b, 2, protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(8*len(rows)))
+	for _, r := range rows {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(r[0].(float64)))
+	}
+
+	// times_ms: packed varints
+	var times []byte
+	for _, r := range rows {
+		times = binary.AppendUvarint(times, uint64(r[1].(int64)))
+	}
+	return appendProtoBytes(b, 3, times)
+}
+
+// marshalProtoTimeseries encodes a time series response as a QueryResponse message.
+func marshalProtoTimeseries(resp []timeseriesResponse) []byte {
+	var b, series []byte
+	for _, ts := range resp {
+		series = appendProtoSeries(series[:0], ts.Target, ts.Datapoints)
+		b = appendProtoBytes(b, 1, series)
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAccepts(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   bool
+	}{
+		{"none", "", false},
+		{"json", "application/json", false},
+		{"protobuf", "application/x-protobuf", true},
+		{"list", "application/json;q=0.9, application/protobuf", true},
+		{"qZero", "application/x-protobuf;q=0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/query", nil)
+			r.Header.Set("Accept", tt.accept)
+			if got := wantsProtobuf(r); got != tt.want {
+				t.Errorf("wantsProtobuf(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalProtoTimeseries(t *testing.T) {
+	tests := []struct {
+		name string
+		resp []timeseriesResponse
+		want []byte
+	}{
+		{
+			"empty",
+			[]timeseriesResponse{{Target: "a", Datapoints: []row{}}},
+			[]byte{0x0a, 0x03, 0x0a, 0x01, 'a'},
+		},
+		{
+			"onePoint",
+			[]timeseriesResponse{{Target: "a", Datapoints: []row{{1.0, int64(2)}}}},
+			[]byte{
+				0x0a, 0x10, // series, 16 bytes
+				0x0a, 0x01, 'a', // target
+				0x12, 0x08, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // values
+				0x1a, 0x01, 0x02, // times_ms
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := marshalProtoTimeseries(tt.resp); !cmp.Equal(got, tt.want) {
+				t.Errorf("marshalProtoTimeseries():\ngot  % x\nwant % x", got, tt.want)
+			}
+		})
+	}
+}
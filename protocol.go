@@ -0,0 +1,245 @@
+package grada
+
+// Protocol drift of /query requests.
+//
+// Grafana versions keep adding fields to the /query payload, and
+// occasionally change the type of a field. The server decodes /query
+// requests leniently: it ignores unknown fields, and fields of another
+// type than it expects keep their zero value. It keeps track of both, so
+// that drift is visible rather than silent. GET /debug/protocol returns
+// the fields:
+//
+//	[{"field": "targets.datasource", "problem": "unknown field", "count": 42,
+//	  "lastSeen": 1508929200000, "userAgent": "Grafana/10.2.0"}, ...]
+//
+// lastSeen is in Unix milliseconds. Like the endpoints of WithPprof,
+// /debug/protocol responds with 403 Forbidden unless the server
+// authenticates clients, as the fields may reveal the clients.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProtocolField is a field of /query requests that the server does not
+// know, or whose type differs from the one it expects.
+// See Dashboard.ProtocolDrift.
+type ProtocolField struct {
+	Field     string    // path of the field, such as "targets.datasource"
+	Problem   string    // "unknown field", or the types, such as "number, want string"
+	Count     int       // number of requests with the field
+	LastSeen  time.Time // time of the last request with the field
+	UserAgent string    // User-Agent of the last request with the field
+}
+
+// maxProtocolFields bounds the number of fields the server keeps track
+// of, as clients choose the fields they send.
+const maxProtocolFields = 1000
+
+// protocolStore holds the protocol drift of a server.
+type protocolStore struct {
+	mu     sync.Mutex
+	fields map[string]*ProtocolField // by field and problem
+}
+
+// protocolResponse is an element of the response to a `/debug/protocol`
+// request.
+type protocolResponse struct {
+	Field     string `json:"field"`
+	Problem   string `json:"problem"`
+	Count     int    `json:"count"`
+	LastSeen  int64  `json:"lastSeen"` // Unix milliseconds
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// unmarshalQuery decodes the /query request body leniently: fields of
+// another type than expected keep their zero value instead of failing
+// the request. See protocolDrift.
+func unmarshalQuery(body []byte) (*query, error) {
+	q := &query{}
+	var te *json.UnmarshalTypeError
+	if err := json.Unmarshal(body, q); err != nil && !errors.As(err, &te) {
+		return nil, err
+	}
+	return q, nil
+}
+
+// recordDrift records the protocol drift of the /query request r with
+// the given body, and logs fields it has not seen before.
+func (srv *server) recordDrift(r *http.Request, body []byte) {
+	now := time.Now()
+	protocolDrift(body, reflect.TypeOf(query{}), "", func(field, problem string) {
+		srv.protocol.mu.Lock()
+		defer srv.protocol.mu.Unlock()
+		key := field + "\x00" + problem
+		f, ok := srv.protocol.fields[key]
+		if !ok {
+			if len(srv.protocol.fields) >= maxProtocolFields {
+				return
+			}
+			if srv.protocol.fields == nil {
+				srv.protocol.fields = map[string]*ProtocolField{}
+			}
+			f = &ProtocolField{Field: field, Problem: problem}
+			srv.protocol.fields[key] = f
+			if srv.logger != nil {
+				srv.logger.Printf("grada: request %s: protocol drift in /query: %s: %s (%s)",
+					RequestIDFromContext(r.Context()), field, problem, r.UserAgent())
+			}
+		}
+		f.Count++
+		f.LastSeen = now
+		f.UserAgent = r.UserAgent()
+	})
+}
+
+// protocolDrift calls drift for every field of the JSON value raw that
+// type t does not have, or whose JSON type does not fit its type in t.
+// path is the path of raw, and the paths of fields name the elements of
+// arrays by the path of the array.
+func protocolDrift(raw json.RawMessage, t reflect.Type, path string, drift func(field, problem string)) {
+	raw = bytes.TrimSpace(raw)
+	got := jsonKind(raw)
+	if got == "null" {
+		return
+	}
+	var want string
+	switch {
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return
+	case t == reflect.TypeOf(time.Time{}) || t.Kind() == reflect.String:
+		want = "string"
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Float64:
+		want = "number"
+	case t.Kind() == reflect.Bool:
+		want = "boolean"
+	case t.Kind() == reflect.Slice:
+		want = "array"
+		if got == want {
+			var list []json.RawMessage
+			json.Unmarshal(raw, &list)
+			for _, e := range list {
+				protocolDrift(e, t.Elem(), path, drift)
+			}
+			return
+		}
+	case t.Kind() == reflect.Struct:
+		want = "object"
+		if got == want {
+			var fields map[string]json.RawMessage
+			json.Unmarshal(raw, &fields)
+			for name, v := range fields {
+				p := name
+				if path != "" {
+					p = path + "." + name
+				}
+				if ft, ok := fieldByJSONName(t, name); ok {
+					protocolDrift(v, ft, p, drift)
+				} else {
+					drift(p, "unknown field")
+				}
+			}
+			return
+		}
+	default:
+		return
+	}
+	if got != want {
+		drift(path, got+", want "+want)
+	}
+}
+
+// fieldByJSONName returns the type of the field of struct type t that
+// encoding/json decodes name into.
+func fieldByJSONName(t reflect.Type, name string) (reflect.Type, bool) {
+	var fold reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return f.Type, true
+		}
+		if fold == nil && strings.EqualFold(tag, name) {
+			fold = f.Type
+		}
+	}
+	return fold, fold != nil
+}
+
+// jsonKind returns the JSON type of the value raw.
+func jsonKind(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "null"
+	}
+	switch raw[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// list returns the fields, sorted by field and problem.
+func (s *protocolStore) list() []ProtocolField {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]ProtocolField, 0, len(s.fields))
+	for _, f := range s.fields {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Field != list[j].Field {
+			return list[i].Field < list[j].Field
+		}
+		return list[i].Problem < list[j].Problem
+	})
+	return list
+}
+
+// ProtocolDrift returns the fields of /query requests that the server
+// does not know, or whose type differs from the one it expects, sorted
+// by field, so that changes of the protocol of new Grafana versions are
+// visible. The server ignores these fields. It logs the first request
+// with each of them through WithLogger, and responds with them to
+// authenticated GET /debug/protocol requests.
+func (d *Dashboard) ProtocolDrift() []ProtocolField {
+	return d.srv.protocol.list()
+}
+
+// protocolHandler responds with the protocol drift of /query requests.
+func (srv *server) protocolHandler(w http.ResponseWriter, r *http.Request) {
+	response := []protocolResponse{}
+	for _, f := range srv.protocol.list() {
+		response = append(response, protocolResponse{
+			Field:     f.Field,
+			Problem:   f.Problem,
+			Count:     f.Count,
+			LastSeen:  f.LastSeen.UnixMilli(),
+			UserAgent: f.UserAgent,
+		})
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal protocol response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,89 @@
+package grada
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProtocolDrift(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"known", `{"panelId":1,"range":{"from":"2017-10-25T11:00:00Z","raw":{"from":"now-1h"}},"targets":[{"target":"cpu","data":{"x":1}}]}`, nil},
+		{"unknown", `{"requestId":"Q1","targets":[{"target":"cpu","datasource":{"uid":"a"}},{"queryType":"raw"}]}`,
+			[]string{"requestId: unknown field", "targets.datasource: unknown field", "targets.queryType: unknown field"}},
+		{"changed", `{"panelId":"A","range":{"from":1508929200000},"targets":{"target":"cpu"}}`,
+			[]string{"panelId: string, want number", "range.from: number, want string", "targets: object, want array"}},
+		{"case-insensitive", `{"MaxDataPoints":10,"targets":[{"refid":"A"}]}`, nil},
+		{"null", `{"targets":null,"range":null}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			protocolDrift([]byte(tt.body), reflect.TypeOf(query{}), "", func(field, problem string) {
+				got = append(got, field+": "+problem)
+			})
+			sort.Strings(got)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("protocolDrift() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServer_protocolDrift(t *testing.T) {
+	var logs bytes.Buffer
+	anyone := AuthenticatorFunc(func(r *http.Request) (Principal, error) { return Principal{Name: "anyone"}, nil })
+	d := NewDashboard(WithLogger(log.New(&logs, "", 0)), WithAuthenticator(anyone))
+	d.CreateMetricWithBufSize("cpu", 10)
+	body := `{"panelId":"7","range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"targets":[{"target":"cpu","datasource":"x"}]}`
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("POST", "/query", strings.NewReader(body))
+		r.Header.Set("User-Agent", "Grafana/10.2.0")
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST /query: %d %s, want 200 despite the drift", w.Code, w.Body)
+		}
+	}
+	if n := strings.Count(logs.String(), "protocol drift"); n != 2 {
+		t.Errorf("logged %d protocol drifts, want one per field:\n%s", n, logs.String())
+	}
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/protocol", nil))
+	var got []protocolResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("GET /debug/protocol: %v: %s", err, w.Body)
+	}
+	for i := range got {
+		if got[i].LastSeen == 0 {
+			t.Errorf("field %s has no lastSeen", got[i].Field)
+		}
+		got[i].LastSeen = 0
+	}
+	want := []protocolResponse{
+		{Field: "panelId", Problem: "string, want number", Count: 2, UserAgent: "Grafana/10.2.0"},
+		{Field: "targets.datasource", Problem: "unknown field", Count: 2, UserAgent: "Grafana/10.2.0"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GET /debug/protocol mismatch (-want +got):\n%s", diff)
+	}
+
+	w = httptest.NewRecorder()
+	NewDashboard().Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/protocol", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/debug/protocol without authentication: status %d, want 403", w.Code)
+	}
+}
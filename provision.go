@@ -0,0 +1,232 @@
+package grada
+
+// Grafana provisioning files for the data source of a dashboard.
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProvisioningConfig configures Dashboard.DatasourceProvisioning.
+type ProvisioningConfig struct {
+	// Name is the name of the data source in Grafana. The default is
+	// "grada".
+	Name string
+	// URL is the address at which Grafana reaches the server. The default
+	// is derived from the listen address of a dashboard started with
+	// GetDashboard, StartWithServer, or Serve, its TLS option, and its path
+	// prefix, with "localhost" for addresses without a host.
+	URL string
+	// Dialect selects the data source plugin. The default is SimpleJSON.
+	// The URL includes the root that WithDialect has set for the dialect;
+	// JSONDatasource requires such a root.
+	Dialect Dialect
+	// Default makes the data source the default data source of Grafana.
+	Default bool
+
+	// Token is sent as bearer token in the Authorization header, as
+	// authenticators such as WithJWT expect.
+	Token string
+	// BasicAuthUser and BasicAuthPassword enable HTTP basic
+	// authentication if BasicAuthUser is set.
+	BasicAuthUser, BasicAuthPassword string
+	// TLSCACert is the PEM-encoded CA certificate with which Grafana
+	// verifies the certificate of the server, if it is not signed by a
+	// CA that Grafana trusts.
+	TLSCACert string
+	// TLSClientCert and TLSClientKey are the PEM-encoded certificate and
+	// key that Grafana presents to a server with WithClientCerts.
+	TLSClientCert, TLSClientKey string
+}
+
+// pluginTypes are the plugin IDs of the dialects.
+var pluginTypes = map[Dialect]string{
+	SimpleJSON:     "grafana-simple-json-datasource",
+	JSONDatasource: "simpod-json-datasource",
+}
+
+// grafanaDatasource is a data source of Grafana's provisioning files and
+// HTTP API.
+type grafanaDatasource struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	Access         string            `json:"access"`
+	URL            string            `json:"url"`
+	IsDefault      bool              `json:"isDefault"`
+	BasicAuth      bool              `json:"basicAuth"`
+	BasicAuthUser  string            `json:"basicAuthUser,omitempty"`
+	JSONData       map[string]string `json:"jsonData,omitempty"` // values other than "true" are strings
+	SecureJSONData map[string]string `json:"secureJsonData,omitempty"`
+}
+
+// MarshalJSON encodes the "true" values of JSONData as booleans.
+func (ds grafanaDatasource) MarshalJSON() ([]byte, error) {
+	type plain grafanaDatasource
+	jsonData := map[string]interface{}{}
+	for k, v := range ds.JSONData {
+		if v == "true" {
+			jsonData[k] = true
+		} else {
+			jsonData[k] = v
+		}
+	}
+	return json.Marshal(struct {
+		plain
+		JSONData map[string]interface{} `json:"jsonData"`
+	}{plain(ds), jsonData})
+}
+
+// datasource returns the data source for the dashboard that cfg
+// describes.
+func (srv *server) datasource(cfg ProvisioningConfig) (grafanaDatasource, error) {
+	if cfg.Name == "" {
+		cfg.Name = "grada"
+	}
+	plugin, ok := pluginTypes[cfg.Dialect]
+	if !ok {
+		return grafanaDatasource{}, errors.New("grada: unknown dialect " + strconv.Itoa(int(cfg.Dialect)))
+	}
+	// Simple JSON is served at "/", other dialects under their first root.
+	root := ""
+	if cfg.Dialect != SimpleJSON {
+		for r, dl := range srv.dialects {
+			if dl == cfg.Dialect && (root == "" || r < root) {
+				root = r
+			}
+		}
+		if root == "" {
+			return grafanaDatasource{}, errors.New("grada: the dashboard does not serve the dialect; use WithDialect")
+		}
+	}
+	if cfg.URL == "" {
+		if srv.httpServer == nil {
+			return grafanaDatasource{}, errors.New("grada: the dashboard has no listen address; set the URL")
+		}
+		cfg.URL = serverURL(srv.httpServer.Addr, srv.certFile != "" || srv.httpServer.TLSConfig != nil) + srv.prefix
+	}
+	ds := grafanaDatasource{
+		Name:           cfg.Name,
+		Type:           plugin,
+		Access:         "proxy",
+		URL:            strings.TrimSuffix(cfg.URL, "/") + root,
+		IsDefault:      cfg.Default,
+		JSONData:       map[string]string{},
+		SecureJSONData: map[string]string{},
+	}
+	if cfg.BasicAuthUser != "" {
+		ds.BasicAuth, ds.BasicAuthUser = true, cfg.BasicAuthUser
+		ds.SecureJSONData["basicAuthPassword"] = cfg.BasicAuthPassword
+	}
+	if cfg.Token != "" {
+		ds.JSONData["httpHeaderName1"] = "Authorization"
+		ds.SecureJSONData["httpHeaderValue1"] = "Bearer " + cfg.Token
+	}
+	if cfg.TLSCACert != "" {
+		ds.JSONData["tlsAuthWithCACert"] = "true"
+		ds.SecureJSONData["tlsCACert"] = cfg.TLSCACert
+	}
+	if cfg.TLSClientCert != "" {
+		ds.JSONData["tlsAuth"] = "true"
+		ds.SecureJSONData["tlsClientCert"] = cfg.TLSClientCert
+		ds.SecureJSONData["tlsClientKey"] = cfg.TLSClientKey
+	}
+	return ds, nil
+}
+
+// DatasourceProvisioning returns a Grafana provisioning file in YAML that
+// creates a data source for the dashboard. Put it into the
+// provisioning/datasources directory of Grafana. The file contains the
+// credentials of cfg in plain text; protect it accordingly.
+//
+// DatasourceProvisioning fails if cfg.URL is empty and the dashboard has
+// no listen address, such as dashboards created with NewDashboard, and if
+// the dialect has no root.
+func (d *Dashboard) DatasourceProvisioning(cfg ProvisioningConfig) ([]byte, error) {
+	ds, err := d.srv.datasource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("# Grafana data source for grada. See\n")
+	b.WriteString("# https://grafana.com/docs/grafana/latest/administration/provisioning/#data-sources\n")
+	b.WriteString("apiVersion: 1\n")
+	b.WriteString("datasources:\n")
+	b.WriteString("  - name: " + yamlString(ds.Name) + "\n")
+	b.WriteString("    type: " + yamlString(ds.Type) + "\n")
+	b.WriteString("    access: " + ds.Access + "\n")
+	b.WriteString("    url: " + yamlString(ds.URL) + "\n")
+	b.WriteString("    isDefault: " + strconv.FormatBool(ds.IsDefault) + "\n")
+	if ds.BasicAuth {
+		b.WriteString("    basicAuth: true\n")
+		b.WriteString("    basicAuthUser: " + yamlString(ds.BasicAuthUser) + "\n")
+	}
+	if len(ds.JSONData) > 0 {
+		b.WriteString("    jsonData:\n")
+		for _, k := range sortedKeys(ds.JSONData) {
+			v := ds.JSONData[k]
+			if v != "true" {
+				v = yamlString(v)
+			}
+			b.WriteString("      " + k + ": " + v + "\n")
+		}
+	}
+	if len(ds.SecureJSONData) > 0 {
+		b.WriteString("    secureJsonData:\n")
+		for _, k := range sortedKeys(ds.SecureJSONData) {
+			b.WriteString("      " + k + ": " + yamlValue(ds.SecureJSONData[k], "        ") + "\n")
+		}
+	}
+	b.WriteString("    editable: true\n")
+	return []byte(b.String()), nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serverURL returns the URL of a server that listens at addr.
+func serverURL(addr string, tls bool) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http://"
+	if tls {
+		scheme = "https://"
+	}
+	if port == "" {
+		return scheme + host
+	}
+	return scheme + net.JoinHostPort(host, port)
+}
+
+// yamlString quotes s for YAML. Grafana expands environment variables
+// of the form $NAME in provisioning files, so yamlString escapes "$" as
+// "$$".
+func yamlString(s string) string {
+	return strconv.Quote(strings.ReplaceAll(s, "$", "$$"))
+}
+
+// yamlValue returns s as a YAML block scalar with the given indentation
+// if s has several lines, such as PEM data, or else as a quoted string.
+func yamlValue(s, indent string) string {
+	s = strings.TrimRight(s, "\n")
+	if !strings.Contains(s, "\n") {
+		return yamlString(s)
+	}
+	s = strings.ReplaceAll(s, "$", "$$")
+	return "|\n" + indent + strings.ReplaceAll(s, "\n", "\n"+indent)
+}
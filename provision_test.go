@@ -0,0 +1,65 @@
+package grada
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDashboard_DatasourceProvisioning(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		addr    string
+		cfg     ProvisioningConfig
+		want    []string
+		wantErr string
+	}{
+		{"defaults", nil, ":3001", ProvisioningConfig{}, []string{
+			"apiVersion: 1\ndatasources:\n",
+			`  - name: "grada"` + "\n" + `    type: "grafana-simple-json-datasource"` + "\n    access: proxy\n" +
+				`    url: "http://localhost:3001"` + "\n    isDefault: false\n    editable: true\n",
+		}, ""},
+		{"TLS and prefix", []Option{WithTLS("cert.pem", "key.pem"), WithPathPrefix("grada")}, "10.0.0.1:8443", ProvisioningConfig{Name: "app", Default: true},
+			[]string{`name: "app"`, `url: "https://10.0.0.1:8443/grada"`, "isDefault: true"}, ""},
+		{"JSON data source", []Option{WithDialect("/jsonds", JSONDatasource)}, "", ProvisioningConfig{URL: "http://grada:3001/", Dialect: JSONDatasource},
+			[]string{`type: "simpod-json-datasource"`, `url: "http://grada:3001/jsonds"`}, ""},
+		{"token", nil, "", ProvisioningConfig{URL: "http://grada", Token: "s3cr$t"}, []string{
+			"    jsonData:\n" + `      httpHeaderName1: "Authorization"` + "\n",
+			"    secureJsonData:\n" + `      httpHeaderValue1: "Bearer s3cr$$t"` + "\n",
+		}, ""},
+		{"basic auth and certificates", nil, "", ProvisioningConfig{URL: "https://grada", BasicAuthUser: "grafana", BasicAuthPassword: "pw",
+			TLSClientCert: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n", TLSClientKey: "KEY"}, []string{
+			"    basicAuth: true\n" + `    basicAuthUser: "grafana"` + "\n",
+			"      tlsAuth: true\n",
+			`      basicAuthPassword: "pw"` + "\n",
+			"      tlsClientCert: |\n        -----BEGIN CERTIFICATE-----\n        MIIB\n        -----END CERTIFICATE-----\n",
+			`      tlsClientKey: "KEY"` + "\n",
+		}, ""},
+		{"no address", nil, "", ProvisioningConfig{}, nil, "no listen address"},
+		{"no dialect root", nil, "", ProvisioningConfig{URL: "http://grada", Dialect: JSONDatasource}, nil, "does not serve the dialect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDashboard(tt.opts...)
+			if tt.addr != "" {
+				d.srv.httpServer = &http.Server{Addr: tt.addr}
+			}
+			got, err := d.DatasourceProvisioning(tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("DatasourceProvisioning() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DatasourceProvisioning() error = %v", err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(got), w) {
+					t.Errorf("DatasourceProvisioning() =\n%s\nwant it to contain\n%s", got, w)
+				}
+			}
+		})
+	}
+}
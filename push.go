@@ -0,0 +1,212 @@
+package grada
+
+// Endpoints for producers and consumers other than Grafana:
+//
+// POST /push adds samples to existing metrics. The body is a list of samples,
+// encoded as JSON or, with "Content-Type: application/msgpack", as MessagePack:
+//
+//	[{"target": "cpu", "value": 0.57, "time": 1508929014000}, ...]
+//
+// "time" is a Unix timestamp in milliseconds (MessagePack clients can also
+// send a timestamp extension value). If "time" is missing, the sample gets
+// the time of its arrival. Bodies of more than 1 MiB fail with 413 Request
+// Entity Too Large; split larger pushes.
+//
+// POST /push?backfill=1 inserts the samples as Dashboard.Backfill does;
+// "backfill" takes the values of strconv.ParseBool. The samples of each
+// target must have times in ascending order. Backfills beyond the limit
+// of WithBackfillLimit fail with 413 Request Entity Too Large.
+//
+// GET /export?target=<name>[&from=<time>&to=<time>] returns the data points
+// of a metric in the same shape as a time series query response:
+//
+//	{"target": "cpu", "datapoints": [[0.57, 1508929014000], ...]}
+//
+// Clients that send "Accept: application/msgpack" receive MessagePack, and
+// clients that accept NDJSON or CSV receive those (see negotiate.go).
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// pushSample is a single sample sent to /push.
+type pushSample struct {
+	Target string  `json:"target"`
+	Value  float64 `json:"value"`
+	Time   int64   `json:"time"` // Unix milliseconds; 0 means "now"
+	t      time.Time
+}
+
+// pushReply is the response to a /push request.
+type pushReply struct {
+	Accepted int `json:"accepted"`
+}
+
+// samplesFromMsgpack converts a decoded MessagePack value into samples.
+func samplesFromMsgpack(v interface{}) ([]pushSample, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("expected an array of samples")
+	}
+	samples := make([]pushSample, len(list))
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("sample " + strconv.Itoa(i) + " is not a map")
+		}
+		s := &samples[i]
+		s.Target, ok = m["target"].(string)
+		if !ok {
+			return nil, errors.New("sample " + strconv.Itoa(i) + ": target must be a string")
+		}
+		s.Value, ok = msgpackFloat(m["value"])
+		if !ok {
+			return nil, errors.New("sample " + strconv.Itoa(i) + ": value must be a number")
+		}
+		switch t := m["time"].(type) {
+		case nil:
+		case time.Time:
+			s.t = t
+		default:
+			ms, ok := msgpackFloat(t)
+			if !ok {
+				return nil, errors.New("sample " + strconv.Itoa(i) + ": time must be a number or a timestamp")
+			}
+			s.Time = int64(ms)
+		}
+	}
+	return samples, nil
+}
+
+// pushHandler adds the samples of a /push request to their metrics.
+// The request is rejected as a whole if any target does not exist, or,
+// for backfills, if the samples of a target are not in order.
+func (srv *server) pushHandler(w http.ResponseWriter, r *http.Request) {
+	backfill := false
+	if v := r.URL.Query().Get("backfill"); v != "" {
+		var err error
+		if backfill, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, err, "invalid backfill parameter")
+			return
+		}
+	}
+
+	body, err := readQueryBody(w, r)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	var samples []pushSample
+	if isMsgpack(r) {
+		var v interface{}
+		v, err = decodeMsgpack(body)
+		if err == nil {
+			samples, err = samplesFromMsgpack(v)
+		}
+	} else {
+		err = json.Unmarshal(body, &samples)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot decode samples")
+		return
+	}
+
+	metrics := make([]*Metric, len(samples))
+	for i, s := range samples {
+		metrics[i], err = srv.metrics.Get(s.Target)
+		if err != nil {
+			writeError(w, statusFor(err), err, "Cannot get metric for target "+s.Target)
+			return
+		}
+	}
+	if backfill {
+		if err := backfillSamples(samples, metrics, srv.backfillLimit()); err != nil {
+			writeError(w, statusFor(err), err, "cannot backfill samples")
+			return
+		}
+	} else {
+		for i, s := range samples {
+			switch {
+			case !s.t.IsZero():
+				metrics[i].AddWithTime(s.Value, s.t)
+			case s.Time != 0:
+				metrics[i].AddWithTime(s.Value, time.Unix(0, s.Time*int64(time.Millisecond)))
+			default:
+				metrics[i].Add(s.Value)
+			}
+		}
+	}
+
+	if wantsMsgpack(r) {
+		w.Header().Set("Content-Type", "application/msgpack")
+		b := appendMsgpackMapHeader(nil, 1)
+		b = appendMsgpackString(b, "accepted")
+		w.Write(appendMsgpackInt(b, int64(len(samples))))
+		return
+	}
+	writeJSON(w, pushReply{Accepted: len(samples)})
+}
+
+// exportHandler writes all data points of a metric within the requested time range.
+func (srv *server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	target := params.Get("target")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, nil, "target is required")
+		return
+	}
+	from, err := parseTimeParam(params.Get("from"), time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot parse from")
+		return
+	}
+	to, err := parseTimeParam(params.Get("to"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot parse to")
+		return
+	}
+	s, err := srv.series(target, from, to, math.MaxInt)
+	if err != nil {
+		writeError(w, statusFor(err), err, "Cannot get metric for target "+target)
+		return
+	}
+	defer s.release()
+
+	if wantsMsgpack(r) {
+		points, err := s.datapoints()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err, "Cannot get data points for target "+target)
+			return
+		}
+		w.Header().Set("Content-Type", "application/msgpack")
+		b := appendMsgpackMapHeader(nil, 2)
+		b = appendMsgpackString(b, "target")
+		b = appendMsgpackString(b, target)
+		b = appendMsgpackString(b, "datapoints")
+		w.Write(appendMsgpackRows(b, points))
+		return
+	}
+	if format := responseFormat(r); format == formatNDJSON || format == formatCSV {
+		points, err := s.datapoints()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err, "Cannot get data points for target "+target)
+			return
+		}
+		writeSeriesText(w, format, []timeseriesResponse{{Target: target, Datapoints: points}})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	sw := &streamWriter{w: w}
+	resp, err := sw.writeSeriesObject(nil, s)
+	if err != nil {
+		srv.streamError(w, r, sw, err, "cannot marshal export response")
+		return
+	}
+	w.Write(resp)
+}
@@ -0,0 +1,94 @@
+package grada
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer_pushHandler(t *testing.T) {
+	msgpackBody := appendMsgpackArrayHeader(nil, 1)
+	msgpackBody = appendMsgpackMapHeader(msgpackBody, 3)
+	msgpackBody = appendMsgpackString(msgpackBody, "target")
+	msgpackBody = appendMsgpackString(msgpackBody, "target1")
+	msgpackBody = appendMsgpackString(msgpackBody, "value")
+	msgpackBody = appendMsgpackInt(msgpackBody, 7)
+	msgpackBody = appendMsgpackString(msgpackBody, "time")
+	msgpackBody = appendMsgpackInt(msgpackBody, 1508929014000)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantStatus  int
+		wantBody    string
+		wantN       float64
+	}{
+		{
+			"json",
+			"application/json",
+			[]byte(`[{"target": "target1", "value": 2.5, "time": 1508929014000}]`),
+			200,
+			`{"accepted":1}`,
+			2.5,
+		},
+		{"msgpack", "application/msgpack", msgpackBody, 200, `{"accepted":1}`, 7},
+		{"unknownTarget", "application/json", []byte(`[{"target": "nope", "value": 1}]`), 404, "", 0},
+		{"badBody", "application/json", []byte(`{`), 400, "", 0},
+		{"tooLarge", "application/json", bytes.Repeat([]byte(" "), maxQueryBytes+1), 413, "", 0},
+		{"tooDeep", "application/msgpack", append(bytes.Repeat([]byte{0x91}, 1<<20), 0xc0), 413, "", 0},
+		{"deepButSmall", "application/msgpack", append(bytes.Repeat([]byte{0x91}, 1000), 0xc0), 400, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := &Metric{list: newCountBuffer(2)}
+			srv := &server{metrics: &metrics{metric: map[string]*Metric{"target1": metric}}}
+			r := httptest.NewRequest("POST", "/push", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			srv.pushHandler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("pushHandler(): status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("pushHandler(): body %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("pushHandler(): Content-Type %q, want application/json", ct)
+			}
+			got := metric.list.at(0)
+			if got.N != tt.wantN || !got.T.Equal(time.Unix(1508929014, 0)) {
+				t.Errorf("pushHandler(): metric got %v, want %v at 1508929014000", got, tt.wantN)
+			}
+		})
+	}
+}
+
+func TestServer_exportHandler_msgpack(t *testing.T) {
+	t1 := time.Unix(1508929014, 0)
+	srv := &server{metrics: &metrics{metric: map[string]*Metric{
+		"target1": {list: countBufferOf([]Count{{1.5, t1}})},
+	}}}
+	r := httptest.NewRequest("GET", "/export?target=target1&to=1508929015000", nil)
+	r.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+	srv.exportHandler(w, r)
+
+	v, err := decodeMsgpack(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("exportHandler(): cannot decode response: %v", err)
+	}
+	m := v.(map[string]interface{})
+	points := m["datapoints"].([]interface{})
+	if m["target"] != "target1" || len(points) != 1 {
+		t.Fatalf("exportHandler(): got %#v", m)
+	}
+	p := points[0].([]interface{})
+	if p[0] != 1.5 || p[1] != int64(1508929014000) {
+		t.Errorf("exportHandler(): got data point %v, want [1.5 1508929014000]", p)
+	}
+}
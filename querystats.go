@@ -0,0 +1,140 @@
+package grada
+
+// Query statistics per target.
+//
+// GET /querystats returns the statistics of all targets that queries
+// have requested:
+//
+//	[{"target": "cpu", "queries": 42, "latency": 0.25, "points": 8400}, ...]
+//
+// latency is the average in milliseconds.
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueryStats are the statistics of the /query requests for a target.
+// See Dashboard.QueryStats.
+type QueryStats struct {
+	Target  string
+	Queries int           // number of queries that have requested the target
+	Latency time.Duration // average time to get the data of the target
+	Points  int           // data points or table rows returned in total
+}
+
+// maxQueryStatsTargets bounds the number of targets with statistics, as
+// clients choose the targets, such as expressions, that they query.
+// Targets beyond the bound have no statistics.
+const maxQueryStatsTargets = 10000
+
+// queryStatsStore holds the query statistics of a server.
+type queryStatsStore struct {
+	mu      sync.Mutex
+	targets map[string]*queryStat
+}
+
+// queryStat are the totals of the queries for a target.
+type queryStat struct {
+	queries int
+	took    time.Duration
+	points  int
+}
+
+// queryStatsResponse is an element of the response to a `/querystats`
+// request.
+type queryStatsResponse struct {
+	Target  string  `json:"target"`
+	Queries int     `json:"queries"`
+	Latency float64 `json:"latency"`
+	Points  int     `json:"points"`
+}
+
+// record adds a query for target that took took to get its data and
+// returned points data points or rows.
+func (s *queryStatsStore) record(target string, took time.Duration, points int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.targets[target]
+	if !ok {
+		if len(s.targets) >= maxQueryStatsTargets {
+			return
+		}
+		if s.targets == nil {
+			s.targets = map[string]*queryStat{}
+		}
+		st = &queryStat{}
+		s.targets[target] = st
+	}
+	st.queries++
+	st.took += took
+	st.points += points
+}
+
+// list returns the statistics of all targets, sorted by target.
+func (s *queryStatsStore) list() []QueryStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]QueryStats, 0, len(s.targets))
+	for target, st := range s.targets {
+		list = append(list, QueryStats{
+			Target:  target,
+			Queries: st.queries,
+			Latency: st.took / time.Duration(st.queries),
+			Points:  st.points,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+	return list
+}
+
+// recordQueryStats adds the statistics of the targets of q that took
+// took to get their series. owners are the indexes of the targets of the
+// series, which have written data points each. recordQueryStats returns
+// the data points in total.
+func (srv *server) recordQueryStats(q *query, took []time.Duration, owners, written []int) int {
+	points := make([]int, len(took))
+	total := 0
+	for i, n := range written {
+		points[owners[i]] += n
+		total += n
+	}
+	for i, d := range took {
+		srv.queryStats.record(q.Targets[i].Target, d, points[i])
+	}
+	return total
+}
+
+// QueryStats returns the statistics of the /query requests for each
+// target, sorted by target, so that the targets that load the server most
+// can be found. A target's latency covers getting its data points or
+// tables, but not encoding the response. Failed queries are not counted.
+// The server also responds with the statistics to GET /querystats; like
+// the endpoints of WithPprof, /querystats responds with 403 Forbidden
+// unless the server authenticates clients.
+func (d *Dashboard) QueryStats() []QueryStats {
+	return d.srv.queryStats.list()
+}
+
+// queryStatsHandler responds with the statistics of all targets.
+func (srv *server) queryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	response := []queryStatsResponse{}
+	for _, s := range srv.queryStats.list() {
+		response = append(response, queryStatsResponse{
+			Target:  s.Target,
+			Queries: s.Queries,
+			Latency: float64(s.Latency) / float64(time.Millisecond),
+			Points:  s.Points,
+		})
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal query statistics response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
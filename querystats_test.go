@@ -0,0 +1,80 @@
+package grada
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_queryStats(t *testing.T) {
+	anyone := AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		return Principal{Name: "anyone"}, nil
+	})
+	d := NewDashboard(WithAuthenticator(anyone))
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		m.AddWithTime(float64(i), t0.Add(time.Duration(i)*time.Second))
+	}
+	d.CreateStaticTable("hosts", &Table{Columns: []Column{{Text: "host", Type: "string"}}, Rows: [][]interface{}{{"a"}, {"b"}}})
+
+	for _, targets := range []string{
+		`{"target": "cpu"}, {"target": "cpu", "data": {"reduce": "max"}}`,
+		`{"target": "cpu"}`,
+		`{"target": "hosts", "type": "table"}`,
+		`{"target": "nope"}`, // fails, not counted
+	} {
+		body := `{"range": {"from": "2017-10-25T10:00:00Z", "to": "2017-10-25T12:00:00Z"}, "maxDataPoints": 10, "targets": [` + targets + `]}`
+		d.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	}
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/querystats", nil))
+	var got []queryStatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("cannot unmarshal %s: %v", w.Body.String(), err)
+	}
+	for i := range got {
+		if got[i].Latency < 0 {
+			t.Errorf("%s has latency %v", got[i].Target, got[i].Latency)
+		}
+		got[i].Latency = 0
+	}
+	want := []queryStatsResponse{
+		{Target: "cpu", Queries: 3, Points: 7},
+		{Target: "hosts", Queries: 1, Points: 2},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("/querystats mismatch (-want +got):\n%s", diff)
+	}
+	if stats := d.QueryStats(); len(stats) != 2 || stats[0].Target != "cpu" {
+		t.Errorf("QueryStats() = %v", stats)
+	}
+
+	w = httptest.NewRecorder()
+	NewDashboard().Handler().ServeHTTP(w, httptest.NewRequest("GET", "/querystats", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("/querystats without authentication: status %d, want 403", w.Code)
+	}
+}
+
+func TestQueryStatsStore_record(t *testing.T) {
+	var s queryStatsStore
+	for i := 0; i < maxQueryStatsTargets+1; i++ {
+		s.record(string(rune('a'+i%26))+strings.Repeat("x", i/26), time.Millisecond, 1)
+	}
+	s.record("a", 3*time.Millisecond, 2)
+	list := s.list()
+	if len(list) != maxQueryStatsTargets {
+		t.Errorf("%d targets, want %d", len(list), maxQueryStatsTargets)
+	}
+	want := QueryStats{Target: "a", Queries: 2, Latency: 2 * time.Millisecond, Points: 3}
+	if list[0] != want {
+		t.Errorf("first target %v, want %v", list[0], want)
+	}
+}
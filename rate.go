@@ -0,0 +1,86 @@
+package grada
+
+// Rates of counters.
+//
+// A time series target "rate:<name>" is the per-second rate of increase
+// of the metric <name>, such as "rate:http.requests" for the requests per
+// second of a counter of requests. A metric named "rate:<name>" takes
+// precedence. The rates are averages over the interval of the query, or
+// over longer steps if the query range has more than maxDataPoints
+// intervals.
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// ratePrefix starts the targets of rate series.
+const ratePrefix = "rate:"
+
+// Rate returns the per-second rate of increase of the metric within the
+// last window, treating the metric as a counter: decreases are counter
+// resets, and the increase is extrapolated to the edges of the window, as
+// with the expression rate(<name>[window]). Rate returns NaN if the window
+// has fewer than two data points.
+func (g *Metric) Rate(window time.Duration) float64 {
+	now := time.Now()
+	start := now.Add(-window)
+	cs := g.appendCounts(nil, start, now.Add(time.Nanosecond), math.MaxInt)
+	return extrapolatedIncrease(cs, start, now) / window.Seconds()
+}
+
+// rateMetric returns the metric of the target "rate:<name>", and reports
+// whether target is such a target.
+func (srv *server) rateMetric(target string) (*Metric, bool) {
+	name, ok := strings.CutPrefix(target, ratePrefix)
+	if !ok {
+		return nil, false
+	}
+	if _, err := srv.metrics.Get(target); err == nil {
+		return nil, false
+	}
+	metric, err := srv.metrics.Get(name)
+	return metric, err == nil
+}
+
+// rateRows returns the average per-second rate of increase of the
+// counter cs between the last data points of successive steps, with the
+// steps aligned to the Unix epoch. Each row has the time of the later
+// data point. Decreases are counter resets.
+func rateRows(cs []Count, step time.Duration) []row {
+	rows := []row{}
+	if len(cs) < 2 || step <= 0 {
+		return rows
+	}
+	// Add the values before each reset, so that the counter only grows.
+	var offset float64
+	prev := cs[0].N
+	for i := 1; i < len(cs); i++ {
+		n := cs[i].N
+		if n < prev {
+			offset += prev
+		}
+		prev = n
+		cs[i].N = n + offset
+	}
+
+	var last Count
+	for i, c := range cs {
+		if i+1 < len(cs) && intervalOf(c.T.UnixNano(), step) == intervalOf(cs[i+1].T.UnixNano(), step) {
+			continue // not the last data point of its step
+		}
+		if dt := c.T.Sub(last.T).Seconds(); !last.T.IsZero() && dt > 0 {
+			rows = append(rows, row{(c.N - last.N) / dt, c.T.UnixNano() / int64(time.Millisecond)})
+		}
+		last = c
+	}
+	return rows
+}
+
+// rateStep returns the step of a rate series within [from, to]: the
+// interval of the query, but long enough for at most maxDataPoints steps.
+func rateStep(from, to time.Time, maxDataPoints int, interval time.Duration) time.Duration {
+	n := time.Duration(max(maxDataPoints, 1))
+	return max(interval, (to.Sub(from)+n-1)/n, time.Millisecond)
+}
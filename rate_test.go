@@ -0,0 +1,69 @@
+package grada
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetric_Rate(t *testing.T) {
+	d := NewDashboard()
+	m, _ := d.CreateMetricWithBufSize("requests", 10)
+	if r := m.Rate(time.Minute); !math.IsNaN(r) {
+		t.Errorf("Rate() of an empty metric = %v, want NaN", r)
+	}
+	now := time.Now()
+	for i := 0; i <= 6; i++ {
+		m.AddWithTime(float64(10*i), now.Add(time.Duration(i-6)*10*time.Second))
+	}
+	if r := m.Rate(time.Minute); math.Abs(r-1) > 0.01 {
+		t.Errorf("Rate() = %v, want 1", r)
+	}
+}
+
+func TestServer_rateSeries(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	ms := func(s int) int64 { return t0.Add(time.Duration(s)*time.Second).UnixNano() / int64(time.Millisecond) }
+	d := NewDashboard()
+	m, _ := d.CreateMetricWithBufSize("requests", 10)
+	// 2 per second, with a restart before 40s.
+	for i, n := range []float64{0, 20, 40, 60, 10, 30} {
+		m.AddWithTime(n, t0.Add(time.Duration(10*i)*time.Second))
+	}
+	tests := []struct {
+		name          string
+		target        string
+		maxDataPoints int
+		interval      time.Duration
+		want          []row
+		wantErr       error
+	}{
+		{"all", "rate:requests", 100, 0, []row{{2.0, ms(10)}, {2.0, ms(20)}, {2.0, ms(30)}, {1.0, ms(40)}, {2.0, ms(50)}}, nil},
+		{"interval", "rate:requests", 100, 20 * time.Second, []row{{2.0, ms(30)}, {1.5, ms(50)}}, nil},
+		{"maxDataPoints", "rate:requests", 3, 0, []row{{2.0, ms(30)}, {1.5, ms(50)}}, nil},
+		{"unknown metric", "rate:nope", 100, 0, nil, ErrMetricNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := d.srv.seriesByInterval(tt.target, t0.Add(-time.Second), t0.Add(59*time.Second), tt.maxDataPoints, tt.interval)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("seriesByInterval() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, _ := s.datapoints()
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("datapoints() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	v, _, _, err := d.srv.reduce("rate:requests", "max", t0.Add(-time.Second), t0.Add(time.Minute))
+	if err != nil || v != 2 {
+		t.Errorf("reduce(rate:requests, max) = %v, %v, want 2", v, err)
+	}
+}
@@ -0,0 +1,190 @@
+package grada
+
+// Recording and replay of Grafana requests.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithRecorder writes every /query and /search request, including those
+// under the roots of WithDialect, to w, one JSON object per line with the
+// time of the request in Unix milliseconds, the method, the path, and the
+// JSON body. Replay sends the recorded requests
+// to another server, so that the load of production dashboards can be
+// reproduced on a development instance. Only requests that pass
+// authentication are recorded, and requests whose body is not JSON are
+// recorded without it. Failures to write are logged through WithLogger.
+func WithRecorder(w io.Writer) Option {
+	return func(srv *server) {
+		srv.recorder = &requestRecorder{w: w}
+	}
+}
+
+// recordedRequest is a line of a recording.
+type recordedRequest struct {
+	Time   int64           `json:"time"` // Unix milliseconds
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// requestRecorder writes requests to a recording.
+type requestRecorder struct {
+	m sync.Mutex // serializes lines
+	w io.Writer
+}
+
+// record writes the /query and /search requests to h to the recording.
+func (srv *server) record(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/query") && !strings.HasSuffix(r.URL.Path, "/search") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := readQueryBody(w, r)
+		r.Body = replayBody(body, err)
+		if err != nil {
+			h.ServeHTTP(w, r) // let h report the error
+			return
+		}
+		rec := recordedRequest{Time: time.Now().UnixMilli(), Method: r.Method, Path: r.URL.Path}
+		if body = bytes.TrimSpace(body); json.Valid(body) {
+			rec.Body = body
+		}
+		line, _ := json.Marshal(rec)
+		srv.recorder.m.Lock()
+		_, err = srv.recorder.w.Write(append(line, '\n'))
+		srv.recorder.m.Unlock()
+		if err != nil && srv.logger != nil {
+			srv.logger.Printf("grada: cannot record request: %v", err)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ReplayConfig configures Replay.
+type ReplayConfig struct {
+	// Speed scales the pace of the recording: 1 sends the requests with
+	// the pauses between them as recorded, 2 twice as fast. Zero sends
+	// them one after another without pauses.
+	Speed float64
+	// ShiftRanges moves the time range of every /query request by the
+	// time that has passed since it was recorded, so that dashboards
+	// that showed the last hour show the last hour again.
+	ShiftRanges bool
+	// Header is added to every request, such as an Authorization header.
+	Header http.Header
+	// Client sends the requests. The default is http.DefaultClient.
+	Client *http.Client
+}
+
+// Replay sends the requests of a recording of WithRecorder, read from r,
+// to the server at baseURL, such as "http://localhost:3001", in the order
+// and at the pace of the recording. It returns the number of requests it
+// has sent and the number of them that failed with an error status. It
+// stops at the first request that cannot be sent, at the first invalid
+// line of r, and when ctx is done.
+func Replay(ctx context.Context, r io.Reader, baseURL string, cfg ReplayConfig) (sent, failed int, err error) {
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	start := time.Now()
+	var first time.Time
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<24)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec recordedRequest
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return sent, failed, err
+		}
+		at := time.UnixMilli(rec.Time)
+		if first.IsZero() {
+			first = at
+		}
+		if cfg.Speed > 0 {
+			wait := time.Duration(float64(at.Sub(first))/cfg.Speed) - time.Since(start)
+			if err := sleep(ctx, wait); err != nil {
+				return sent, failed, err
+			}
+		}
+		body := []byte(rec.Body)
+		if cfg.ShiftRanges && rec.Path == "/query" {
+			body = shiftRange(body, time.Since(at))
+		}
+		req, err := http.NewRequestWithContext(ctx, rec.Method, baseURL+rec.Path, bytes.NewReader(body))
+		if err != nil {
+			return sent, failed, err
+		}
+		for k, vs := range cfg.Header {
+			req.Header[k] = vs
+		}
+		if len(body) > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return sent, failed, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		sent++
+		if resp.StatusCode >= 400 {
+			failed++
+		}
+	}
+	return sent, failed, sc.Err()
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shiftRange moves the time range of the /query request body by d. It
+// leaves bodies without a valid time range as they are.
+func shiftRange(body []byte, d time.Duration) []byte {
+	var q map[string]json.RawMessage
+	if json.Unmarshal(body, &q) != nil || q["range"] == nil {
+		return body
+	}
+	var rng map[string]json.RawMessage
+	if json.Unmarshal(q["range"], &rng) != nil {
+		return body
+	}
+	for _, k := range []string{"from", "to"} {
+		var t time.Time
+		if json.Unmarshal(rng[k], &t) != nil {
+			return body
+		}
+		rng[k], _ = json.Marshal(t.Add(d))
+	}
+	q["range"], _ = json.Marshal(rng)
+	shifted, err := json.Marshal(q)
+	if err != nil {
+		return body
+	}
+	return shifted
+}
@@ -0,0 +1,87 @@
+package grada
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var recording bytes.Buffer
+	prod := NewDashboard(WithRecorder(&recording))
+	prod.CreateMetricWithBufSize("cpu", 10)
+	query := `{"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"targets":[{"target":"cpu","refId":"A"}]}`
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/search", strings.NewReader(`{"target":""}`)),
+		httptest.NewRequest("POST", "/query", strings.NewReader(query)),
+		httptest.NewRequest("POST", "/query", strings.NewReader(`{"targets":[{"target":"nope"}]}`)),
+		httptest.NewRequest("GET", "/csv?target=cpu", nil), // not recorded
+	} {
+		prod.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if n := strings.Count(recording.String(), "\n"); n != 3 {
+		t.Fatalf("recording has %d lines, want 3:\n%s", n, recording.String())
+	}
+
+	// Replaying against a recording dev instance records the same requests.
+	var replayed bytes.Buffer
+	dev := NewDashboard(WithRecorder(&replayed))
+	dev.CreateMetricWithBufSize("cpu", 10)
+	srv := httptest.NewServer(dev.Handler())
+	defer srv.Close()
+	sent, failed, err := Replay(context.Background(), bytes.NewReader(recording.Bytes()), srv.URL, ReplayConfig{})
+	if err != nil || sent != 3 || failed != 1 {
+		t.Fatalf("Replay() = %d, %d, %v, want 3, 1, nil", sent, failed, err)
+	}
+	strip := func(b []byte) []recordedRequest {
+		var list []recordedRequest
+		for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+			var rec recordedRequest
+			json.Unmarshal(line, &rec)
+			rec.Time = 0
+			list = append(list, rec)
+		}
+		return list
+	}
+	if diff := cmp.Diff(strip(recording.Bytes()), strip(replayed.Bytes())); diff != "" {
+		t.Errorf("replayed requests mismatch (-want +got):\n%s", diff)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	late := `{"time":1508929200000,"method":"POST","path":"/search"}` + "\n" + `{"time":1508932800000,"method":"POST","path":"/search"}`
+	if sent, _, err := Replay(ctx, strings.NewReader(late), srv.URL, ReplayConfig{Speed: 1}); err != context.Canceled || sent != 0 {
+		t.Errorf("Replay() with canceled context = %d, %v, want 0, context.Canceled", sent, err)
+	}
+
+	// The recorder reads no more of the body than the query handler accepts.
+	recording.Reset()
+	huge := httptest.NewRequest("POST", "/query", strings.NewReader(strings.Repeat(" ", maxQueryBytes+1)))
+	w := httptest.NewRecorder()
+	prod.Handler().ServeHTTP(w, huge)
+	if w.Code != http.StatusRequestEntityTooLarge || recording.Len() != 0 {
+		t.Errorf("oversized query: code %d, %d bytes recorded, want 413 and nothing recorded", w.Code, recording.Len())
+	}
+}
+
+func TestShiftRange(t *testing.T) {
+	body := []byte(`{"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z","raw":{"from":"now-1h"}},"maxDataPoints":100}`)
+	var q query
+	if err := json.Unmarshal(shiftRange(body, 24*time.Hour), &q); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2017, time.October, 26, 11, 0, 0, 0, time.UTC)
+	if !q.Range.From.Equal(want) || !q.Range.To.Equal(want.Add(time.Hour)) || q.Range.Raw.From != "now-1h" || q.MaxDataPoints != 100 {
+		t.Errorf("shiftRange() = %+v, want the range from %v, and the other fields unchanged", q, want)
+	}
+	if got := shiftRange([]byte(`{"targets":[]}`), time.Hour); string(got) != `{"targets":[]}` {
+		t.Errorf("shiftRange() without a range = %s", got)
+	}
+}
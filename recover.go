@@ -0,0 +1,49 @@
+package grada
+
+// Recovery from panics in handlers and user-supplied callbacks.
+
+import (
+	"net/http"
+	runtimedebug "runtime/debug"
+)
+
+// WithOnPanic registers a hook that the server calls after it has recovered
+// from a panic while handling r. v is the value passed to panic, and stack
+// is the stack trace of the panicking goroutine.
+//
+// The server recovers from panics regardless of this option, and responds
+// with a 500 Internal Server Error.
+func WithOnPanic(hook func(r *http.Request, v interface{}, stack []byte)) Option {
+	return func(srv *server) {
+		srv.onPanic = hook
+	}
+}
+
+// recoverPanic turns panics in h into 500 responses, so that a failing
+// callback does not take down the connection.
+func (srv *server) recoverPanic(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v) // deliberate abort; let net/http handle it
+			}
+			stack := runtimedebug.Stack()
+			if srv.logger != nil {
+				srv.logger.Printf("grada: request %s: panic: %v\n%s", RequestIDFromContext(r.Context()), v, stack)
+			}
+			if srv.onPanic != nil {
+				srv.onPanic(r, v, stack)
+			}
+			if sr.status != 0 {
+				return // too late for an error response
+			}
+			writeError(w, http.StatusInternalServerError, nil, "internal server error")
+		}()
+		h.ServeHTTP(sr, r)
+	})
+}
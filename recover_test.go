@@ -0,0 +1,62 @@
+package grada
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_recoverPanic(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantPanic  interface{}
+	}{
+		{
+			"panic",
+			func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			500,
+			"boom",
+		},
+		{
+			"panicAfterWrite",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("[]"))
+				panic("late")
+			},
+			200,
+			"late",
+		},
+		{
+			"noPanic",
+			func(w http.ResponseWriter, r *http.Request) {},
+			200,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			srv := &server{}
+			WithOnPanic(func(r *http.Request, v interface{}, stack []byte) {
+				got = v
+				if len(stack) == 0 {
+					t.Errorf("OnPanic hook: empty stack")
+				}
+			})(srv)
+			w := httptest.NewRecorder()
+			srv.requestID(srv.recoverPanic(tt.handler)).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got != tt.wantPanic {
+				t.Errorf("OnPanic hook got %v, want %v", got, tt.wantPanic)
+			}
+			if tt.wantStatus == 500 && !strings.Contains(w.Body.String(), w.Header().Get(RequestIDHeader)) {
+				t.Errorf("response %s lacks the request ID", w.Body.String())
+			}
+		})
+	}
+}
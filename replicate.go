@@ -0,0 +1,240 @@
+package grada
+
+// Replication of metrics between instances.
+//
+// GET /replicate?since=<Unix nanoseconds> returns the data points of all
+// metrics with a time stamp after since:
+//
+//	[{"target": "cpu", "size": 1000, "values": [0.5, 0.7],
+//	  "times": [1508929014000000000, 1508929015000000000]}, ...]
+//
+// Times are Unix nanoseconds, so that replicated data points keep their
+// exact time stamps and can be recognized when they come back. Values
+// that JSON cannot represent (NaN and infinities) are not replicated.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplicationConfig configures WithReplication.
+type ReplicationConfig struct {
+	// Peers are the base URLs of the other instances, including the path
+	// prefix of their endpoints if they have one, as in "http://b:3001".
+	Peers []string
+	// Interval is the time between two pulls from a peer. Default is 10
+	// seconds.
+	Interval time.Duration
+	// Client sends the requests. Default is http.DefaultClient.
+	Client *http.Client
+	// Header is added to every request, for example for authorization.
+	Header http.Header
+}
+
+// WithReplication makes the server exchange the data points of its
+// metrics with other instances, so that Grafana pointed at any of them,
+// or at a load balancer in front of them, sees complete data while one
+// instance restarts. Configure every instance with the others as peers:
+//
+//	a := grada.NewDashboard(grada.WithReplication(grada.ReplicationConfig{
+//		Peers: []string{"http://b:3001"},
+//	}))
+//
+// The server serves the endpoint /replicate, and pulls the data points of
+// all metrics from each peer at every interval: everything at the first
+// pull, after a restart, and then the data points with time stamps since
+// one interval before the previous pull. It merges them into its own
+// metrics, skipping data points of the same time stamp that it has
+// already, so that data points that return from a peer are not
+// duplicated. Metrics that do not exist yet are created with the buffer
+// size of the peer. Aliases, tables, and other targets that are not
+// metrics are not replicated.
+//
+// The pulls run as collectors named "replicate.<peer>". Failed pulls are
+// logged and retried at the next interval.
+func WithReplication(cfg ReplicationConfig) Option {
+	return func(srv *server) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = defaultCollectInterval
+		}
+		if cfg.Client == nil {
+			cfg.Client = http.DefaultClient
+		}
+		srv.replication = &cfg
+	}
+}
+
+// startReplication serves /replicate and starts pulling from the peers.
+func (srv *server) startReplication() {
+	srv.mux.HandleFunc("/replicate", allowMethods(srv.replicateHandler, "GET", "HEAD"))
+	for _, peer := range srv.replication.Peers {
+		r := &replica{srv: srv, peer: strings.TrimSuffix(peer, "/"), cfg: srv.replication}
+		if err := srv.collectors.add(srv, r); err != nil && srv.logger != nil {
+			srv.logger.Printf("grada: replicate: %v", err)
+		}
+	}
+}
+
+// replicaMetric is an element of the response to a /replicate request.
+type replicaMetric struct {
+	Target string    `json:"target"`
+	Size   int       `json:"size"`
+	Values []float64 `json:"values"`
+	Times  []int64   `json:"times"`
+}
+
+// replicateHandler responds with the data points of all metrics since
+// the requested time.
+func (srv *server) replicateHandler(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		ns, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err, "cannot parse since")
+			return
+		}
+		since = time.Unix(0, ns)
+	}
+	srv.metrics.m.Lock()
+	all := make(map[string]*Metric, len(srv.metrics.metric))
+	for target, m := range srv.metrics.metric {
+		all[target] = m
+	}
+	srv.metrics.m.Unlock()
+
+	response := []replicaMetric{}
+	for target, m := range all {
+		counts := m.appendCounts(nil, since, endOfTime, math.MaxInt)
+		rm := replicaMetric{Target: target, Size: m.list.len()}
+		for _, c := range counts {
+			if c.T.IsZero() || math.IsNaN(c.N) || math.IsInf(c.N, 0) {
+				continue
+			}
+			rm.Values = append(rm.Values, c.N)
+			rm.Times = append(rm.Times, c.T.UnixNano())
+		}
+		if len(rm.Values) > 0 {
+			response = append(response, rm)
+		}
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal replicate response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// replica is the collector that pulls the data points of a peer.
+type replica struct {
+	srv  *server
+	peer string
+	cfg  *ReplicationConfig
+	last time.Time // start of the last successful pull
+}
+
+func (r *replica) Name() string            { return "replicate." + r.peer }
+func (r *replica) Interval() time.Duration { return r.cfg.Interval }
+
+// Collect merges the new data points of the peer into the metrics. It
+// returns no samples, as merging skips duplicates.
+func (r *replica) Collect(ctx context.Context) []Sample {
+	start := time.Now()
+	if err := r.pull(ctx); err != nil {
+		if r.srv.logger != nil {
+			r.srv.logger.Printf("grada: replicate from %s: %v", r.peer, err)
+		}
+		return nil
+	}
+	r.last = start
+	return nil
+}
+
+// pull fetches the data points since one interval before the last pull,
+// or all data points before the first pull, and merges them.
+func (r *replica) pull(ctx context.Context) error {
+	url := r.peer + "/replicate"
+	if !r.last.IsZero() {
+		url += "?since=" + strconv.FormatInt(r.last.Add(-r.cfg.Interval).UnixNano(), 10)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range r.cfg.Header {
+		req.Header[k] = vs
+	}
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("/replicate: %s", resp.Status)
+	}
+	var metrics []replicaMetric
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return fmt.Errorf("/replicate: %w", err)
+	}
+	for _, rm := range metrics {
+		if len(rm.Values) != len(rm.Times) {
+			return fmt.Errorf("/replicate: %d values and %d times for %s", len(rm.Values), len(rm.Times), rm.Target)
+		}
+		m, err := r.srv.metrics.Get(rm.Target)
+		if err != nil {
+			if m, err = r.srv.metrics.createAuto(rm.Target, max(rm.Size, 1)); err != nil {
+				m = r.srv.metrics.getOrCreate(rm.Target) // created concurrently
+			}
+		}
+		counts := make([]Count, len(rm.Values))
+		for i := range counts {
+			counts[i] = Count{rm.Values[i], time.Unix(0, rm.Times[i])}
+		}
+		m.merge(counts)
+	}
+	return nil
+}
+
+// merge adds the Counts whose time stamps are not in the buffer yet, and
+// returns how many it added.
+func (g *Metric) merge(counts []Count) int {
+	g.m.Lock()
+	have := make(map[int64]bool, g.list.len())
+	for _, ns := range g.list.ns {
+		if ns != noTime {
+			have[ns] = true
+		}
+	}
+	var added []Count
+	for _, c := range counts {
+		if have[c.T.UnixNano()] {
+			continue
+		}
+		have[c.T.UnixNano()] = true
+		if g.wal != nil {
+			g.wal.append(g.target, c)
+		}
+		g.unsorted = true
+		g.list.set(g.head, c)
+		g.head = (g.head + 1) % g.list.len()
+		added = append(added, c)
+	}
+	if len(added) > 0 {
+		g.seq = nextSeq()
+	}
+	subs := g.subs
+	g.m.Unlock()
+	for _, c := range added {
+		for _, s := range subs {
+			s.fn(c)
+		}
+	}
+	return len(added)
+}
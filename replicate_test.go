@@ -0,0 +1,134 @@
+package grada
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// allCounts returns all Counts of the metric of target, oldest first,
+// without the monotonic clock readings of their time stamps.
+func allCounts(t *testing.T, d *Dashboard, target string) []Count {
+	t.Helper()
+	m, err := d.GetMetric(target)
+	if err != nil {
+		t.Fatalf("GetMetric(%s): %v", target, err)
+	}
+	counts := m.appendCounts(nil, time.Time{}, time.Unix(1<<40, 0), math.MaxInt)
+	for i := range counts {
+		counts[i].T = time.Unix(0, counts[i].T.UnixNano())
+	}
+	return counts
+}
+
+func TestReplica_pull(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 123456789, time.UTC)
+	a := NewDashboard(WithReplication(ReplicationConfig{}))
+	cpu, _ := a.CreateMetricWithBufSize("cpu", 10)
+	cpu.AddCount(Count{1, t0})
+	cpu.AddCount(Count{2, t0.Add(time.Second)})
+	b := NewDashboard(WithReplication(ReplicationConfig{}))
+	b.Add("cpu", 0) // at the current time
+	b.Add("mem", 5)
+
+	tsA := httptest.NewServer(a.Handler())
+	defer tsA.Close()
+	tsB := httptest.NewServer(b.Handler())
+	defer tsB.Close()
+	fromA := &replica{srv: b.srv, peer: tsA.URL, cfg: a.srv.replication}
+	fromB := &replica{srv: a.srv, peer: tsB.URL, cfg: b.srv.replication}
+
+	for i := 0; i < 2; i++ { // the second round adds nothing
+		if err := fromA.pull(context.Background()); err != nil {
+			t.Fatalf("pull() from a: %v", err)
+		}
+		if err := fromB.pull(context.Background()); err != nil {
+			t.Fatalf("pull() from b: %v", err)
+		}
+	}
+	for _, target := range []string{"cpu", "mem"} {
+		if diff := cmp.Diff(allCounts(t, b, target), allCounts(t, a, target)); diff != "" {
+			t.Errorf("%s differs between b and a (-b +a):\n%s", target, diff)
+		}
+	}
+	if got := allCounts(t, b, "cpu"); len(got) != 3 || got[0].T.UnixNano() != t0.UnixNano() || got[1].N != 2 {
+		t.Errorf("cpu = %v, want 2 replicated data points and 1 local one", got)
+	}
+	if m, _ := b.GetMetric("cpu"); m.list.len() != DefaultAutoCreateSize {
+		t.Errorf("cpu of b has buffer size %d", m.list.len())
+	}
+	if m, _ := a.GetMetric("mem"); m.list.len() != DefaultAutoCreateSize {
+		t.Errorf("mem of a has buffer size %d, want the size of b", m.list.len())
+	}
+}
+
+func TestServer_replicateHandler(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{"all", "/replicate", 200, `[{"target":"cpu","size":5,"values":[1,2],"times":[1508930214000000000,1508930215000000000]}]`},
+		{"since", "/replicate?since=1508930214000000000", 200, `[{"target":"cpu","size":5,"values":[2],"times":[1508930215000000000]}]`},
+		{"none", "/replicate?since=1508930215000000000", 200, `[]`},
+		{"badSince", "/replicate?since=yesterday", 400, ""},
+	}
+	d := NewDashboard(WithReplication(ReplicationConfig{}))
+	cpu, _ := d.CreateMetricWithBufSize("cpu", 5)
+	cpu.AddCount(Count{2, t0.Add(time.Second)})
+	cpu.AddCount(Count{1, t0})
+	cpu.AddCount(Count{math.NaN(), t0.Add(2 * time.Second)})
+	d.CreateMetricWithBufSize("empty", 5)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Errorf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetric_merge(t *testing.T) {
+	t0 := time.Unix(100, 0)
+	m := &Metric{list: newCountBuffer(4)}
+	m.AddCount(Count{1, t0})
+	var notified int
+	m.Subscribe(func(Count) { notified++ })
+	added := m.merge([]Count{{1, t0}, {2, t0.Add(time.Second)}, {2, t0.Add(time.Second)}, {3, t0.Add(-time.Second)}})
+	if added != 2 || notified != 2 {
+		t.Errorf("merge() added %d and notified %d, want 2", added, notified)
+	}
+	var got []float64
+	for _, c := range m.appendCounts(nil, time.Time{}, time.Unix(1<<40, 0), 10) {
+		got = append(got, c.N)
+	}
+	if diff := cmp.Diff([]float64{3, 1, 2}, got); diff != "" {
+		t.Errorf("values mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithReplication(t *testing.T) {
+	d := NewDashboard(WithReplication(ReplicationConfig{Peers: []string{"http://localhost:1/", "http://localhost:2"}}))
+	defer d.Shutdown(context.Background())
+	want := []string{"replicate.http://localhost:1", "replicate.http://localhost:2"}
+	if diff := cmp.Diff(want, d.Collectors()); diff != "" {
+		t.Errorf("Collectors() mismatch (-want +got):\n%s", diff)
+	}
+	w := httptest.NewRecorder()
+	NewDashboard().Handler().ServeHTTP(w, httptest.NewRequest("GET", "/replicate", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error("/replicate is served without WithReplication")
+	}
+}
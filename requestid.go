@@ -0,0 +1,111 @@
+package grada
+
+// Request IDs for correlating Grafana errors with application logs.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader is the header that carries the request ID.
+// Incoming IDs are accepted; otherwise the server generates one.
+// Every response carries the ID in this header.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request that ctx belongs to,
+// or "" if there is none. The context is the one of the *http.Request
+// passed to grada's handlers.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithLogger makes the server log failed requests (status 400 and above)
+// to l, including the request ID.
+func WithLogger(l *log.Logger) Option {
+	return func(srv *server) {
+		srv.logger = l
+	}
+}
+
+// validRequestID reports whether an incoming request ID is safe to
+// echo back in headers, JSON, and logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Flush implements http.Flusher.
+func (sr *statusRecorder) Flush() {
+	http.NewResponseController(sr.ResponseWriter).Flush()
+}
+
+// requestID assigns an ID to every request, adds it to the request context
+// and to the response headers, and logs failed requests.
+func (srv *server) requestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		if srv.logger == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(sr, r)
+		if sr.status >= 400 {
+			srv.logger.Printf("grada: request %s: %s %s: status %d after %v",
+				id, r.Method, r.URL.Path, sr.status, time.Since(start))
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package grada
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_requestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"accepted", "abc-123", true},
+		{"generated", "", false},
+		{"rejected", `bad"id`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			srv := newServer(WithLogger(log.New(&logs, "", 0)))
+			r := httptest.NewRequest("GET", "/csv", nil) // fails: no target
+			r.Header.Set(RequestIDHeader, tt.incoming)
+			w := httptest.NewRecorder()
+			srv.handler.ServeHTTP(w, r)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" || (id == tt.incoming) != tt.wantSame {
+				t.Errorf("request ID %q for incoming %q", id, tt.incoming)
+			}
+			if !strings.Contains(w.Body.String(), `"requestId":"`+id+`"`) {
+				t.Errorf("error response %s does not contain request ID %s", w.Body.String(), id)
+			}
+			if !strings.Contains(logs.String(), "request "+id+": GET /csv: status 400") {
+				t.Errorf("log %q does not contain request ID %s", logs.String(), id)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Package runtimemetrics provides a grada collector for the performance of the
+Go runtime, read through runtime/metrics: GC pauses, the CPU fraction of the
+garbage collector, scheduler latencies, goroutines, and heap size.
+
+Register the collector with a dashboard:
+
+	d.AddCollector(runtimemetrics.New(10 * time.Second))
+
+The distributions of GC pauses and scheduler latencies become quantile
+metrics of the values observed since the previous collection, in seconds:
+"go.gc.pause.p50", "go.gc.pause.p90", "go.gc.pause.p99", "go.gc.pause.max",
+and likewise "go.sched.latency.*". An interval without GC pauses has no
+pause data points.
+*/
+package runtimemetrics
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/christophberger/grada"
+)
+
+// Prefix starts the target names of the collector.
+const Prefix = "go."
+
+// Names of the runtime metrics that the collector reads. The runtime
+// renamed the GC pause distribution in Go 1.22; the collector reads
+// whichever of the two names the runtime supports.
+const (
+	gcPauses       = "/sched/pauses/total/gc:seconds"
+	gcPausesOld    = "/gc/pauses:seconds"
+	gcCPU          = "/cpu/classes/gc/total:cpu-seconds"
+	totalCPU       = "/cpu/classes/total:cpu-seconds"
+	schedLatencies = "/sched/latencies:seconds"
+	goroutines     = "/sched/goroutines:goroutines"
+	heapObjects    = "/memory/classes/heap/objects:bytes"
+	gcCycles       = "/gc/cycles/total:gc-cycles"
+)
+
+// quantiles are the quantiles of distributions, by target name suffix.
+var quantiles = []struct {
+	suffix string
+	q      float64
+}{{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}, {"max", 1}}
+
+// collector reads runtime metrics. It keeps the previous values of
+// cumulative metrics to report differences between collections.
+type collector struct {
+	interval time.Duration
+
+	mu         sync.Mutex
+	samples    []metrics.Sample
+	prevCounts map[string][]uint64 // previous counts of distributions
+	prevSecs   map[string]float64  // previous values of CPU time counters
+}
+
+// New returns a collector of runtime metrics with the given interval.
+func New(interval time.Duration) grada.Collector {
+	supported := map[string]bool{}
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+	c := &collector{interval: interval, prevCounts: map[string][]uint64{}, prevSecs: map[string]float64{}}
+	pauses := gcPauses
+	if !supported[pauses] {
+		pauses = gcPausesOld
+	}
+	for _, name := range []string{pauses, gcCPU, totalCPU, schedLatencies, goroutines, heapObjects, gcCycles} {
+		if supported[name] {
+			c.samples = append(c.samples, metrics.Sample{Name: name})
+		}
+	}
+	return c
+}
+
+// Name returns the name of the collector, "go.runtime".
+func (c *collector) Name() string { return Prefix + "runtime" }
+
+// Interval returns the interval of the collector.
+func (c *collector) Interval() time.Duration { return c.interval }
+
+// Collect reads the runtime metrics.
+func (c *collector) Collect(ctx context.Context) []grada.Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	metrics.Read(c.samples)
+	var result []grada.Sample
+	var gcSecs, totalSecs float64
+	for _, s := range c.samples {
+		switch s.Name {
+		case gcPauses, gcPausesOld:
+			result = appendQuantiles(result, Prefix+"gc.pause.", c.delta(s))
+		case schedLatencies:
+			result = appendQuantiles(result, Prefix+"sched.latency.", c.delta(s))
+		case gcCPU:
+			gcSecs = c.counterDelta(s)
+		case totalCPU:
+			totalSecs = c.counterDelta(s)
+		case goroutines:
+			result = append(result, grada.Sample{Target: Prefix + "goroutines", N: float64(s.Value.Uint64())})
+		case heapObjects:
+			result = append(result, grada.Sample{Target: Prefix + "heap.objects_bytes", N: float64(s.Value.Uint64())})
+		case gcCycles:
+			result = append(result, grada.Sample{Target: Prefix + "gc.cycles", N: float64(s.Value.Uint64())})
+		}
+	}
+	if totalSecs > 0 {
+		result = append(result, grada.Sample{Target: Prefix + "gc.cpu_fraction", N: gcSecs / totalSecs})
+	}
+	return result
+}
+
+// counterDelta returns the difference of a cumulative float64 metric
+// since the previous collection, or 0 at the first collection.
+func (c *collector) counterDelta(s metrics.Sample) float64 {
+	prev, ok := c.prevSecs[s.Name]
+	c.prevSecs[s.Name] = s.Value.Float64()
+	if !ok {
+		return 0
+	}
+	return s.Value.Float64() - prev
+}
+
+// delta returns the histogram of the values observed since the previous
+// collection. The first collection returns all values observed so far.
+func (c *collector) delta(s metrics.Sample) *metrics.Float64Histogram {
+	h := s.Value.Float64Histogram()
+	d := &metrics.Float64Histogram{Counts: append([]uint64(nil), h.Counts...), Buckets: h.Buckets}
+	if prev := c.prevCounts[s.Name]; len(prev) == len(d.Counts) {
+		for i := range d.Counts {
+			d.Counts[i] -= prev[i]
+		}
+	}
+	// metrics.Read reuses the memory of the histogram, so keep a copy.
+	c.prevCounts[s.Name] = append(c.prevCounts[s.Name][:0], h.Counts...)
+	return d
+}
+
+// appendQuantiles appends the quantiles of h as samples for targets that
+// start with prefix. It appends nothing if h is empty.
+func appendQuantiles(dst []grada.Sample, prefix string, h *metrics.Float64Histogram) []grada.Sample {
+	for _, q := range quantiles {
+		v, ok := quantile(h, q.q)
+		if !ok {
+			return dst
+		}
+		dst = append(dst, grada.Sample{Target: prefix + q.suffix, N: v})
+	}
+	return dst
+}
+
+// quantile returns the q-quantile of the values in h, estimated as the
+// upper bound of the bucket that contains it, or the lower bound for the
+// last bucket if it is unbounded. It reports false if h is empty.
+func quantile(h *metrics.Float64Histogram, q float64) (float64, bool) {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var sum uint64
+	for i, n := range h.Counts {
+		sum += n
+		if sum >= rank {
+			if upper := h.Buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper, true
+			}
+			return h.Buckets[i], true
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1], true
+}
@@ -0,0 +1,66 @@
+package runtimemetrics
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuantile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{0, 5, 4, 1},
+		Buckets: []float64{0, 1, 2, 3, math.Inf(1)},
+	}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 2},
+		{0.5, 2},
+		{0.6, 3},
+		{0.9, 3},
+		{1, 3}, // lower bound of the unbounded bucket
+	}
+	for _, tt := range tests {
+		if got, ok := quantile(h, tt.q); !ok || got != tt.want {
+			t.Errorf("quantile(%v) = %v, %v, want %v", tt.q, got, ok, tt.want)
+		}
+	}
+	if _, ok := quantile(&metrics.Float64Histogram{Counts: []uint64{0}, Buckets: []float64{0, 1}}, 0.5); ok {
+		t.Errorf("quantile() of an empty histogram reports ok")
+	}
+}
+
+func TestCollector_Collect(t *testing.T) {
+	c := New(time.Second)
+	if c.Name() != "go.runtime" || c.Interval() != time.Second {
+		t.Errorf("collector has name %q and interval %v", c.Name(), c.Interval())
+	}
+	c.Collect(context.Background())
+	runtime.GC()
+	runtime.GC()
+
+	targets := map[string]float64{}
+	for _, s := range c.Collect(context.Background()) {
+		if !strings.HasPrefix(s.Target, Prefix) {
+			t.Errorf("target %q does not start with %q", s.Target, Prefix)
+		}
+		targets[s.Target] = s.N
+	}
+	for _, want := range []string{"go.gc.pause.p50", "go.gc.pause.max", "go.goroutines", "go.heap.objects_bytes", "go.gc.cycles"} {
+		if _, ok := targets[want]; !ok {
+			t.Errorf("no sample for %s in %v", want, targets)
+		}
+	}
+	if targets["go.gc.pause.max"] < targets["go.gc.pause.p50"] {
+		t.Errorf("maximum GC pause %v is below the median %v", targets["go.gc.pause.max"], targets["go.gc.pause.p50"])
+	}
+	if f, ok := targets["go.gc.cpu_fraction"]; ok && (f < 0 || f > 1) {
+		t.Errorf("GC CPU fraction %v", f)
+	}
+
+}
@@ -0,0 +1,180 @@
+package grada
+
+// Search for target names.
+//
+// Grafana sends the text that the user has typed into the metric picker:
+//
+//	POST /search
+//	{"target": "servers.web"}
+//
+// By default, the server responds with all target names. With
+// WithSearchTree, it treats "." and "/" in target names as hierarchy
+// separators and responds with one level at a time, like Graphite's
+// metric finder. Branches end with their separator:
+//
+//	["servers.web-1.", "servers.web-2.", "servers.webproxy"]
+//
+// Search texts of the form "category:<name> <text>" restrict the search
+// to the targets of a category (see Dashboard.SetCategories). With
+// "grouped": true in the request, or grouped=true in the URL, the server
+// groups the results by category:
+//
+//	[{"category": "db", "targets": ["db.conns", "db.queries"]},
+//	 {"category": "", "targets": ["uptime"]}]
+//
+// Targets with several categories appear in each group; uncategorized
+// targets are in the group with the empty name, which comes last.
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hierarchySeparators separate the levels of hierarchical target names.
+const hierarchySeparators = "./"
+
+// WithSearchTree makes /search return the target names one hierarchy
+// level at a time, which keeps metric pickers usable with thousands of
+// targets. Names are split at "." and "/".
+//
+// The search text selects the level: "" lists the top level, "servers."
+// the level below "servers", and "servers.web" the names and branches of
+// that level that start with "web". A trailing "*" is ignored, so that
+// Graphite-style queries like "servers.*" work, too.
+func WithSearchTree() Option {
+	return func(srv *server) {
+		srv.searchTree = true
+	}
+}
+
+// categoryPrefix starts search texts that select a category.
+const categoryPrefix = "category:"
+
+// SetCategories assigns a target to categories, such as the subsystems
+// of an application, for finding it with /search. It replaces any previous
+// categories of the target. Like aliases, categories belong to the target
+// name, even if no metric of that name exists yet.
+func (d *Dashboard) SetCategories(target string, categories ...string) {
+	copied := append([]string(nil), categories...)
+	d.srv.meta.update(target, func(m *targetMeta) { m.categories = copied })
+}
+
+// searchRequest is the body of a /search request.
+type searchRequest struct {
+	Target  string `json:"target"`
+	Grouped bool   `json:"grouped"`
+}
+
+// searchGroup is an element of a grouped /search response.
+type searchGroup struct {
+	Category string   `json:"category"`
+	Targets  []string `json:"targets"`
+}
+
+// parseSearch returns the search request of r, from the JSON body or
+// the "target" and "grouped" query parameters. It fails only if the body
+// cannot be read.
+func parseSearch(w http.ResponseWriter, r *http.Request) (searchRequest, error) {
+	var req searchRequest
+	if r.Body != nil {
+		body, err := readQueryBody(w, r)
+		if err != nil {
+			return req, err
+		}
+		json.Unmarshal(body, &req)
+	}
+	params := r.URL.Query()
+	if t := params.Get("target"); t != "" {
+		req.Target = t
+	}
+	if g, err := strconv.ParseBool(params.Get("grouped")); err == nil {
+		req.Grouped = g
+	}
+	return req, nil
+}
+
+// splitCategory splits a search text into a category and the rest.
+func splitCategory(q string) (category, text string, ok bool) {
+	if !strings.HasPrefix(q, categoryPrefix) {
+		return "", q, false
+	}
+	category, text, _ = strings.Cut(q[len(categoryPrefix):], " ")
+	return category, strings.TrimSpace(text), true
+}
+
+// search returns the target names that match the search text q.
+func (srv *server) search(q string) []string {
+	targets := srv.targets()
+	if category, text, ok := splitCategory(q); ok {
+		var in []string
+		for _, t := range targets {
+			for _, c := range srv.meta.get(t).categories {
+				if c == category {
+					in = append(in, t)
+					break
+				}
+			}
+		}
+		targets, q = in, text
+	}
+	if srv.searchTree {
+		targets = treeLevel(targets, q)
+	}
+	if targets == nil {
+		targets = []string{}
+	}
+	return targets
+}
+
+// groupByCategory groups target names by their categories.
+func (srv *server) groupByCategory(targets []string) []searchGroup {
+	groups := map[string][]string{}
+	for _, t := range targets {
+		categories := srv.meta.get(t).categories
+		if len(categories) == 0 {
+			categories = []string{""}
+		}
+		for _, c := range categories {
+			groups[c] = append(groups[c], t)
+		}
+	}
+	result := make([]searchGroup, 0, len(groups))
+	for c, ts := range groups {
+		result = append(result, searchGroup{c, ts})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].Category, result[j].Category
+		if a == "" || b == "" {
+			return b == "" && a != "" // uncategorized last
+		}
+		return a < b
+	})
+	return result
+}
+
+// treeLevel returns the names and branches of the level of names that
+// the search text q selects.
+func treeLevel(names []string, q string) []string {
+	q = strings.TrimSuffix(q, "*")
+	parent := q[:strings.LastIndexAny(q, hierarchySeparators)+1]
+	seen := map[string]bool{}
+	var level []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, q) {
+			continue
+		}
+		entry := name
+		if i := strings.IndexAny(name[len(parent):], hierarchySeparators); i >= 0 {
+			entry = name[:len(parent)+i+1] // a branch, including the separator
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			level = append(level, entry)
+		}
+	}
+	sort.Strings(level)
+	return level
+}
@@ -0,0 +1,98 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTreeLevel(t *testing.T) {
+	names := []string{"cpu", "servers.web-1.cpu", "servers.web-1.mem", "servers.web-2.cpu", "servers.webproxy", "servers.db/disk/sda"}
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"", []string{"cpu", "servers."}},
+		{"servers.", []string{"servers.db/", "servers.web-1.", "servers.web-2.", "servers.webproxy"}},
+		{"servers.*", []string{"servers.db/", "servers.web-1.", "servers.web-2.", "servers.webproxy"}},
+		{"servers.web", []string{"servers.web-1.", "servers.web-2.", "servers.webproxy"}},
+		{"servers.web-1.", []string{"servers.web-1.cpu", "servers.web-1.mem"}},
+		{"servers.db/disk/", []string{"servers.db/disk/sda"}},
+		{"nope", nil},
+	}
+	for _, tt := range tests {
+		if got := treeLevel(names, tt.q); !cmp.Equal(got, tt.want) {
+			t.Errorf("treeLevel(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestServer_searchTree(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithSearchTree()}} {
+		d := NewDashboard(opts...)
+		d.CreateMetricWithBufSize("app.requests", 10)
+		d.CreateMetricWithBufSize("app.errors", 10)
+
+		want := `["app.errors","app.requests"]`
+		if opts != nil {
+			want = `["app."]`
+		}
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(`{"target": ""}`)))
+		if w.Body.String() != want {
+			t.Errorf("options %v: search response %s, want %s", opts, w.Body.String(), want)
+		}
+	}
+
+	d := NewDashboard(WithSearchTree())
+	d.CreateMetricWithBufSize("app.requests", 10)
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/search?target=app.", nil))
+	if want := `["app.requests"]`; w.Body.String() != want {
+		t.Errorf("GET search response %s, want %s", w.Body.String(), want)
+	}
+}
+
+func TestServer_searchCategories(t *testing.T) {
+	d := NewDashboard()
+	d.CreateMetricWithBufSize("db.conns", 10)
+	d.CreateMetricWithBufSize("db.queries", 10)
+	d.CreateMetricWithBufSize("web.requests", 10)
+	d.CreateMetricWithBufSize("uptime", 10)
+	d.SetCategories("db.conns", "db")
+	d.SetCategories("db.queries", "db", "sql")
+	d.SetCategories("web.requests", "web")
+
+	tests := []struct {
+		name, method, url, body, want string
+	}{
+		{"category", "POST", "/search", `{"target": "category:db"}`, `["db.conns","db.queries"]`},
+		{"categoryGET", "GET", "/search?target=category:web", "", `["web.requests"]`},
+		{"unknownCategory", "POST", "/search", `{"target": "category:nope"}`, `[]`},
+		{"grouped", "POST", "/search", `{"target": "", "grouped": true}`,
+			`[{"category":"db","targets":["db.conns","db.queries"]},{"category":"sql","targets":["db.queries"]},{"category":"web","targets":["web.requests"]},{"category":"","targets":["uptime"]}]`},
+		{"groupedGET", "GET", "/search?target=category:sql&grouped=true", "",
+			`[{"category":"db","targets":["db.queries"]},{"category":"sql","targets":["db.queries"]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			if w.Body.String() != tt.want {
+				t.Errorf("search response %s, want %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+
+	tree := NewDashboard(WithSearchTree())
+	tree.CreateMetricWithBufSize("db.conns", 10)
+	tree.CreateMetricWithBufSize("web.requests", 10)
+	tree.SetCategories("db.conns", "db")
+	w := httptest.NewRecorder()
+	tree.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/search", strings.NewReader(`{"target": "category:db db."}`)))
+	if want := `["db.conns"]`; w.Body.String() != want {
+		t.Errorf("tree search response %s, want %s", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,48 @@
+package grada
+
+// Logging of slow queries.
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SlowQueryTarget is the target of the metric that counts slow queries.
+// See WithSlowQueryLog.
+const SlowQueryTarget = "grada.queries.slow"
+
+// WithSlowQueryLog logs every /query request whose handling takes longer
+// than threshold, with its targets, its time range, and the number of
+// data points or table rows of its response, so that slow dashboards can
+// be tracked down. The requests are logged to the logger of WithLogger,
+// and counted in the metric SlowQueryTarget, which is created as by
+// Dashboard.Add.
+//
+// The time of a request includes reading and decoding the request, and
+// writing the response, but not waiting for a slot of
+// WithMaxConcurrentQueries.
+func WithSlowQueryLog(threshold time.Duration) Option {
+	return func(srv *server) {
+		srv.slowQuery = threshold
+	}
+}
+
+// logSlowQuery logs and counts the query q of r if it took longer than
+// the slow query threshold.
+func (srv *server) logSlowQuery(r *http.Request, q *query, took time.Duration, points int) {
+	if srv.slowQuery <= 0 || took <= srv.slowQuery {
+		return
+	}
+	srv.increment(SlowQueryTarget, time.Time{})
+	if srv.logger == nil {
+		return
+	}
+	targets := make([]string, len(q.Targets))
+	for i, t := range q.Targets {
+		targets[i] = t.Target
+	}
+	srv.logger.Printf("grada: request %s: slow query took %v: targets %q, range %s to %s, %d data points",
+		RequestIDFromContext(r.Context()), took, strings.Join(targets, ","),
+		q.Range.From.Format(time.RFC3339), q.Range.To.Format(time.RFC3339), points)
+}
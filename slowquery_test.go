@@ -0,0 +1,54 @@
+package grada
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_logSlowQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		wantLog   string
+	}{
+		{"off", 0, ""},
+		{"fast", time.Hour, ""},
+		{"slow", time.Nanosecond, `slow query took`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			d := NewDashboard(WithSlowQueryLog(tt.threshold), WithLogger(log.New(&logs, "", 0)))
+			m, _ := d.CreateMetricWithBufSize("cpu", 10)
+			t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+			for i := 0; i < 3; i++ {
+				m.AddWithTime(float64(i), t0.Add(time.Duration(i)*time.Second))
+			}
+			body := `{"range": {"from": "2017-10-25T10:00:00Z", "to": "2017-10-25T12:00:00Z"}, "maxDataPoints": 10, "targets": [{"target": "cpu"}, {"target": "cpu"}]}`
+			d.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+
+			got := logs.String()
+			if tt.wantLog == "" {
+				if got != "" {
+					t.Errorf("logged %q, want nothing", got)
+				}
+				if _, err := d.GetMetric(SlowQueryTarget); err == nil {
+					t.Errorf("metric %s exists", SlowQueryTarget)
+				}
+				return
+			}
+			for _, want := range []string{tt.wantLog, `targets "cpu,cpu"`, "range 2017-10-25T10:00:00Z to 2017-10-25T12:00:00Z", "6 data points"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("logged %q, want %q", got, want)
+				}
+			}
+			if n := allCounts(t, d, SlowQueryTarget); len(n) != 1 || n[0].N != 1 {
+				t.Errorf("%s has data points %v, want 1", SlowQueryTarget, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package grada
+
+// Snapshots of table targets as time series.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SnapshotConfig configures Dashboard.SnapshotTable.
+type SnapshotConfig struct {
+	// Schedule is the cron expression of the times of the snapshots, as
+	// for Cron. Default is every minute, "* * * * *".
+	Schedule string
+	// Key is the column that identifies a row, such as "Host" or "Queue".
+	// Rows with an empty key are skipped.
+	Key string
+	// Columns are the columns to record. Default is all number columns.
+	// Cells that are not numbers are skipped.
+	Columns []string
+	// Prefix starts the target names. Default is the name of the table
+	// target and a dot.
+	Prefix string
+}
+
+// SnapshotTable records the number columns of the table target table as
+// time series, on the schedule of cfg.Schedule. Each snapshot adds the
+// cells of every row to the metrics "<prefix><key>.<column>", where key is
+// the cell of the key column, so that a table of the current state, such
+// as the queue lengths of a broker, turns into charts of its history:
+//
+//	d.SnapshotTable("queues", grada.SnapshotConfig{
+//		Schedule: "*/5 * * * *",
+//		Key:      "Queue",
+//		Columns:  []string{"Length", "Consumers"},
+//	})
+//	// records "queues.orders.Length", "queues.orders.Consumers", ...
+//
+// The table function receives the time of the snapshot as both ends of
+// the time range. Metrics that do not exist yet are created as by
+// Dashboard.Add.
+//
+// The snapshots run as a collector named "snapshot.<table>"; remove it
+// with Dashboard.RemoveCollector. SnapshotTable fails with
+// ErrMetricNotFound if table is not a table target, and if Key is empty
+// or Schedule is malformed.
+func (d *Dashboard) SnapshotTable(table string, cfg SnapshotConfig) error {
+	if cfg.Key == "" {
+		return errors.New("snapshot of table " + table + ": no key column")
+	}
+	d.srv.tablesMu.Lock()
+	_, exists := d.srv.tables[table]
+	d.srv.tablesMu.Unlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrMetricNotFound, table)
+	}
+	if cfg.Schedule == "" {
+		cfg.Schedule = "* * * * *"
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = table + "."
+	}
+	return d.AddCollector(&snapshotCollector{srv: d.srv, table: table, cfg: cfg}, Cron(cfg.Schedule))
+}
+
+// snapshotCollector is the collector of SnapshotTable.
+type snapshotCollector struct {
+	srv   *server
+	table string
+	cfg   SnapshotConfig
+}
+
+func (c *snapshotCollector) Name() string { return "snapshot." + c.table }
+
+// Interval limits the duration of a snapshot to a minute, the shortest
+// time between two snapshots.
+func (c *snapshotCollector) Interval() time.Duration { return time.Minute }
+
+// Collect takes a snapshot of the table. Failures are logged.
+func (c *snapshotCollector) Collect(ctx context.Context) []Sample {
+	samples, err := c.snapshot(time.Now())
+	if err != nil && c.srv.logger != nil {
+		c.srv.logger.Printf("grada: snapshot of table %s: %v", c.table, err)
+	}
+	return samples
+}
+
+// snapshot returns the samples of all tables of the target at time now.
+func (c *snapshotCollector) snapshot(now time.Time) ([]Sample, error) {
+	tables, err := c.srv.tablesFor(c.table, now, now)
+	if err != nil {
+		return nil, err
+	}
+	var samples []Sample
+	for _, t := range tables {
+		s, err := c.samples(t)
+		if err != nil {
+			return samples, err
+		}
+		samples = append(samples, s...)
+	}
+	return samples, nil
+}
+
+// samples returns the samples of the rows of t.
+func (c *snapshotCollector) samples(t *Table) ([]Sample, error) {
+	columns := t.Columns
+	if len(columns) == 0 {
+		columns = inferColumns(t.Rows)
+	}
+	key, err := columnIndex(columns, c.cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	var values []int
+	if len(c.cfg.Columns) == 0 {
+		for i, col := range columns {
+			if col.Type == ColumnNumber && i != key {
+				values = append(values, i)
+			}
+		}
+	}
+	for _, name := range c.cfg.Columns {
+		i, err := columnIndex(columns, name)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, i)
+	}
+
+	var samples []Sample
+	for _, r := range t.Rows {
+		k := cell(r, key)
+		if k == nil || k == "" {
+			continue
+		}
+		prefix := c.cfg.Prefix + fmt.Sprint(k) + "."
+		for _, i := range values {
+			v := cell(r, i)
+			if _, isText := v.(string); isText {
+				continue // number would parse time stamps
+			}
+			n, ok := number(v)
+			if !ok {
+				continue
+			}
+			samples = append(samples, Sample{Target: prefix + columns[i].Text, N: n})
+		}
+	}
+	return samples, nil
+}
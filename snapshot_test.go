@@ -0,0 +1,140 @@
+package grada
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func queuesTable(from, to time.Time) (*Table, error) {
+	return &Table{
+		Columns: []Column{
+			{Text: "Queue", Type: ColumnString},
+			{Text: "Length", Type: ColumnNumber},
+			{Text: "Consumers", Type: ColumnNumber},
+			{Text: "State", Type: ColumnString},
+		},
+		Rows: [][]interface{}{
+			{"orders", 12, uint8(3), "ok"},
+			{"mails", 0.5, nil, "ok"},
+			{"", 7, 1, "ok"},
+			{nil, 7, 1, "ok"},
+		},
+	}, nil
+}
+
+func TestDashboard_SnapshotTable(t *testing.T) {
+	d := NewDashboard()
+	if err := d.CreateTable("queues", queuesTable); err != nil {
+		t.Fatalf("CreateTable(): %v", err)
+	}
+	tests := []struct {
+		name    string
+		table   string
+		cfg     SnapshotConfig
+		wantErr bool
+		wantIs  error
+	}{
+		{"noKey", "queues", SnapshotConfig{}, true, nil},
+		{"noTable", "topics", SnapshotConfig{Key: "Topic"}, true, ErrMetricNotFound},
+		{"badSchedule", "queues", SnapshotConfig{Key: "Queue", Schedule: "* * *"}, true, nil},
+		{"ok", "queues", SnapshotConfig{Key: "Queue", Schedule: "0 0 1 1 *"}, false, nil},
+		{"exists", "queues", SnapshotConfig{Key: "Queue"}, true, ErrCollectorExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.SnapshotTable(tt.table, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SnapshotTable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("SnapshotTable() error = %v, want %v", err, tt.wantIs)
+			}
+		})
+	}
+	if got := d.Collectors(); !cmp.Equal(got, []string{"snapshot.queues"}) {
+		t.Errorf("Collectors() = %q", got)
+	}
+	if err := d.RemoveCollector("snapshot.queues"); err != nil {
+		t.Errorf("RemoveCollector(): %v", err)
+	}
+}
+
+func TestSnapshotCollector_snapshot(t *testing.T) {
+	d := NewDashboard()
+	if err := d.CreateTable("queues", queuesTable); err != nil {
+		t.Fatalf("CreateTable(): %v", err)
+	}
+	tests := []struct {
+		name    string
+		cfg     SnapshotConfig
+		want    []Sample
+		wantErr bool
+	}{
+		{"numberColumns", SnapshotConfig{Key: "Queue", Prefix: "q."}, []Sample{
+			{Target: "q.orders.Length", N: 12},
+			{Target: "q.orders.Consumers", N: 3},
+			{Target: "q.mails.Length", N: 0.5},
+		}, false},
+		{"selectedColumns", SnapshotConfig{Key: "Queue", Prefix: "q.", Columns: []string{"Consumers", "State"}}, []Sample{
+			{Target: "q.orders.Consumers", N: 3},
+		}, false},
+		{"keyColumn", SnapshotConfig{Key: "State", Prefix: "q.", Columns: []string{"Length"}}, []Sample{
+			{Target: "q.ok.Length", N: 12},
+			{Target: "q.ok.Length", N: 0.5},
+			{Target: "q.ok.Length", N: 7},
+			{Target: "q.ok.Length", N: 7},
+		}, false},
+		{"noKeyColumn", SnapshotConfig{Key: "Name"}, nil, true},
+		{"noColumn", SnapshotConfig{Key: "Queue", Columns: []string{"Size"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &snapshotCollector{srv: d.srv, table: "queues", cfg: tt.cfg}
+			got, err := c.snapshot(time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("snapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("snapshot() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDashboard_SnapshotTable_collect(t *testing.T) {
+	d := NewDashboard()
+	if err := d.CreateTable("queues", queuesTable); err != nil {
+		t.Fatalf("CreateTable(): %v", err)
+	}
+	c := &snapshotCollector{srv: d.srv, table: "queues", cfg: SnapshotConfig{Key: "Queue", Prefix: "queues."}}
+	if err := d.AddCollector(c); err != nil {
+		t.Fatalf("AddCollector(): %v", err)
+	}
+	defer d.RemoveCollector(c.Name())
+	waitForRun(t, d)
+	m, err := d.GetMetric("queues.orders.Length")
+	if err != nil {
+		t.Fatalf("GetMetric(): %v", err)
+	}
+	if m.head == 0 || m.list.at(0).N != 12 {
+		t.Errorf("metric has head %d and first data point %v, want 12", m.head, m.list.at(0))
+	}
+}
+
+// waitForRun waits until the first collector of d has completed a run.
+func waitForRun(t *testing.T, d *Dashboard) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if st := d.CollectorStatus(); len(st) > 0 && st[0].Runs > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("collector did not run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,399 @@
+package grada
+
+// A minimal SQL dialect for table targets.
+//
+// With WithSQL, the target of a table query may be a statement of the form
+//
+//	SELECT * | column [, column ...]
+//	FROM target
+//	[WHERE condition [AND condition ...]]
+//	[ORDER BY column [ASC | DESC] [, ...]]
+//	[LIMIT n [OFFSET m]]
+//
+// where a condition is one of
+//
+//	column = | != | <> | < | <= | > | >= value
+//	column LIKE 'pattern'
+//	column IS [NOT] NULL
+//
+// Values are numbers or 'single-quoted strings'; times compare with
+// strings in RFC 3339 format. LIKE patterns match any text with % and any
+// single character with _. Keywords are case-insensitive. Names that are
+// not plain words, such as column names with spaces, go in "double quotes".
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// WithSQL lets table queries use SQL statements as targets, so that panel
+// authors can select, filter, sort, and limit the rows of table targets
+// without changes to the application. See sql.go for the supported syntax.
+func WithSQL() Option {
+	return func(srv *server) {
+		srv.sql = true
+	}
+}
+
+// isSQL reports whether target is an SQL statement.
+func isSQL(target string) bool {
+	word, _, _ := strings.Cut(strings.TrimSpace(target), " ")
+	return strings.EqualFold(word, "select")
+}
+
+// sqlQuery is a parsed SQL statement.
+type sqlQuery struct {
+	columns []string // nil for *
+	from    string
+	filters []tableFilter
+	sorts   []tableSort
+	limit   int // -1 for no limit
+	offset  int
+}
+
+// sqlToken is a token of an SQL statement.
+type sqlToken struct {
+	kind  byte   // 'w'ord, 'q'uoted name, 's'tring, 'n'umber, or 'o'perator
+	text  string // the word, name, string, number, or operator
+	value float64
+}
+
+// is reports whether the token is the keyword kw.
+func (t sqlToken) is(kw string) bool {
+	return t.kind == 'w' && strings.EqualFold(t.text, kw)
+}
+
+// isNameRune reports whether r may be part of an unquoted name.
+// Target names often contain dots, colons, and dashes.
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:-/", r)
+}
+
+// sqlTokens splits an SQL statement into tokens.
+func sqlTokens(s string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(rs); j++ {
+				if rs[j] == r {
+					if j+1 < len(rs) && rs[j+1] == r { // doubled quote
+						b.WriteRune(r)
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("%w: unterminated %c", ErrBadTableQuery, r)
+			}
+			kind := byte('s')
+			if r == '"' {
+				kind = 'q'
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: b.String()})
+			i = j + 1
+		case strings.ContainsRune("=<>!,*", r):
+			op := string(r)
+			if i+1 < len(rs) && (r == '<' || r == '>' || r == '!') && strings.ContainsRune("=>", rs[i+1]) {
+				op += string(rs[i+1])
+			}
+			if op == "!>" || op == ">>" || op == "!" {
+				return nil, fmt.Errorf("%w: unexpected %q", ErrBadTableQuery, op)
+			}
+			tokens = append(tokens, sqlToken{kind: 'o', text: op})
+			i += len(op)
+		case isNameRune(r):
+			j := i
+			for j < len(rs) && isNameRune(rs[j]) {
+				j++
+			}
+			word := string(rs[i:j])
+			if v, err := strconv.ParseFloat(word, 64); err == nil {
+				tokens = append(tokens, sqlToken{kind: 'n', text: word, value: v})
+			} else {
+				tokens = append(tokens, sqlToken{kind: 'w', text: word})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q", ErrBadTableQuery, r)
+		}
+	}
+	return tokens, nil
+}
+
+// sqlParser parses a token list.
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return sqlToken{}
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *sqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrBadTableQuery, fmt.Sprintf(format, args...))
+}
+
+// keyword consumes the keyword kw.
+func (p *sqlParser) keyword(kw string) error {
+	if t := p.next(); !t.is(kw) {
+		return p.errorf("expected %s, found %q", kw, t.text)
+	}
+	return nil
+}
+
+// name consumes a column or target name.
+func (p *sqlParser) name() (string, error) {
+	t := p.next()
+	if t.kind != 'w' && t.kind != 'q' {
+		return "", p.errorf("expected a name, found %q", t.text)
+	}
+	return t.text, nil
+}
+
+// number consumes a non-negative integer.
+func (p *sqlParser) number() (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != 'n' || err != nil || n < 0 {
+		return 0, p.errorf("expected a number, found %q", t.text)
+	}
+	return n, nil
+}
+
+// parseSQL parses an SQL statement.
+func parseSQL(s string) (*sqlQuery, error) {
+	tokens, err := sqlTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+	q := &sqlQuery{limit: -1}
+
+	if err := p.keyword("select"); err != nil {
+		return nil, err
+	}
+	if p.peek().text == "*" && p.peek().kind == 'o' {
+		p.next()
+	} else {
+		for {
+			c, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			q.columns = append(q.columns, c)
+			if p.peek().text != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.keyword("from"); err != nil {
+		return nil, err
+	}
+	if q.from, err = p.name(); err != nil {
+		return nil, err
+	}
+
+	if p.peek().is("where") {
+		p.next()
+		for {
+			f, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+			q.filters = append(q.filters, f)
+			if !p.peek().is("and") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if p.peek().is("order") {
+		p.next()
+		if err := p.keyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			c, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			s := tableSort{Column: c}
+			switch {
+			case p.peek().is("desc"):
+				s.Desc = true
+				p.next()
+			case p.peek().is("asc"):
+				p.next()
+			}
+			q.sorts = append(q.sorts, s)
+			if p.peek().text != "," {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if p.peek().is("limit") {
+		p.next()
+		if q.limit, err = p.number(); err != nil {
+			return nil, err
+		}
+		if p.peek().is("offset") {
+			p.next()
+			if q.offset, err = p.number(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return q, nil
+}
+
+// condition parses a WHERE condition.
+func (p *sqlParser) condition() (tableFilter, error) {
+	c, err := p.name()
+	if err != nil {
+		return tableFilter{}, err
+	}
+	f := tableFilter{Column: c}
+	op := p.next()
+	switch {
+	case op.is("is"):
+		f.Op = "="
+		if p.peek().is("not") {
+			p.next()
+			f.Op = "!="
+		}
+		return f, p.keyword("null")
+	case op.is("like"):
+		f.Op = "like"
+	case op.kind == 'o' && op.text == "<>":
+		f.Op = "!="
+	case op.kind == 'o' && filterOps[op.text]:
+		f.Op = op.text
+	default:
+		return tableFilter{}, p.errorf("expected an operator, found %q", op.text)
+	}
+	v := p.next()
+	switch v.kind {
+	case 's':
+		f.Value = v.text
+	case 'n':
+		f.Value = v.value
+	default:
+		return tableFilter{}, p.errorf("expected a value, found %q", v.text)
+	}
+	if f.Op == "like" {
+		if _, ok := f.Value.(string); !ok {
+			return tableFilter{}, p.errorf("LIKE requires a string pattern")
+		}
+	}
+	return f, nil
+}
+
+// likeMatch reports whether s matches the LIKE pattern.
+func likeMatch(s, pattern string) bool {
+	sr, pr := []rune(s), []rune(pattern)
+	// Classic wildcard matching with backtracking to the last %.
+	i, j, star, mark := 0, 0, -1, 0
+	for i < len(sr) {
+		switch {
+		case j < len(pr) && (pr[j] == '_' || pr[j] == sr[i]):
+			i++
+			j++
+		case j < len(pr) && pr[j] == '%':
+			star, mark = j, i
+			j++
+		case star >= 0:
+			j = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for j < len(pr) && pr[j] == '%' {
+		j++
+	}
+	return j == len(pr)
+}
+
+// sqlTables executes an SQL statement against the tables of its target.
+func (srv *server) sqlTables(statement string, from, to time.Time) ([]*Table, error) {
+	q, err := parseSQL(statement)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := srv.tablesFor(q.from, from, to)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Table, len(tables))
+	for i, t := range tables {
+		t, err := t.filterSort(q.filters, q.sorts)
+		if err != nil {
+			return nil, err
+		}
+		rows := t.Rows[min(q.offset, len(t.Rows)):]
+		if q.limit >= 0 && q.limit < len(rows) {
+			rows = rows[:q.limit]
+		}
+		t.Rows = rows
+		if q.columns != nil {
+			if t, err = t.project(q.columns); err != nil {
+				return nil, err
+			}
+		}
+		result[i] = t
+	}
+	return result, nil
+}
+
+// project returns a table with the given columns of t.
+func (t *Table) project(names []string) (*Table, error) {
+	idx := make([]int, len(names))
+	p := &Table{Name: t.Name, Columns: make([]Column, len(names)), Rows: make([][]interface{}, len(t.Rows))}
+	for i, name := range names {
+		j, err := columnIndex(t.Columns, name)
+		if err != nil {
+			return nil, err
+		}
+		idx[i] = j
+		p.Columns[i] = t.Columns[j]
+	}
+	for i, r := range t.Rows {
+		p.Rows[i] = make([]interface{}, len(idx))
+		for k, j := range idx {
+			p.Rows[i][k] = cell(r, j)
+		}
+	}
+	return p, nil
+}
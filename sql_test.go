@@ -0,0 +1,122 @@
+package grada
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		want    *sqlQuery
+		wantErr bool
+	}{
+		{
+			"star",
+			"SELECT * FROM hosts",
+			&sqlQuery{from: "hosts", limit: -1},
+			false,
+		},
+		{
+			"full",
+			`select Name, "Load (1m)" from app.hosts where Region = 'eu' and Load >= 0.5 and Name like 'web%' and Owner is not null order by Load desc, Name limit 10 offset 20`,
+			&sqlQuery{
+				columns: []string{"Name", "Load (1m)"},
+				from:    "app.hosts",
+				filters: []tableFilter{{"Region", "=", "eu"}, {"Load", ">=", 0.5}, {"Name", "like", "web%"}, {"Owner", "!=", nil}},
+				sorts:   []tableSort{{"Load", true}, {"Name", false}},
+				limit:   10,
+				offset:  20,
+			},
+			false,
+		},
+		{
+			"quotes",
+			`SELECT * FROM t WHERE Name <> 'it''s'`,
+			&sqlQuery{from: "t", filters: []tableFilter{{"Name", "!=", "it's"}}, limit: -1},
+			false,
+		},
+		{"noFrom", "SELECT *", nil, true},
+		{"badOp", "SELECT * FROM t WHERE a ! 1", nil, true},
+		{"unterminated", "SELECT * FROM t WHERE a = 'x", nil, true},
+		{"trailing", "SELECT * FROM t LIMIT 1 2", nil, true},
+		{"negativeLimit", "SELECT * FROM t LIMIT -1", nil, true},
+		{"likeNumber", "SELECT * FROM t WHERE a LIKE 1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSQL(tt.sql)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrBadTableQuery) {
+					t.Errorf("parseSQL() error = %v, want ErrBadTableQuery", err)
+				}
+				return
+			}
+			if !cmp.Equal(got, tt.want, cmp.AllowUnexported(sqlQuery{})) {
+				t.Errorf("parseSQL():\ngot  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"web-1", "web%", true},
+		{"web-1", "%-_", true},
+		{"web-12", "%-_", false},
+		{"db", "web%", false},
+		{"", "%", true},
+		{"abc", "a%c%", true},
+	}
+	for _, tt := range tests {
+		if got := likeMatch(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("likeMatch(%q, %q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestServer_sqlTables(t *testing.T) {
+	table := &Table{
+		Columns: []Column{{"Host", ColumnString}, {"Region", ColumnString}, {"Load", ColumnNumber}},
+		Rows:    [][]interface{}{{"a", "eu", 1}, {"b", "us", 3}, {"c", "eu", 2}, {"d", "eu", 0.5}},
+	}
+	query := func(d *Dashboard, sql string) (int, string) {
+		target, _ := json.Marshal(sql)
+		body := `{"targets": [{"target": ` + string(target) + `, "type": "table"}]}`
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	d := NewDashboard(WithSQL())
+	d.CreateStaticTable("hosts", table)
+	code, body := query(d, "SELECT Load, Host FROM hosts WHERE Region = 'eu' ORDER BY Load DESC LIMIT 2 OFFSET 1")
+	want := `[{"columns":[{"text":"Load","type":"number"},{"text":"Host","type":"string"}],"rows":[[1,"a"],[0.5,"d"]],"type":"table"}]`
+	if code != 200 || body != want {
+		t.Errorf("SQL query: status %d\ngot  %s\nwant %s", code, body, want)
+	}
+	if code, _ := query(d, "SELECT Nope FROM hosts"); code != 400 {
+		t.Errorf("unknown column: status %d, want 400", code)
+	}
+	if code, _ := query(d, "SELECT * FROM nope"); code != 404 {
+		t.Errorf("unknown table: status %d, want 404", code)
+	}
+
+	d = NewDashboard()
+	d.CreateStaticTable("hosts", table)
+	if code, _ := query(d, "SELECT * FROM hosts"); code != 404 {
+		t.Errorf("SQL without WithSQL: status %d, want 404", code)
+	}
+}
@@ -0,0 +1,88 @@
+package grada
+
+// Tables with cached JSON responses.
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// StaticTable is a table target whose data changes rarely, such as an
+// inventory or a configuration overview. The server marshals the table
+// once per Update and answers every query from the cached JSON, regardless
+// of the query's time range.
+type StaticTable struct {
+	m     sync.Mutex
+	table *Table
+	json  []byte // the marshaled tableResponse of table
+	seq   uint64 // write sequence number of the last Update
+}
+
+// CreateStaticTable creates a table target with the data of t.
+// Call Update on the returned StaticTable to replace the data.
+// t must not be modified afterwards.
+func (d *Dashboard) CreateStaticTable(target string, t *Table) (*StaticTable, error) {
+	st := &StaticTable{}
+	if err := st.Update(t); err != nil {
+		return nil, err
+	}
+	err := d.srv.addTables(target, func(from, to time.Time) ([]*Table, error) {
+		st.m.Lock()
+		defer st.m.Unlock()
+		return []*Table{st.table}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.srv.tablesMu.Lock()
+	if d.srv.staticTables == nil {
+		d.srv.staticTables = map[string]*StaticTable{}
+	}
+	d.srv.staticTables[target] = st
+	d.srv.tablesMu.Unlock()
+	return st, nil
+}
+
+// Update replaces the data of the table with t and refreshes the cached
+// response. If t cannot be marshaled, Update returns an error and the
+// table keeps its previous data. t must not be modified afterwards.
+func (st *StaticTable) Update(t *Table) error {
+	resp, err := t.response()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	st.m.Lock()
+	st.table = t
+	st.json = b
+	st.seq = nextSeq()
+	st.m.Unlock()
+	return nil
+}
+
+// cached returns the cached response of the table and its number of
+// rows. The returned slice is replaced, not modified, by Update.
+func (st *StaticTable) cached() ([]byte, int) {
+	st.m.Lock()
+	defer st.m.Unlock()
+	return st.json, len(st.table.Rows)
+}
+
+// version returns the write sequence number of the last Update.
+func (st *StaticTable) version() uint64 {
+	st.m.Lock()
+	defer st.m.Unlock()
+	return st.seq
+}
+
+// staticTable returns the static table of target, if target is one.
+func (srv *server) staticTable(target string) (*StaticTable, bool) {
+	srv.tablesMu.Lock()
+	defer srv.tablesMu.Unlock()
+	st, ok := srv.staticTables[target]
+	return st, ok
+}
@@ -0,0 +1,64 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard_CreateStaticTable(t *testing.T) {
+	d := NewDashboard()
+	st, err := d.CreateStaticTable("hosts", &Table{
+		Columns: []Column{{"Host", ColumnString}},
+		Rows:    [][]interface{}{{"a"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateStaticTable(): %v", err)
+	}
+	if _, err := d.CreateStaticTable("hosts", &Table{}); err == nil {
+		t.Errorf("CreateStaticTable() with an existing target: want error")
+	}
+
+	query := func() string {
+		body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "targets": [{"target": "hosts", "type": "table"}, {"target": "hosts", "type": "table"}]}`
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+		return w.Body.String()
+	}
+	table := `{"columns":[{"text":"Host","type":"string"}],"rows":[["a"]],"type":"table"}`
+	if got, want := query(), "["+table+","+table+"]"; got != want {
+		t.Errorf("query:\ngot  %s\nwant %s", got, want)
+	}
+
+	err = st.Update(&Table{Columns: []Column{{"Host", ColumnString}}, Rows: [][]interface{}{{"b"}}})
+	if err != nil {
+		t.Fatalf("Update(): %v", err)
+	}
+	table = `{"columns":[{"text":"Host","type":"string"}],"rows":[["b"]],"type":"table"}`
+	if got, want := query(), "["+table+","+table+"]"; got != want {
+		t.Errorf("query after Update:\ngot  %s\nwant %s", got, want)
+	}
+
+	err = st.Update(&Table{Columns: []Column{{"Host", ColumnJSON}}, Rows: [][]interface{}{{make(chan int)}}})
+	if err == nil {
+		t.Errorf("Update() with an unmarshalable cell: want error")
+	}
+	if got, want := query(), "["+table+","+table+"]"; got != want {
+		t.Errorf("query after failed Update:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestServer_sendTablePaged(t *testing.T) {
+	d := NewDashboard()
+	d.CreateStaticTable("hosts", &Table{
+		Columns: []Column{{"Host", ColumnString}},
+		Rows:    [][]interface{}{{"a"}, {"b"}, {"c"}},
+	})
+	body := `{"targets": [{"target": "hosts", "type": "table", "data": {"page": 2, "limit": 2}}]}`
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	want := `[{"columns":[{"text":"Host","type":"string"}],"rows":[["c"]],"type":"table","meta":{"totalRows":3,"page":2,"limit":2,"pages":2}}]`
+	if got := w.Body.String(); got != want {
+		t.Errorf("paged query:\ngot  %s\nwant %s", got, want)
+	}
+}
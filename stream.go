@@ -0,0 +1,129 @@
+package grada
+
+// Series from external sources, streamed to the client.
+//
+// A persistent backend may hold millions of data points for a time range.
+// Rather than collecting them into a slice and encoding the slice, the
+// server encodes the data points as the source produces them, and flushes
+// the response every streamChunk bytes, so that memory use stays flat.
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// streamChunk is the size of the response chunks of streamed series.
+const streamChunk = 64 << 10
+
+// SeriesSource provides the data points of a series that is stored outside
+// grada, such as in a database.
+type SeriesSource interface {
+	// Range calls fn for each data point within [from, to], oldest first.
+	// It stops and returns the error if fn returns an error.
+	Range(from, to time.Time, fn func(Count) error) error
+}
+
+// SeriesSourceFunc adapts a function to the SeriesSource interface.
+type SeriesSourceFunc func(from, to time.Time, fn func(Count) error) error
+
+// Range calls f(from, to, fn).
+func (f SeriesSourceFunc) Range(from, to time.Time, fn func(Count) error) error {
+	return f(from, to, fn)
+}
+
+// CreateSeriesSource creates a target whose data points come from src.
+//
+// JSON responses to /query and /export stream the data points of src
+// without holding them in memory. Where the server needs all data points
+// at once, such as for protobuf and msgpack responses or for forecasts,
+// it collects them first. Queries for a source target bypass the response
+// cache (see WithResponseCache).
+//
+// Queries receive at most maxDataPoints data points: the first data point
+// of each of maxDataPoints equal time intervals of the query range.
+func (d *Dashboard) CreateSeriesSource(target string, src SeriesSource) error {
+	d.srv.names.Lock()
+	defer d.srv.names.Unlock()
+	if d.srv.targetExists(target) {
+		return fmt.Errorf("%w: %s", ErrMetricExists, target)
+	}
+	v := &d.srv.virtual
+	v.m.Lock()
+	defer v.m.Unlock()
+	if v.sources == nil {
+		v.sources = map[string]SeriesSource{}
+	}
+	v.sources[target] = src
+	return nil
+}
+
+// source returns the series source of target, if target has one.
+func (srv *server) source(target string) (SeriesSource, bool) {
+	srv.virtual.m.Lock()
+	defer srv.virtual.m.Unlock()
+	src, ok := srv.virtual.sources[target]
+	return src, ok
+}
+
+// sourceRange calls fn for the data points of s, thinned out to at most
+// s.max data points.
+func (s series) sourceRange(fn func(Count) error) error {
+	if s.max <= 0 {
+		return nil
+	}
+	width := s.to.Sub(s.from) / time.Duration(s.max)
+	if width <= 0 {
+		// No more than maxDataPoints nanoseconds in the range.
+		return s.source.Range(s.from, s.to, fn)
+	}
+	bucket := int64(-1)
+	return s.source.Range(s.from, s.to, func(c Count) error {
+		b := min(max(int64(c.T.Sub(s.from)/width), 0), int64(s.max-1))
+		if b <= bucket {
+			return nil // not the first data point of its interval
+		}
+		bucket = b
+		return fn(c)
+	})
+}
+
+// streamError reports an error that occurred while writing a response
+// with sw. If parts of the response have been sent already, it is too late
+// for an error response; streamError aborts the response instead, so that
+// the client does not mistake the truncated response for a complete one.
+func (srv *server) streamError(w http.ResponseWriter, r *http.Request, sw *streamWriter, err error, m string) {
+	if !sw.flushed {
+		writeError(w, http.StatusInternalServerError, err, m)
+		return
+	}
+	if srv.logger != nil {
+		srv.logger.Printf("grada: request %s: %s: %v", RequestIDFromContext(r.Context()), m, err)
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// streamWriter writes a response in chunks.
+type streamWriter struct {
+	w       io.Writer // nil for a response that is written at once
+	flushed bool      // whether a chunk has been written
+	points  int       // data points written so far
+	written []int     // data points of each series written so far
+}
+
+// flush writes b to the response if it has grown beyond streamChunk,
+// and returns the emptied buffer.
+func (sw *streamWriter) flush(b []byte) ([]byte, error) {
+	if sw.w == nil || len(b) < streamChunk {
+		return b, nil
+	}
+	if _, err := sw.w.Write(b); err != nil {
+		return b, err
+	}
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	sw.flushed = true
+	return b[:0], nil
+}
@@ -0,0 +1,109 @@
+package grada
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// counterSource produces one data point per second with the value of
+// the seconds since t0, without holding the data points in memory.
+func counterSource(t0 time.Time, fail error) SeriesSource {
+	return SeriesSourceFunc(func(from, to time.Time, fn func(Count) error) error {
+		for t := t0; !t.After(to); t = t.Add(time.Second) {
+			if t.Before(from) {
+				continue
+			}
+			if err := fn(Count{float64(t.Sub(t0) / time.Second), t}); err != nil {
+				return err
+			}
+		}
+		return fail
+	})
+}
+
+func TestServer_streamQuery(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	d := NewDashboard(WithoutCompression())
+	if err := d.CreateSeriesSource("big", counterSource(t0, nil)); err != nil {
+		t.Fatalf("CreateSeriesSource(): %v", err)
+	}
+	if err := d.CreateSeriesSource("big", counterSource(t0, nil)); err == nil {
+		t.Errorf("CreateSeriesSource() with an existing target: want error")
+	}
+
+	tests := []struct {
+		name     string
+		max      int
+		wantLen  int
+		wantLast float64
+	}{
+		{"all", 100000, 3601, 3600},
+		{"thinned", 60, 60, 3540},
+		{"none", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "maxDataPoints": ` + strconv.Itoa(tt.max) + `, "targets": [{"target": "big"}]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			var resp []struct {
+				Target     string
+				Datapoints [][2]float64
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("cannot unmarshal %.200s: %v", w.Body.String(), err)
+			}
+			points := resp[0].Datapoints
+			if len(points) != tt.wantLen {
+				t.Fatalf("%d data points, want %d", len(points), tt.wantLen)
+			}
+			if len(points) > 0 && points[len(points)-1][0] != tt.wantLast {
+				t.Errorf("last data point %v, want %v", points[len(points)-1][0], tt.wantLast)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/export?target=big&from=2017-10-25T11:00:00Z&to=2017-10-25T11:00:02Z", nil))
+	if want := `{"target":"big","datapoints":[[0,1508929200000],[1,1508929201000],[2,1508929202000]]}`; w.Body.String() != want {
+		t.Errorf("/export:\ngot  %s\nwant %s", w.Body.String(), want)
+	}
+
+	w = httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/value?target=big&reduce=count&from=2017-10-25T11:00:00Z&to=2017-10-25T11:00:09Z", nil))
+	if want := `[{"target":"big","value":10,"time":1508929209000}]`; w.Body.String() != want {
+		t.Errorf("/value:\ngot  %s\nwant %s", w.Body.String(), want)
+	}
+}
+
+func TestServer_streamError(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	d := NewDashboard(WithoutCompression())
+	d.CreateSeriesSource("early", SeriesSourceFunc(func(from, to time.Time, fn func(Count) error) error {
+		return errors.New("backend down")
+	}))
+	d.CreateSeriesSource("late", counterSource(t0, errors.New("backend down")))
+
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/export?target=early", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("error before streaming: status %d, want 500", w.Code)
+	}
+
+	// After the first chunk, the response must be aborted rather than
+	// completed with an invalid body.
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("error while streaming: recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	w = httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/export?target=late&from=2017-10-25T11:00:00Z&to=2017-10-26T11:00:00Z", nil))
+	t.Errorf("error while streaming: handler returned with status %d", w.Code)
+}
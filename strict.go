@@ -0,0 +1,103 @@
+package grada
+
+// Strict validation of /query requests.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// WithStrictProtocol makes the server validate /query requests instead
+// of decoding them leniently. It responds with 400 Bad Request and a
+// description of all problems of a request if the request
+//
+//   - has fields that the server does not know, or fields of another
+//     type than the server expects (see Dashboard.ProtocolDrift),
+//   - lacks range.from or range.to, or range.from is not before range.to,
+//   - lacks both interval and intervalMs, or interval is not a Grafana
+//     interval such as "500ms", "30s", or "1d",
+//   - has no targets, a target without a name, or targets of different
+//     types.
+//
+// Strict validation helps when developing clients of grada. Grafana
+// sends fields that grada does not use, so do not enable it for servers
+// that Grafana queries.
+func WithStrictProtocol() Option {
+	return func(srv *server) {
+		srv.strict = true
+	}
+}
+
+// grafanaInterval matches the intervals of Grafana queries.
+var grafanaInterval = regexp.MustCompile(`^[0-9]+(ms|s|m|h|d|w|y)$`)
+
+// validateQuery returns an error that describes all problems of the
+// /query request q with the given body, or nil.
+func validateQuery(q *query, body []byte) error {
+	var problems []string
+	protocolDrift(body, reflect.TypeOf(query{}), "", func(field, problem string) {
+		problems = append(problems, field+": "+problem)
+	})
+	sort.Strings(problems)
+	switch {
+	case q.Range.From.IsZero() || q.Range.To.IsZero():
+		problems = append(problems, "range: from and to are required")
+	case !q.Range.From.Before(q.Range.To):
+		problems = append(problems, "range: from must be before to")
+	}
+	switch {
+	case q.Interval == "" && q.IntervalMs <= 0:
+		problems = append(problems, "interval: interval or intervalMs is required")
+	case q.Interval != "" && !grafanaInterval.MatchString(q.Interval):
+		problems = append(problems, fmt.Sprintf("interval: %q is not an interval such as \"30s\"", q.Interval))
+	}
+	if len(q.Targets) == 0 {
+		problems = append(problems, "targets: at least one target is required")
+	}
+	for i, t := range q.Targets {
+		if t.Target == "" {
+			problems = append(problems, fmt.Sprintf("targets[%d].target: the name is required", i))
+		}
+		if t.Type != q.Targets[0].Type {
+			problems = append(problems, fmt.Sprintf("targets[%d].type: %q differs from the type %q of targets[0]", i, t.Type, q.Targets[0].Type))
+		}
+	}
+	if problems == nil {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// strictQueries responds with 400 Bad Request to invalid /query
+// requests if the server validates queries strictly. It wraps the cache
+// and the ETags of responses, so that an invalid request never gets the
+// response to a valid one.
+func (srv *server) strictQueries(h http.HandlerFunc) http.HandlerFunc {
+	if !srv.strict {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := readQueryBody(w, r)
+		r.Body = replayBody(body, err)
+		if err != nil {
+			h(w, r) // let h report the error
+			return
+		}
+		q, err := unmarshalQuery(body)
+		if err != nil {
+			h(w, r)
+			return
+		}
+		if err := validateQuery(q, body); err != nil {
+			srv.recordDrift(r, body)
+			writeError(w, http.StatusBadRequest, err, "invalid query")
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,87 @@
+package grada
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_strictProtocol(t *testing.T) {
+	d := NewDashboard(WithStrictProtocol())
+	d.CreateMetricWithBufSize("cpu", 10)
+	const rng = `"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"}`
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantErr    []string
+	}{
+		{"valid", `{` + rng + `,"interval":"30s","targets":[{"target":"cpu","refId":"A"}]}`, http.StatusOK, nil},
+		{"intervalMs", `{` + rng + `,"intervalMs":30000,"targets":[{"target":"cpu"}]}`, http.StatusOK, nil},
+		{"days", `{` + rng + `,"interval":"1d","targets":[{"target":"cpu"}]}`, http.StatusOK, nil},
+		{"empty", `{}`, http.StatusBadRequest, []string{
+			"range: from and to are required", "interval: interval or intervalMs is required", "targets: at least one target is required"}},
+		{"reversed range", `{"range":{"from":"2017-10-25T12:00:00Z","to":"2017-10-25T11:00:00Z"},"interval":"1m","targets":[{"target":"cpu"}]}`,
+			http.StatusBadRequest, []string{"range: from must be before to"}},
+		{"bad interval", `{` + rng + `,"interval":"30 sec","targets":[{"target":"cpu"}]}`, http.StatusBadRequest, []string{`interval: "30 sec" is not`}},
+		{"targets", `{` + rng + `,"interval":"1m","targets":[{"target":"cpu"},{"refId":"B","type":"table"}]}`, http.StatusBadRequest, []string{
+			"targets[1].target: the name is required", `targets[1].type: "table" differs from the type "" of targets[0]`}},
+		{"drift", `{` + rng + `,"interval":"1m","maxDataPoints":"100","targets":[{"taget":"cpu"}]}`, http.StatusBadRequest, []string{
+			"maxDataPoints: string, want number", "targets.taget: unknown field"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("POST /query: %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			var e errorResponse
+			json.Unmarshal(w.Body.Bytes(), &e)
+			if !strings.HasPrefix(e.Error, "invalid query: ") {
+				t.Errorf("error = %q, want an invalid query", e.Error)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(e.Error, want) {
+					t.Errorf("error = %q, want %q", e.Error, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_strictProtocolCached(t *testing.T) {
+	d := NewDashboard(WithStrictProtocol(), WithResponseCache(time.Minute))
+	d.CreateMetricWithBufSize("cpu", 10)
+	const valid = `{"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"interval":"30s","targets":[{"target":"cpu"}]}`
+	// The same query with an unknown field has the cache key of the valid one.
+	invalid := strings.Replace(valid, `"interval"`, `"unknown":1,"interval"`, 1)
+	var etag string
+	for _, tt := range []struct {
+		body       string
+		wantStatus int
+	}{
+		{valid, http.StatusOK},
+		{invalid, http.StatusBadRequest},
+		{valid, http.StatusOK},
+	} {
+		r := httptest.NewRequest("POST", "/query", strings.NewReader(tt.body))
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		d.Handler().ServeHTTP(w, r)
+		if w.Code != tt.wantStatus && (tt.wantStatus != http.StatusOK || w.Code != http.StatusNotModified) {
+			t.Fatalf("POST /query %s: %d %s, want %d", tt.body, w.Code, w.Body, tt.wantStatus)
+		}
+		if e := w.Header().Get("ETag"); e != "" {
+			etag = e
+		}
+	}
+}
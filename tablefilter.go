@@ -0,0 +1,203 @@
+package grada
+
+// Server-side filtering and sorting of table targets.
+//
+// The "data" object of a table target may contain filter and sort
+// directives, which the server applies before pagination:
+//
+//	{"target": "hosts", "type": "table", "data": {
+//		"filter": [{"column": "Region", "op": "=", "value": "eu"},
+//		           {"column": "Load", "op": ">", "value": 0.8}],
+//		"sort": [{"column": "Load", "desc": true}, {"column": "Name"}]}}
+//
+// All filters must match for a row to be included. Empty cells sort last.
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tableFilter is a filter directive.
+type tableFilter struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"` // =, !=, <, <=, >, >=, contains, or like
+	Value  interface{} `json:"value"`
+}
+
+// tableSort is a sort directive.
+type tableSort struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+// filterOps are the supported filter operators.
+var filterOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "contains": true, "like": true}
+
+// columnIndex returns the index of the column named name.
+func columnIndex(columns []Column, name string) (int, error) {
+	for i, c := range columns {
+		if c.Text == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no column %q", ErrBadTableQuery, name)
+}
+
+// filterSort returns a table with the rows of t that match all filters,
+// sorted by the sort directives. t remains unchanged.
+func (t *Table) filterSort(filters []tableFilter, sorts []tableSort) (*Table, error) {
+	columns := t.Columns
+	if len(columns) == 0 {
+		columns = inferColumns(t.Rows)
+	}
+	filterCols := make([]int, len(filters))
+	for i, f := range filters {
+		if !filterOps[f.Op] {
+			return nil, fmt.Errorf("%w: unknown operator %q", ErrBadTableQuery, f.Op)
+		}
+		c, err := columnIndex(columns, f.Column)
+		if err != nil {
+			return nil, err
+		}
+		filterCols[i] = c
+	}
+	sortCols := make([]int, len(sorts))
+	for i, s := range sorts {
+		c, err := columnIndex(columns, s.Column)
+		if err != nil {
+			return nil, err
+		}
+		sortCols[i] = c
+	}
+
+	rows := make([][]interface{}, 0, len(t.Rows))
+rows:
+	for _, r := range t.Rows {
+		for i, f := range filters {
+			if !f.match(cell(r, filterCols[i])) {
+				continue rows
+			}
+		}
+		rows = append(rows, r)
+	}
+	if len(sorts) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for k, s := range sorts {
+				a, b := cell(rows[i], sortCols[k]), cell(rows[j], sortCols[k])
+				if (a == nil) != (b == nil) {
+					return b == nil // nil last in either direction
+				}
+				c := compareCells(a, b)
+				if c != 0 {
+					return c < 0 != s.Desc
+				}
+			}
+			return false
+		})
+	}
+	return &Table{Name: t.Name, Columns: columns, Rows: rows}, nil
+}
+
+// cell returns the value of column j of r, or nil if r is too short.
+func cell(r []interface{}, j int) interface{} {
+	if j < len(r) {
+		return r[j]
+	}
+	return nil
+}
+
+// match reports whether v passes the filter. A nil value or filter value
+// only passes "=" if both are nil, and "!=" if only one is nil.
+func (f tableFilter) match(v interface{}) bool {
+	if v == nil || f.Value == nil {
+		switch f.Op {
+		case "=":
+			return v == nil && f.Value == nil
+		case "!=":
+			return (v == nil) != (f.Value == nil)
+		}
+		return false
+	}
+	switch f.Op {
+	case "contains":
+		return strings.Contains(fmt.Sprint(v), fmt.Sprint(f.Value))
+	case "like":
+		return likeMatch(fmt.Sprint(v), fmt.Sprint(f.Value))
+	}
+	c := compareCells(v, f.Value)
+	switch f.Op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// number returns v as a float64 if v is a number or a time. Times are
+// Unix milliseconds, as in responses. A string is a time if it is in
+// RFC 3339 format.
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return float64(v.UnixNano() / int64(time.Millisecond)), true
+	case *time.Time:
+		if v != nil {
+			return float64(v.UnixNano() / int64(time.Millisecond)), true
+		}
+		return 0, false
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return float64(t.UnixNano() / int64(time.Millisecond)), err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// compareCells compares a and b numerically if both are numbers or times,
+// and as text otherwise. Nil is greater than all other values.
+func compareCells(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	if !aStr || !bStr {
+		x, okA := number(a)
+		y, okB := number(b)
+		if okA && okB {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -0,0 +1,102 @@
+package grada
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTable_filterSort(t *testing.T) {
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	table := &Table{
+		Columns: []Column{{"Name", ColumnString}, {"Load", ColumnNumber}, {"Started", ColumnTime}},
+		Rows: [][]interface{}{
+			{"a", 0.5, t0},
+			{"b", 2, t0.Add(time.Hour)},
+			{"c", nil, t0.Add(2 * time.Hour)},
+			{"d", 1.5, t0.Add(3 * time.Hour)},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		filters []tableFilter
+		sorts   []tableSort
+		want    []string // names of the resulting rows
+		wantErr bool
+	}{
+		{"none", nil, nil, []string{"a", "b", "c", "d"}, false},
+		{"greater", []tableFilter{{"Load", ">", 1.0}}, nil, []string{"b", "d"}, false},
+		{"notEqualNil", []tableFilter{{"Load", "!=", 2.0}}, nil, []string{"a", "c", "d"}, false},
+		{"time", []tableFilter{{"Started", ">=", "2017-10-25T12:30:00Z"}}, nil, []string{"c", "d"}, false},
+		{"contains", []tableFilter{{"Name", "contains", "b"}}, nil, []string{"b"}, false},
+		{"and", []tableFilter{{"Load", ">", 0.0}, {"Name", "<", "d"}}, nil, []string{"a", "b"}, false},
+		{"sortDesc", nil, []tableSort{{"Load", true}}, []string{"b", "d", "a", "c"}, false},
+		{"sortAsc", nil, []tableSort{{"Load", false}}, []string{"a", "d", "b", "c"}, false},
+		{"badColumn", []tableFilter{{"Nope", "=", 1.0}}, nil, nil, true},
+		{"badOp", []tableFilter{{"Load", "~", 1.0}}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := table.filterSort(tt.filters, tt.sorts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("filterSort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrBadTableQuery) {
+					t.Errorf("filterSort() error = %v, want ErrBadTableQuery", err)
+				}
+				return
+			}
+			var names []string
+			for _, r := range got.Rows {
+				names = append(names, r[0].(string))
+			}
+			if !cmp.Equal(names, tt.want) {
+				t.Errorf("filterSort() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+	if table.Rows[2][0] != "c" {
+		t.Errorf("filterSort() modified the table")
+	}
+}
+
+func TestServer_sendTableFiltered(t *testing.T) {
+	d := NewDashboard()
+	d.CreateStaticTable("hosts", &Table{
+		Columns: []Column{{"Host", ColumnString}, {"Load", ColumnNumber}},
+		Rows:    [][]interface{}{{"a", 1}, {"b", 3}, {"c", 2}},
+	})
+	tests := []struct {
+		name       string
+		data       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"filterSortPage",
+			`{"filter": [{"column": "Load", "op": ">", "value": 1}], "sort": [{"column": "Load", "desc": true}], "limit": 1}`,
+			200,
+			`[{"columns":[{"text":"Host","type":"string"},{"text":"Load","type":"number"}],"rows":[["b",3]],"type":"table","meta":{"totalRows":2,"page":1,"limit":1,"pages":2}}]`,
+		},
+		{"badColumn", `{"sort": [{"column": "Nope"}]}`, 400, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"targets": [{"target": "hosts", "type": "table", "data": ` + tt.data + `}]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body:\ngot  %s\nwant %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
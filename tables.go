@@ -0,0 +1,185 @@
+package grada
+
+// Table targets for Grafana's table panel.
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Column describes a column of a Table. Type is one of the Column...
+// constants.
+type Column struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// Column types.
+const (
+	ColumnString = "string"
+	ColumnNumber = "number"
+	ColumnTime   = "time"
+	// ColumnJSON cells hold arbitrary values, such as structs, maps, or
+	// slices, that are marshaled inline as JSON for the JSON cell view of
+	// Grafana's table panel.
+	ColumnJSON = "json"
+	// ColumnObject is an alias of ColumnJSON.
+	ColumnObject = "object"
+)
+
+// Table is the data of a table target. Each row has one value per column.
+// Values of type time.Time are sent to Grafana as Unix milliseconds.
+//
+// If Columns is empty, the column types are inferred from the values of
+// the rows. See TableOf for creating a table from a slice of structs.
+type Table struct {
+	Name    string // optional; identifies the table if a target has several
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// TableFunc returns the table of a table target for the time range of
+// a query.
+type TableFunc func(from, to time.Time) (*Table, error)
+
+// tablesFunc returns the tables of a target that has several tables.
+type tablesFunc func(from, to time.Time) ([]*Table, error)
+
+// CreateTable creates a table target. Grafana panels that query the target
+// with the "table" format receive the table that f returns.
+//
+// Table targets share their names with metrics; creating a table with the
+// name of an existing target fails with ErrMetricExists.
+func (d *Dashboard) CreateTable(target string, f TableFunc) error {
+	return d.srv.addTable(target, f)
+}
+
+// targetExists reports whether target names a metric, a virtual series,
+// a series source, or a table.
+func (srv *server) targetExists(target string) bool {
+	if _, err := srv.metrics.Get(target); err == nil {
+		return true
+	}
+	srv.virtual.m.Lock()
+	_, exists := srv.virtual.series[target]
+	if !exists {
+		_, exists = srv.virtual.sources[target]
+	}
+	srv.virtual.m.Unlock()
+	if exists {
+		return true
+	}
+	srv.tablesMu.Lock()
+	_, exists = srv.tables[target]
+	srv.tablesMu.Unlock()
+	return exists
+}
+
+// addTable registers a table target.
+func (srv *server) addTable(target string, f TableFunc) error {
+	return srv.addTables(target, func(from, to time.Time) ([]*Table, error) {
+		t, err := f(from, to)
+		if err != nil {
+			return nil, err
+		}
+		return []*Table{t}, nil
+	})
+}
+
+// addTables registers a target with several tables. Like addVirtual, it
+// checks and registers the name under srv.names.
+func (srv *server) addTables(target string, f tablesFunc) error {
+	srv.names.Lock()
+	defer srv.names.Unlock()
+	if srv.targetExists(target) {
+		return fmt.Errorf("%w: %s", ErrMetricExists, target)
+	}
+	srv.tablesMu.Lock()
+	defer srv.tablesMu.Unlock()
+	if srv.tables == nil {
+		srv.tables = map[string]tablesFunc{}
+	}
+	srv.tables[target] = f
+	return nil
+}
+
+// tablesFor returns the tables of a table target.
+func (srv *server) tablesFor(target string, from, to time.Time) ([]*Table, error) {
+	srv.tablesMu.Lock()
+	f, ok := srv.tables[target]
+	srv.tablesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMetricNotFound, target)
+	}
+	return f(from, to)
+}
+
+// tableMeta describes the page of a paginated table response.
+type tableMeta struct {
+	TotalRows int `json:"totalRows"`
+	Page      int `json:"page"`
+	Limit     int `json:"limit"`
+	Pages     int `json:"pages"`
+}
+
+// page returns the rows of page number page (starting at 1) of t, with
+// limit rows per page, and the metadata that lets a panel navigate the
+// pages. Pages below 1 are page 1; pages beyond the last page are empty.
+func (t *Table) page(page, limit int) (*Table, *tableMeta) {
+	page = max(page, 1)
+	meta := &tableMeta{
+		TotalRows: len(t.Rows),
+		Page:      page,
+		Limit:     limit,
+		Pages:     len(t.Rows) / limit,
+	}
+	if len(t.Rows)%limit != 0 {
+		meta.Pages++
+	}
+	start := min((page-1)*limit, len(t.Rows))
+	if page-1 > len(t.Rows)/limit {
+		start = len(t.Rows) // avoid overflowing (page-1)*limit
+	}
+	end := start + min(limit, len(t.Rows)-start)
+	columns := t.Columns
+	if len(columns) == 0 {
+		columns = inferColumns(t.Rows) // from all rows, not just the page
+	}
+	return &Table{Name: t.Name, Columns: columns, Rows: t.Rows[start:end]}, meta
+}
+
+// response converts a table into a /query response.
+// Cells of JSON columns are marshaled here, so that a cell that cannot be
+// marshaled is reported with its position.
+func (t *Table) response() (tableResponse, error) {
+	columns := t.Columns
+	if len(columns) == 0 {
+		columns = inferColumns(t.Rows)
+	}
+	rows := make([]row, len(t.Rows))
+	for i, r := range t.Rows {
+		rows[i] = make(row, len(r))
+		for j, v := range r {
+			switch {
+			case j < len(columns) && (columns[j].Type == ColumnJSON || columns[j].Type == ColumnObject):
+				b, err := json.Marshal(v)
+				if err != nil {
+					return tableResponse{}, fmt.Errorf("row %d, column %q: %w", i, columns[j].Text, err)
+				}
+				v = json.RawMessage(b)
+			default:
+				switch tm := v.(type) {
+				case time.Time:
+					v = tm.UnixNano() / int64(time.Millisecond)
+				case *time.Time:
+					if tm != nil {
+						v = tm.UnixNano() / int64(time.Millisecond)
+					}
+				}
+			}
+			rows[i][j] = v
+		}
+	}
+	return tableResponse{Name: t.Name, Columns: columns, Rows: rows, Type: "table"}, nil
+}
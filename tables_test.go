@@ -0,0 +1,184 @@
+package grada
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTable_response(t *testing.T) {
+	type config struct {
+		Name    string   `json:"name"`
+		Retries int      `json:"retries"`
+		Hosts   []string `json:"hosts"`
+	}
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		table   Table
+		want    string
+		wantErr bool
+	}{
+		{
+			"plain",
+			Table{
+				Columns: []Column{{"Time", ColumnTime}, {"Name", ColumnString}, {"Value", ColumnNumber}},
+				Rows:    [][]interface{}{{t0, "a", 1.5}},
+			},
+			`{"columns":[{"text":"Time","type":"time"},{"text":"Name","type":"string"},{"text":"Value","type":"number"}],"rows":[[1508929200000,"a",1.5]],"type":"table"}`,
+			false,
+		},
+		{
+			"json",
+			Table{
+				Columns: []Column{{"Service", ColumnString}, {"Config", ColumnJSON}, {"Meta", ColumnObject}},
+				Rows:    [][]interface{}{{"api", config{"api", 3, []string{"a", "b"}}, map[string]int{"x": 1}}},
+			},
+			`{"columns":[{"text":"Service","type":"string"},{"text":"Config","type":"json"},{"text":"Meta","type":"object"}],"rows":[["api",{"name":"api","retries":3,"hosts":["a","b"]},{"x":1}]],"type":"table"}`,
+			false,
+		},
+		{
+			"unmarshalable",
+			Table{
+				Columns: []Column{{"Config", ColumnJSON}},
+				Rows:    [][]interface{}{{make(chan int)}},
+			},
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.table.response()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("response() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, _ := json.Marshal(resp)
+			if string(got) != tt.want {
+				t.Errorf("response():\ngot  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTable_page(t *testing.T) {
+	table := &Table{Columns: []Column{{"N", ColumnNumber}}}
+	for i := 0; i < 25; i++ {
+		table.Rows = append(table.Rows, []interface{}{i})
+	}
+
+	tests := []struct {
+		name        string
+		page, limit int
+		wantRows    int
+		wantFirst   int
+		wantPages   int
+	}{
+		{"first", 1, 10, 10, 0, 3},
+		{"zero", 0, 10, 10, 0, 3},
+		{"last", 3, 10, 5, 20, 3},
+		{"beyond", 4, 10, 0, 0, 3},
+		{"huge", math.MaxInt, math.MaxInt, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, meta := table.page(tt.page, tt.limit)
+			if len(got.Rows) != tt.wantRows {
+				t.Fatalf("page() returned %d rows, want %d", len(got.Rows), tt.wantRows)
+			}
+			if len(got.Rows) > 0 && got.Rows[0][0] != tt.wantFirst {
+				t.Errorf("first row %v, want %v", got.Rows[0][0], tt.wantFirst)
+			}
+			if meta.TotalRows != 25 || meta.Pages != tt.wantPages {
+				t.Errorf("meta = %+v, want 25 rows in %d pages", meta, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestServer_tableTargets(t *testing.T) {
+	d := NewDashboard()
+	d.CreateMetricWithBufSize("cpu", 10)
+	hosts := func(from, to time.Time) (*Table, error) {
+		return &Table{
+			Columns: []Column{{"Host", ColumnString}, {"Since", ColumnTime}},
+			Rows:    [][]interface{}{{"web-1", from}},
+		}, nil
+	}
+	failing := func(from, to time.Time) (*Table, error) { return nil, errors.New("no hosts") }
+	if err := d.CreateTable("hosts", hosts); err != nil {
+		t.Fatalf("CreateTable(hosts): %v", err)
+	}
+	if err := d.CreateTable("failing", failing); err != nil {
+		t.Fatalf("CreateTable(failing): %v", err)
+	}
+	if err := d.CreateTable("cpu", hosts); !errors.Is(err, ErrMetricExists) {
+		t.Errorf("CreateTable(cpu) = %v, want %v", err, ErrMetricExists)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		want       string
+	}{
+		{"table", "hosts", 200, `[{"columns":[{"text":"Host","type":"string"},{"text":"Since","type":"time"}],"rows":[["web-1",1508929200000]],"type":"table"}]`},
+		{"unknown", "nope", 404, ""},
+		{"error", "failing", 500, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"range":{"from":"2017-10-25T11:00:00Z","to":"2017-10-25T12:00:00Z"},"targets":[{"target":"` + tt.target + `","type":"table"}]}`
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("POST /query: %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if tt.want != "" && strings.TrimSpace(w.Body.String()) != tt.want {
+				t.Errorf("POST /query:\ngot  %s\nwant %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestDashboard_CreateTable(t *testing.T) {
+	d := NewDashboard()
+	f := func(from, to time.Time) (*Table, error) { return &Table{}, nil }
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				errs[i] = d.CreateTable("t", f)
+			} else {
+				_, errs[i] = d.CreateEvent("t", 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrMetricExists):
+			t.Errorf("CreateTable(): %v, want %v", err, ErrMetricExists)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d targets named t created, want 1", created)
+	}
+}
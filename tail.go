@@ -0,0 +1,404 @@
+package grada
+
+// Metrics from the lines of growing files.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TailConfig configures how TailFile and TailLog extract values from lines.
+type TailConfig struct {
+	// Regexp extracts the value from a line for TailFile: the first
+	// capture group, or the whole match if the expression has no groups.
+	// For TailLog, Regexp has a named capture group for every LogRule.
+	// Lines that do not match are skipped.
+	Regexp string
+	// Column selects the value if Regexp is empty: the field of a line
+	// at this position, starting with 1, where fields are separated by
+	// Separator, or by white space if Separator is empty. Default is 1.
+	Column    int
+	Separator string
+	// Poll is the time between two checks for new lines. Default is
+	// 1 second.
+	Poll time.Duration
+	// FromStart makes TailFile read the lines that the file contains
+	// already, rather than only the lines that are added later.
+	FromStart bool
+
+	// Rules map the named capture groups of Regexp to targets, for TailLog.
+	Rules []LogRule
+	// TimeGroup is the named capture group of Regexp that contains the
+	// time stamp of a line, for TailLog. Lines whose time stamp cannot be
+	// parsed are skipped. Without TimeGroup, data points have the time at
+	// which the line is read.
+	TimeGroup string
+	// TimeLayout is the layout of the time stamp for time.Parse, or "unix"
+	// or "unixms" for Unix time stamps in seconds or milliseconds.
+	// Default is time.RFC3339.
+	TimeLayout string
+}
+
+// LogRule maps a named capture group of TailConfig.Regexp to a target.
+// See TailLog.
+type LogRule struct {
+	// Group is the named capture group. If Group is empty, the rule
+	// applies to every matching line; use it with Count.
+	Group string
+	// Target is the target name. "{value}" in Target is replaced by the
+	// text of the group, as in "http.status.{value}".
+	Target string
+	// Count adds the number of lines so far in which the group has matched,
+	// as with Dashboard.Increment, rather than the number in the group.
+	Count bool
+	// Scale multiplies the numbers in the group, for example 0.001 to
+	// turn milliseconds into seconds. Zero means 1.
+	Scale float64
+}
+
+// TailFile follows the file at path, like "tail -F", and adds a value
+// extracted from every new line to the metric of target. Use it to chart
+// the output of tools that write statistics to a log file. Lines without
+// a number at the configured position are skipped. Metrics that do not
+// exist yet are created as by Dashboard.Add.
+//
+// TailFile follows the file when it is truncated, or replaced by a new
+// file of the same name, as log rotation does. It fails if Regexp is
+// malformed or the file cannot be opened. Call stop to stop following
+// the file.
+func (d *Dashboard) TailFile(path, target string, cfg TailConfig) (stop func(), err error) {
+	extract, err := cfg.extractor()
+	if err != nil {
+		return nil, err
+	}
+	return d.srv.tail(path, cfg, func(line string) {
+		s, ok := extract(line)
+		if !ok {
+			return
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return
+		}
+		d.srv.metrics.getOrCreate(target).Add(n)
+	})
+}
+
+// TailLog follows the file at path like TailFile, and turns each line that
+// matches cfg.Regexp into data points for several targets, according to
+// cfg.Rules. This way, one access log can feed series of the request rate,
+// the latency, and the status codes at once:
+//
+//	d.TailLog("access.log", grada.TailConfig{
+//		Regexp:    `^(?P<time>\S+) (?P<status>\d+) (?P<ms>[\d.]+)ms`,
+//		TimeGroup: "time",
+//		Rules: []grada.LogRule{
+//			{Target: "web.requests", Count: true},
+//			{Group: "status", Target: "web.status.{value}", Count: true},
+//			{Group: "ms", Target: "web.latency", Scale: 0.001},
+//		},
+//	})
+//
+// TailLog fails if Regexp is malformed, if it lacks a group of the rules,
+// or if the file cannot be opened.
+func (d *Dashboard) TailLog(path string, cfg TailConfig) (stop func(), err error) {
+	p, err := cfg.logParser()
+	if err != nil {
+		return nil, err
+	}
+	return d.srv.tail(path, cfg, func(line string) {
+		p.parse(d.srv, line)
+	})
+}
+
+// logParser applies the rules of a TailConfig to lines.
+type logParser struct {
+	re     *regexp.Regexp
+	rules  []LogRule
+	groups []int // index of the group of each rule, or -1
+	time   int   // index of the time group, or -1
+	layout string
+}
+
+// logParser compiles the regular expression and resolves the groups.
+func (cfg TailConfig) logParser() (*logParser, error) {
+	re, err := regexp.Compile(cfg.Regexp)
+	if err != nil {
+		return nil, fmt.Errorf("tail regexp: %w", err)
+	}
+	group := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		if i := re.SubexpIndex(name); i > 0 {
+			return i, nil
+		}
+		return 0, fmt.Errorf("tail regexp has no group %q", name)
+	}
+	p := &logParser{re: re, rules: cfg.Rules, layout: cfg.TimeLayout}
+	if p.layout == "" {
+		p.layout = time.RFC3339
+	}
+	if p.time, err = group(cfg.TimeGroup); err != nil {
+		return nil, err
+	}
+	for _, r := range cfg.Rules {
+		i, err := group(r.Group)
+		if err != nil {
+			return nil, err
+		}
+		p.groups = append(p.groups, i)
+	}
+	return p, nil
+}
+
+// parse adds the data points of a line to metrics.
+func (p *logParser) parse(srv *server, line string) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	t := time.Now()
+	if p.time >= 0 {
+		var ok bool
+		if t, ok = parseLogTime(m[p.time], p.layout); !ok {
+			return
+		}
+	}
+	for i, r := range p.rules {
+		text := ""
+		if g := p.groups[i]; g >= 0 {
+			if text = m[g]; text == "" {
+				continue // an optional group that did not match
+			}
+		}
+		target := strings.ReplaceAll(r.Target, "{value}", text)
+		if r.Count {
+			srv.increment(target, t)
+			continue
+		}
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			continue
+		}
+		if r.Scale != 0 {
+			n *= r.Scale
+		}
+		srv.metrics.getOrCreate(target).AddCount(Count{n, t})
+	}
+}
+
+// parseLogTime parses a time stamp with a layout of TailConfig.TimeLayout.
+func parseLogTime(s, layout string) (time.Time, bool) {
+	return parseTimeIn(s, layout, time.UTC)
+}
+
+// parseTimeIn is like parseLogTime, but time stamps without a time zone
+// are in loc.
+func parseTimeIn(s, layout string, loc *time.Location) (time.Time, bool) {
+	switch layout {
+	case "unix", "unixms":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if layout == "unixms" {
+			n /= 1000
+		}
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	return t, err == nil
+}
+
+// extractor returns a function that extracts the value text from a line.
+func (cfg TailConfig) extractor() (func(line string) (string, bool), error) {
+	if cfg.Regexp != "" {
+		re, err := regexp.Compile(cfg.Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("tail regexp: %w", err)
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		return func(line string) (string, bool) {
+			m := re.FindStringSubmatch(line)
+			if m == nil {
+				return "", false
+			}
+			return m[group], true
+		}, nil
+	}
+	column := max(cfg.Column, 1)
+	return func(line string) (string, bool) {
+		var fields []string
+		if cfg.Separator == "" {
+			fields = strings.Fields(line)
+		} else {
+			fields = strings.Split(line, cfg.Separator)
+		}
+		if column > len(fields) {
+			return "", false
+		}
+		return strings.TrimSpace(fields[column-1]), true
+	}, nil
+}
+
+// tail calls fn for every line added to the file at path, until the
+// returned stop function is called.
+func (srv *server) tail(path string, cfg TailConfig, fn func(line string)) (stop func(), err error) {
+	t := &tailer{path: path, fn: fn}
+	if err := t.open(!cfg.FromStart); err != nil {
+		return nil, err
+	}
+	poll := cfg.Poll
+	if poll <= 0 {
+		poll = time.Second
+	}
+	t.poll()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		defer t.close()
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.poll(); err != nil && srv.logger != nil {
+					srv.logger.Printf("grada: tail %s: %v", path, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// tailer reads the lines that are added to a file.
+type tailer struct {
+	path    string
+	fn      func(line string)
+	f       *os.File
+	info    os.FileInfo // of f, for detecting replacement
+	offset  int64       // position in f up to which lines are read
+	partial []byte      // unterminated last line
+}
+
+// open opens the file at path, at its end if atEnd is set.
+func (t *tailer) open(atEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.f, t.info, t.offset, t.partial = f, info, 0, nil
+	if atEnd {
+		t.offset = info.Size()
+	}
+	return nil
+}
+
+// close closes the file.
+func (t *tailer) close() {
+	if t.f != nil {
+		t.f.Close()
+		t.f = nil
+	}
+}
+
+// poll reads the new lines of the file. If the file at path has been
+// replaced, poll reads the rest of the old file and continues with the
+// start of the new one.
+func (t *tailer) poll() error {
+	if t.f == nil {
+		// The file was missing at the previous poll.
+		if err := t.open(false); err != nil {
+			return err
+		}
+	}
+	if err := t.read(); err != nil {
+		return err
+	}
+	info, err := os.Stat(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // rotated; wait for the new file
+		}
+		return err
+	}
+	if os.SameFile(info, t.info) {
+		return nil
+	}
+	t.close()
+	if err := t.open(false); err != nil {
+		return err
+	}
+	return t.read()
+}
+
+// tailChunk is the size of the reads of a tailer.
+const tailChunk = 32 << 10
+
+// read reads the lines added to f since the last read: it reads from the
+// offset of the last read to the end of the file, in chunks of tailChunk
+// bytes. If the file has been truncated, it starts over at the beginning.
+func (t *tailer) read() error {
+	info, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < t.offset {
+		t.offset, t.partial = 0, nil
+	}
+	if info.Size() == t.offset {
+		return nil
+	}
+	if _, err := t.f.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, tailChunk)
+	for {
+		n, err := t.f.Read(buf)
+		t.offset += int64(n)
+		t.lines(buf[:n])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// lines calls fn for every line that b completes, and keeps the rest of b
+// as the start of the next line.
+func (t *tailer) lines(b []byte) {
+	if len(t.partial) > 0 {
+		b = append(t.partial, b...)
+	}
+	for {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			break
+		}
+		t.fn(strings.TrimSuffix(string(b[:i]), "\r"))
+		b = b[i+1:]
+	}
+	t.partial = append(t.partial[:0], b...)
+}
@@ -0,0 +1,231 @@
+package grada
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTailConfig_extractor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    TailConfig
+		line   string
+		want   string
+		wantOK bool
+	}{
+		{"firstColumn", TailConfig{}, "  42 requests", "42", true},
+		{"column", TailConfig{Column: 3}, "a b 7", "7", true},
+		{"missingColumn", TailConfig{Column: 4}, "a b 7", "", false},
+		{"separator", TailConfig{Column: 2, Separator: ","}, "x, 1.5,y", "1.5", true},
+		{"group", TailConfig{Regexp: `load=(\S+)`}, "ts=1 load=0.75 ok", "0.75", true},
+		{"wholeMatch", TailConfig{Regexp: `[0-9.]+`}, "took 12.5ms", "12.5", true},
+		{"noMatch", TailConfig{Regexp: `load=(\S+)`}, "idle", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := tt.cfg.extractor()
+			if err != nil {
+				t.Fatalf("extractor(): %v", err)
+			}
+			if got, ok := extract(tt.line); got != tt.want || ok != tt.wantOK {
+				t.Errorf("extract(%q) = %q, %v, want %q, %v", tt.line, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+	if _, err := (TailConfig{Regexp: "("}).extractor(); err == nil {
+		t.Errorf("extractor() with a malformed regexp succeeded")
+	}
+}
+
+func TestTailer_poll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.log")
+	write := func(flag int, s string) {
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Close()
+	}
+	write(os.O_TRUNC, "old\n")
+
+	var lines []string
+	tl := &tailer{path: path, fn: func(line string) { lines = append(lines, line) }}
+	if err := tl.open(true); err != nil {
+		t.Fatal(err)
+	}
+	defer tl.close()
+
+	steps := []struct {
+		name  string
+		flag  int
+		write string
+		want  []string
+	}{
+		{"append", os.O_APPEND, "1\n2\r\n3", []string{"1", "2"}},
+		{"completeLine", os.O_APPEND, "4\n", []string{"34"}},
+		{"nothingNew", os.O_APPEND, "", nil},
+		{"largerThanChunk", os.O_APPEND, strings.Repeat("x", tailChunk) + "\n8\n", []string{strings.Repeat("x", tailChunk), "8"}},
+		{"truncate", os.O_TRUNC, "5\n", []string{"5"}},
+		{"rotate", -1, "6\n", []string{"7", "6"}},
+	}
+	for _, s := range steps {
+		lines = nil
+		if s.flag == -1 {
+			write(os.O_APPEND, "7\n")
+			os.Rename(path, path+".1")
+			write(os.O_TRUNC, s.write)
+		} else {
+			write(s.flag, s.write)
+		}
+		if err := tl.poll(); err != nil {
+			t.Fatalf("%s: poll(): %v", s.name, err)
+		}
+		if !cmp.Equal(lines, s.want) {
+			t.Errorf("%s: lines %q, want %q", s.name, lines, s.want)
+		}
+	}
+}
+
+func TestDashboard_TailFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.log")
+	os.WriteFile(path, []byte("load 1\n"), 0o644)
+
+	d := NewDashboard()
+	if _, err := d.TailFile(filepath.Join(t.TempDir(), "missing"), "x", TailConfig{}); err == nil {
+		t.Errorf("TailFile() of a missing file succeeded")
+	}
+	stop, err := d.TailFile(path, "load", TailConfig{Column: 2, FromStart: true, Poll: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("TailFile(): %v", err)
+	}
+	defer stop()
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("load 2\nload x\nload 3\n")
+	f.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m, err := d.GetMetric("load")
+		if err == nil {
+			m.m.Lock()
+			head, last := m.head, m.list.at(max(m.head-1, 0)).N
+			m.m.Unlock()
+			if head == 3 && last == 3 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metric load did not receive 3 data points")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLogParser(t *testing.T) {
+	cfg := TailConfig{
+		Regexp:    `^(?P<time>\S+) (?P<path>\S+) (?P<status>\d+) (?P<ms>[\d.]+)ms(?: (?P<user>\w+))?`,
+		TimeGroup: "time",
+		Rules: []LogRule{
+			{Target: "web.requests", Count: true},
+			{Group: "status", Target: "web.status.{value}", Count: true},
+			{Group: "ms", Target: "web.latency", Scale: 0.001},
+			{Group: "user", Target: "web.user.{value}", Count: true},
+		},
+	}
+	p, err := cfg.logParser()
+	if err != nil {
+		t.Fatalf("logParser(): %v", err)
+	}
+	srv := newServer()
+	for _, line := range []string{
+		"2017-10-25T11:16:54Z / 200 12.5ms alice",
+		"2017-10-25T11:16:55Z /a 500 250ms",
+		"2017-10-25T11:16:56Z /b 200 1ms",
+		"not a log line",
+		"yesterday / 200 1ms",
+	} {
+		p.parse(srv, line)
+	}
+
+	t1 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	tests := []struct {
+		target string
+		want   []Count
+	}{
+		{"web.requests", []Count{{1, t1}, {2, t1.Add(time.Second)}, {3, t1.Add(2 * time.Second)}}},
+		{"web.status.200", []Count{{1, t1}, {2, t1.Add(2 * time.Second)}}},
+		{"web.status.500", []Count{{1, t1.Add(time.Second)}}},
+		{"web.latency", []Count{{0.0125, t1}, {0.25, t1.Add(time.Second)}, {0.001, t1.Add(2 * time.Second)}}},
+		{"web.user.alice", []Count{{1, t1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			m, err := srv.metrics.Get(tt.target)
+			if err != nil {
+				t.Fatalf("Get(): %v", err)
+			}
+			if got := m.list.counts()[:m.head]; !cmp.Equal(got, tt.want) {
+				t.Errorf("data points:\n%s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+	if targets := srv.targets(); len(targets) != len(tests) {
+		t.Errorf("targets %q, want %d", targets, len(tests))
+	}
+
+	for _, bad := range []TailConfig{
+		{Regexp: "("},
+		{Regexp: `(?P<a>\d+)`, TimeGroup: "time"},
+		{Regexp: `(?P<a>\d+)`, Rules: []LogRule{{Group: "b", Target: "x"}}},
+	} {
+		if _, err := bad.logParser(); err == nil {
+			t.Errorf("logParser() of %+v succeeded", bad)
+		}
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	tests := []struct {
+		s, layout string
+		want      time.Time
+		wantOK    bool
+	}{
+		{"1508930214.5", "unix", time.Unix(1508930214, 5e8), true},
+		{"1508930214500", "unixms", time.Unix(1508930214, 5e8), true},
+		{"25/Oct/2017:11:16:54 +0000", "02/Jan/2006:15:04:05 -0700", time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC), true},
+		{"x", "unix", time.Time{}, false},
+		{"x", time.RFC3339, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLogTime(tt.s, tt.layout)
+		if !got.Equal(tt.want) || ok != tt.wantOK {
+			t.Errorf("parseLogTime(%q, %q) = %v, %v, want %v, %v", tt.s, tt.layout, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestDashboard_TailLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	os.WriteFile(path, []byte("GET 200\nGET 404\n"), 0o644)
+	d := NewDashboard()
+	stop, err := d.TailLog(path, TailConfig{
+		Regexp:    `(?P<method>\w+) (?P<status>\d+)`,
+		FromStart: true,
+		Rules:     []LogRule{{Group: "status", Target: "status.{value}", Count: true}},
+	})
+	if err != nil {
+		t.Fatalf("TailLog(): %v", err)
+	}
+	stop()
+	for _, target := range []string{"status.200", "status.404"} {
+		if _, err := d.GetMetric(target); err != nil {
+			t.Errorf("GetMetric(%q): %v", target, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package grada
+
+// Handling of queries for targets that have no metric.
+
+import "errors"
+
+// UnknownTargetPolicy determines how the server responds to queries
+// for targets that have no metric.
+type UnknownTargetPolicy int
+
+const (
+	// UnknownTargetError responds with a 404 Not Found error. This is the default.
+	UnknownTargetError UnknownTargetPolicy = iota
+	// UnknownTargetEmpty responds with an empty list of data points,
+	// so that Grafana shows "no data" instead of an error.
+	UnknownTargetEmpty
+	// UnknownTargetCreate creates a metric for the target and responds
+	// with its (still empty) list of data points.
+	UnknownTargetCreate
+)
+
+// DefaultAutoCreateSize is the buffer size of metrics that the server
+// creates for unknown targets, unless set through WithAutoCreate.
+const DefaultAutoCreateSize = 1000
+
+// WithUnknownTargets sets the policy for queries of targets that have no metric.
+// The policy applies to /query, /csv, and /export; /push always rejects
+// samples for unknown targets.
+func WithUnknownTargets(p UnknownTargetPolicy) Option {
+	return func(srv *server) {
+		srv.unknownTargets = p
+	}
+}
+
+// WithAutoCreate creates metrics with the given buffer size for unknown
+// targets that Grafana queries, so that dashboards can be built before the
+// application starts reporting. It implies WithUnknownTargets(UnknownTargetCreate).
+//
+// When the application later calls CreateMetric or CreateMetricWithBufSize
+// for an auto-created target, the dashboard adopts the metric with the
+// new buffer size and keeps its data points, instead of failing with
+// ErrMetricExists.
+func WithAutoCreate(size int) Option {
+	return func(srv *server) {
+		srv.unknownTargets = UnknownTargetCreate
+		srv.autoCreateSize = size
+	}
+}
+
+// lookup returns the metric for a queried target, applying the
+// server's policy for unknown targets.
+func (srv *server) lookup(target string) (*Metric, error) {
+	metric, err := srv.metrics.Get(target)
+	if !errors.Is(err, ErrMetricNotFound) {
+		return metric, err
+	}
+	switch srv.unknownTargets {
+	case UnknownTargetEmpty:
+		return &Metric{}, nil // not registered; yields no data points
+	case UnknownTargetCreate:
+		size := srv.autoCreateSize
+		if size < 1 {
+			size = DefaultAutoCreateSize
+		}
+		metric, err = srv.metrics.createAuto(target, size)
+		if errors.Is(err, ErrMetricExists) {
+			// Another request has created the metric in the meantime.
+			return srv.metrics.Get(target)
+		}
+		return metric, err
+	}
+	return nil, err
+}
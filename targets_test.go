@@ -0,0 +1,76 @@
+package grada
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_unknownTargets(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     UnknownTargetPolicy
+		wantStatus int
+		wantBody   string
+		wantMetric bool
+	}{
+		{"error", UnknownTargetError, 404, "", false},
+		{"empty", UnknownTargetEmpty, 200, `[{"target":"nope","datapoints":[]}]`, false},
+		{"create", UnknownTargetCreate, 200, `[{"target":"nope","datapoints":[]}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(WithUnknownTargets(tt.policy))
+			body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "targets": [{"target": "nope", "type": "timeserie"}], "maxDataPoints": 10}`
+			r := httptest.NewRequest("POST", "/query", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			srv.handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			_, err := srv.metrics.Get("nope")
+			if (err == nil) != tt.wantMetric {
+				t.Errorf("metric created: %v, want %v", err == nil, tt.wantMetric)
+			}
+		})
+	}
+}
+
+func TestWithAutoCreate(t *testing.T) {
+	srv := newServer(WithAutoCreate(5))
+	d := &Dashboard{srv: srv}
+
+	auto, err := srv.lookup("cpu")
+	if err != nil {
+		t.Fatalf("lookup(): %v", err)
+	}
+	if auto.list.len() != 5 {
+		t.Errorf("buffer size %d, want 5", auto.list.len())
+	}
+	t0 := time.Date(2017, time.October, 25, 11, 0, 0, 0, time.UTC)
+	auto.AddWithTime(1, t0)
+	auto.AddWithTime(2, t0.Add(time.Second))
+
+	metric, err := d.CreateMetricWithBufSize("cpu", 10)
+	if err != nil {
+		t.Fatalf("CreateMetricWithBufSize() after auto-creation: %v", err)
+	}
+	got, _ := d.GetMetric("cpu")
+	if got != metric || metric.list.len() != 10 {
+		t.Errorf("auto-created metric not adopted")
+	}
+	points := metric.fetchDatapoints(t0.Add(-time.Second), t0.Add(time.Minute), 10)
+	if len(*points) != 2 {
+		t.Errorf("adopted metric has %d data points, want 2", len(*points))
+	}
+
+	if _, err := d.CreateMetricWithBufSize("cpu", 10); !errors.Is(err, ErrMetricExists) {
+		t.Errorf("second CreateMetricWithBufSize(): error %v, want ErrMetricExists", err)
+	}
+}
@@ -0,0 +1,81 @@
+package grada
+
+// HTTPS and mutual TLS.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"strings"
+)
+
+// WithTLS makes the server listen for HTTPS instead of HTTP, using the
+// certificate and private key in the given PEM files.
+func WithTLS(certFile, keyFile string) Option {
+	return func(srv *server) {
+		srv.certFile = certFile
+		srv.keyFile = keyFile
+	}
+}
+
+// WithClientCerts requires HTTPS clients to present a certificate signed
+// by one of the CAs in pool. Use it together with WithTLS.
+//
+// access authorizes clients by the common name (CN) of their certificate.
+// It maps each CN to the endpoints that the client may call, for example
+//
+//	map[string][]string{
+//		"grafana":  {"/", "/search", "/query"},
+//		"producer": {"/push"},
+//	}
+//
+// An endpoint ending in "/" also permits all paths below it, except "/",
+// which permits only the root path that Grafana tests. Clients with a
+// CN that is not in the map are rejected. If access is nil, every client
+// with a valid certificate may call every endpoint.
+func WithClientCerts(pool *x509.CertPool, access map[string][]string) Option {
+	return func(srv *server) {
+		srv.clientCAs = pool
+		srv.cnAccess = access
+	}
+}
+
+// tlsConfig returns the TLS configuration for client certificate
+// verification, or nil if client certificates are not required.
+func (srv *server) tlsConfig() *tls.Config {
+	if srv.clientCAs == nil {
+		return nil
+	}
+	return &tls.Config{
+		ClientCAs:  srv.clientCAs,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+}
+
+// pathAllowed reports whether path matches one of the allowed endpoints.
+// "/" matches only the root path, not every path.
+func pathAllowed(path string, allowed []string) bool {
+	for _, a := range allowed {
+		if path == a || (a != "/" && strings.HasSuffix(a, "/") && strings.HasPrefix(path, a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeClientCert passes a request on to h only if the common name of
+// the client certificate is allowed to call the requested endpoint.
+func (srv *server) authorizeClientCert(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			writeError(w, http.StatusForbidden, nil, "client certificate required")
+			return
+		}
+		cn := r.TLS.PeerCertificates[0].Subject.CommonName
+		if !pathAllowed(r.URL.Path, srv.cnAccess[cn]) {
+			writeError(w, http.StatusForbidden, nil, "client not authorized for this endpoint")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
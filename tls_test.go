@@ -0,0 +1,48 @@
+package grada
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer_authorizeClientCert(t *testing.T) {
+	access := map[string][]string{
+		"grafana":  {"/", "/search", "/query"},
+		"producer": {"/push"},
+		"admin":    {"/debug/"},
+	}
+	tests := []struct {
+		name       string
+		cn         string
+		path       string
+		wantStatus int
+	}{
+		{"allowed", "grafana", "/search", 200},
+		{"root", "grafana", "/", 200},
+		{"rootIsNoPrefix", "grafana", "/push", 403},
+		{"rootIsNoSubtree", "grafana", "/debug/pprof/", 403},
+		{"wrongEndpoint", "producer", "/query", 403},
+		{"unknownCN", "mallory", "/", 403},
+		{"subtree", "admin", "/debug/pprof/heap", 404}, // authorized, but pprof is not mounted
+		{"noCert", "", "/", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(WithClientCerts(x509.NewCertPool(), access))
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.cn != "" {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+					{Subject: pkix.Name{CommonName: tt.cn}},
+				}}
+			}
+			w := httptest.NewRecorder()
+			srv.handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s %s: status %d, want %d", tt.cn, tt.path, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
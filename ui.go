@@ -0,0 +1,125 @@
+package grada
+
+// A web page for inspecting the metrics of a dashboard.
+//
+// GET /admin/ lists all metrics with a sparkline of their buffer, how full
+// the buffer is, the time and value of the newest data point, and links
+// to the metric as JSON and to its data points, so that an empty panel
+// can be debugged without Grafana.
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sparkPoints is the number of data points of a sparkline.
+const sparkPoints = 60
+
+// uiPage is the page at /admin/.
+var uiPage = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>grada metrics</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1em 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; text-align: left; border-bottom: 1px solid #ddd; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+polyline { fill: none; stroke: #3274d9; stroke-width: 1.5; }
+.empty { color: #999; }
+</style></head><body>
+<h1>Metrics ({{len .}})</h1>
+<table>
+<tr><th>Target</th><th>Data</th><th>Buffer</th><th>Last update</th><th>Last value</th><th></th></tr>
+{{range .}}<tr>
+<td>{{.Target}}</td>
+<td>{{if .Spark}}<svg width="120" height="24" viewBox="0 0 120 24"><polyline points="{{.Spark}}"/></svg>{{else}}<span class="empty">no data</span>{{end}}</td>
+<td class="n">{{.Points}} / {{.Size}} ({{.Fill}}%)</td>
+<td>{{if .Updated}}{{.Updated}} ({{.Age}} ago){{else}}<span class="empty">never</span>{{end}}</td>
+<td class="n">{{.Value}}</td>
+<td><a href="{{.JSONURL}}">JSON</a> <a href="{{.ExportURL}}">data points</a></td>
+</tr>
+{{end}}</table>
+</body></html>
+`))
+
+// uiRow is a metric on the page at /admin/.
+type uiRow struct {
+	adminMetric
+	Fill      int    // percentage of the buffer in use
+	Updated   string // time of the newest data point
+	Age       string // time since the newest data point
+	Value     string // value of the newest data point
+	Spark     string // points of the SVG polyline of the sparkline
+	JSONURL   string
+	ExportURL string
+}
+
+// uiHandler responds with the page that lists all metrics.
+func (srv *server) uiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/" {
+		writeError(w, http.StatusNotFound, nil, "no such page")
+		return
+	}
+	now := time.Now()
+	var rows []uiRow
+	for _, am := range srv.adminMetrics() {
+		row := uiRow{
+			adminMetric: am,
+			Fill:        am.Points * 100 / max(am.Size, 1),
+			JSONURL:     "metrics/" + url.PathEscape(am.Target),
+			ExportURL:   "../export?target=" + url.QueryEscape(am.Target),
+		}
+		if am.Points > 0 {
+			t := time.UnixMilli(am.Newest)
+			row.Updated = t.Format(time.RFC3339)
+			row.Age = now.Sub(t).Round(time.Second).String()
+		}
+		if am.Last != nil {
+			row.Value = strconv.FormatFloat(*am.Last, 'g', 6, 64)
+		}
+		if m, err := srv.metrics.Get(am.Target); err == nil {
+			row.Spark = sparkline(m.appendCounts(nil, time.Time{}, endOfTime, sparkPoints))
+		}
+		rows = append(rows, row)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := uiPage.Execute(w, rows); err != nil && srv.logger != nil {
+		srv.logger.Printf("grada: request %s: cannot render /admin/: %v", RequestIDFromContext(r.Context()), err)
+	}
+}
+
+// sparkline returns the points of an SVG polyline, 120 by 24 pixels, of
+// the values of counts. NaN and infinite values are skipped.
+func sparkline(counts []Count) string {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, c := range counts {
+		if !math.IsNaN(c.N) && !math.IsInf(c.N, 0) {
+			lo, hi = min(lo, c.N), max(hi, c.N)
+		}
+	}
+	if lo > hi {
+		return ""
+	}
+	var b strings.Builder
+	step := 118.0 / float64(max(len(counts)-1, 1))
+	for i, c := range counts {
+		if math.IsNaN(c.N) || math.IsInf(c.N, 0) {
+			continue
+		}
+		y := 12.0 // flat line
+		if hi > lo {
+			y = 23 - (c.N-lo)/(hi-lo)*22
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.FormatFloat(1+float64(i)*step, 'f', 1, 64))
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatFloat(y, 'f', 1, 64))
+	}
+	return b.String()
+}
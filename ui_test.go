@@ -0,0 +1,73 @@
+package grada
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_uiHandler(t *testing.T) {
+	anyone := AuthenticatorFunc(func(r *http.Request) (Principal, error) {
+		return Principal{Name: "anyone"}, nil
+	})
+	d := NewDashboard(WithAdminAPI(), WithAuthenticator(anyone))
+	m, _ := d.CreateMetricWithBufSize("cpu", 4)
+	m.AddWithTime(0.5, time.Now().Add(-time.Minute))
+	m.AddWithTime(0.75, time.Now())
+	d.CreateMetricWithBufSize("http.GET /items/{id}.latency", 10)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		want       []string
+	}{
+		{"/admin/", 200, []string{
+			"Metrics (2)", "<polyline points=", "2 / 4 (50%)", "0.75",
+			`href="metrics/cpu"`, `href="../export?target=cpu"`,
+			`href="metrics/http.GET%20%2Fitems%2F%7Bid%7D.latency"`, "0 / 10 (0%)", "never",
+		}},
+		{"/admin/nope", 404, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("page does not contain %s:\n%s", want, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"NaN only", []float64{math.NaN()}, ""},
+		{"flat", []float64{2, 2}, "1.0,12.0 119.0,12.0"},
+		{"rising", []float64{0, 5, 10}, "1.0,23.0 60.0,12.0 119.0,1.0"},
+		{"gap", []float64{0, math.NaN(), 10}, "1.0,23.0 119.0,1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := make([]Count, len(tt.values))
+			for i, v := range tt.values {
+				counts[i] = Count{N: v}
+			}
+			if got := sparkline(counts); got != tt.want {
+				t.Errorf("sparkline() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package grada
+
+// Single values for Stat and Gauge panels.
+//
+// GET /value?target=<name>[&target=<name>...][&reduce=<fn>][&from=<time>&to=<time>]
+// returns one value per target:
+//
+//	[{"target": "cpu", "value": 0.57, "time": 1508929014000}, ...]
+//
+// reduce is one of last (the default), first, mean, min, max, sum, or
+// count. "from" and "to" work as in /csv; without them, the value is
+// computed over the whole buffer. "value" is null if there are no data
+// points, and "time" is the time of the latest data point.
+//
+// In /query requests, a target with the data {"reduce": "<fn>"} returns
+// a single data point in the same way.
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+)
+
+// valueResponse is an element of the response to a `/value` request.
+type valueResponse struct {
+	Target string   `json:"target"`
+	Value  *float64 `json:"value"`
+	Time   int64    `json:"time,omitempty"` // Unix milliseconds
+}
+
+// targetData is the "data" object of a query target.
+type targetData struct {
+	Reduce string `json:"reduce"`
+	Alias  string `json:"alias"` // see Dashboard.SetAlias
+
+	// Downsampling of time series targets, see fill.go.
+	Fill      string `json:"fill"`
+	Aggregate string `json:"aggregate"`
+
+	// Pagination of table targets, see Table.page.
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+
+	// Filtering and sorting of table targets, see tablefilter.go.
+	Filter []tableFilter `json:"filter"`
+	Sort   []tableSort   `json:"sort"`
+}
+
+// reducer accumulates data points into a single value.
+type reducer struct {
+	fn    string
+	n     int
+	value float64
+	first int64 // time of the earliest data point
+	last  int64 // time of the latest data point
+}
+
+// validReduce reports whether fn is a known reduce function.
+func validReduce(fn string) bool {
+	switch fn {
+	case "last", "first", "mean", "min", "max", "sum", "count":
+		return true
+	}
+	return false
+}
+
+// add adds a data point with a value and a time in Unix milliseconds.
+func (r *reducer) add(v float64, t int64) {
+	r.n++
+	if r.n == 1 {
+		r.value, r.first, r.last = v, t, t
+		return
+	}
+	switch r.fn {
+	case "last":
+		if t >= r.last {
+			r.value = v
+		}
+	case "first":
+		if t < r.first {
+			r.value = v
+		}
+	case "mean", "sum":
+		r.value += v
+	case "min":
+		r.value = math.Min(r.value, v)
+	case "max":
+		r.value = math.Max(r.value, v)
+	}
+	if t < r.first {
+		r.first = t
+	}
+	if t > r.last {
+		r.last = t
+	}
+}
+
+// result returns the reduced value and the time of the latest data point.
+// ok is false if there were no data points, except for "count".
+func (r *reducer) result() (v float64, t int64, ok bool) {
+	switch {
+	case r.fn == "count":
+		return float64(r.n), r.last, true
+	case r.n == 0:
+		return 0, 0, false
+	case r.fn == "mean":
+		return r.value / float64(r.n), r.last, true
+	}
+	return r.value, r.last, true
+}
+
+// reduce scans the buffer of g for data points within [from, to]
+// without copying them, unless duplicates must be removed first.
+func (g *Metric) reduce(from, to time.Time, r *reducer) {
+	g.m.Lock()
+	if g.dups.Policy != DuplicatesKeepAll && !g.dups.OnIngest {
+		g.m.Unlock()
+		for _, c := range g.appendCounts(nil, from, to, math.MaxInt) {
+			r.add(c.N, c.T.UnixNano()/int64(time.Millisecond))
+		}
+		return
+	}
+	defer g.m.Unlock()
+	g.sort()
+	n := g.list.len()
+	lo, hi := g.list.window(g.head, from, to)
+	for i := lo; i < hi; i++ {
+		j := (g.head + i) % n
+		r.add(g.list.n[j], g.list.ns[j]/int64(time.Millisecond))
+	}
+}
+
+// reduce returns a single value for target, computed by fn over the
+// data points within [from, to].
+func (srv *server) reduce(target, fn string, from, to time.Time) (v float64, t int64, ok bool, err error) {
+	r := &reducer{fn: fn}
+	srv.virtual.m.Lock()
+	_, virtual := srv.virtual.series[target]
+	srv.virtual.m.Unlock()
+	if _, ok := srv.rateMetric(target); ok {
+		virtual = true
+	}
+	if src, ok := srv.source(target); ok {
+		err := src.Range(from, to, func(c Count) error {
+			r.add(c.N, c.T.UnixNano()/int64(time.Millisecond))
+			return nil
+		})
+		if err != nil {
+			return 0, 0, false, err
+		}
+	} else if virtual {
+		points, err := srv.datapoints(target, from, to, math.MaxInt)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		for _, p := range points {
+			r.add(p[0].(float64), p[1].(int64))
+		}
+	} else {
+		metric, err := srv.lookup(target)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		metric.reduce(from, to, r)
+	}
+	v, t, ok = r.result()
+	return v, t, ok, nil
+}
+
+// valueHandler responds with a single value per requested target.
+func (srv *server) valueHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	targets := params["target"]
+	if len(targets) == 0 {
+		writeError(w, http.StatusBadRequest, nil, "target is required")
+		return
+	}
+	fn := params.Get("reduce")
+	if fn == "" {
+		fn = "last"
+	}
+	if !validReduce(fn) {
+		writeError(w, http.StatusBadRequest, nil, "unknown reduce function "+fn)
+		return
+	}
+	from, err := parseTimeParam(params.Get("from"), time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot parse from")
+		return
+	}
+	to, err := parseTimeParam(params.Get("to"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err, "cannot parse to")
+		return
+	}
+
+	response := make([]valueResponse, len(targets))
+	for i, target := range targets {
+		v, t, ok, err := srv.reduce(target, fn, from, to)
+		if err != nil {
+			writeError(w, statusFor(err), err, "Cannot get metric for target "+target)
+			return
+		}
+		response[i] = valueResponse{Target: target, Time: t}
+		if ok {
+			response[i].Value = &v
+		}
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err, "cannot marshal value response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
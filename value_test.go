@@ -0,0 +1,55 @@
+package grada
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_valueHandler(t *testing.T) {
+	t1 := time.Date(2017, time.October, 25, 11, 16, 54, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	t3 := t1.Add(2 * time.Minute)
+	d := NewDashboard()
+	metric, _ := d.CreateMetricWithBufSize("cpu", 5)
+	metric.AddWithTime(2, t2)
+	metric.AddWithTime(6, t3)
+	metric.AddWithTime(1, t1)
+	d.CreateMetricWithBufSize("idle", 5)
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"last", "/value?target=cpu", 200, `[{"target":"cpu","value":6,"time":1508930334000}]`},
+		{"first", "/value?target=cpu&reduce=first", 200, `[{"target":"cpu","value":1,"time":1508930334000}]`},
+		{"mean", "/value?target=cpu&reduce=mean", 200, `[{"target":"cpu","value":3,"time":1508930334000}]`},
+		{"maxRange", "/value?target=cpu&reduce=max&to=2017-10-25T11:18:00Z", 200, `[{"target":"cpu","value":2,"time":1508930274000}]`},
+		{"several", "/value?target=cpu&target=idle&reduce=count", 200, `[{"target":"cpu","value":3,"time":1508930334000},{"target":"idle","value":0}]`},
+		{"noData", "/value?target=idle", 200, `[{"target":"idle","value":null}]`},
+		{"badReduce", "/value?target=cpu&reduce=median", 400, ""},
+		{"unknown", "/value?target=nope", 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			d.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body:\ngot  %s\nwant %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	body := `{"range": {"from": "2017-10-25T11:00:00Z", "to": "2017-10-25T12:00:00Z"}, "targets": [{"target": "cpu", "type": "timeserie", "data": {"reduce": "sum"}}]}`
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/query", strings.NewReader(body)))
+	if want := `[{"target":"cpu","datapoints":[[9,1508930334000]]}]`; w.Body.String() != want {
+		t.Errorf("/query with reduce:\ngot  %s\nwant %s", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,77 @@
+package grada
+
+// Virtual series: targets whose data points are computed at query time.
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// seriesFunc computes the data points of a virtual series within [from, to],
+// with at most maxDataPoints items.
+type seriesFunc func(from, to time.Time, maxDataPoints int) ([]row, error)
+
+// virtualSeries maps target names to virtual series and series sources.
+type virtualSeries struct {
+	m       sync.Mutex
+	series  map[string]seriesFunc
+	sources map[string]SeriesSource // see Dashboard.CreateSeriesSource
+}
+
+// addVirtual registers a virtual series for target. Metrics, virtual
+// series, and tables share one name space. srv.names makes the check and
+// the registration atomic.
+func (srv *server) addVirtual(target string, f seriesFunc) error {
+	srv.names.Lock()
+	defer srv.names.Unlock()
+	if srv.targetExists(target) {
+		return fmt.Errorf("%w: %s", ErrMetricExists, target)
+	}
+	v := &srv.virtual
+	v.m.Lock()
+	defer v.m.Unlock()
+	if v.series == nil {
+		v.series = map[string]seriesFunc{}
+	}
+	v.series[target] = f
+	return nil
+}
+
+// datapoints returns the data points of a metric, virtual series, or source
+// within [from, to], with at most maxDataPoints items.
+func (srv *server) datapoints(target string, from, to time.Time, maxDataPoints int) ([]row, error) {
+	s, err := srv.series(target, from, to, maxDataPoints)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+	return s.datapoints()
+}
+
+// targets returns the sorted names of all metrics, virtual series, sources,
+// and tables.
+func (srv *server) targets() []string {
+	var targets []string
+	srv.metrics.m.Lock()
+	for t := range srv.metrics.metric {
+		targets = append(targets, t)
+	}
+	srv.metrics.m.Unlock()
+	srv.virtual.m.Lock()
+	for t := range srv.virtual.series {
+		targets = append(targets, t)
+	}
+	for t := range srv.virtual.sources {
+		targets = append(targets, t)
+	}
+	srv.virtual.m.Unlock()
+	srv.tablesMu.Lock()
+	for t := range srv.tables {
+		targets = append(targets, t)
+	}
+	srv.tablesMu.Unlock()
+	sort.Strings(targets)
+	return targets
+}
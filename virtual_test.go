@@ -0,0 +1,37 @@
+package grada
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer_addVirtual(t *testing.T) {
+	srv := newServer()
+	f := func(from, to time.Time, maxDataPoints int) ([]row, error) { return nil, nil }
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = srv.addVirtual("v", f)
+		}(i)
+	}
+	wg.Wait()
+
+	added := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			added++
+		case !errors.Is(err, ErrMetricExists):
+			t.Errorf("addVirtual(): %v, want %v", err, ErrMetricExists)
+		}
+	}
+	if added != 1 {
+		t.Errorf("addVirtual() succeeded %d times, want once", added)
+	}
+}
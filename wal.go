@@ -0,0 +1,323 @@
+package grada
+
+// Write-ahead log of data points.
+//
+// The log is a text file with one data point per line: the time stamp in
+// Unix nanoseconds, the value, and the quoted target name, separated by
+// spaces:
+//
+//	1508929014000000000 0.5 "cpu"
+//
+// Renaming and deleting a metric add a line with the quoted target names,
+// so that the replay renames or deletes the metric, too:
+//
+//	rename "cpu" "cpu.total"
+//	delete "mem"
+//
+// To start a new segment, the file is renamed to <path>.1, replacing the
+// previous segment, and a new file is started. Without checkpoints, this
+// happens when the file exceeds the segment size; with checkpoints, at
+// every checkpoint (see checkpoint.go).
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WALConfig configures WithWAL.
+type WALConfig struct {
+	// Path is the file of the log.
+	Path string
+	// SegmentSize is the size in bytes at which the log starts a new
+	// segment. The server keeps the current and the previous segment.
+	// Default is 64 MiB. With checkpoints, the log starts a new segment
+	// at every checkpoint instead.
+	SegmentSize int64
+	// CheckpointInterval is the time between two checkpoints. Zero
+	// disables checkpoints. See WithWAL.
+	CheckpointInterval time.Duration
+	// Sync flushes every data point to the disk before adding it, so that
+	// data points survive a crash of the operating system, too. Without
+	// Sync, data points survive a crash of the process.
+	Sync bool
+}
+
+// defaultSegmentSize replaces segment sizes that are not positive.
+const defaultSegmentSize = 64 << 20
+
+// WithWAL writes every data point that is added to a metric to a
+// write-ahead log before adding it, and replays the log at startup, so
+// that a server that crashes and restarts keeps its recent data points.
+//
+// Replayed data points go to metrics that are created as by Dashboard.Add;
+// creating a metric of the same name later adopts them. The log holds
+// the data points of the last one to two segments; size the segments to
+// hold more data points than the buffers of the metrics.
+//
+// With a checkpoint interval, the server also writes the data points of
+// all metrics to a checkpoint file, <path>.checkpoint, after startup, at
+// every interval, and at Shutdown, and starts a new segment of the log; the log then
+// holds only the data points since the previous checkpoint. Checkpoints
+// are replaced atomically and carry a checksum. At startup, the server
+// loads the checkpoint, or the previous one if the checkpoint is damaged,
+// and replays the log on top of it, skipping data points that the
+// checkpoint contains already.
+//
+// Failures to read or write the log and the checkpoints are logged
+// through WithLogger.
+func WithWAL(cfg WALConfig) Option {
+	return func(srv *server) {
+		if cfg.SegmentSize <= 0 {
+			cfg.SegmentSize = defaultSegmentSize
+		}
+		srv.walConfig = &cfg
+	}
+}
+
+// wal is an open write-ahead log.
+type wal struct {
+	mu     sync.Mutex
+	cfg    WALConfig
+	f      *os.File
+	size   int64
+	logger func(format string, v ...interface{})
+	failed bool // the last write failed; log only the first failure
+}
+
+// openWAL replays the log into the metrics, and then starts logging their
+// new data points.
+func (srv *server) openWAL() {
+	logf := func(format string, v ...interface{}) {
+		if srv.logger != nil {
+			srv.logger.Printf(format, v...)
+		}
+	}
+	cfg := *srv.walConfig
+	if cfg.CheckpointInterval > 0 {
+		srv.loadCheckpoint(cfg.Path)
+	}
+	r := &walReplay{metrics: srv.metrics, counts: map[string][]Count{}}
+	for _, path := range []string{cfg.Path + ".1", cfg.Path} {
+		if err := readWAL(path, r); err != nil {
+			logf("grada: cannot replay write-ahead log %s: %v", path, err)
+		}
+	}
+	r.flush()
+	w := &wal{cfg: cfg, logger: logf}
+	if err := w.open(); err != nil {
+		logf("grada: cannot open write-ahead log: %v", err)
+		return
+	}
+	srv.metrics.m.Lock()
+	srv.metrics.wal = w
+	for target, m := range srv.metrics.metric {
+		m.m.Lock()
+		m.wal, m.target = w, target
+		m.m.Unlock()
+	}
+	srv.metrics.m.Unlock()
+	if cfg.CheckpointInterval > 0 {
+		srv.collectors.add(srv, &checkpointer{srv})
+	}
+}
+
+// walReplay replays a log into metrics. It collects the data points by
+// target, and replays them before every rename or deletion, so that these
+// apply to the data points that precede them in the log.
+type walReplay struct {
+	metrics *metrics
+	counts  map[string][]Count
+}
+
+// flush replays the collected data points into their metrics.
+func (r *walReplay) flush() {
+	for target, list := range r.counts {
+		r.metrics.getOrCreate(target).replay(list)
+	}
+	r.counts = map[string][]Count{}
+}
+
+// apply renames or deletes a metric as a line of the log says. Errors are
+// ignored: the metric may be gone with an older segment of the log.
+func (r *walReplay) apply(op string, targets []string) {
+	r.flush()
+	switch op {
+	case "rename":
+		r.metrics.Rename(targets[0], targets[1])
+	case "delete":
+		r.metrics.Delete(targets[0])
+	}
+}
+
+// readWAL replays the log file at path through r. A missing file is not
+// an error. Lines that cannot be parsed, such as a line that a crash has
+// cut off, are skipped.
+func readWAL(path string, r *walReplay) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if target, c, ok := parseWALLine(sc.Text()); ok {
+			r.counts[target] = append(r.counts[target], c)
+		} else if op, targets, ok := parseWALRecord(sc.Text()); ok {
+			r.apply(op, targets)
+		}
+	}
+	return sc.Err()
+}
+
+// appendWALLine appends the line of a data point to b.
+func appendWALLine(b []byte, target string, c Count) []byte {
+	b = strconv.AppendInt(b, c.T.UnixNano(), 10)
+	b = append(b, ' ')
+	b = strconv.AppendFloat(b, c.N, 'g', -1, 64)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, target)
+	return append(b, '\n')
+}
+
+// parseWALLine parses a line of the log.
+func parseWALLine(line string) (target string, c Count, ok bool) {
+	ts, rest, ok1 := strings.Cut(line, " ")
+	n, quoted, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return "", Count{}, false
+	}
+	ns, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", Count{}, false
+	}
+	if c.N, err = strconv.ParseFloat(n, 64); err != nil {
+		return "", Count{}, false
+	}
+	if target, err = strconv.Unquote(quoted); err != nil {
+		return "", Count{}, false
+	}
+	c.T = time.Unix(0, ns)
+	return target, c, true
+}
+
+// appendWALRecord appends the line of a rename or a deletion of a metric
+// to b: op is "rename" with the old and the new target, or "delete" with
+// the target.
+func appendWALRecord(b []byte, op string, targets ...string) []byte {
+	b = append(b, op...)
+	for _, target := range targets {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, target)
+	}
+	return append(b, '\n')
+}
+
+// parseWALRecord parses the line of a rename or a deletion of a metric.
+func parseWALRecord(line string) (op string, targets []string, ok bool) {
+	op, rest, _ := strings.Cut(line, " ")
+	for rest != "" {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return "", nil, false
+		}
+		target, _ := strconv.Unquote(quoted)
+		targets = append(targets, target)
+		rest = strings.TrimPrefix(rest[len(quoted):], " ")
+	}
+	switch {
+	case op == "rename" && len(targets) == 2, op == "delete" && len(targets) == 1:
+		return op, targets, true
+	}
+	return "", nil, false
+}
+
+// open opens the log file for appending.
+func (w *wal) open() error {
+	f, err := os.OpenFile(w.cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size = f, info.Size()
+	return nil
+}
+
+// append writes a data point of target to the log.
+func (w *wal) append(target string, c Count) {
+	w.log(appendWALLine(nil, target, c))
+}
+
+// log writes a line to the log.
+func (w *wal) log(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return // closed
+	}
+	err := w.write(line)
+	switch {
+	case err != nil && !w.failed:
+		w.logger("grada: cannot write to write-ahead log: %v", err)
+	case err == nil && w.failed:
+		w.logger("grada: writing to write-ahead log again")
+	}
+	w.failed = err != nil
+}
+
+// write writes a line, starting a new segment if the current one is
+// full. The caller must hold w.mu.
+func (w *wal) write(line []byte) error {
+	if w.cfg.CheckpointInterval <= 0 && w.size+int64(len(line)) > w.cfg.SegmentSize && w.size > 0 {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.f.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if w.cfg.Sync {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+// rotate replaces the previous segment by the current one, and starts a
+// new segment. The caller must hold w.mu.
+func (w *wal) rotate() error {
+	cerr := w.f.Close()
+	rerr := os.Rename(w.cfg.Path, w.cfg.Path+".1")
+	if err := w.open(); err != nil {
+		return err
+	}
+	if rerr != nil {
+		return fmt.Errorf("starting a new segment: %w", rerr)
+	}
+	return cerr
+}
+
+// close closes the log file. Data points added later are not logged.
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
@@ -0,0 +1,165 @@
+package grada
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseWALLine(t *testing.T) {
+	t0 := time.Unix(1508929014, 5)
+	tests := []struct {
+		name   string
+		target string
+		c      Count
+	}{
+		{"plain", "cpu", Count{0.5, t0}},
+		{"spaces", `GET /items "all"`, Count{-3, t0}},
+		{"inf", "x", Count{math.Inf(1), t0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := appendWALLine(nil, tt.target, tt.c)
+			target, c, ok := parseWALLine(string(line[:len(line)-1]))
+			if !ok || target != tt.target || c.N != tt.c.N || !c.T.Equal(tt.c.T) {
+				t.Errorf("parseWALLine(%q) = %q, %v, %v", line, target, c, ok)
+			}
+		})
+	}
+	for _, line := range []string{"", "1 2", "x 2 \"a\"", "1 y \"a\"", "1 2 a", `1 2 "a`} {
+		if _, _, ok := parseWALLine(line); ok {
+			t.Errorf("parseWALLine(%q) succeeded", line)
+		}
+	}
+}
+
+func TestParseWALRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      string
+		targets []string
+	}{
+		{"rename", "rename", []string{"cpu", `GET /items "all"`}},
+		{"delete", "delete", []string{"mem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := appendWALRecord(nil, tt.op, tt.targets...)
+			op, targets, ok := parseWALRecord(string(line[:len(line)-1]))
+			if !ok || op != tt.op || !cmp.Equal(targets, tt.targets) {
+				t.Errorf("parseWALRecord(%q) = %q, %q, %v", line, op, targets, ok)
+			}
+		})
+	}
+	for _, line := range []string{"", "rename \"a\"", "delete \"a\" \"b\"", "move \"a\"", `delete "a`, `1 2 "a"`} {
+		if _, _, ok := parseWALRecord(line); ok {
+			t.Errorf("parseWALRecord(%q) succeeded", line)
+		}
+	}
+}
+
+func TestWithWAL_renameDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grada.wal")
+	t0 := time.Unix(1508929014, 0)
+
+	d := NewDashboard(WithWAL(WALConfig{Path: path}))
+	cpu, _ := d.CreateMetricWithBufSize("cpu", 10)
+	mem, _ := d.CreateMetricWithBufSize("mem", 10)
+	cpu.AddCount(Count{1, t0})
+	mem.AddCount(Count{2, t0})
+	if err := d.RenameMetric("cpu", "load"); err != nil {
+		t.Fatalf("RenameMetric(): %v", err)
+	}
+	cpu.AddCount(Count{3, t0.Add(time.Second)})
+	if err := d.DeleteMetric("mem"); err != nil {
+		t.Fatalf("DeleteMetric(): %v", err)
+	}
+	mem.AddCount(Count{4, t0.Add(time.Second)}) // not logged after the deletion
+	d.Shutdown(context.Background())
+
+	d = NewDashboard(WithWAL(WALConfig{Path: path}))
+	defer d.Shutdown(context.Background())
+	var got []float64
+	for _, c := range allCounts(t, d, "load") {
+		got = append(got, c.N)
+	}
+	if diff := cmp.Diff([]float64{1, 3}, got); diff != "" {
+		t.Errorf("load mismatch (-want +got):\n%s", diff)
+	}
+	for _, target := range []string{"cpu", "mem"} {
+		if _, err := d.GetMetric(target); err == nil {
+			t.Errorf("GetMetric(%s) after replay succeeded, want the metric gone", target)
+		}
+	}
+}
+
+func TestWithWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grada.wal")
+	t0 := time.Unix(1508929014, 0)
+
+	d := NewDashboard(WithWAL(WALConfig{Path: path}))
+	m, err := d.CreateMetricWithBufSize("cpu", 10)
+	if err != nil {
+		t.Fatalf("CreateMetricWithBufSize(): %v", err)
+	}
+	m.AddCount(Count{1, t0})
+	d.Add("mem", 2)
+	d.Shutdown(context.Background())
+	d.Add("mem", 3) // not logged after Shutdown
+
+	// Simulate a crash in the middle of writing a line.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("1508929015000000000 4 \"cp")
+	f.Close()
+
+	d = NewDashboard(WithWAL(WALConfig{Path: path}))
+	defer d.Shutdown(context.Background())
+	m, err = d.CreateMetricWithBufSize("cpu", 10) // adopts the replayed data points
+	if err != nil {
+		t.Fatalf("CreateMetricWithBufSize() after replay: %v", err)
+	}
+	m.AddCount(Count{5, t0.Add(time.Second)})
+	want := map[string][]float64{"cpu": {1, 5}, "mem": {2}}
+	for target, values := range want {
+		var got []float64
+		for _, c := range allCounts(t, d, target) {
+			got = append(got, c.N)
+		}
+		if diff := cmp.Diff(values, got); diff != "" {
+			t.Errorf("%s mismatch (-want +got):\n%s", target, diff)
+		}
+	}
+	if got := allCounts(t, d, "cpu"); !got[0].T.Equal(t0) {
+		t.Errorf("replayed time stamp %v, want %v", got[0].T, t0)
+	}
+}
+
+func TestWAL_rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grada.wal")
+	line := appendWALLine(nil, "cpu", Count{1, time.Unix(1, 0)})
+	d := NewDashboard(WithWAL(WALConfig{Path: path, SegmentSize: int64(3 * len(line))}))
+	m, _ := d.CreateMetricWithBufSize("cpu", 10)
+	for i := 1; i <= 8; i++ {
+		m.AddCount(Count{float64(i), time.Unix(int64(i), 0)})
+	}
+	d.Shutdown(context.Background())
+
+	// The segments hold the last 3 and 2 data points; the first 3 are gone.
+	d = NewDashboard(WithWAL(WALConfig{Path: path}))
+	defer d.Shutdown(context.Background())
+	var got []float64
+	for _, c := range allCounts(t, d, "cpu") {
+		got = append(got, c.N)
+	}
+	if diff := cmp.Diff([]float64{4, 5, 6, 7, 8}, got); diff != "" {
+		t.Errorf("replayed values mismatch (-want +got):\n%s", diff)
+	}
+}
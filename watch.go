@@ -0,0 +1,116 @@
+package grada
+
+// Notifications about changes of the metrics registry.
+
+import "fmt"
+
+// MetricEventKind is the kind of change that a MetricEvent reports.
+type MetricEventKind int
+
+const (
+	// MetricCreated reports a new metric, including metrics that the
+	// dashboard creates automatically.
+	MetricCreated MetricEventKind = iota + 1
+	// MetricDeleted reports a deleted metric.
+	MetricDeleted
+	// MetricRenamed reports a metric that has a new target name.
+	MetricRenamed
+)
+
+// String returns the name of the event kind.
+func (k MetricEventKind) String() string {
+	switch k {
+	case MetricCreated:
+		return "created"
+	case MetricDeleted:
+		return "deleted"
+	case MetricRenamed:
+		return "renamed"
+	}
+	return fmt.Sprintf("MetricEventKind(%d)", int(k))
+}
+
+// MetricEvent is a change of the metrics of a dashboard.
+type MetricEvent struct {
+	Kind      MetricEventKind
+	Target    string // the target name; for MetricRenamed, the new name
+	OldTarget string // the previous target name of a renamed metric
+}
+
+// Watch calls fn for every metric that is created, deleted, or renamed
+// from now on, until the returned stop function is called.
+//
+// fn is called synchronously by the goroutine that changes the metrics,
+// after the change has taken effect. It must not block for long, but it
+// may call methods of the dashboard.
+func (d *Dashboard) Watch(fn func(MetricEvent)) (stop func()) {
+	return d.srv.metrics.watch(fn)
+}
+
+// RenameMetric gives the metric for target oldTarget the new target name
+// newTarget. Grafana panels that refer to the old name receive no more data.
+//
+// Renaming fails with ErrMetricNotFound if oldTarget has no metric, and with
+// ErrMetricExists if newTarget has one.
+func (d *Dashboard) RenameMetric(oldTarget, newTarget string) error {
+	return d.srv.metrics.Rename(oldTarget, newTarget)
+}
+
+// watch registers fn as a watcher and returns a function that removes it.
+func (m *metrics) watch(fn func(MetricEvent)) func() {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.watchers == nil {
+		m.watchers = map[int]func(MetricEvent){}
+	}
+	id := m.nextWatcher
+	m.nextWatcher++
+	m.watchers[id] = fn
+	return func() {
+		m.m.Lock()
+		defer m.m.Unlock()
+		delete(m.watchers, id)
+	}
+}
+
+// notify calls all watchers. The caller must not hold m.m.
+func (m *metrics) notify(e MetricEvent) {
+	m.m.Lock()
+	fns := make([]func(MetricEvent), 0, len(m.watchers))
+	for _, fn := range m.watchers {
+		fns = append(fns, fn)
+	}
+	m.m.Unlock()
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+// Rename moves a metric to a new target name.
+func (m *metrics) Rename(oldTarget, newTarget string) error {
+	m.m.Lock()
+	metric, exists := m.metric[oldTarget]
+	if !exists {
+		m.m.Unlock()
+		return fmt.Errorf("cannot rename metric: %w: %s", ErrMetricNotFound, oldTarget)
+	}
+	if _, exists := m.metric[newTarget]; exists {
+		m.m.Unlock()
+		return fmt.Errorf("cannot rename metric: %w: %s", ErrMetricExists, newTarget)
+	}
+	delete(m.metric, oldTarget)
+	m.metric[newTarget] = metric
+	if m.auto[oldTarget] {
+		delete(m.auto, oldTarget)
+		m.auto[newTarget] = true
+	}
+	metric.m.Lock()
+	if metric.wal != nil {
+		metric.wal.log(appendWALRecord(nil, "rename", oldTarget, newTarget))
+	}
+	metric.target = newTarget
+	metric.m.Unlock()
+	m.m.Unlock()
+	m.notify(MetricEvent{Kind: MetricRenamed, Target: newTarget, OldTarget: oldTarget})
+	return nil
+}
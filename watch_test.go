@@ -0,0 +1,54 @@
+package grada
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboard_Watch(t *testing.T) {
+	d := NewDashboard()
+	var got []MetricEvent
+	stop := d.Watch(func(e MetricEvent) {
+		got = append(got, e)
+	})
+
+	d.CreateMetricWithBufSize("a", 1)
+	d.CreateMetricWithBufSize("a", 1) // exists; no event
+	d.RenameMetric("a", "b")
+	d.DeleteMetric("b")
+	d.Add("c", 1)
+	stop()
+	d.DeleteMetric("c")
+
+	want := []MetricEvent{
+		{Kind: MetricCreated, Target: "a"},
+		{Kind: MetricRenamed, Target: "b", OldTarget: "a"},
+		{Kind: MetricDeleted, Target: "b"},
+		{Kind: MetricCreated, Target: "c"},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("events:\ngot  %v\nwant %v", got, want)
+	}
+}
+
+func TestMetrics_Rename(t *testing.T) {
+	m := &metrics{metric: map[string]*Metric{"a": {}, "b": {}}}
+	tests := []struct {
+		name     string
+		old, new string
+		want     error
+	}{
+		{"notFound", "x", "y", ErrMetricNotFound},
+		{"exists", "a", "b", ErrMetricExists},
+		{"ok", "a", "c", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Rename(tt.old, tt.new); !errors.Is(err, tt.want) {
+				t.Errorf("Rename(%q, %q): error %v, want %v", tt.old, tt.new, err, tt.want)
+			}
+		})
+	}
+}